@@ -2,9 +2,41 @@
  * Main compression API
  */
 
-import type { CompressionOptions, CompressionResult } from './types';
+import type { PDFDocument } from 'pdf-lib';
+import type {
+  BatchFile,
+  BatchFileResult,
+  CompressionErrorCode,
+  CompressionOptions,
+  CompressionResult,
+  CompressionStats,
+  CompressionVariant,
+  MobileCompressionOptions,
+  MobileCompressionResult,
+  ScaledPage,
+} from './types';
 import { CompressionError } from './types';
-import { compressPDF } from '../core/pdf-lib-compressor';
+import { decryptDocument } from '../core/encryption';
+import { scalePageToFit } from '../core/pages';
+import { compressPDF, compressVariants } from '../core/pdf-lib-compressor';
+import { loadDocument, saveDocument } from '../core/pdf-objects';
+import { isValidMarkerKey } from '../core/processed-marker';
+import { countDeclaredObjects } from '../core/raw-pdf';
+
+/** Object limit no ordinary document reaches; see maxObjects */
+const DEFAULT_MAX_OBJECTS = 1_000_000;
+
+/** Mobile defaults: phone screens rarely show more than ~100 DPI at fit-to-width */
+const MOBILE_DEFAULTS: Partial<CompressionOptions> = {
+  preset: 'balanced',
+  targetDPI: 96,
+  jpegQuality: 0.6,
+  trimXMP: true,
+  dedupeICCProfiles: true,
+};
+
+/** Long side of A4 in points */
+const MOBILE_MAX_PAGE_SIZE = 842;
 
 /**
  * Compresses a PDF file using the specified preset and options
@@ -41,26 +73,9 @@ export async function compress(
     throw new CompressionError('Empty PDF buffer', 'lossless', 0);
   }
 
-  // Set defaults
-  const fullOptions: CompressionOptions = {
-    preset: options.preset || 'balanced',
-    chunkSize: options.chunkSize,
-    onProgress: options.onProgress,
-    wasmUrl: options.wasmUrl,
-    wasmExecUrl: options.wasmExecUrl,
-    gracefulDegradation: options.gracefulDegradation !== false,
-    preserveMetadata: options.preserveMetadata,
-    targetDPI: options.targetDPI,
-    jpegQuality: options.jpegQuality,
-    enableRasterization: options.enableRasterization,
-    mergeStrategy: options.mergeStrategy || 'worker',
-    timeout: options.timeout || 300000, // 5 minutes
-  };
-
-  // Validate preset
-  if (!['lossless', 'balanced', 'max'].includes(fullOptions.preset)) {
-    throw new TypeError(`Invalid preset: ${fullOptions.preset}. Must be 'lossless', 'balanced', or 'max'.`);
-  }
+  const fullOptions = withDefaults(options);
+  validateOptions(fullOptions);
+  assertObjectCount(pdfBuffer, fullOptions);
 
   // Initialize
   if (fullOptions.onProgress) {
@@ -71,9 +86,12 @@ export async function compress(
     });
   }
 
+  const input = await decryptInput(pdfBuffer, fullOptions);
+
+  let result: CompressionResult;
   try {
     // Compress using pdf-lib
-    return await compressPDF(pdfBuffer, fullOptions);
+    result = await compressPDF(input, afterDecryption(input, pdfBuffer, fullOptions));
   } catch (error) {
     throw new CompressionError(
       'Failed to compress PDF',
@@ -83,6 +101,15 @@ export async function compress(
       error instanceof Error ? error : undefined
     );
   }
+
+  // Report savings against the encrypted input, not the decrypted copy
+  if (input !== pdfBuffer) {
+    result = { ...result, stats: withOriginalSize(result.stats, pdfBuffer.byteLength) };
+  }
+
+  assertPinnedObjects(result, fullOptions, pdfBuffer.byteLength);
+  assertOutputSize(result, fullOptions, pdfBuffer.byteLength);
+  return result;
 }
 
 /**
@@ -126,3 +153,591 @@ export async function compressMax(
 ): Promise<CompressionResult> {
   return compress(pdfBuffer, { ...options, preset: 'max' });
 }
+
+/**
+ * Compresses a PDF with the auto preset
+ * Convenience wrapper around compress()
+ *
+ * The document is classified (scanned, born-digital or mixed) and the
+ * preset, DPI and JPEG quality are picked from that, its size and
+ * options.sizeGoal. The choice is returned in appliedSettings.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Additional compression options (preset will be overridden)
+ *
+ * @example
+ * ```typescript
+ * const result = await compressAuto(file, { sizeGoal: 'smaller' });
+ * const { preset, classification, targetDPI, jpegQuality } = result.appliedSettings;
+ * console.log(`${classification}: ${preset} at ${targetDPI ?? '-'} DPI, quality ${jpegQuality ?? '-'}`);
+ * ```
+ */
+export async function compressAuto(
+  pdfBuffer: ArrayBuffer,
+  options: Omit<Partial<CompressionOptions>, 'preset'> = {}
+): Promise<CompressionResult> {
+  return compress(pdfBuffer, { ...options, preset: 'auto' });
+}
+
+/**
+ * Makes a small-screen, low-bandwidth version of a PDF in one call
+ *
+ * Pages larger than maxPageSize are scaled down first (posters, drawings
+ * and other oversized pages), then the document is compressed with
+ * mobile-tuned defaults: balanced preset, 96 DPI, JPEG quality 0.6, XMP
+ * trimming and ICC profile deduplication. Any compression option
+ * overrides the matching default. Since images are resampled relative to
+ * the page size, scaled pages also get proportionally fewer pixels.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Page size cap and compression overrides
+ * @returns The compressed PDF with stats against the original input, the
+ *   settings applied, and the pages that were scaled
+ *
+ * @example
+ * ```typescript
+ * const result = await compressForMobile(file);
+ * console.log(`Saved ${result.stats.percentageSaved.toFixed(1)}% at ${result.appliedSettings.targetDPI} DPI`);
+ * console.log(`${result.scaledPages.length} oversized pages scaled to ${result.maxPageSize}pt`);
+ * ```
+ */
+export async function compressForMobile(
+  pdfBuffer: ArrayBuffer,
+  options: MobileCompressionOptions = {}
+): Promise<MobileCompressionResult> {
+  if (!(pdfBuffer instanceof ArrayBuffer)) {
+    throw new TypeError('pdfBuffer must be an ArrayBuffer');
+  }
+
+  if (pdfBuffer.byteLength === 0) {
+    throw new CompressionError('Empty PDF buffer', 'lossless', 0);
+  }
+
+  const { maxPageSize = MOBILE_MAX_PAGE_SIZE, ...compressionOptions } = options;
+  if (typeof maxPageSize !== 'number' || !Number.isFinite(maxPageSize) || maxPageSize <= 0) {
+    throw new TypeError(`Invalid maxPageSize: ${maxPageSize}. Must be a positive number of points.`);
+  }
+
+  // Before page scaling parses the file
+  const fullOptions = withDefaults({ ...MOBILE_DEFAULTS, ...compressionOptions });
+  validateOptions(fullOptions);
+  assertObjectCount(pdfBuffer, fullOptions);
+
+  // Skipped files are returned unchanged, without scaling
+  if (isBelowMinInputBytes(pdfBuffer, fullOptions)) {
+    const result = await compress(pdfBuffer, { ...MOBILE_DEFAULTS, ...compressionOptions });
+    return { ...result, maxPageSize, scaledPages: [] };
+  }
+
+  // Page scaling writes new content, which must not land in an encrypted document
+  const decrypted = await decryptInput(pdfBuffer, fullOptions);
+  const pdfDoc = await loadDocument(decrypted);
+  const scaledPages: ScaledPage[] = [];
+  pdfDoc.getPages().forEach((page, index) => {
+    const scale = scalePageToFit(page, maxPageSize);
+    if (scale < 1) scaledPages.push({ page: index + 1, scale });
+  });
+  const input = scaledPages.length > 0 ? await saveDocument(pdfDoc) : decrypted;
+
+  const result = await compress(input, {
+    ...afterDecryption(input, pdfBuffer, { ...MOBILE_DEFAULTS, ...compressionOptions }),
+    password: undefined,
+  });
+
+  // Report savings against what the caller passed in, not the scaled copy
+  return {
+    ...result,
+    stats: withOriginalSize(result.stats, pdfBuffer.byteLength),
+    maxPageSize,
+    scaledPages,
+  };
+}
+
+/**
+ * Produces several compressed variants of one PDF from a single parse
+ *
+ * The document is loaded and structurally optimized once; only the image
+ * pass is repeated per variant, which is much faster than calling
+ * compress() for each.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param variants - Named preset and image settings, one per output
+ * @param options - Options shared by all variants (structural passes, progress)
+ * @returns Results keyed by variant name, each with its stats and appliedSettings
+ *
+ * @example
+ * ```typescript
+ * const outputs = await generateVariants(file, [
+ *   { name: 'web', settings: { preset: 'balanced', targetDPI: 150 } },
+ *   { name: 'print', settings: { preset: 'balanced', targetDPI: 300, jpegQuality: 0.9 } },
+ *   { name: 'email', settings: { preset: 'max', targetDPI: 100 } },
+ * ]);
+ * console.log(outputs.email.stats.compressedSize);
+ * ```
+ */
+export async function generateVariants(
+  pdfBuffer: ArrayBuffer,
+  variants: CompressionVariant[],
+  options: Omit<Partial<CompressionOptions>, 'preset' | 'targetDPI' | 'jpegQuality'> = {}
+): Promise<Record<string, CompressionResult>> {
+  if (!(pdfBuffer instanceof ArrayBuffer)) {
+    throw new TypeError('pdfBuffer must be an ArrayBuffer');
+  }
+
+  if (pdfBuffer.byteLength === 0) {
+    throw new CompressionError('Empty PDF buffer', 'lossless', 0);
+  }
+
+  if (!Array.isArray(variants) || variants.length === 0) {
+    throw new TypeError('variants must be a non-empty array');
+  }
+
+  const sharedOptions = withDefaults(options);
+  validateOptions(sharedOptions);
+  assertObjectCount(pdfBuffer, sharedOptions);
+
+  const names = new Set<string>();
+  const resolved = variants.map(({ name, settings }) => {
+    if (typeof name !== 'string' || name === '' || names.has(name)) {
+      throw new TypeError(`Invalid variant name: ${name}. Names must be unique, non-empty strings.`);
+    }
+    names.add(name);
+
+    const variantOptions = withDefaults({ ...options, ...settings });
+    validateOptions(variantOptions);
+    return { name, options: variantOptions };
+  });
+
+  const input = await decryptInput(pdfBuffer, sharedOptions);
+
+  let results: Record<string, CompressionResult>;
+  try {
+    results = await compressVariants(input, afterDecryption(input, pdfBuffer, sharedOptions), resolved);
+  } catch (error) {
+    throw new CompressionError(
+      'Failed to compress PDF variants',
+      sharedOptions.preset,
+      pdfBuffer.byteLength,
+      'compressing',
+      error instanceof Error ? error : undefined
+    );
+  }
+
+  for (const { name, options: variantOptions } of resolved) {
+    if (input !== pdfBuffer) {
+      results[name] = { ...results[name], stats: withOriginalSize(results[name].stats, pdfBuffer.byteLength) };
+    }
+    assertPinnedObjects(results[name], variantOptions, pdfBuffer.byteLength, name);
+    assertOutputSize(results[name], variantOptions, pdfBuffer.byteLength, name);
+  }
+  return results;
+}
+
+/**
+ * Compresses several PDFs with the same options, each with its own password
+ *
+ * Files are compressed one after another. A file that fails doesn't stop
+ * the batch: its entry holds the CompressionError instead of a result,
+ * with code PASSWORD_INCORRECT when its password is wrong. Files without
+ * a password are opened with an empty one, so an encrypted file that
+ * needs a password fails with PASSWORD_REQUIRED instead of being
+ * compressed as ciphertext. Decrypted files are saved without
+ * encryption. Invalid options throw before any file is compressed.
+ *
+ * @param files - The PDFs, each with an optional password and name
+ * @param options - Compression options for every file
+ * @returns One entry per file, in order
+ *
+ * @example
+ * ```typescript
+ * const results = await compressBatch([
+ *   { name: 'invoice.pdf', pdf: invoice, password: 'inv-2024' },
+ *   { name: 'contract.pdf', pdf: contract, password: 'c0ntract' },
+ *   { name: 'brochure.pdf', pdf: brochure },
+ * ], { preset: 'balanced' });
+ *
+ * for (const { name, result, error } of results) {
+ *   if (error?.code === 'PASSWORD_INCORRECT') console.warn(`${name}: wrong password`);
+ *   else if (result) save(name, result.pdf);
+ * }
+ * ```
+ */
+export async function compressBatch(
+  files: BatchFile[],
+  options: Omit<Partial<CompressionOptions>, 'password'> = {}
+): Promise<BatchFileResult[]> {
+  if (!Array.isArray(files)) {
+    throw new TypeError('files must be an array');
+  }
+
+  validateOptions(withDefaults(options));
+
+  const results: BatchFileResult[] = [];
+  for (const { pdf, password, name } of files) {
+    try {
+      const result = await compress(pdf, { ...options, password: password ?? '' });
+      results.push({ ...(name !== undefined && { name }), result });
+    } catch (error) {
+      // Anything else is a programming error, such as a file that isn't an ArrayBuffer
+      if (!(error instanceof CompressionError)) throw error;
+      results.push({ ...(name !== undefined && { name }), error });
+    }
+  }
+  return results;
+}
+
+/**
+ * Decrypts the input with options.password so every pass reads plain
+ * objects; without a password, for unencrypted input, or for input
+ * minInputBytes skips, returns it as is
+ */
+async function decryptInput(pdfBuffer: ArrayBuffer, options: CompressionOptions): Promise<ArrayBuffer> {
+  if (options.password === undefined) return pdfBuffer;
+  // Skipped files are returned unchanged, so they must not be decrypted
+  if (isBelowMinInputBytes(pdfBuffer, options)) return pdfBuffer;
+
+  const fail = (message: string, error?: unknown, code?: CompressionErrorCode) => new CompressionError(
+    message,
+    options.preset,
+    pdfBuffer.byteLength,
+    'compressing',
+    error instanceof Error ? error : undefined,
+    code
+  );
+
+  let pdfDoc: PDFDocument;
+  try {
+    pdfDoc = await loadDocument(pdfBuffer);
+  } catch (error) {
+    throw fail('Failed to load PDF', error);
+  }
+  if (pdfDoc.context.trailerInfo.Encrypt === undefined) return pdfBuffer;
+
+  let decrypted: boolean;
+  try {
+    decrypted = await decryptDocument(pdfDoc, options.password);
+  } catch (error) {
+    const reason = error instanceof Error ? error.message : String(error);
+    throw fail(`Cannot decrypt PDF: ${reason}`, error, 'UNSUPPORTED_ENCRYPTION');
+  }
+  if (!decrypted && options.password === '') {
+    throw fail('Encrypted PDF needs a password', undefined, 'PASSWORD_REQUIRED');
+  }
+  if (!decrypted) {
+    throw fail('Incorrect password for encrypted PDF', undefined, 'PASSWORD_INCORRECT');
+  }
+  return saveDocument(pdfDoc);
+}
+
+function isBelowMinInputBytes(pdfBuffer: ArrayBuffer, options: CompressionOptions): boolean {
+  return options.minInputBytes !== undefined && pdfBuffer.byteLength < options.minInputBytes;
+}
+
+/**
+ * Options for compressing a decrypted or scaled copy: minInputBytes was
+ * already checked against the caller's file, so the copy's size must not
+ * skip it
+ */
+function afterDecryption<T extends Partial<CompressionOptions>>(
+  input: ArrayBuffer,
+  pdfBuffer: ArrayBuffer,
+  options: T
+): T {
+  return input === pdfBuffer ? options : { ...options, minInputBytes: undefined };
+}
+
+/**
+ * Recomputes stats against the size of what the caller passed in
+ */
+function withOriginalSize(stats: CompressionStats, originalSize: number): CompressionStats {
+  const { compressedSize } = stats;
+  return {
+    ...stats,
+    originalSize,
+    ratio: compressedSize / originalSize,
+    bytesSaved: originalSize - compressedSize,
+    percentageSaved: ((originalSize - compressedSize) / originalSize) * 100,
+  };
+}
+
+/**
+ * Throws OUTPUT_TOO_LARGE if a result exceeds maxOutputBytes
+ */
+function assertOutputSize(
+  result: CompressionResult,
+  options: CompressionOptions,
+  originalSize: number,
+  variantName?: string
+): void {
+  const size = result.stats.compressedSize;
+  if (options.maxOutputBytes === undefined || size <= options.maxOutputBytes) return;
+
+  const subject = variantName === undefined ? 'Compressed PDF' : `Variant "${variantName}"`;
+  throw new CompressionError(
+    `${subject} is ${size} bytes, ${size - options.maxOutputBytes} over maxOutputBytes (${options.maxOutputBytes})`,
+    options.preset,
+    originalSize,
+    'compressing',
+    undefined,
+    'OUTPUT_TOO_LARGE',
+    size
+  );
+}
+
+/**
+ * Throws PINNED_OBJECT_CHANGED if the output doesn't hold a pinned object
+ * byte for byte; pinned objects must never be altered silently
+ */
+function assertPinnedObjects(
+  result: CompressionResult,
+  options: CompressionOptions,
+  originalSize: number,
+  variantName?: string
+): void {
+  const changed = (result.report?.pinnedObjects ?? []).filter(entry => !entry.preserved);
+  if (changed.length === 0) return;
+
+  const subject = variantName === undefined ? 'Compressed PDF' : `Variant "${variantName}"`;
+  throw new CompressionError(
+    `${subject} does not preserve pinned object(s) ${changed.map(entry => entry.object).join(', ')}`,
+    options.preset,
+    originalSize,
+    'compressing',
+    undefined,
+    'PINNED_OBJECT_CHANGED'
+  );
+}
+
+/**
+ * Throws TOO_MANY_OBJECTS if the file declares more than maxObjects
+ * indirect objects; runs before anything is parsed
+ */
+function assertObjectCount(pdfBuffer: ArrayBuffer, options: CompressionOptions): void {
+  if (options.maxObjects === undefined || options.maxObjects === Infinity) return;
+
+  const count = countDeclaredObjects(new Uint8Array(pdfBuffer));
+  if (count <= options.maxObjects) return;
+
+  throw new CompressionError(
+    `PDF declares ${count} objects, more than maxObjects (${options.maxObjects})`,
+    options.preset,
+    pdfBuffer.byteLength,
+    undefined,
+    undefined,
+    'TOO_MANY_OBJECTS'
+  );
+}
+
+/**
+ * Fills in option defaults
+ */
+function withDefaults(options: Partial<CompressionOptions>): CompressionOptions {
+  return {
+    preset: options.preset || 'balanced',
+    chunkSize: options.chunkSize,
+    onProgress: options.onProgress,
+    wasmUrl: options.wasmUrl,
+    wasmExecUrl: options.wasmExecUrl,
+    gracefulDegradation: options.gracefulDegradation !== false,
+    preserveMetadata: options.preserveMetadata,
+    targetDPI: options.targetDPI,
+    jpegQuality: options.jpegQuality,
+    minSSIM: options.minSSIM,
+    jpegRestartInterval: options.jpegRestartInterval,
+    enableRasterization: options.enableRasterization,
+    mergeStrategy: options.mergeStrategy || 'worker',
+    timeout: options.timeout || 300000, // 5 minutes
+    yield: options.yield,
+    pruneEmptyContent: options.pruneEmptyContent,
+    removeEmptyPages: options.removeEmptyPages,
+    removeBlankLayout: options.removeBlankLayout,
+    renderingIntent: options.renderingIntent,
+    optimizeInlineImages: options.optimizeInlineImages,
+    trimXMP: options.trimXMP,
+    xmpSafelist: options.xmpSafelist,
+    dedupePages: options.dedupePages,
+    printAnnotations: options.printAnnotations,
+    printAnnotationSubtypes: options.printAnnotationSubtypes,
+    compressAppearances: options.compressAppearances,
+    posterize: options.posterize,
+    posterizeColors: options.posterizeColors,
+    posterizePhotos: options.posterizePhotos,
+    optimizePNG: options.optimizePNG,
+    cmykToRgb: options.cmykToRgb,
+    cmykConversion: options.cmykConversion,
+    tryMultipleEncodings: options.tryMultipleEncodings,
+    recombineContentStreams: options.recombineContentStreams,
+    stripExternalLinks: options.stripExternalLinks,
+    minInputBytes: options.minInputBytes,
+    maxOutputBytes: options.maxOutputBytes,
+    maxObjects: options.maxObjects ?? DEFAULT_MAX_OBJECTS,
+    removeXFA: options.removeXFA,
+    qualityFloor: options.qualityFloor,
+    protectTextImages: options.protectTextImages,
+    tagProcessed: options.tagProcessed,
+    processedMarkerKey: options.processedMarkerKey,
+    attachTextSidecar: options.attachTextSidecar,
+    textSidecarName: options.textSidecarName,
+    repairImages: options.repairImages,
+    dedupeICCProfiles: options.dedupeICCProfiles,
+    normalizeEncoding: options.normalizeEncoding,
+    maxImagesToProcess: options.maxImagesToProcess,
+    sizeGoal: options.sizeGoal,
+    pinObjects: options.pinObjects,
+    preserveSignedContent: options.preserveSignedContent,
+    preserveInteractive: options.preserveInteractive,
+    changelog: options.changelog,
+    password: options.password,
+  };
+}
+
+/**
+ * Validates option values, throwing TypeError on the first invalid one
+ */
+function validateOptions(options: CompressionOptions): void {
+  // Validate preset
+  if (!['lossless', 'balanced', 'max', 'auto'].includes(options.preset)) {
+    throw new TypeError(`Invalid preset: ${options.preset}. Must be 'lossless', 'balanced', 'max', or 'auto'.`);
+  }
+
+  // Validate image overrides
+  if (options.targetDPI !== undefined && !(options.targetDPI > 0)) {
+    throw new TypeError(`Invalid targetDPI: ${options.targetDPI}. Must be a positive number.`);
+  }
+
+  if (options.jpegQuality !== undefined && !(options.jpegQuality > 0 && options.jpegQuality <= 1)) {
+    throw new TypeError(`Invalid jpegQuality: ${options.jpegQuality}. Must be between 0 (exclusive) and 1.`);
+  }
+
+  if (options.minSSIM !== undefined && !(options.minSSIM > 0 && options.minSSIM <= 1)) {
+    throw new TypeError(`Invalid minSSIM: ${options.minSSIM}. Must be between 0 (exclusive) and 1.`);
+  }
+
+  if (
+    options.jpegRestartInterval !== undefined &&
+    !(Number.isInteger(options.jpegRestartInterval) && options.jpegRestartInterval >= 1 && options.jpegRestartInterval <= 65535)
+  ) {
+    throw new TypeError(`Invalid jpegRestartInterval: ${options.jpegRestartInterval}. Must be an integer from 1 to 65535.`);
+  }
+
+  // Validate size limits
+  if (options.minInputBytes !== undefined && !(options.minInputBytes >= 0)) {
+    throw new TypeError(`Invalid minInputBytes: ${options.minInputBytes}. Must be a non-negative number.`);
+  }
+
+  if (options.maxOutputBytes !== undefined && !(options.maxOutputBytes > 0)) {
+    throw new TypeError(`Invalid maxOutputBytes: ${options.maxOutputBytes}. Must be a positive number.`);
+  }
+
+  if (
+    options.maxObjects !== undefined &&
+    !((Number.isInteger(options.maxObjects) || options.maxObjects === Infinity) && options.maxObjects > 0)
+  ) {
+    throw new TypeError(`Invalid maxObjects: ${options.maxObjects}. Must be a positive integer or Infinity.`);
+  }
+
+  // Validate image limit
+  if (
+    options.maxImagesToProcess !== undefined &&
+    !(Number.isInteger(options.maxImagesToProcess) && options.maxImagesToProcess >= 0)
+  ) {
+    throw new TypeError(`Invalid maxImagesToProcess: ${options.maxImagesToProcess}. Must be a non-negative integer.`);
+  }
+
+  // Validate size goal
+  if (options.sizeGoal !== undefined && !['smaller', 'balanced', 'quality'].includes(options.sizeGoal)) {
+    throw new TypeError(`Invalid sizeGoal: ${options.sizeGoal}. Must be 'smaller', 'balanced', or 'quality'.`);
+  }
+
+  // Validate pinned objects
+  if (options.pinObjects !== undefined) {
+    if (!Array.isArray(options.pinObjects) || !options.pinObjects.every(n => Number.isInteger(n) && n > 0)) {
+      throw new TypeError(`Invalid pinObjects: ${options.pinObjects}. Must be an array of positive object numbers.`);
+    }
+    if (options.pinObjects.length > 0 && (options.preset === 'balanced' || options.preset === 'max')) {
+      throw new TypeError(
+        `Invalid pinObjects with preset '${options.preset}': its image pass rebuilds the document with new object numbers. ` +
+        "Use 'lossless' (or 'auto', which fails if it picks an image pass)."
+      );
+    }
+  }
+
+  // Validate quality floor
+  const floor = options.qualityFloor;
+  if (floor?.minDPI !== undefined && !(floor.minDPI > 0)) {
+    throw new TypeError(`Invalid qualityFloor.minDPI: ${floor.minDPI}. Must be a positive number.`);
+  }
+
+  if (floor?.minJpegQuality !== undefined && !(floor.minJpegQuality > 0 && floor.minJpegQuality <= 1)) {
+    throw new TypeError(`Invalid qualityFloor.minJpegQuality: ${floor.minJpegQuality}. Must be between 0 (exclusive) and 1.`);
+  }
+
+  // Validate marker key
+  if (options.processedMarkerKey !== undefined && !isValidMarkerKey(options.processedMarkerKey)) {
+    throw new TypeError(
+      `Invalid processedMarkerKey: ${options.processedMarkerKey}. ` +
+      'Must start with a letter or underscore and contain only letters, digits, _, . or -.'
+    );
+  }
+
+  // Validate password
+  if (options.password !== undefined && typeof options.password !== 'string') {
+    throw new TypeError(`Invalid password: ${typeof options.password}. Must be a string.`);
+  }
+
+  // Validate sidecar name
+  if (options.textSidecarName !== undefined && (typeof options.textSidecarName !== 'string' || options.textSidecarName.trim() === '')) {
+    throw new TypeError(`Invalid textSidecarName: ${options.textSidecarName}. Must be a non-empty string.`);
+  }
+
+  // Validate rendering intent
+  if (
+    options.renderingIntent !== undefined &&
+    !['Perceptual', 'RelativeColorimetric', 'Saturation', 'AbsoluteColorimetric'].includes(options.renderingIntent)
+  ) {
+    throw new TypeError(
+      `Invalid renderingIntent: ${options.renderingIntent}. ` +
+      `Must be 'Perceptual', 'RelativeColorimetric', 'Saturation', or 'AbsoluteColorimetric'.`
+    );
+  }
+
+  // Validate page dedupe mode
+  if (options.dedupePages !== undefined && !['adjacent', 'all'].includes(options.dedupePages)) {
+    throw new TypeError(`Invalid dedupePages: ${options.dedupePages}. Must be 'adjacent' or 'all'.`);
+  }
+
+  // Validate image repair mode
+  if (options.repairImages !== undefined && !['placeholder', 'drop'].includes(options.repairImages)) {
+    throw new TypeError(`Invalid repairImages: ${options.repairImages}. Must be 'placeholder' or 'drop'.`);
+  }
+
+  // Validate palette size
+  if (
+    options.posterizeColors !== undefined &&
+    !(Number.isInteger(options.posterizeColors) && options.posterizeColors >= 2 && options.posterizeColors <= 256)
+  ) {
+    throw new TypeError(`Invalid posterizeColors: ${options.posterizeColors}. Must be an integer from 2 to 256.`);
+  }
+
+  // Validate CMYK conversion
+  if (options.cmykConversion !== undefined && !['naive', 'swop'].includes(options.cmykConversion)) {
+    throw new TypeError(`Invalid cmykConversion: ${options.cmykConversion}. Must be 'naive' or 'swop'.`);
+  }
+
+  // Validate annotation subtype filter
+  if (
+    options.printAnnotationSubtypes !== undefined &&
+    !(Array.isArray(options.printAnnotationSubtypes) &&
+      options.printAnnotationSubtypes.every(subtype => typeof subtype === 'string'))
+  ) {
+    throw new TypeError('Invalid printAnnotationSubtypes: expected an array of annotation subtype names');
+  }
+
+  // Validate XMP safelist
+  if (
+    options.xmpSafelist !== undefined &&
+    !(Array.isArray(options.xmpSafelist) && options.xmpSafelist.every(uri => typeof uri === 'string'))
+  ) {
+    throw new TypeError('Invalid xmpSafelist: expected an array of namespace URIs');
+  }
+}
@@ -0,0 +1,100 @@
+/**
+ * Document creation API
+ */
+
+import { PDFDocument, PageSizes, StandardFonts } from 'pdf-lib';
+import type { QrCoverOptions, QrCoverResult, QrErrorCorrection } from './types';
+import { QUIET_ZONE, addQrCoverPage } from '../core/cover-sheet';
+import { saveDocument } from '../core/pdf-objects';
+import { encodeQr, qrVersionFor } from '../core/qr';
+
+const ERROR_CORRECTION_LEVELS: QrErrorCorrection[] = ['L', 'M', 'Q', 'H'];
+
+/** Placeholder for the sheet number in payloads and titles */
+const SHEET_NUMBER = /\{n\}/g;
+
+/**
+ * Creates QR-coded cover sheets to print and insert as scan separators
+ *
+ * Each page holds one code, centered, with an optional title above it.
+ * In batch mode (`count` above 1) the payload must contain `{n}`, which
+ * is replaced by the sheet number so each separator is distinct; every
+ * code uses the same QR version, so all sheets print at the same module
+ * size. Titles use Helvetica and are limited to WinAnsi characters.
+ *
+ * To remove scanned separators later with removeMarkedPages(), generate
+ * a single sheet and use a scan of it as the template.
+ *
+ * @param options - Payload, code size, error correction and batch settings
+ * @returns The sheets and the dimensions of the printed code
+ *
+ * @example
+ * ```typescript
+ * const { pdf, moduleSize } = await createQrCoverSheet({
+ *   payload: 'BATCH-2024-{n}',
+ *   title: 'Batch 2024 / document {n}',
+ *   count: 20,
+ * });
+ * console.log(`Modules are ${moduleSize.toFixed(1)} pt wide`);
+ * ```
+ */
+export async function createQrCoverSheet(options: QrCoverOptions): Promise<QrCoverResult> {
+  const size = options.size ?? 216;
+  const errorCorrection = options.errorCorrection ?? 'M';
+  const count = options.count ?? 1;
+  const start = options.start ?? 1;
+  const pageSize = options.pageSize ?? (PageSizes.A4 as [number, number]);
+
+  if (typeof options.payload !== 'string' || options.payload.length === 0) {
+    throw new TypeError(`Invalid payload: ${options.payload}. Must be a non-empty string.`);
+  }
+  if (!ERROR_CORRECTION_LEVELS.includes(errorCorrection)) {
+    throw new TypeError(`Invalid errorCorrection: ${errorCorrection}. Must be one of: ${ERROR_CORRECTION_LEVELS.join(', ')}.`);
+  }
+  if (!Number.isInteger(count) || count < 1) {
+    throw new TypeError(`Invalid count: ${count}. Must be a positive integer.`);
+  }
+  if (!Number.isInteger(start) || start < 0) {
+    throw new TypeError(`Invalid start: ${start}. Must be a non-negative integer.`);
+  }
+  if (count > 1 && !options.payload.includes('{n}')) {
+    throw new TypeError(`Invalid payload: ${options.payload}. Must contain {n} when count is above 1.`);
+  }
+  if (!Array.isArray(pageSize) || pageSize.length !== 2 || !pageSize.every(side => Number.isFinite(side) && side > 0)) {
+    throw new TypeError(`Invalid pageSize: ${pageSize}. Must be [width, height] in points.`);
+  }
+  if (!Number.isFinite(size) || size <= 0 || size > Math.min(...pageSize)) {
+    throw new TypeError(`Invalid size: ${size}. Must be positive and fit on the page.`);
+  }
+
+  const sheets = Array.from({ length: count }, (_, i) => String(start + i));
+  const payloads = sheets.map(n => options.payload.replace(SHEET_NUMBER, n));
+  const encoded = payloads.map(payload => new TextEncoder().encode(payload));
+
+  let version = 1;
+  for (const data of encoded) {
+    const needed = qrVersionFor(data, errorCorrection);
+    if (needed === undefined) {
+      throw new TypeError(`Invalid payload: ${data.length} bytes is too long for error correction level ${errorCorrection}.`);
+    }
+    version = Math.max(version, needed);
+  }
+
+  const pdfDoc = await PDFDocument.create();
+  const font = await pdfDoc.embedFont(StandardFonts.HelveticaBold);
+  let modules = 0;
+  encoded.forEach((data, i) => {
+    const code = encodeQr(data, errorCorrection, version);
+    modules = code.size;
+    addQrCoverPage(pdfDoc, code, size, pageSize, font, options.title?.replace(SHEET_NUMBER, sheets[i]));
+  });
+
+  return {
+    pdf: await saveDocument(pdfDoc),
+    version,
+    modules,
+    size,
+    moduleSize: size / (modules + QUIET_ZONE * 2),
+    payloads,
+  };
+}
@@ -0,0 +1,902 @@
+/**
+ * Document editing API
+ */
+
+import { PDFDict, PDFDocument, StandardFonts } from 'pdf-lib';
+import type {
+  CompressionErrorCode,
+  DocumentPermissions,
+  EncryptBatchFile,
+  EncryptBatchFileResult,
+  EncryptBatchOptions,
+  FlattenAnnotationsOptions,
+  FlattenAnnotationsResult,
+  FormAppearanceOptions,
+  FormAppearanceResult,
+  MarkedPage,
+  OcrPrepareOptions,
+  OcrPrepareResult,
+  OcrPreparedPage,
+  OpenActionOptions,
+  OpenFit,
+  PadToAspectOptions,
+  PrintNormalizeOptions,
+  PrintNormalizeResult,
+  RemoveMarkedPagesOptions,
+  RemoveMarkedPagesResult,
+  SetDatesOptions,
+  SetLanguageResult,
+  TabOrderOptions,
+  TextLayerOptions,
+  TrimTrailingDataResult,
+  TrimSize,
+  UpgradeEncryptionOptions,
+  UpgradeEncryptionResult,
+} from './types';
+import { CompressionError } from './types';
+import { assertPdfBuffer, parseHexColor } from './validate';
+import { removePromptingActions, setOpenDestination } from '../core/actions';
+import { MARKUP_SUBTYPES, flattenAnnotations as flattenPageAnnotations } from '../core/annotations';
+import { decryptDocument, encryptAes256 } from '../core/encryption';
+import { hasAcroForm, regenerateFieldAppearances, setNeedAppearances, setPageTabOrder } from '../core/forms';
+import { differenceHash, hashDistance } from '../core/image-hash';
+import { saveIncremental, snapshotObjects } from '../core/incremental';
+import { addOcrPage } from '../core/ocr-prepare';
+import { readDestinationTargets, rebuildPageTree } from '../core/page-tree';
+import { padPageToAspect } from '../core/pages';
+import { loadDocument, lookupNumber, lookupText, saveDocument } from '../core/pdf-objects';
+import { openPdfjsDocument } from '../core/pdfjs';
+import { normalizePageBoxes, sameTrimSize, uprightPage } from '../core/print-boxes';
+import { findRevisionEnd, toLatin1 } from '../core/raw-pdf';
+import { parseIsoDate, setDocumentDates } from '../core/provenance';
+import type { ZonedDate } from '../core/provenance';
+import { decodeImage, renderPage } from '../core/render';
+import { encodePermissions, readSecurityInfo, recoverUserPassword } from '../core/security';
+import { addInvisibleWords, imageToPageWords } from '../core/text-layer';
+
+/** Rendered size (longer side, px) for marker matching */
+const MARKER_RENDER_SIZE = 128;
+
+/** Loose BCP 47 shape: language subtag, then optional subtags */
+const LANGUAGE_TAG = /^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$/;
+
+const OPEN_FITS: OpenFit[] = ['Fit', 'FitH', 'FitV', 'FitB', 'FitBH', 'FitBV', 'XYZ'];
+
+/**
+ * Pads every page to a consistent aspect ratio (letterboxing)
+ *
+ * Whitespace is added around the content to reach the target ratio;
+ * content is never scaled down. Unlike resizing to a fixed page size,
+ * pages of different sizes keep their own scale.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Target aspect ratio and padding color
+ * @returns The padded PDF
+ *
+ * @example
+ * ```typescript
+ * const slides = await padToAspect(file, { aspect: '16:9', background: '#000000' });
+ * ```
+ */
+export async function padToAspect(
+  pdfBuffer: ArrayBuffer,
+  options: PadToAspectOptions
+): Promise<ArrayBuffer> {
+  assertPdfBuffer(pdfBuffer);
+
+  const aspect = parseAspect(options.aspect);
+  const background = options.background !== undefined
+    ? parseHexColor(options.background, 'background')
+    : undefined;
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const snapshot = options.incremental ? snapshotObjects(pdfDoc, pdfBuffer) : undefined;
+  for (const page of pdfDoc.getPages()) {
+    padPageToAspect(page, aspect, background);
+  }
+
+  return snapshot ? saveIncremental(pdfDoc, pdfBuffer, snapshot) : saveDocument(pdfDoc);
+}
+
+/**
+ * Removes pages that match a marker image, such as printed separator
+ * sheets or "intentionally left blank" pages in a scan batch
+ *
+ * Each page is rendered and compared to the template with a perceptual
+ * hash, so the marker should fill most of the page. Browser only.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Marker template and match tolerance
+ * @returns The cleaned PDF and the pages that were removed
+ *
+ * @example
+ * ```typescript
+ * const separator = await fetch('/separator.png').then(r => r.blob());
+ * const { pdf, removed } = await removeMarkedPages(scan, { template: separator });
+ * console.log(`Removed pages ${removed.map(p => p.page).join(', ')}`);
+ * ```
+ */
+export async function removeMarkedPages(
+  pdfBuffer: ArrayBuffer,
+  options: RemoveMarkedPagesOptions
+): Promise<RemoveMarkedPagesResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  const maxDistance = options.maxDistance ?? 10;
+  if (!Number.isInteger(maxDistance) || maxDistance < 0 || maxDistance > 64) {
+    throw new TypeError(`Invalid maxDistance: ${maxDistance}. Must be an integer from 0 to 64.`);
+  }
+  if (!(options.template instanceof ArrayBuffer) && !(options.template instanceof Blob)) {
+    throw new TypeError('Invalid template: expected an ArrayBuffer or Blob');
+  }
+
+  const templateImage = await decodeImage(options.template);
+  const templateHash = differenceHash(templateImage);
+  templateImage.close();
+
+  const removed: MarkedPage[] = [];
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  try {
+    for (let pageNum = 1; pageNum <= pdfDocument.numPages; pageNum++) {
+      const canvas = await renderPage(pdfDocument, pageNum, MARKER_RENDER_SIZE);
+      const distance = hashDistance(differenceHash(canvas), templateHash);
+      canvas.width = 0;
+      canvas.height = 0;
+
+      if (distance <= maxDistance) {
+        removed.push({ page: pageNum, marker: 'template', distance });
+      }
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  if (removed.length === pdfDoc.getPageCount()) {
+    throw new Error('Every page matches the marker; refusing to remove all pages');
+  }
+
+  for (const { page } of [...removed].reverse()) {
+    pdfDoc.removePage(page - 1);
+  }
+
+  return { pdf: await saveDocument(pdfDoc), removed };
+}
+
+/**
+ * Prepares page boxes for print imposition
+ *
+ * Rotated pages are first turned upright, their rotation baked into the
+ * content (unless normalizeOrientation is false), so N-up and booklet
+ * layouts don't place them sideways. Then every page gets a valid TrimBox
+ * and BleedBox (derived from the CropBox or MediaBox when missing),
+ * malformed boxes are removed or clamped, and pages are moved so the
+ * MediaBox starts at the origin. With trimSize, every TrimBox is set to
+ * that size.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Target trim size, bleed for derived BleedBoxes, and
+ *   whether to bake in page rotation
+ * @returns The normalized PDF with per-page changes, pages that differ from
+ *   the majority trim size, pages that could not be normalized, and pages
+ *   that were turned upright
+ *
+ * @example
+ * ```typescript
+ * const result = await normalizeForPrint(file, {
+ *   trimSize: { width: 595.28, height: 841.89 }, // A4
+ *   bleed: 8.5, // 3 mm
+ * });
+ * result.failedPages.forEach(p => console.warn(`Page ${p.page}: ${p.reason}`));
+ * result.reorientedPages.forEach(p => console.log(`Page ${p.page} was rotated ${p.rotation}°`));
+ * ```
+ */
+export async function normalizeForPrint(
+  pdfBuffer: ArrayBuffer,
+  options: PrintNormalizeOptions = {}
+): Promise<PrintNormalizeResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  const bleed = options.bleed ?? 0;
+  if (!Number.isFinite(bleed) || bleed < 0) {
+    throw new TypeError(`Invalid bleed: ${bleed}. Must be a non-negative number.`);
+  }
+  const { trimSize } = options;
+  if (trimSize !== undefined && !(trimSize.width > 0 && trimSize.height > 0)) {
+    throw new TypeError('Invalid trimSize: width and height must be positive numbers');
+  }
+
+  const normalizeOrientation = options.normalizeOrientation ?? true;
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const result: Omit<PrintNormalizeResult, 'pdf'> = {
+    pages: [],
+    inconsistentPages: [],
+    failedPages: [],
+    reorientedPages: [],
+  };
+  const sizes: Array<{ page: number; size: TrimSize }> = [];
+
+  pdfDoc.getPages().forEach((page, index) => {
+    const rotation = normalizeOrientation ? uprightPage(page) : 0;
+    if (rotation !== 0) result.reorientedPages.push({ page: index + 1, rotation });
+    const { changes, failure, trimSize: size } = normalizePageBoxes(page, bleed, trimSize);
+    if (changes.length > 0) result.pages.push({ page: index + 1, changes });
+    if (failure) result.failedPages.push({ page: index + 1, reason: failure });
+    if (size) sizes.push({ page: index + 1, size });
+  });
+
+  // Majority trim size, grouping sizes within tolerance
+  const groups: Array<{ size: TrimSize; pages: number[] }> = [];
+  for (const { page, size } of sizes) {
+    const group = groups.find(candidate => sameTrimSize(candidate.size, size));
+    if (group) group.pages.push(page);
+    else groups.push({ size, pages: [page] });
+  }
+  const majority = groups.reduce<typeof groups[number] | undefined>(
+    (best, group) => (!best || group.pages.length > best.pages.length ? group : best),
+    undefined
+  );
+  result.inconsistentPages = groups
+    .filter(group => group !== majority)
+    .flatMap(group => group.pages)
+    .sort((a, b) => a - b);
+
+  return { pdf: await saveDocument(pdfDoc), ...result };
+}
+
+/**
+ * Sets the creation and/or modification date, in both the Info dictionary
+ * and the XMP metadata (when present), e.g. to normalize a batch
+ *
+ * Dates are ISO 8601 strings; their UTC offset is kept, and dates without
+ * one are written as UTC. With `incremental`, the original bytes are kept
+ * and only the changed Info and XMP objects are appended.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - The dates to write; at least one is required
+ * @returns The updated PDF
+ *
+ * @example
+ * ```typescript
+ * const pdf = await setDates(file, {
+ *   creationDate: '2024-03-01T09:00:00+01:00',
+ *   modDate: '2024-03-01T09:00:00+01:00',
+ * });
+ * ```
+ */
+export async function setDates(pdfBuffer: ArrayBuffer, options: SetDatesOptions): Promise<ArrayBuffer> {
+  assertPdfBuffer(pdfBuffer);
+
+  if (options.creationDate === undefined && options.modDate === undefined) {
+    throw new TypeError('setDates requires creationDate, modDate, or both');
+  }
+  const creationDate = parseDateOption(options.creationDate, 'creationDate');
+  const modDate = parseDateOption(options.modDate, 'modDate');
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const snapshot = options.incremental ? snapshotObjects(pdfDoc, pdfBuffer) : undefined;
+  setDocumentDates(pdfDoc, creationDate, modDate);
+  return snapshot ? saveIncremental(pdfDoc, pdfBuffer, snapshot) : saveDocument(pdfDoc);
+}
+
+/**
+ * Removes actions that fire when the document or a page opens and could
+ * prompt or take over the viewer: JavaScript, Launch, print and other
+ * named actions, and full-screen mode
+ *
+ * Navigation (GoTo actions, open destinations, page-turning named actions)
+ * is kept, so a file that opens on its first page still does.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns The cleaned PDF
+ *
+ * @example
+ * ```typescript
+ * const pdf = await removeOpenActionPrompts(file);
+ * ```
+ */
+export async function removeOpenActionPrompts(pdfBuffer: ArrayBuffer): Promise<ArrayBuffer> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  removePromptingActions(pdfDoc);
+  return saveDocument(pdfDoc);
+}
+
+/**
+ * Sets the page and zoom the document opens at
+ *
+ * Writes a destination as the /OpenAction, which every viewer honors,
+ * rather than a JavaScript action. Any existing open action is replaced.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Page, fit mode and XYZ zoom or position
+ * @returns The PDF with its open action set
+ *
+ * @example
+ * ```typescript
+ * // Open a presentation on slide 3, whole slide visible
+ * const pdf = await setOpenAction(file, { page: 3, fit: 'Fit' });
+ * // Open at 150% at the top of the first page
+ * const zoomed = await setOpenAction(file, { fit: 'XYZ', zoom: 1.5 });
+ * ```
+ */
+export async function setOpenAction(pdfBuffer: ArrayBuffer, options: OpenActionOptions = {}): Promise<ArrayBuffer> {
+  assertPdfBuffer(pdfBuffer);
+
+  const fit = options.fit ?? 'Fit';
+  if (!OPEN_FITS.includes(fit)) {
+    throw new TypeError(`Invalid fit: ${fit}. Must be one of: ${OPEN_FITS.join(', ')}.`);
+  }
+  if (options.zoom !== undefined) {
+    if (fit !== 'XYZ') throw new TypeError(`Invalid zoom: ${options.zoom}. Only applies to fit 'XYZ'.`);
+    if (!Number.isFinite(options.zoom) || options.zoom <= 0) {
+      throw new TypeError(`Invalid zoom: ${options.zoom}. Must be a positive number.`);
+    }
+  }
+  if (options.top !== undefined) {
+    if (!['XYZ', 'FitH', 'FitBH'].includes(fit)) {
+      throw new TypeError(`Invalid top: ${options.top}. Only applies to fit 'XYZ', 'FitH' or 'FitBH'.`);
+    }
+    if (!Number.isFinite(options.top)) throw new TypeError(`Invalid top: ${options.top}. Must be a number.`);
+  }
+  if (options.left !== undefined) {
+    if (!['XYZ', 'FitV', 'FitBV'].includes(fit)) {
+      throw new TypeError(`Invalid left: ${options.left}. Only applies to fit 'XYZ', 'FitV' or 'FitBV'.`);
+    }
+    if (!Number.isFinite(options.left)) throw new TypeError(`Invalid left: ${options.left}. Must be a number.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const page = options.page ?? 1;
+  const pageCount = pdfDoc.getPageCount();
+  if (!Number.isInteger(page) || page < 1 || page > pageCount) {
+    throw new TypeError(`Invalid page: ${page}. Must be between 1 and ${pageCount}.`);
+  }
+
+  setOpenDestination(pdfDoc, page - 1, fit, options);
+  return saveDocument(pdfDoc);
+}
+
+/**
+ * Draws annotations into the page content and removes them, producing a
+ * "frozen" document whose markup can't be edited or hidden
+ *
+ * Each annotation is drawn from its own appearance stream, so it looks
+ * exactly as before. Hidden annotations are kept, and annotations without
+ * an appearance can't be drawn and are skipped. Separate from form
+ * flattening: widgets are only included if listed in `subtypes`.
+ * With compressAppearances, the drawn appearance streams are re-deflated
+ * where that makes them smaller.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Subtypes to flatten, and whether to recompress their appearances
+ * @returns The flattened PDF with flattened and skipped counts (and
+ *   appearance bytes saved, with compressAppearances)
+ *
+ * @example
+ * ```typescript
+ * const { pdf, flattened } = await flattenAnnotations(file, { subtypes: ['Highlight', 'Ink'] });
+ * ```
+ */
+export async function flattenAnnotations(
+  pdfBuffer: ArrayBuffer,
+  options: FlattenAnnotationsOptions = {}
+): Promise<FlattenAnnotationsResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  const subtypes = options.subtypes ?? MARKUP_SUBTYPES;
+  if (!Array.isArray(subtypes) || !subtypes.every(subtype => typeof subtype === 'string')) {
+    throw new TypeError('Invalid subtypes: expected an array of annotation subtype names');
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const report = flattenPageAnnotations(pdfDoc, new Set(subtypes), options.compressAppearances === true);
+  return { pdf: await saveDocument(pdfDoc), ...report };
+}
+
+/**
+ * Brings form field appearances in line with field values, e.g. after a
+ * form was filled client-side and shows blank or stale fields
+ *
+ * By default every field's appearance is rebuilt (signature fields
+ * excepted). With regenerateAppearances: false, appearances are kept and
+ * viewers are asked to rebuild them instead. XFA data is removed when
+ * rebuilding, since it would override the rebuilt AcroForm.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Whether to rebuild or defer to the viewer
+ * @returns The updated PDF and which fields were rebuilt
+ *
+ * @example
+ * ```typescript
+ * const { pdf, failed } = await updateFormAppearances(filled);
+ * failed.forEach(f => console.warn(`${f.field}: ${f.reason}`));
+ * ```
+ */
+export async function updateFormAppearances(
+  pdfBuffer: ArrayBuffer,
+  options: FormAppearanceOptions = {}
+): Promise<FormAppearanceResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  if (!hasAcroForm(pdfDoc)) {
+    return { pdf: pdfBuffer.slice(0), regenerated: [], failed: [], needAppearances: false };
+  }
+
+  if (options.regenerateAppearances === false) {
+    setNeedAppearances(pdfDoc);
+    return { pdf: await saveDocument(pdfDoc), regenerated: [], failed: [], needAppearances: true };
+  }
+
+  const { regenerated, failed } = await regenerateFieldAppearances(pdfDoc);
+  return { pdf: await saveDocument(pdfDoc), regenerated, failed, needAppearances: false };
+}
+
+/**
+ * Rebuilds the page tree as one flat list with the pages numbered in
+ * order, e.g. after many reorder and remove operations
+ *
+ * Page content and order are unchanged. Links, bookmarks and named
+ * destinations are updated to the new page objects, and the output is
+ * checked to resolve every one of them to the same page as before.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns The PDF with a rebuilt page tree
+ * @throws If a link or bookmark would point somewhere else afterwards
+ *
+ * @example
+ * ```typescript
+ * const tidy = await renumberPages(reordered);
+ * ```
+ */
+export async function renumberPages(pdfBuffer: ArrayBuffer): Promise<ArrayBuffer> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const before = readDestinationTargets(pdfDoc);
+  rebuildPageTree(pdfDoc);
+  const pdf = await saveDocument(pdfDoc);
+
+  const after = readDestinationTargets(await loadDocument(pdf));
+  if (after.length !== before.length || after.some((page, i) => page !== before[i])) {
+    throw new Error('Rebuilding the page tree changed where links or bookmarks point');
+  }
+  return pdf;
+}
+
+/**
+ * Sets the keyboard tab order of form fields, page by page
+ *
+ * Each listed page's annotations are rewritten with its fields first, in
+ * the given order, and the page's /Tabs is set to A (annotation order).
+ * Fields not listed, and other annotations, follow in their original
+ * order. Pages not listed are unchanged.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Field names in tab order for each page
+ * @returns The updated PDF
+ * @throws TypeError if a page doesn't exist or a field has no widget on
+ *   its page
+ *
+ * @example
+ * ```typescript
+ * const accessible = await setTabOrder(form, {
+ *   order: { 1: ['firstName', 'lastName', 'email'], 2: ['consent', 'submit'] },
+ * });
+ * ```
+ */
+export async function setTabOrder(pdfBuffer: ArrayBuffer, options: TabOrderOptions): Promise<ArrayBuffer> {
+  assertPdfBuffer(pdfBuffer);
+
+  if (typeof options.order !== 'object' || options.order === null) {
+    throw new TypeError(`Invalid order: ${options.order}. Must map page numbers to arrays of field names.`);
+  }
+
+  const entries = Object.entries(options.order);
+  for (const [page, names] of entries) {
+    if (!Array.isArray(names) || !names.every(name => typeof name === 'string')) {
+      throw new TypeError(`Invalid order for page ${page}: ${names}. Must be an array of field names.`);
+    }
+    const duplicate = names.find((name, i) => names.indexOf(name) !== i);
+    if (duplicate !== undefined) {
+      throw new TypeError(`Invalid order for page ${page}: field '${duplicate}' is listed twice.`);
+    }
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const pageCount = pdfDoc.getPageCount();
+
+  for (const [key, names] of entries) {
+    const page = Number(key);
+    if (!Number.isInteger(page) || page < 1 || page > pageCount) {
+      throw new TypeError(`Invalid page: ${key}. Must be between 1 and ${pageCount}.`);
+    }
+    const missing = setPageTabOrder(pdfDoc, pdfDoc.getPage(page - 1), names);
+    if (missing.length > 0) {
+      const list = missing.map(name => `'${name}'`).join(', ');
+      throw new TypeError(`Invalid order for page ${page}: no field named ${list} on that page.`);
+    }
+  }
+
+  return saveDocument(pdfDoc);
+}
+
+/**
+ * Sets the document's natural language (the catalog /Lang entry)
+ *
+ * Tags are checked loosely against the BCP 47 shape (a 2-8 letter
+ * language subtag, then hyphen-separated subtags of up to 8 letters or
+ * digits), not against the subtag registry.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param language - Language tag, such as 'en-US' or 'de'
+ * @returns The updated PDF and the language it replaced (null if none)
+ *
+ * @example
+ * ```typescript
+ * const { pdf, previous } = await setLanguage(scan, 'en-US');
+ * console.log(`Language: ${previous ?? 'unset'} -> en-US`);
+ * ```
+ */
+export async function setLanguage(pdfBuffer: ArrayBuffer, language: string): Promise<SetLanguageResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  if (typeof language !== 'string' || !LANGUAGE_TAG.test(language)) {
+    throw new TypeError(`Invalid language: ${language}. Must be a BCP 47 language tag such as 'en-US'.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const previous = lookupText(pdfDoc.catalog, 'Lang') ?? null;
+  pdfDoc.setLanguage(language);
+
+  return { pdf: await saveDocument(pdfDoc), previous };
+}
+
+/**
+ * Rebuilds a document as one image per page, ready for an OCR engine
+ *
+ * Every page is rendered at the same DPI, upright, in grayscale by
+ * default, and stored losslessly so glyph edges carry no JPEG artifacts.
+ * Page sizes are kept, so OCR coordinates map back to the original.
+ * Pages are not deskewed: no skew detector is bundled. Browser only.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Resolution and color
+ * @returns The image-only PDF and the size and DPI of each page image
+ *
+ * @example
+ * ```typescript
+ * const { pdf, pages } = await prepareForOcr(scan, { dpi: 300 });
+ * const text = await ocrEngine.recognize(new Blob([pdf], { type: 'application/pdf' }));
+ * ```
+ */
+export async function prepareForOcr(pdfBuffer: ArrayBuffer, options: OcrPrepareOptions = {}): Promise<OcrPrepareResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  const dpi = options.dpi ?? 300;
+  if (!Number.isFinite(dpi) || dpi < 72 || dpi > 600) {
+    throw new TypeError(`Invalid dpi: ${dpi}. Must be between 72 and 600.`);
+  }
+  const grayscale = options.grayscale !== false;
+
+  const prepared = await PDFDocument.create();
+  const pages: OcrPreparedPage[] = [];
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  try {
+    for (let pageNum = 1; pageNum <= pdfDocument.numPages; pageNum++) {
+      pages.push(await addOcrPage(prepared, pdfDocument, pageNum, dpi, grayscale));
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+
+  return { pdf: await saveDocument(prepared), pages };
+}
+
+/**
+ * Makes scanned pages searchable by adding OCR results as invisible text
+ *
+ * Each word is drawn in text render mode 3 over its box, sized and
+ * squeezed to fit, so search hits and selections line up with the
+ * scanned glyphs. Boxes can come straight from hOCR by giving the size of
+ * the image OCR ran on. Words use Helvetica, so characters outside
+ * WinAnsi are stored as '?'.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Recognized words per page
+ * @returns The searchable PDF
+ *
+ * @example
+ * ```typescript
+ * const words = hocrWords.map(w => ({ text: w.text, x: w.x0, y: w.y0, width: w.x1 - w.x0, height: w.y1 - w.y0 }));
+ * const searchable = await addTextLayer(scan, {
+ *   layers: [{ page: 1, words, imageWidth: 2480, imageHeight: 3508 }],
+ * });
+ * ```
+ */
+export async function addTextLayer(pdfBuffer: ArrayBuffer, options: TextLayerOptions): Promise<ArrayBuffer> {
+  assertPdfBuffer(pdfBuffer);
+
+  if (!options || !Array.isArray(options.layers)) {
+    throw new TypeError('layers must be an array of pages with words');
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const pageCount = pdfDoc.getPageCount();
+  for (const layer of options.layers) {
+    if (!Number.isInteger(layer.page) || layer.page < 1 || layer.page > pageCount) {
+      throw new TypeError(`Invalid page: ${layer.page}. Must be between 1 and ${pageCount}.`);
+    }
+    if (!Array.isArray(layer.words) || !layer.words.every(isWordBox)) {
+      throw new TypeError(`Invalid words for page ${layer.page}: each needs text, x, y, width and height.`);
+    }
+    const { imageWidth, imageHeight } = layer;
+    if ((imageWidth !== undefined || imageHeight !== undefined) &&
+      !(Number.isFinite(imageWidth) && Number.isFinite(imageHeight) && (imageWidth ?? 0) > 0 && (imageHeight ?? 0) > 0)) {
+      throw new TypeError(`Invalid image size for page ${layer.page}: imageWidth and imageHeight must both be positive.`);
+    }
+  }
+
+  const font = await pdfDoc.embedFont(StandardFonts.Helvetica);
+  for (const layer of options.layers) {
+    const page = pdfDoc.getPage(layer.page - 1);
+    const words = layer.imageWidth && layer.imageHeight
+      ? imageToPageWords(page, layer.words, layer.imageWidth, layer.imageHeight)
+      : layer.words;
+    addInvisibleWords(page, font, words);
+  }
+
+  return saveDocument(pdfDoc);
+}
+
+function isWordBox(word: unknown): boolean {
+  if (!word || typeof word !== 'object') return false;
+  const { text, x, y, width, height } = word as Record<string, unknown>;
+  return typeof text === 'string' && [x, y, width, height].every(Number.isFinite);
+}
+
+function parseAspect(aspect: number | string): number {
+  let ratio = NaN;
+  if (typeof aspect === 'number') {
+    ratio = aspect;
+  } else {
+    const match = /^\s*(\d+(?:\.\d+)?)\s*:\s*(\d+(?:\.\d+)?)\s*$/.exec(aspect);
+    if (match) ratio = parseFloat(match[1]) / parseFloat(match[2]);
+  }
+
+  if (!Number.isFinite(ratio) || ratio <= 0) {
+    throw new TypeError(`Invalid aspect: ${aspect}. Must be a positive number or a ratio like '16:9'.`);
+  }
+  return ratio;
+}
+
+function parseDateOption(value: string | undefined, name: string): ZonedDate | undefined {
+  if (value === undefined) return undefined;
+  const date = typeof value === 'string' ? parseIsoDate(value) : undefined;
+  if (!date) {
+    throw new TypeError(`Invalid ${name}: ${value}. Must be an ISO 8601 date such as '2024-03-01' or '2024-03-01T09:00:00Z'.`);
+  }
+  return date;
+}
+
+/**
+ * Removes junk appended after the file's last %%EOF
+ *
+ * Some scanners and upload handlers pad files or append stray bytes;
+ * lenient viewers skip them, strict parsers don't. The file is cut
+ * after the %%EOF of its last revision (one whose startxref points at a
+ * cross-reference section), so incremental updates are kept, and never
+ * inside a signed byte range. Nothing else changes: the file is not
+ * re-saved.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns The trimmed file and how many bytes were removed
+ * @throws TypeError if no valid %%EOF is found
+ *
+ * @example
+ * ```typescript
+ * const { pdf, bytesRemoved } = await trimTrailingData(scan);
+ * if (bytesRemoved > 0) console.log(`Removed ${bytesRemoved} bytes of trailing data`);
+ * ```
+ */
+export async function trimTrailingData(pdfBuffer: ArrayBuffer): Promise<TrimTrailingDataResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  const end = findRevisionEnd(toLatin1(pdfBuffer));
+  if (end === undefined) {
+    throw new TypeError('Invalid pdfBuffer: no %%EOF marker follows a valid startxref.');
+  }
+
+  const bytesRemoved = pdfBuffer.byteLength - end;
+  return { pdf: bytesRemoved > 0 ? pdfBuffer.slice(0, end) : pdfBuffer, bytesRemoved };
+}
+
+/**
+ * Re-encrypts an RC4 or AES-128 document with AES-256, keeping its
+ * passwords and permissions
+ *
+ * Up to AES-128 (revisions 2 to 4), the user password is stored
+ * encrypted under the owner password, so the owner password alone
+ * recovers both; it is checked before anything changes. The document is
+ * then decrypted and encrypted again with a new key (revision 6, read by
+ * Acrobat X and later and current browsers) and saved without object
+ * streams. Documents already using AES-256 are returned unchanged.
+ * The older algorithms only use a password's first 32 characters, so a
+ * longer user password is kept as those 32.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - The owner password
+ * @returns The upgraded file, the algorithm it had and whether it changed
+ * @throws TypeError if the document isn't encrypted
+ * @throws CompressionError with code PASSWORD_INCORRECT if the password
+ *   isn't its owner password, or UNSUPPORTED_ENCRYPTION if its handler
+ *   or revision can't be upgraded
+ *
+ * @example
+ * ```typescript
+ * const { pdf, previousAlgorithm, upgraded } = await upgradeEncryption(file, { ownerPassword: 'archive-owner' });
+ * if (upgraded) console.log(`Upgraded from ${previousAlgorithm} to AES-256`);
+ * ```
+ */
+export async function upgradeEncryption(
+  pdfBuffer: ArrayBuffer,
+  options: UpgradeEncryptionOptions
+): Promise<UpgradeEncryptionResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  if (typeof options?.ownerPassword !== 'string') {
+    throw new TypeError(`Invalid ownerPassword: ${typeof options?.ownerPassword}. Must be a string.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const security = await readSecurityInfo(pdfDoc);
+  if (!security.encrypted) {
+    throw new TypeError('Invalid pdfBuffer: the document is not encrypted.');
+  }
+  const previousAlgorithm = security.algorithm ?? 'unknown';
+  if (previousAlgorithm === 'AES-256') {
+    return { pdf: pdfBuffer, previousAlgorithm, upgraded: false };
+  }
+
+  const fail = (message: string, error?: unknown, code?: CompressionErrorCode) => new CompressionError(
+    message,
+    'lossless',
+    pdfBuffer.byteLength,
+    undefined,
+    error instanceof Error ? error : undefined,
+    code
+  );
+
+  const encrypt = pdfDoc.context.lookup(pdfDoc.context.trailerInfo.Encrypt, PDFDict);
+  let userPassword: string | undefined;
+  try {
+    userPassword = recoverUserPassword(pdfDoc, encrypt, options.ownerPassword);
+  } catch (error) {
+    const reason = error instanceof Error ? error.message : String(error);
+    throw fail(`Cannot upgrade encryption: ${reason}`, error, 'UNSUPPORTED_ENCRYPTION');
+  }
+  if (userPassword === undefined) {
+    throw fail('Incorrect owner password for encrypted PDF', undefined, 'PASSWORD_INCORRECT');
+  }
+  // Read before decryption removes the dictionary
+  const permissions = lookupNumber(encrypt, 'P') ?? 0;
+
+  await decryptDocument(pdfDoc, options.ownerPassword);
+  await encryptAes256(pdfDoc, {
+    userPassword,
+    ownerPassword: options.ownerPassword,
+    permissions,
+    encryptMetadata: security.encryptMetadata ?? true,
+  });
+
+  // Objects are encrypted one by one, so none may go into an object stream
+  const bytes = await pdfDoc.save({ useObjectStreams: false, addDefaultPage: false });
+  return { pdf: bytes.buffer as ArrayBuffer, previousAlgorithm, upgraded: true };
+}
+
+/**
+ * Encrypts several PDFs with one policy: the same passwords, permissions
+ * and key length for every file
+ *
+ * Files are encrypted one after another with AES-256 (revision 6) and
+ * saved without object streams. A file that fails doesn't stop the
+ * batch: its entry holds the CompressionError instead of a file, with
+ * code ALREADY_ENCRYPTED for input that is encrypted already. Invalid
+ * options throw before any file is encrypted.
+ *
+ * @param files - The PDFs, each with an optional name
+ * @param options - The encryption policy
+ * @returns One entry per file, in order
+ *
+ * @example
+ * ```typescript
+ * const results = await encryptBatch(exports, {
+ *   ownerPassword: 'dms-owner',
+ *   permissions: { modify: false, copy: false },
+ * });
+ * for (const { name, pdf, error } of results) {
+ *   if (error?.code === 'ALREADY_ENCRYPTED') console.warn(`${name}: already encrypted`);
+ *   else if (pdf) store(name, pdf);
+ * }
+ * ```
+ */
+export async function encryptBatch(
+  files: EncryptBatchFile[],
+  options: EncryptBatchOptions
+): Promise<EncryptBatchFileResult[]> {
+  if (!Array.isArray(files)) {
+    throw new TypeError('files must be an array');
+  }
+
+  const { userPassword = '', ownerPassword, keyLength = 256, encryptMetadata = true } = options ?? {};
+  if (typeof userPassword !== 'string') {
+    throw new TypeError(`Invalid userPassword: ${typeof userPassword}. Must be a string.`);
+  }
+  if (typeof ownerPassword !== 'string' || ownerPassword === '') {
+    throw new TypeError('Invalid ownerPassword: must be a non-empty string.');
+  }
+  if (keyLength !== 256) {
+    throw new TypeError(`Invalid keyLength: ${keyLength}. Only 256 (AES-256) is supported.`);
+  }
+  const permissions = readPermissionPolicy(options.permissions ?? {});
+
+  const results: EncryptBatchFileResult[] = [];
+  for (const { pdf, name } of files) {
+    if (!(pdf instanceof ArrayBuffer)) {
+      throw new TypeError('pdf must be an ArrayBuffer');
+    }
+    const entry = { ...(name !== undefined && { name }) };
+    const fail = (message: string, error?: unknown, code?: CompressionErrorCode) => new CompressionError(
+      message,
+      'lossless',
+      pdf.byteLength,
+      undefined,
+      error instanceof Error ? error : undefined,
+      code
+    );
+
+    try {
+      const pdfDoc = await loadDocument(pdf);
+      if (pdfDoc.isEncrypted || pdfDoc.context.trailerInfo.Encrypt) {
+        results.push({ ...entry, error: fail('The PDF is already encrypted', undefined, 'ALREADY_ENCRYPTED') });
+        continue;
+      }
+      await encryptAes256(pdfDoc, { userPassword, ownerPassword, permissions, encryptMetadata });
+      // Objects are encrypted one by one, so none may go into an object stream
+      const bytes = await pdfDoc.save({ useObjectStreams: false, addDefaultPage: false });
+      results.push({ ...entry, pdf: bytes.buffer as ArrayBuffer });
+    } catch (error) {
+      results.push({ ...entry, error: fail('Failed to encrypt PDF', error) });
+    }
+  }
+  return results;
+}
+
+/**
+ * Validates a permission policy and encodes it as P; omitted permissions are allowed
+ */
+function readPermissionPolicy(policy: Partial<DocumentPermissions>): number {
+  const permissions: DocumentPermissions = {
+    print: true,
+    modify: true,
+    copy: true,
+    annotate: true,
+    fillForms: true,
+    extractForAccessibility: true,
+    assemble: true,
+    printHighQuality: true,
+  };
+  for (const [key, value] of Object.entries(policy)) {
+    if (!(key in permissions)) {
+      throw new TypeError(`Invalid permission: ${key}. Must be one of ${Object.keys(permissions).join(', ')}.`);
+    }
+    if (typeof value !== 'boolean') {
+      throw new TypeError(`Invalid permissions.${key}: ${value}. Must be true or false.`);
+    }
+    permissions[key as keyof DocumentPermissions] = value;
+  }
+  return encodePermissions(permissions);
+}
@@ -4,16 +4,246 @@
  */
 
 // Main API
-export { compress, compressLossless, compressBalanced, compressMax } from './compress';
+export { compress, compressLossless, compressBalanced, compressMax, compressAuto, compressForMobile, compressBatch, generateVariants } from './compress';
+
+// Inspection
+export {
+  checkBoxes,
+  checkCompatibility,
+  checkPrepress,
+  checkSignatureCoverage,
+  describePermissions,
+  detectBlankPages,
+  detectDuplicateText,
+  extractText,
+  extractWords,
+  findDuplicatePages,
+  getAnnotationStats,
+  getBookmarks,
+  getContentOperators,
+  getCreationInfo,
+  getFirstImage,
+  getImageHistogram,
+  getImageSequence,
+  getLanguage,
+  getLinks,
+  getPageAsSvg,
+  getPageCount,
+  getPageImageSummary,
+  getProducerChain,
+  getSecurityInfo,
+  getSignatures,
+  getStatistics,
+  getStructTree,
+  getTextStats,
+  getTrailer,
+  validateImages,
+  wasProcessed,
+} from './inspect';
+
+// Editing
+export {
+  addTextLayer,
+  encryptBatch,
+  flattenAnnotations,
+  normalizeForPrint,
+  padToAspect,
+  prepareForOcr,
+  removeMarkedPages,
+  removeOpenActionPrompts,
+  renumberPages,
+  setDates,
+  setLanguage,
+  setOpenAction,
+  setTabOrder,
+  trimTrailingData,
+  updateFormAppearances,
+  upgradeEncryption,
+} from './edit';
+
+// Merging
+export { merge, mergePdfA, mergeWithSeparators } from './merge';
+
+// Creation
+export { createQrCoverSheet } from './create';
 
 // Types
 export type {
-  CompressionPreset,
+  AnnotationFlattenReport,
+  AnnotationStats,
+  AppliedSettings,
+  BatchFile,
+  BatchFileResult,
+  BlankPageDecision,
+  BlankPageMethod,
+  BlankPageOptions,
+  BlankPageReport,
+  Bookmark,
+  BookmarkOutline,
+  BoxIssue,
+  BrokenImage,
+  ChangelogEntry,
+  ChangelogOperation,
+  CmykConversion,
+  CmykConversionReport,
+  CmykConvertedImage,
+  CompatibilityIssue,
+  CompatibilityReport,
+  CompatibilityTarget,
+  CompressionErrorCode,
   CompressionOptions,
+  CompressionPreset,
+  CompressionPresetOption,
+  CompressionReport,
   CompressionResult,
   CompressionStats,
+  CompressionVariant,
+  ContentDict,
+  ContentOperand,
+  ContentOperator,
+  ContentOperatorsOptions,
+  ContentRecombineReport,
+  ContentString,
+  CreationInfo,
+  CreationInfoDiscrepancy,
+  DescribePermissionsOptions,
+  DestinationCollision,
+  DividerStyle,
+  DocumentClassification,
+  DocumentPermissions,
+  DocumentStatistics,
+  DuplicatePageGroup,
+  DuplicatePageMode,
+  DuplicateTextCluster,
+  DuplicateTextOccurrence,
+  DuplicateTextOptions,
+  EncryptBatchFile,
+  EncryptBatchFileResult,
+  EncryptBatchOptions,
+  EncryptionAlgorithm,
+  ExternalLink,
+  ExternalLinkSource,
+  ExtractTextOptions,
+  ExtractWordsOptions,
+  FeatureCount,
+  FindDuplicatePagesOptions,
+  FlattenAnnotationsOptions,
+  FlattenAnnotationsResult,
+  FontEncodingReport,
+  FormAppearanceFailure,
+  FormAppearanceOptions,
+  FormAppearanceResult,
+  IccDedupeReport,
+  ImageEncoding,
+  ImageHistogram,
+  ImageHistogramKind,
+  ImageHistogramOptions,
+  ImageLimitReport,
+  ImageRepairMode,
+  ImageRepairReport,
+  ImageSequenceOptions,
+  ImageSequencePage,
+  ImageValidation,
+  InlineImageReport,
+  InteractiveFeatureReport,
+  LargeObject,
+  MarkedPage,
+  MergeInput,
+  MergeLayer,
+  MergeOptions,
+  MergePageSource,
+  MergeResult,
+  MergeSortOrder,
+  MergeSourceStart,
+  MobileCompressionOptions,
+  MobileCompressionResult,
+  NormalizedFont,
+  OcrPrepareOptions,
+  OcrPrepareResult,
+  OcrPreparedPage,
+  OpenActionOptions,
+  OpenFit,
+  OptimizedPngImage,
+  PadToAspectOptions,
+  PageAnnotationStats,
+  PageBoxChange,
+  PageBoxName,
+  PageContentOperators,
+  PageCountResult,
+  PageDedupeMode,
+  PageDedupeReport,
+  PageImageEncoding,
+  PageImageSummary,
+  PageSvgOptions,
+  PageText,
+  PageWords,
+  PdfAIssue,
+  PdfAIssueCode,
+  PdfAMergeOptions,
+  PdfAMergeResult,
+  PdfFeature,
+  PinnedObjectReport,
+  PngOptimizeReport,
+  PosterizeReport,
+  PosterizedImage,
+  PrepressConcern,
+  PrepressIssue,
+  PrepressPage,
+  PrepressReport,
+  PreviewImage,
+  PrintNormalizeOptions,
+  PrintNormalizeResult,
+  ProcessedMarker,
+  ProducerChain,
+  ProducerHistoryEntry,
   ProgressEvent,
   ProgressPhase,
+  PruneReport,
+  QrCoverOptions,
+  QrCoverResult,
+  QrErrorCorrection,
+  QualityFloor,
+  RemoveMarkedPagesOptions,
+  RemoveMarkedPagesResult,
+  RenderingIntent,
+  RestartMarkerReport,
+  ScaledPage,
+  SecurityInfo,
+  SeparatorMergeOptions,
+  SeparatorMergeResult,
+  SetDatesOptions,
+  SetLanguageResult,
+  SignatureCoverage,
+  SignatureCoverageReport,
+  SignatureCoverageStatus,
+  SignatureInfo,
+  SignedContentReport,
+  SizeGoal,
+  SkippedFont,
+  SkippedImage,
+  SsimPageQuality,
+  SsimQualityReport,
+  StatisticsOptions,
+  StructElement,
+  StructTreeReport,
+  SvgFallback,
+  TabOrderOptions,
+  TextExtraction,
+  TextImageReport,
+  TextLayerOptions,
+  TextLayerPage,
+  TextLayoutMode,
+  TextSidecarReport,
+  TextStats,
+  TrailerInfo,
+  TrimSize,
+  TrimTrailingDataResult,
+  UpgradeEncryptionOptions,
+  UpgradeEncryptionResult,
+  VariantSettings,
+  WordBox,
+  XfaRemovalReport,
+  XmpCreationInfo,
 } from './types';
 
 export { CompressionError } from './types';
@@ -0,0 +1,1136 @@
+/**
+ * Read-only document inspection API
+ */
+
+import type {
+  AnnotationStats,
+  BlankPageDecision,
+  BlankPageOptions,
+  BlankPageReport,
+  BookmarkOutline,
+  BoxIssue,
+  CompatibilityReport,
+  CompatibilityTarget,
+  ContentOperatorsOptions,
+  CreationInfo,
+  DescribePermissionsOptions,
+  DocumentStatistics,
+  DuplicatePageGroup,
+  DuplicateTextCluster,
+  DuplicateTextOptions,
+  ExternalLink,
+  ExtractTextOptions,
+  ExtractWordsOptions,
+  FindDuplicatePagesOptions,
+  ImageHistogram,
+  ImageHistogramOptions,
+  ImageSequenceOptions,
+  ImageSequencePage,
+  ImageValidation,
+  PageContentOperators,
+  PageCountResult,
+  PageImageSummary,
+  PageSvgOptions,
+  PageText,
+  PageWords,
+  PrepressReport,
+  PreviewImage,
+  ProcessedMarker,
+  ProducerChain,
+  SecurityInfo,
+  SignatureCoverageReport,
+  SignatureInfo,
+  StatisticsOptions,
+  StructTreeReport,
+  TextStats,
+  TextExtraction,
+  TrailerInfo,
+} from './types';
+import { assertPdfBuffer } from './validate';
+import { countAnnotations } from '../core/annotations';
+import { BLANK_RENDER_SIZE, MAX_BLANK_IMAGE_COVERAGE, MAX_BLANK_INK, inkShare, pageImageCoverage } from '../core/blank-pages';
+import { checkPageBoxes } from '../core/boxes';
+import { checkFeatureCompatibility, detectFeatures } from '../core/compatibility';
+import { parsePageContent } from '../core/content-stream';
+import { groupIdenticalPages } from '../core/dedupe-pages';
+import { findDuplicateBlocks } from '../core/duplicate-text';
+import type { PageTextBlock } from '../core/duplicate-text';
+import { differenceHash, hashDistance } from '../core/image-hash';
+import type { ImageHash } from '../core/image-hash';
+import { imageLuminanceStats } from '../core/image-histogram';
+import { readPageImage } from '../core/image-sequence';
+import { collectPageImages, validateImages as validatePageImages } from '../core/image-validation';
+import { findExternalLinks } from '../core/links';
+import { readOutline } from '../core/outline';
+import { analyzePage } from '../core/page-analysis';
+import { loadDocument, lookupText } from '../core/pdf-objects';
+import { readCreationInfo, readProducerChain } from '../core/provenance';
+import { openPdfjsDocument } from '../core/pdfjs';
+import { assessPrepress } from '../core/prepress';
+import { findPreviewImage } from '../core/preview-image';
+import { DEFAULT_MARKER_KEY, isValidMarkerKey, readMarker } from '../core/processed-marker';
+import { readPageTreeCount, toLatin1 } from '../core/raw-pdf';
+import { renderPage } from '../core/render';
+import { describePermissionList, readSecurityInfo } from '../core/security';
+import { checkSignatureCoverage as checkByteRanges, readSignatures } from '../core/signatures';
+import { findLargestObjects, readPageImageSummaries, readStatistics } from '../core/statistics';
+import { readStructTree } from '../core/structure';
+import { convertPageToSvg, rasterPageToSvg, readSvgText } from '../core/svg';
+import { getPageTextItems, groupTextBlocks, groupTextLines, groupWords } from '../core/text';
+import { formatPageText } from '../core/text-layout';
+import { readTrailer } from '../core/trailer';
+
+/** Render size for perceptual page hashes; the hash itself is 9x8 */
+const HASH_RENDER_SIZE = 128;
+
+/** Share of the page an image must cover for getImageSequence() to use it */
+const DEFAULT_SEQUENCE_COVERAGE = 0.9;
+
+/** Resolution of the page image getPageAsSvg() falls back to */
+const RASTER_FALLBACK_DPI = 150;
+
+const SVG_FALLBACKS = ['raster', 'omit'];
+
+/**
+ * Lists the signed signature fields of a PDF
+ *
+ * Signatures are read from their signature dictionaries only; nothing is
+ * verified. Pass `byteRange` to a separate verifier to check the crypto.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Signature details, or an empty array for unsigned documents
+ *
+ * @example
+ * ```typescript
+ * const signatures = await getSignatures(file);
+ * for (const sig of signatures) {
+ *   console.log(`${sig.name} signed by ${sig.signerName ?? 'unknown'}`);
+ * }
+ * ```
+ */
+export async function getSignatures(pdfBuffer: ArrayBuffer): Promise<SignatureInfo[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return readSignatures(pdfDoc);
+}
+
+/**
+ * Checks that each signature's byte range covers what it should
+ *
+ * A sound range starts at the beginning of the file and leaves out only
+ * the signature value. Bytes after the most recent signed range mean
+ * the file was changed by an incremental update after signing. This is
+ * a structural tamper check; nothing is verified cryptographically.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Per-signature coverage and whether the file changed after
+ *   the last signature
+ *
+ * @example
+ * ```typescript
+ * const { signatures, modifiedAfterSigning } = await checkSignatureCoverage(file);
+ * if (modifiedAfterSigning || signatures.some(s => s.status === 'invalid')) {
+ *   rejectUpload();
+ * }
+ * ```
+ */
+export async function checkSignatureCoverage(pdfBuffer: ArrayBuffer): Promise<SignatureCoverageReport> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return checkByteRanges(new Uint8Array(pdfBuffer), readSignatures(pdfDoc));
+}
+
+/**
+ * Reads the document outline (bookmarks) as a nested tree
+ *
+ * Each bookmark's destination is resolved to a concrete page number,
+ * following GoTo actions and named destinations.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns The outline, with hasOutline false and no bookmarks if there is none
+ */
+export async function getBookmarks(pdfBuffer: ArrayBuffer): Promise<BookmarkOutline> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return readOutline(pdfDoc);
+}
+
+/**
+ * Finds paragraphs that repeat across the document (boilerplate, clauses)
+ *
+ * Text is extracted per page and split into blocks by line spacing; blocks
+ * are clustered by word-shingle similarity.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Minimum block length and similarity threshold
+ * @returns Clusters of repeated blocks, or an empty array if nothing repeats
+ */
+export async function detectDuplicateText(
+  pdfBuffer: ArrayBuffer,
+  options: DuplicateTextOptions = {}
+): Promise<DuplicateTextCluster[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const minBlockLength = options.minBlockLength ?? 80;
+  const minSimilarity = options.minSimilarity ?? 0.9;
+  if (minSimilarity <= 0 || minSimilarity > 1) {
+    throw new TypeError(`Invalid minSimilarity: ${minSimilarity}. Must be between 0 (exclusive) and 1.`);
+  }
+
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  const blocks: PageTextBlock[] = [];
+
+  try {
+    for (let pageNum = 1; pageNum <= pdfDocument.numPages; pageNum++) {
+      const lines = groupTextLines(await getPageTextItems(pdfDocument, pageNum));
+      for (const text of groupTextBlocks(lines)) {
+        blocks.push({ page: pageNum, text });
+      }
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+
+  return findDuplicateBlocks(blocks, minBlockLength, minSimilarity);
+}
+
+/**
+ * Checks whether a document uses features that may not work on a target
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param target - Viewing context: 'browser', 'print', 'pdfa2' or 'mobile'
+ * @returns Detected features and per-feature notes with remediation hints
+ *
+ * @example
+ * ```typescript
+ * const report = await checkCompatibility(file, 'mobile');
+ * if (!report.compatible) {
+ *   report.issues.forEach(issue => console.warn(issue.note));
+ * }
+ * ```
+ */
+export async function checkCompatibility(
+  pdfBuffer: ArrayBuffer,
+  target: CompatibilityTarget
+): Promise<CompatibilityReport> {
+  assertPdfBuffer(pdfBuffer);
+
+  if (!['browser', 'print', 'pdfa2', 'mobile'].includes(target)) {
+    throw new TypeError(`Invalid target: ${target}. Must be 'browser', 'print', 'pdfa2', or 'mobile'.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const features = detectFeatures(pdfDoc, pdfBuffer);
+  const issues = checkFeatureCompatibility(features, target);
+
+  return {
+    target,
+    compatible: issues.length === 0,
+    features: [...features],
+    issues,
+  };
+}
+
+/**
+ * Checks a document for what print shops reject or query: overprint,
+ * spot colors, heavy ink and RGB images in a CMYK job
+ *
+ * Documents that use only RGB and gray color aren't treated as errors:
+ * they're reported as not print-targeted. Ink coverage is estimated from
+ * the CMYK colors set in page content, not from rendered separations.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Per-page findings, the concerns with their pages, and an overall verdict
+ *
+ * @example
+ * ```typescript
+ * const report = await checkPrepress(file);
+ * if (!report.printReady) {
+ *   report.concerns.forEach(c => console.warn(`${c.message} (pages ${c.pages.join(', ') || 'all'})`));
+ * }
+ * ```
+ */
+export async function checkPrepress(pdfBuffer: ArrayBuffer): Promise<PrepressReport> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return assessPrepress(pdfDoc);
+}
+
+/**
+ * Summarizes who made the file and when, from both Info and XMP
+ *
+ * Values are reconciled between the Info dictionary and the XMP packet;
+ * fields set in both with different values are listed in discrepancies,
+ * which is useful for authenticity checks.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Producer, creator, dates and trapping with any disagreements
+ */
+export async function getCreationInfo(pdfBuffer: ArrayBuffer): Promise<CreationInfo> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return readCreationInfo(pdfDoc);
+}
+
+/**
+ * Lists the software that created and modified a document
+ *
+ * Gives the Info /Producer and /Creator, their XMP counterparts, and the
+ * XMP edit history (xmpMM:History) as written by tools that keep one,
+ * such as Adobe applications. Documents without XMP history return just
+ * the producer and creator.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Producer and creator strings, and history events oldest first
+ *
+ * @example
+ * ```typescript
+ * const chain = await getProducerChain(file);
+ * for (const event of chain.history) {
+ *   console.log(`${event.when?.toISOString() ?? '?'} ${event.action} by ${event.software ?? 'unknown'}`);
+ * }
+ * console.log(`Last written by ${chain.producer ?? 'unknown'}`);
+ * ```
+ */
+export async function getProducerChain(pdfBuffer: ArrayBuffer): Promise<ProducerChain> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return readProducerChain(pdfDoc);
+}
+
+/**
+ * Reads the tagged structure tree for accessibility auditing
+ *
+ * Untagged documents return tagged: false with an empty tree rather than
+ * an error; untaggedContentCount is reported either way.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Simplified structure tree with alt text coverage
+ */
+export async function getStructTree(pdfBuffer: ArrayBuffer): Promise<StructTreeReport> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return readStructTree(pdfDoc);
+}
+
+/**
+ * Reads the document's natural language (the catalog /Lang entry)
+ *
+ * Screen readers use it to pick a voice and pronunciation; PDF/UA
+ * requires it. OCR output and scans usually have none.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns A language tag such as 'en-US', or null when none is set
+ *
+ * @example
+ * ```typescript
+ * if ((await getLanguage(scan)) === null) {
+ *   scan = (await setLanguage(scan, 'en-US')).pdf;
+ * }
+ * ```
+ */
+export async function getLanguage(pdfBuffer: ArrayBuffer): Promise<string | null> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return lookupText(pdfDoc.catalog, 'Lang') ?? null;
+}
+
+/**
+ * Lists the content stream operators of one page, decoded and tokenized
+ *
+ * Operands are returned as values (numbers, '/Name' strings, string and
+ * dictionary objects, arrays); inline image data is reported by size only.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Page to inspect and an optional operator cap
+ * @returns The page's operators in drawing order
+ *
+ * @example
+ * ```typescript
+ * const { operators, truncated } = await getContentOperators(file, { page: 1, maxOperators: 500 });
+ * const fonts = operators.filter(op => op.operator === 'Tf').map(op => op.operands[0]);
+ * ```
+ */
+export async function getContentOperators(
+  pdfBuffer: ArrayBuffer,
+  options: ContentOperatorsOptions
+): Promise<PageContentOperators> {
+  assertPdfBuffer(pdfBuffer);
+
+  const maxOperators = options.maxOperators ?? 10000;
+  if (!Number.isInteger(maxOperators) || maxOperators < 1) {
+    throw new TypeError(`Invalid maxOperators: ${maxOperators}. Must be a positive integer.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const pageCount = pdfDoc.getPageCount();
+  if (!Number.isInteger(options.page) || options.page < 1 || options.page > pageCount) {
+    throw new TypeError(`Invalid page: ${options.page}. Must be between 1 and ${pageCount}.`);
+  }
+
+  const operations = parsePageContent(pdfDoc.getPage(options.page - 1));
+
+  return {
+    page: options.page,
+    totalOperators: operations.length,
+    truncated: operations.length > maxOperators,
+    operators: operations.slice(0, maxOperators).map(({ operator, operands, inlineImageData }) => ({
+      operator,
+      operands,
+      ...(inlineImageData && { inlineImageBytes: inlineImageData.length }),
+    })),
+  };
+}
+
+/**
+ * Converts a page to SVG markup
+ *
+ * Paths, clipping, colors, line styles, form XObjects, images and axial or
+ * radial shadings become SVG elements; text is set as real `<text>` in a
+ * generic font family, stretched to the original widths. Constructs that
+ * content parsing can't handle (mesh shadings, tiling patterns, soft
+ * masks, inline and JPEG 2000/JBIG2/CCITT images) are listed in a comment
+ * at the top of the markup. With the default raster fallback such a page
+ * is embedded as a rendered image instead, under transparent selectable
+ * text; rendering needs a browser.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Page to convert and fallback behavior
+ * @returns SVG markup sized to the page's crop box in points, rotation
+ *   applied
+ *
+ * @example
+ * ```typescript
+ * const svg = await getPageAsSvg(file, { page: 1, fallback: 'omit' });
+ * container.innerHTML = svg;
+ * ```
+ */
+export async function getPageAsSvg(pdfBuffer: ArrayBuffer, options: PageSvgOptions): Promise<string> {
+  assertPdfBuffer(pdfBuffer);
+
+  const fallback = options.fallback ?? 'raster';
+  if (!SVG_FALLBACKS.includes(fallback)) {
+    throw new TypeError(`Invalid fallback: ${fallback}. Must be one of: ${SVG_FALLBACKS.join(', ')}.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const pageCount = pdfDoc.getPageCount();
+  if (!Number.isInteger(options.page) || options.page < 1 || options.page > pageCount) {
+    throw new TypeError(`Invalid page: ${options.page}. Must be between 1 and ${pageCount}.`);
+  }
+
+  const page = pdfDoc.getPage(options.page - 1);
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+
+  try {
+    const text = await readSvgText(pdfDocument, options.page);
+    const { svg, unsupported } = convertPageToSvg(page, text);
+    if (unsupported.length === 0 || fallback === 'omit' || typeof document === 'undefined') {
+      return svg;
+    }
+
+    const { width, height } = page.getSize();
+    const size = (Math.max(width, height) / 72) * RASTER_FALLBACK_DPI;
+    const canvas = await renderPage(pdfDocument, options.page, size);
+    return rasterPageToSvg(page, canvas.toDataURL('image/png'), text, unsupported);
+  } finally {
+    await pdfDocument.destroy();
+  }
+}
+
+/**
+ * Flags images that may fail or change when re-encoded
+ *
+ * Each image used on each page is listed with its color space, filters
+ * and issues: codecs compression passes through (JPEG 2000, JBIG2,
+ * CCITT), CMYK JPEGs (especially with an inverted Decode array), unknown
+ * filters or color spaces, invalid dimensions and corrupt or truncated
+ * data. Nothing is changed; use the repairImages compression option to
+ * fix damaged images.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Every image, in page order (images used on several pages are
+ *   listed on each)
+ *
+ * @example
+ * ```typescript
+ * const images = await validateImages(file);
+ * for (const image of images.filter(i => i.issues.length > 0)) {
+ *   console.warn(`Page ${image.page}, image ${image.index}: ${image.issues.join('; ')}`);
+ * }
+ * ```
+ */
+export async function validateImages(pdfBuffer: ArrayBuffer): Promise<ImageValidation[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return validatePageImages(pdfDoc);
+}
+
+/**
+ * Checks page boxes for common prepress problems
+ *
+ * Flags boxes that are malformed, have zero area, extend beyond the box
+ * that should contain them, or are missing where a printer expects them.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Problems found, in page order (empty if the boxes are consistent)
+ *
+ * @example
+ * ```typescript
+ * const issues = await checkBoxes(file);
+ * issues.forEach(issue => console.warn(`Page ${issue.page}: ${issue.message}`));
+ * ```
+ */
+export async function checkBoxes(pdfBuffer: ArrayBuffer): Promise<BoxIssue[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return checkPageBoxes(pdfDoc);
+}
+
+/**
+ * Summarizes size, pages and content in one call (for overview panels)
+ *
+ * With topObjects, also lists the largest objects with their type and
+ * the pages using them, which shows where a heavy file's weight is (a
+ * single oversized image often dominates).
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Number of largest objects to list
+ * @returns Counts and flags gathered from a single parse
+ *
+ * @example
+ * ```typescript
+ * const stats = await getStatistics(file, { topObjects: 5 });
+ * for (const item of stats.largestObjects ?? []) {
+ *   console.log(`${item.object} ${item.type}: ${item.bytes} bytes, pages ${item.pages.join(', ')}`);
+ * }
+ * ```
+ */
+export async function getStatistics(
+  pdfBuffer: ArrayBuffer,
+  options: StatisticsOptions = {}
+): Promise<DocumentStatistics> {
+  assertPdfBuffer(pdfBuffer);
+
+  const { topObjects = 0 } = options;
+  if (!Number.isInteger(topObjects) || topObjects < 0) {
+    throw new TypeError(`Invalid topObjects: ${topObjects}. Must be a non-negative integer.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const statistics = readStatistics(pdfDoc, pdfBuffer);
+  if (topObjects > 0) statistics.largestObjects = findLargestObjects(pdfDoc, topObjects, pdfBuffer.byteLength);
+  return statistics;
+}
+
+/**
+ * Summarizes each page's images: how many, their stored size, and the
+ * highest resolution they're drawn at
+ *
+ * Pages with many image bytes drawn well above the DPI a preset renders
+ * at gain the most from balanced or max compression, so this suits a
+ * preview before compressing.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns One entry per page, in page order
+ *
+ * @example
+ * ```typescript
+ * const pages = await getPageImageSummary(file);
+ * const heavy = pages.filter(p => (p.maxEffectiveDPI ?? 0) > 200).sort((a, b) => b.totalImageBytes - a.totalImageBytes);
+ * console.log(`Biggest win: page ${heavy[0]?.page}`);
+ * ```
+ */
+export async function getPageImageSummary(pdfBuffer: ArrayBuffer): Promise<PageImageSummary[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return readPageImageSummaries(pdfDoc);
+}
+
+/**
+ * Reports how a document is encrypted, without needing its password
+ *
+ * For the standard security handler this also tells whether a password is
+ * needed to open the file or only an owner password restricts it. Other
+ * handlers (e.g. certificate security) are described as far as possible
+ * and flagged in warnings. The algorithm is the one used for streams, so
+ * RC4 marks files worth re-encrypting with AES.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Encryption settings, with encrypted false for unencrypted files
+ *
+ * @example
+ * ```typescript
+ * const security = await getSecurityInfo(file);
+ * if (security.userPasswordRequired) {
+ *   promptForPassword();
+ * }
+ * if (security.algorithm === 'RC4') {
+ *   console.warn(`Weak ${security.keyLength}-bit RC4 (V ${security.version}, R ${security.revision})`);
+ * }
+ * ```
+ */
+export async function getSecurityInfo(pdfBuffer: ArrayBuffer): Promise<SecurityInfo> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return readSecurityInfo(pdfDoc);
+}
+
+/**
+ * Summarizes what a document's permissions allow, as lines ready to show
+ * to users
+ *
+ * Each line names one permission and whether it's allowed, e.g.
+ * 'Printing: allowed (high resolution)' or 'Content copying: denied'.
+ * Unencrypted documents give ['No restrictions']. Permissions are
+ * enforced by viewers, not by the encryption, so treat them as the
+ * author's intent.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Whether to list only the restrictions
+ * @returns Display lines
+ *
+ * @example
+ * ```typescript
+ * const lines = await describePermissions(file, { restrictionsOnly: true });
+ * showList(lines); // ['Printing: allowed (low resolution only)', 'Content copying: denied']
+ * ```
+ */
+export async function describePermissions(
+  pdfBuffer: ArrayBuffer,
+  options: DescribePermissionsOptions = {}
+): Promise<string[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return describePermissionList(await readSecurityInfo(pdfDoc), options.restrictionsOnly);
+}
+
+/**
+ * Lists every external link (URI action) for review before distribution
+ *
+ * Covers link annotations, other annotation and page actions, bookmarks,
+ * and document-level actions. To remove them, compress with
+ * stripExternalLinks.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns The links in document order, or an empty array if there are none
+ *
+ * @example
+ * ```typescript
+ * const links = await getLinks(file);
+ * links.forEach(link => console.log(`${link.page ?? '-'}: ${link.url}`));
+ * ```
+ */
+export async function getLinks(pdfBuffer: ArrayBuffer): Promise<ExternalLink[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return findExternalLinks(pdfDoc);
+}
+
+/**
+ * Returns the largest image on the first page that has images, as a cheap
+ * thumbnail for scanned documents (no rendering)
+ *
+ * Small images (icons, logos under 32 px) and images whose data can't be
+ * extracted without a full decoder (JBIG2, CCITT) are skipped.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns The image, or null if there is none (fall back to rendering)
+ *
+ * @example
+ * ```typescript
+ * const image = await getFirstImage(file);
+ * if (image?.format === 'jpeg') {
+ *   thumbnail.src = URL.createObjectURL(new Blob([image.data], { type: 'image/jpeg' }));
+ * }
+ * ```
+ */
+export async function getFirstImage(pdfBuffer: ArrayBuffer): Promise<PreviewImage | null> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return findPreviewImage(pdfDoc);
+}
+
+/**
+ * Reads an image's luminance histogram and basic statistics, to choose
+ * how aggressively (and with which codec) to compress it
+ *
+ * Images are numbered as in validateImages(). JPEGs are decoded with the
+ * browser's decoder; JPEG 2000, JBIG2, CCITT, predictor-encoded data and
+ * Lab or DeviceN images can't be analyzed. Nothing is modified.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Page and position of the image
+ * @returns The histogram, mean, standard deviation and color count
+ * @throws If the image's data or color space can't be decoded
+ *
+ * @example
+ * ```typescript
+ * const stats = await getImageHistogram(file, { page: 1, index: 0 });
+ * if (stats.kind === 'bilevel') {
+ *   console.log('Scan of black and white text: CCITT will beat JPEG');
+ * }
+ * ```
+ */
+export async function getImageHistogram(pdfBuffer: ArrayBuffer, options: ImageHistogramOptions): Promise<ImageHistogram> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const pageCount = pdfDoc.getPageCount();
+  if (!Number.isInteger(options.page) || options.page < 1 || options.page > pageCount) {
+    throw new TypeError(`Invalid page: ${options.page}. Must be between 1 and ${pageCount}.`);
+  }
+
+  const images = collectPageImages(pdfDoc.getPage(options.page - 1));
+  if (!Number.isInteger(options.index) || options.index < 0 || options.index >= images.length) {
+    throw new TypeError(`Invalid index: ${options.index}. Page ${options.page} has ${images.length} image(s).`);
+  }
+
+  const stream = images[options.index];
+  const ref = pdfDoc.context.enumerateIndirectObjects().find(([, object]) => object === stream)?.[0];
+  const stats = await imageLuminanceStats(stream).catch((error: unknown) => {
+    const reason = error instanceof Error ? error.message : 'unknown error';
+    throw new Error(`Image ${options.index} on page ${options.page} can't be analyzed: ${reason}`);
+  });
+
+  return {
+    page: options.page,
+    index: options.index,
+    object: ref?.toString() ?? null,
+    ...stats,
+  };
+}
+
+/**
+ * Returns one image per page, in page order, for showing a scanned
+ * document in a continuous-scroll image viewer without a PDF renderer
+ *
+ * A page that consists of a single image (a scan, optionally with an
+ * invisible OCR layer) yields that image: JPEG and JPEG 2000 data as
+ * stored, gray, RGB and indexed samples converted to PNG. Any other page
+ * (text, vector drawing, several images, a rotated placement, or an image
+ * encoding browsers can't display) is flagged with requiresRendering.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Coverage a page's image needs to stand in for the page
+ * @returns An entry for every page
+ *
+ * @example
+ * ```typescript
+ * for (const entry of await getImageSequence(file)) {
+ *   if (entry.requiresRendering) {
+ *     viewer.appendSvg(await getPageAsSvg(file, { page: entry.page }));
+ *   } else {
+ *     viewer.appendImage(new Blob([entry.data!], { type: entry.mimeType }), entry.rotation);
+ *   }
+ * }
+ * ```
+ */
+export async function getImageSequence(
+  pdfBuffer: ArrayBuffer,
+  options: ImageSequenceOptions = {}
+): Promise<ImageSequencePage[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const { minCoverage = DEFAULT_SEQUENCE_COVERAGE } = options;
+  if (typeof minCoverage !== 'number' || !(minCoverage > 0 && minCoverage <= 1)) {
+    throw new TypeError(`Invalid minCoverage: ${minCoverage}. Must be between 0 (exclusive) and 1.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return pdfDoc.getPages().map((page, index) => readPageImage(pdfDoc.context, page, index, minCoverage));
+}
+
+/**
+ * Checks for the marker written by the tagProcessed compression option
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param key - Marker key, if a custom processedMarkerKey was used
+ * @returns The marker (library version and time), or null if the file
+ * wasn't tagged
+ *
+ * @example
+ * ```typescript
+ * if (await wasProcessed(file)) {
+ *   return file; // already compressed by this pipeline
+ * }
+ * ```
+ */
+export async function wasProcessed(
+  pdfBuffer: ArrayBuffer,
+  key: string = DEFAULT_MARKER_KEY
+): Promise<ProcessedMarker | null> {
+  assertPdfBuffer(pdfBuffer);
+
+  if (!isValidMarkerKey(key)) {
+    throw new TypeError(`Invalid key: ${key}. Must start with a letter or underscore and contain only letters, digits, _, . or -.`);
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return readMarker(pdfDoc, key);
+}
+
+/**
+ * Finds groups of pages with the same content, such as a cover sheet that
+ * repeats after merging many sources
+ *
+ * Nothing is removed; pair with the dedupePages compression option (or
+ * your own page selection) to drop the repeats. Exact mode compares page
+ * content and resources. Near mode renders each page and compares
+ * perceptual hashes, so it also matches pages that were re-generated or
+ * rescanned; it only works in the browser.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Comparison mode and near-mode tolerance
+ * @returns Groups of two or more pages, or an empty array if nothing repeats
+ *
+ * @example
+ * ```typescript
+ * const groups = await findDuplicatePages(merged, { mode: 'near' });
+ * groups.forEach(g => console.log(`Pages ${g.pages.join(', ')} look the same`));
+ * ```
+ */
+export async function findDuplicatePages(
+  pdfBuffer: ArrayBuffer,
+  options: FindDuplicatePagesOptions = {}
+): Promise<DuplicatePageGroup[]> {
+  assertPdfBuffer(pdfBuffer);
+
+  const mode = options.mode ?? 'exact';
+  if (mode !== 'exact' && mode !== 'near') {
+    throw new TypeError(`Invalid mode: ${mode}. Must be 'exact' or 'near'.`);
+  }
+  const maxDistance = options.maxDistance ?? 4;
+  if (!Number.isInteger(maxDistance) || maxDistance < 0 || maxDistance > 64) {
+    throw new TypeError(`Invalid maxDistance: ${maxDistance}. Must be an integer from 0 to 64.`);
+  }
+
+  if (mode === 'exact') {
+    const pdfDoc = await loadDocument(pdfBuffer);
+    return groupIdenticalPages(pdfDoc).map(pages => ({ pages, distance: 0 }));
+  }
+
+  const hashes: ImageHash[] = [];
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  try {
+    for (let pageNum = 1; pageNum <= pdfDocument.numPages; pageNum++) {
+      const canvas = await renderPage(pdfDocument, pageNum, HASH_RENDER_SIZE);
+      hashes.push(differenceHash(canvas));
+      canvas.width = 0;
+      canvas.height = 0;
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+
+  const groups: DuplicatePageGroup[] = [];
+  hashes.forEach((hash, index) => {
+    for (const group of groups) {
+      const distance = hashDistance(hashes[group.pages[0] - 1], hash);
+      if (distance <= maxDistance) {
+        group.pages.push(index + 1);
+        group.distance = Math.max(group.distance, distance);
+        return;
+      }
+    }
+    groups.push({ pages: [index + 1], distance: 0 });
+  });
+
+  return groups.filter(group => group.pages.length > 1);
+}
+
+/**
+ * Finds blank pages, deciding by content, by rendering, or by both
+ *
+ * The text method catches pages whose only marks are too faint or small
+ * for the pixel method to tell from scanner noise; the pixel method
+ * catches scanned blank sheets, which draw a full-page image. With
+ * 'both', a page is blank only when both agree, the most reliable
+ * choice. Nothing is removed.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Detection method
+ * @returns A decision for every page and the blank page numbers
+ *
+ * @example
+ * ```typescript
+ * const { blankPages } = await detectBlankPages(scan, { method: 'pixels' });
+ * console.log(`Blank: ${blankPages.join(', ') || 'none'}`);
+ * ```
+ */
+export async function detectBlankPages(
+  pdfBuffer: ArrayBuffer,
+  options: BlankPageOptions = {}
+): Promise<BlankPageReport> {
+  assertPdfBuffer(pdfBuffer);
+
+  const method = options.method ?? 'both';
+  if (!['text', 'pixels', 'both'].includes(method)) {
+    throw new TypeError(`Invalid method: ${method}. Must be 'text', 'pixels', or 'both'.`);
+  }
+  const useText = method !== 'pixels';
+  const usePixels = method !== 'text';
+
+  const pdfDoc = useText ? await loadDocument(pdfBuffer) : undefined;
+  const pages: BlankPageDecision[] = [];
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  try {
+    for (let pageNum = 1; pageNum <= pdfDocument.numPages; pageNum++) {
+      const decision: BlankPageDecision = { page: pageNum, blank: true };
+
+      if (pdfDoc && pageNum <= pdfDoc.getPageCount()) {
+        const items = await getPageTextItems(pdfDocument, pageNum);
+        decision.hasText = items.some(item => item.str.trim() !== '');
+        decision.imageCoverage = pageImageCoverage(pdfDoc.getPage(pageNum - 1));
+        decision.blank = !decision.hasText && decision.imageCoverage < MAX_BLANK_IMAGE_COVERAGE;
+      }
+      if (usePixels) {
+        const canvas = await renderPage(pdfDocument, pageNum, BLANK_RENDER_SIZE);
+        decision.inkShare = inkShare(canvas);
+        canvas.width = 0;
+        canvas.height = 0;
+        decision.blank &&= decision.inkShare <= MAX_BLANK_INK;
+      }
+      pages.push(decision);
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+
+  return { method, pages, blankPages: pages.filter(page => page.blank).map(page => page.page) };
+}
+
+/**
+ * Reads the trailer of the last cross-reference section (read-only)
+ *
+ * A debugging aid: shows whether the file uses an xref table or stream,
+ * where the section starts and, for incrementally updated files, where the
+ * previous one is.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns The decoded trailer
+ *
+ * @example
+ * ```typescript
+ * const trailer = await getTrailer(file);
+ * console.log(`${trailer.xrefType} xref, root ${trailer.root}, prev ${trailer.prev ?? 'none'}`);
+ * ```
+ */
+export async function getTrailer(pdfBuffer: ArrayBuffer): Promise<TrailerInfo> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const trailer = readTrailer(pdfDoc, pdfBuffer);
+  if (!trailer) {
+    throw new Error('Cannot read the trailer: startxref is missing or points at no cross-reference section');
+  }
+  return trailer;
+}
+
+/**
+ * Counts the pages of a PDF as cheaply as possible
+ *
+ * The count is read from the /Count of the root page tree node, found
+ * through the trailer, the cross-reference table and the catalog without
+ * parsing the rest of the file, so it is ready almost at once even for
+ * large documents. When the file uses cross-reference streams, the table
+ * doesn't lead to the catalog or page tree, or /Count is missing or
+ * inconsistent, the file is parsed in full instead. method tells which
+ * path was taken.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns The page count and how it was found
+ *
+ * @example
+ * ```typescript
+ * const { pageCount, method } = await getPageCount(file);
+ * pageSelector.max = pageCount;
+ * console.log(`${pageCount} pages (${method})`);
+ * ```
+ */
+export async function getPageCount(pdfBuffer: ArrayBuffer): Promise<PageCountResult> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pageTreeCount = readPageTreeCount(toLatin1(pdfBuffer));
+  if (pageTreeCount !== undefined) {
+    return { pageCount: pageTreeCount, method: 'pageTree' };
+  }
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return { pageCount: pdfDoc.getPageCount(), method: 'fullParse' };
+}
+
+/**
+ * Extracts the text of every page
+ *
+ * Pick the layout for the consumer: 'reading' for search indexing and
+ * summaries, 'layout' for display where columns and indentation matter,
+ * 'raw' to see the order the generator wrote text in.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Layout mode
+ * @returns Per-page text and the mode used
+ *
+ * @example
+ * ```typescript
+ * const { pages } = await extractText(file, { layout: 'layout' });
+ * pre.textContent = pages.map(p => p.text).join('\n\f');
+ * ```
+ */
+export async function extractText(
+  pdfBuffer: ArrayBuffer,
+  options: ExtractTextOptions = {}
+): Promise<TextExtraction> {
+  assertPdfBuffer(pdfBuffer);
+
+  const mode = options.layout ?? 'reading';
+  if (!['reading', 'raw', 'layout'].includes(mode)) {
+    throw new TypeError(`Invalid layout: ${mode}. Must be 'reading', 'raw', or 'layout'.`);
+  }
+
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  const pages: PageText[] = [];
+  try {
+    for (let pageNum = 1; pageNum <= pdfDocument.numPages; pageNum++) {
+      const items = await getPageTextItems(pdfDocument, pageNum);
+      pages.push({ page: pageNum, text: formatPageText(items, mode) });
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+
+  return { mode, pages };
+}
+
+/**
+ * Lists the words of a page with their bounding boxes, for drawing
+ * search highlights over a rendered page
+ *
+ * Boxes are axis-aligned in PDF user space (origin bottom left, y up)
+ * and ignore the page rotation, which is reported alongside. Words are
+ * placed by character count within each text run, so boxes in
+ * proportional fonts can be a little off. Pages with no text layer
+ * (plain scans) have no words.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @param options - Page to read
+ * @returns The page's words and the geometry needed to map them to the screen
+ *
+ * @example
+ * ```typescript
+ * const { words, viewBox } = await extractWords(file, { page: 1 });
+ * const scale = canvas.width / (viewBox[2] - viewBox[0]);
+ * for (const word of words.filter(w => w.text.toLowerCase().includes(query))) {
+ *   ctx.fillRect(
+ *     (word.x - viewBox[0]) * scale,
+ *     (viewBox[3] - word.y - word.height) * scale,
+ *     word.width * scale,
+ *     word.height * scale
+ *   );
+ * }
+ * ```
+ */
+export async function extractWords(pdfBuffer: ArrayBuffer, options: ExtractWordsOptions): Promise<PageWords> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  try {
+    if (!Number.isInteger(options.page) || options.page < 1 || options.page > pdfDocument.numPages) {
+      throw new TypeError(`Invalid page: ${options.page}. Must be between 1 and ${pdfDocument.numPages}.`);
+    }
+
+    const page = await pdfDocument.getPage(options.page);
+    const [x1, y1, x2, y2] = page.view;
+    const words = groupWords(await getPageTextItems(pdfDocument, options.page));
+    return {
+      page: options.page,
+      viewBox: [x1, y1, x2, y2],
+      width: x2 - x1,
+      height: y2 - y1,
+      rotation: ((page.rotate % 360) + 360) % 360,
+      rotationApplied: false,
+      words,
+    };
+  } finally {
+    await pdfDocument.destroy();
+  }
+}
+
+/**
+ * Counts words and characters, and how many pages have text or are only
+ * images
+ *
+ * A cheap triage check: a document with image-only pages and few words
+ * is a scan that needs OCR before it can be searched. Empty and
+ * image-only documents get zero counts.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Word, character and page counts
+ *
+ * @example
+ * ```typescript
+ * const stats = await getTextStats(file);
+ * if (stats.pagesImageOnly > stats.pagesWithText) queueForOcr(file);
+ * ```
+ */
+export async function getTextStats(pdfBuffer: ArrayBuffer): Promise<TextStats> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  const stats: TextStats = { wordCount: 0, charCount: 0, pagesWithText: 0, pagesImageOnly: 0 };
+
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  try {
+    for (let pageNum = 1; pageNum <= pdfDocument.numPages; pageNum++) {
+      const words = groupWords(await getPageTextItems(pdfDocument, pageNum));
+      if (words.length > 0) {
+        stats.pagesWithText++;
+        stats.wordCount += words.length;
+        stats.charCount += words.reduce((total, word) => total + [...word.text].length, 0);
+      } else if (pageNum <= pdfDoc.getPageCount() && analyzePage(pdfDoc.getPage(pageNum - 1)).images.length > 0) {
+        stats.pagesImageOnly++;
+      }
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+
+  return stats;
+}
+
+/**
+ * Counts annotations by subtype, for the document and per page
+ *
+ * Useful before stripping or flattening, e.g. to tell users a document
+ * has 47 comments. Documents without annotations get all-zero counts.
+ *
+ * @param pdfBuffer - The PDF file as an ArrayBuffer
+ * @returns Totals by subtype with a per-page breakdown
+ *
+ * @example
+ * ```typescript
+ * const stats = await getAnnotationStats(file);
+ * console.log(`${stats.bySubtype.Text + stats.bySubtype.FreeText} comments`);
+ * ```
+ */
+export async function getAnnotationStats(pdfBuffer: ArrayBuffer): Promise<AnnotationStats> {
+  assertPdfBuffer(pdfBuffer);
+
+  const pdfDoc = await loadDocument(pdfBuffer);
+  return countAnnotations(pdfDoc);
+}
@@ -0,0 +1,317 @@
+/**
+ * Document merging API
+ */
+
+import { PDFDocument, PDFEmbeddedPage, PageSizes, StandardFonts } from 'pdf-lib';
+import type {
+  MergeInput,
+  MergeOptions,
+  MergePageSource,
+  MergeResult,
+  MergeSortOrder,
+  MergeSourceStart,
+  PdfAIssue,
+  PdfAMergeOptions,
+  PdfAMergeResult,
+  SeparatorMergeOptions,
+  SeparatorMergeResult,
+} from './types';
+import { assertPdfBuffer, parseHexColor } from './validate';
+import { drawDividerPage } from '../core/cover-sheet';
+import { mergeSources, setSourcePageLabels, sortSources, sourcePrefix } from '../core/merge';
+import type { MergeSource } from '../core/merge';
+import { loadDocument, saveDocument } from '../core/pdf-objects';
+import { checkPdfA, mergeOutputIntents, readPdfAClaim, writePdfAIdentification } from '../core/pdfa';
+
+/**
+ * Merges several PDFs into one
+ *
+ * Inputs are merged in the order given unless sortPagesBy says otherwise.
+ * Natural sorting compares embedded numbers numerically, so scans named
+ * "scan-2" come before "scan-10". With preserveLayers, each input's
+ * layers stay toggleable, grouped under the input's name. With
+ * dedupeDestinations, named destinations are carried over and names
+ * defined by several inputs are resolved so each input's links keep
+ * their targets. With sourceLabels, page labels show where each page
+ * came from ("A-1", "A-2", "B-1"), as in legal bundles.
+ *
+ * @param inputs - PDFs as ArrayBuffers, or objects carrying a name for sorting
+ * @param options - Merge options
+ * @returns The merged PDF with the input order used and a per-page source map
+ *
+ * @example
+ * ```typescript
+ * const result = await merge(
+ *   files.map(f => ({ pdf: f.buffer, name: f.name })),
+ *   { sortPagesBy: 'name' }
+ * );
+ * console.log(result.order); // e.g. [1, 2, 0] for 003, 001, 002
+ * ```
+ */
+export async function merge(
+  inputs: MergeInput[],
+  options: MergeOptions = {}
+): Promise<MergeResult> {
+  const { merged, prefixes, result } = await mergeInputs(inputs, options);
+  if (prefixes) setSourcePageLabels(merged, result.pages, prefixes);
+  return { pdf: await saveDocument(merged), ...result };
+}
+
+/**
+ * Merges several PDFs with a labeled divider page before each
+ *
+ * Works like merge(); each divider shows its input's label centered on
+ * the page, wrapped to fit. Dividers take the size of the page that
+ * follows unless style.pageSize is set, and are listed in the page map
+ * with page 0. With sourceLabels, a divider is labeled with its input's
+ * prefix alone. Dividers can be blank, drawn on the first page of a
+ * template PDF, or placed only between inputs.
+ *
+ * @param inputs - PDFs as ArrayBuffers, or objects carrying a name
+ * @param options - Merge options, divider labels and styling
+ * @returns The merged PDF with the input order used, a per-page source
+ *   map, the page count and where each input starts
+ *
+ * @example
+ * ```typescript
+ * const { pdf, starts } = await mergeWithSeparators([contract, invoice, receipts], {
+ *   labels: ['Contract', 'Invoice', 'Receipts'],
+ *   style: { fontSize: 36, background: '#f0f4ff' },
+ * });
+ * console.log(`Invoice starts on page ${starts[1].firstPage}`);
+ * ```
+ */
+export async function mergeWithSeparators(
+  inputs: MergeInput[],
+  options: SeparatorMergeOptions = {}
+): Promise<SeparatorMergeResult> {
+  const style = options.style ?? {};
+  if (options.labels !== undefined) {
+    if (!Array.isArray(options.labels) || options.labels.length !== (Array.isArray(inputs) ? inputs.length : -1)) {
+      throw new TypeError('labels must be an array with one label per input');
+    }
+    if (!options.labels.every(label => typeof label === 'string')) {
+      throw new TypeError('labels must be strings');
+    }
+  }
+  const fontSize = style.fontSize ?? 28;
+  if (!Number.isFinite(fontSize) || fontSize <= 0) {
+    throw new TypeError(`Invalid fontSize: ${fontSize}. Must be a positive number.`);
+  }
+  const textColor = parseHexColor(style.textColor ?? '#000000', 'textColor');
+  const background = style.background !== undefined ? parseHexColor(style.background, 'background') : undefined;
+  const pageSize = style.pageSize;
+  if (pageSize !== undefined && (!Array.isArray(pageSize) || pageSize.length !== 2 || !pageSize.every(side => Number.isFinite(side) && side > 0))) {
+    throw new TypeError(`Invalid pageSize: ${pageSize}. Must be [width, height] in points.`);
+  }
+  const dividerKind = options.divider ?? 'label';
+  if (!['label', 'blank'].includes(dividerKind)) {
+    throw new TypeError(`Invalid divider: ${dividerKind}. Must be 'label' or 'blank'.`);
+  }
+  const placement = options.placement ?? 'before';
+  if (!['before', 'between'].includes(placement)) {
+    throw new TypeError(`Invalid placement: ${placement}. Must be 'before' or 'between'.`);
+  }
+  if (options.template !== undefined) assertPdfBuffer(options.template, 'template');
+
+  const { merged, ordered, prefixes, result } = await mergeInputs(inputs, options);
+  const font = await merged.embedFont(style.bold === false ? StandardFonts.Helvetica : StandardFonts.HelveticaBold);
+
+  let template: PDFEmbeddedPage | undefined;
+  if (options.template) {
+    const templateDoc = await loadDocument(options.template);
+    if (templateDoc.getPageCount() === 0) throw new TypeError('Invalid template: the PDF has no pages');
+    template = await merged.embedPage(templateDoc.getPage(0));
+  }
+
+  // Insert from the back so earlier start indices stay valid
+  const pages: MergePageSource[] = [];
+  let end = result.pages.length;
+  for (let i = ordered.length - 1; i >= 0; i--) {
+    const { index, name } = ordered[i];
+    let start = end;
+    while (start > 0 && result.pages[start - 1].input === index) start--;
+    const following = start < end ? merged.getPage(start).getSize() : undefined;
+    pages.unshift(...result.pages.slice(start, end));
+    end = start;
+    if (placement === 'between' && i === 0) break;
+
+    const size = pageSize ??
+      (template ? [template.width, template.height] : following ? [following.width, following.height] : PageSizes.A4);
+    const divider = merged.insertPage(start, size as [number, number]);
+    if (template) {
+      const { width, height } = divider.getSize();
+      divider.drawPage(template, { x: 0, y: 0, width, height });
+    }
+    const label = dividerKind === 'blank' ? '' : options.labels?.[index] ?? name ?? `Document ${index + 1}`;
+    drawDividerPage(divider, label, font, { fontSize, textColor, background: template ? undefined : background });
+
+    pages.unshift({ input: index, page: 0 });
+  }
+
+  if (prefixes) setSourcePageLabels(merged, pages, prefixes);
+  return {
+    pdf: await saveDocument(merged),
+    ...result,
+    pages,
+    pageCount: pages.length,
+    starts: findStarts(ordered, pages),
+  };
+}
+
+/**
+ * Merges PDF/A files into one PDF/A-2b file
+ *
+ * Works like merge(), then restores what merging loses: the first
+ * input's output intent is carried over, and XMP identifying the file as
+ * PDF/A-2b, matching the document information, is written with a new
+ * file identifier. Page content, and so font embedding, is copied as is.
+ * The output is then checked for the requirements merging can break and
+ * what inputs can bring along (unembedded fonts, scripts, LZW). This is
+ * not a full validator; run one for archival sign-off.
+ *
+ * @param inputs - PDFs as ArrayBuffers, or objects carrying a name
+ * @param options - Merge options and the document title
+ * @returns The merged PDF with the merge() details, whether no blocking
+ *   issue was found, each input's claimed conformance, and the issues
+ *
+ * @example
+ * ```typescript
+ * const { pdf, conformant, issues } = await mergePdfA([contract, annex], { title: 'Signed contract' });
+ * if (!conformant) console.warn(issues.map(issue => issue.message).join('\n'));
+ * ```
+ */
+export async function mergePdfA(inputs: MergeInput[], options: PdfAMergeOptions = {}): Promise<PdfAMergeResult> {
+  if (options.title !== undefined && typeof options.title !== 'string') {
+    throw new TypeError(`Invalid title: ${options.title}. Must be a string.`);
+  }
+
+  const { merged, ordered, prefixes, result } = await mergeInputs(inputs, options);
+  if (prefixes) setSourcePageLabels(merged, result.pages, prefixes);
+
+  const issues: PdfAIssue[] = [];
+  const inputConformance = new Array<string | null>(inputs.length).fill(null);
+  for (const { index, pdfDoc } of ordered) {
+    const claim = readPdfAClaim(pdfDoc);
+    if (claim) inputConformance[index] = `PDF/A-${claim.part}${claim.conformance}`;
+    if (pdfDoc.isEncrypted) {
+      issues.push({ code: 'encrypted', message: 'Encrypted inputs cannot be merged into PDF/A', inputs: [index], blocking: true });
+    }
+  }
+  const unclaimed = ordered.filter(source => inputConformance[source.index] === null).map(source => source.index);
+  if (unclaimed.length > 0) {
+    issues.push({
+      code: 'inputNotPdfA',
+      message: 'These inputs claim no PDF/A conformance; their content may break it in ways not checked here',
+      inputs: unclaimed,
+      blocking: false,
+    });
+  }
+
+  issues.push(...mergeOutputIntents(merged, ordered));
+  const title = options.title ?? ordered.map(source => source.pdfDoc.getTitle()).find(Boolean);
+  writePdfAIdentification(merged, title);
+
+  const pdf = await saveDocument(merged);
+  // Issues already traced to inputs aren't repeated for the output
+  for (const issue of checkPdfA(await loadDocument(pdf))) {
+    if (!issues.some(known => known.code === issue.code)) issues.push(issue);
+  }
+
+  return {
+    pdf,
+    ...result,
+    conformant: !issues.some(issue => issue.blocking),
+    inputConformance,
+    issues,
+  };
+}
+
+/**
+ * Loads, orders and merges the inputs, leaving the document unsaved
+ */
+async function mergeInputs(
+  inputs: MergeInput[],
+  options: MergeOptions
+): Promise<{
+  merged: PDFDocument;
+  ordered: MergeSource[];
+  prefixes?: string[];
+  result: Omit<MergeResult, 'pdf'>;
+}> {
+  if (!Array.isArray(inputs) || inputs.length === 0) {
+    throw new TypeError('inputs must be a non-empty array');
+  }
+  const sourceLabels = options.sourceLabels;
+  if (Array.isArray(sourceLabels)) {
+    if (sourceLabels.length !== inputs.length || !sourceLabels.every(prefix => typeof prefix === 'string')) {
+      throw new TypeError('sourceLabels must be true or an array with one prefix string per input');
+    }
+  } else if (sourceLabels !== undefined && typeof sourceLabels !== 'boolean') {
+    throw new TypeError(`Invalid sourceLabels: ${sourceLabels}. Must be a boolean or an array of prefixes.`);
+  }
+
+  const sortBy: MergeSortOrder = options.sortPagesBy || 'input';
+  if (!['input', 'name', 'title'].includes(sortBy)) {
+    throw new TypeError(`Invalid sortPagesBy: ${sortBy}. Must be 'input', 'name', or 'title'.`);
+  }
+
+  const sources: MergeSource[] = [];
+  for (let index = 0; index < inputs.length; index++) {
+    const input = inputs[index];
+    const pdf = input instanceof ArrayBuffer ? input : input.pdf;
+    assertPdfBuffer(pdf, `inputs[${index}]`);
+
+    sources.push({
+      index,
+      name: input instanceof ArrayBuffer ? undefined : input.name,
+      pdfDoc: await loadDocument(pdf),
+    });
+  }
+
+  const ordered = sortSources(sources, sortBy);
+  const { merged, pages, layers, destinationCollisions } = await mergeSources(
+    ordered,
+    options.preserveLayers === true,
+    options.dedupeDestinations === true
+  );
+
+  let prefixes: string[] | undefined;
+  if (Array.isArray(sourceLabels)) {
+    prefixes = sourceLabels;
+  } else if (sourceLabels) {
+    const letters = new Array<string>(inputs.length);
+    ordered.forEach((source, position) => {
+      letters[source.index] = sourcePrefix(position);
+    });
+    prefixes = letters;
+  }
+
+  return {
+    merged,
+    ordered,
+    prefixes,
+    result: {
+      order: ordered.map(source => source.index),
+      pages,
+      ...(layers && { layers }),
+      ...(destinationCollisions && { destinationCollisions }),
+    },
+  };
+}
+
+/**
+ * Finds each input's divider and first page in the final page map
+ */
+function findStarts(ordered: MergeSource[], pages: MergePageSource[]): MergeSourceStart[] {
+  const starts = ordered.map(({ index }): MergeSourceStart => ({ input: index, divider: null, firstPage: null }));
+  const byInput = new Map(starts.map(start => [start.input, start]));
+
+  pages.forEach((source, i) => {
+    const start = byInput.get(source.input);
+    if (!start) return;
+    if (source.page === 0) start.divider = i + 1;
+    else start.firstPage ??= i + 1;
+  });
+  return starts;
+}
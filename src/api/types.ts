@@ -6,6 +6,32 @@
  */
 export type CompressionPreset = 'lossless' | 'balanced' | 'max';
 
+/**
+ * Preset option accepted by compress()
+ * - auto: classify the document and pick a preset (max for scans,
+ *   lossless for born-digital text, balanced for mixed content) and image
+ *   settings, biased by sizeGoal
+ */
+export type CompressionPresetOption = CompressionPreset | 'auto';
+
+/**
+ * Document classification used by the auto preset
+ */
+export type DocumentClassification = 'scanned' | 'digital' | 'mixed';
+
+/**
+ * What the auto preset favors when picking settings
+ * - smaller: smaller output, at some cost in image quality
+ * - balanced: the default trade-off
+ * - quality: sharper images, at some cost in size
+ */
+export type SizeGoal = 'smaller' | 'balanced' | 'quality';
+
+/**
+ * Rendering intent for color conversion
+ */
+export type RenderingIntent = 'Perceptual' | 'RelativeColorimetric' | 'Saturation' | 'AbsoluteColorimetric';
+
 /**
  * Progress event phases during compression
  */
@@ -33,8 +59,8 @@ export interface ProgressEvent {
  * Compression options
  */
 export interface CompressionOptions {
-  /** Compression preset to use */
-  preset: CompressionPreset;
+  /** Compression preset to use ('auto' picks one from the document's content) */
+  preset: CompressionPresetOption;
   /** Pages per chunk (default: 10) */
   chunkSize?: number;
   /** Progress callback function */
@@ -51,14 +77,310 @@ export interface CompressionOptions {
   targetDPI?: number;
   /** Override JPEG quality (0-1, balanced/max only) */
   jpegQuality?: number;
+  /**
+   * Pick the JPEG quality of each rendered page instead: the lowest
+   * quality whose decoded result keeps at least this structural
+   * similarity (SSIM, 0-1) to the rendering, found by binary search.
+   * Replaces jpegQuality; qualityFloor.minJpegQuality still bounds the
+   * search. 0.95 is visually close; 0.98 near-transparent. Each page is
+   * encoded and decoded about six times. Results are in
+   * report.ssimQuality. Balanced/max only, browser only
+   */
+  minSSIM?: number;
+  /**
+   * Put a restart marker every this many MCUs (8x8 or 16x16 pixel blocks)
+   * in the JPEGs the image pass writes, so a corrupted byte in streamed
+   * delivery spoils one strip of a page instead of the rest of it.
+   * Browser encoders can't write restart markers, so they're inserted
+   * losslessly after encoding; no other encoder is needed. Results are in
+   * report.restartMarkers. Balanced/max only. Default: no markers
+   */
+  jpegRestartInterval?: number;
   /** Enable rasterization in max mode (default: auto-detect) */
   enableRasterization?: boolean;
   /** Merge strategy: 'worker' (default) or 'main' thread */
   mergeStrategy?: 'worker' | 'main';
   /** Timeout in milliseconds (default: 300000 = 5 minutes) */
   timeout?: number;
+  /**
+   * Hand control back to the event loop between pipeline steps so the main
+   * thread stays responsive without a Web Worker. `true` yields with a
+   * zero-delay timeout; a function is awaited instead (e.g. one resolving
+   * on requestAnimationFrame). Each yield adds a few milliseconds per page.
+   * Default: no extra yielding.
+   */
+  yield?: boolean | (() => Promise<void> | void);
+  /** Remove content streams that draw nothing (default: false) */
+  pruneEmptyContent?: boolean;
+  /** With pruneEmptyContent, also remove pages whose content was entirely no-op (default: false) */
+  removeEmptyPages?: boolean;
+  /**
+   * With pruneEmptyContent, also remove pages that have no content stream at
+   * all. These are usually deliberate layout blanks, so this is separate
+   * from removeEmptyPages (default: false)
+   */
+  removeBlankLayout?: boolean;
+  /**
+   * Rendering intent to set on images that don't specify one. Images
+   * re-encoded by balanced/max rasterization are new and not tagged.
+   */
+  renderingIntent?: RenderingIntent;
+  /**
+   * Move inline images larger than 4 KB out of content streams into image
+   * XObjects and Flate-encode uncompressed small ones (lossless, default: false)
+   */
+  optimizeInlineImages?: boolean;
+  /**
+   * Trim XMP metadata to Dublin Core, PDF and XMP basic properties (plus
+   * PDF/A and PDF/UA identification), dropping other namespaces and packet
+   * padding (default: false)
+   */
+  trimXMP?: boolean;
+  /** With trimXMP, additional namespace URIs to keep */
+  xmpSafelist?: string[];
+  /**
+   * Remove pages identical to an earlier page (same content, resources,
+   * boxes and rotation): 'adjacent' collapses consecutive runs, 'all'
+   * compares against every earlier page. Pages with annotations or
+   * tagging are kept. Bookmarks, destinations and links to a removed
+   * page are pointed at the page it duplicated. Default: off
+   */
+  dedupePages?: PageDedupeMode;
+  /**
+   * Draw markup annotations into the page content so they print, then
+   * remove them (default: false)
+   */
+  printAnnotations?: boolean;
+  /**
+   * With printAnnotations, the annotation subtypes to convert (default:
+   * markup types such as Highlight, FreeText, Stamp, Ink, Square, Line)
+   */
+  printAnnotationSubtypes?: string[];
+  /**
+   * With printAnnotations, re-deflate the converted appearance streams
+   * (and forms they use), keeping each only if smaller; the bytes saved
+   * are in report.printedAnnotations. Default: false
+   */
+  compressAppearances?: boolean;
+  /**
+   * Reduce RGB images to a small palette for laser printing (browser only
+   * for JPEG images). Images re-encoded by balanced/max rasterization are
+   * not affected. Default: false
+   */
+  posterize?: boolean;
+  /** With posterize, the palette size (2-256, default: 16) */
+  posterizeColors?: number;
+  /**
+   * With posterize, also reduce images the palette can't represent closely
+   * (typically photographs). Default: false, such images are skipped
+   */
+  posterizePhotos?: boolean;
+  /**
+   * Re-encode screenshot-like RGB images (mostly flat areas) losslessly
+   * the way PNG does: an exact palette when they have at most 256
+   * colors, and per-row prediction filters. Photographs are skipped, and
+   * each image is kept only if smaller. Runs after posterize. Browser
+   * only for JPEG images. Results are in report.optimizedPng.
+   * Default: false
+   */
+  optimizePNG?: boolean;
+  /**
+   * Convert CMYK images (DeviceCMYK, CMYK ICC profiles, and Indexed images
+   * with a CMYK base) to RGB so they look right in web viewers, which
+   * often show print CMYK too dark. Runs before posterize. Colors are
+   * approximate: no ICC transform is applied, so an image's own CMYK
+   * profile is ignored, and converted images print less accurately.
+   * JPEGs are decoded by the browser (browser only) and re-encoded.
+   * Results are in report.convertedCmyk. Default: false
+   */
+  cmykToRgb?: boolean;
+  /**
+   * With cmykToRgb, the conversion: 'swop' approximates the US Web Coated
+   * (SWOP) press profile, 'naive' is the simple formula (brighter, more
+   * saturated). Default: 'swop'
+   */
+  cmykConversion?: CmykConversion;
+  /**
+   * When rasterizing (balanced/max), encode each page image as JPEG, Flate
+   * and, for black-and-white pages, CCITT Group 4, keeping the smallest.
+   * Slower; the choices are listed in stats.imageEncodings. Default: false
+   */
+  tryMultipleEncodings?: boolean;
+  /**
+   * Merge pages split into several content streams into one re-deflated
+   * stream per page (lossless). Leave off for workflows that depend on the
+   * stream boundaries, such as incremental edits of the same file.
+   * Default: false
+   */
+  recombineContentStreams?: boolean;
+  /**
+   * Remove every URI action (external link) from annotations, bookmarks and
+   * document actions; removed links are listed in report.strippedLinks.
+   * Default: false
+   */
+  stripExternalLinks?: boolean;
+  /**
+   * Return inputs smaller than this many bytes unchanged, with
+   * result.skipped set, instead of compressing them. Default: no minimum
+   */
+  minInputBytes?: number;
+  /**
+   * Fail with a CompressionError (code 'OUTPUT_TOO_LARGE', achievedSize
+   * set) if the result is still larger than this many bytes.
+   * Default: no limit
+   */
+  maxOutputBytes?: number;
+  /**
+   * Fail with a CompressionError (code 'TOO_MANY_OBJECTS') before parsing
+   * if the file declares more indirect objects than this, to stop crafted
+   * files from exhausting memory. The count is the larger of what the
+   * last cross-reference section declares and the objects actually in
+   * the file (object headers plus object stream contents), so a small
+   * /Size doesn't get past it. Default: 1,000,000 (Infinity for no limit)
+   */
+  maxObjects?: number;
+  /**
+   * Remove the XFA form data from hybrid forms, keeping the AcroForm
+   * fields. XFA-only forms are kept, with a warning in report.xfa.
+   * Default: false
+   */
+  removeXFA?: boolean;
+  /**
+   * Lowest image settings any preset may use (balanced/max only). Preset
+   * choices and explicit targetDPI/jpegQuality below the floor are raised
+   * to it; the floor always wins. Canvas size limits for very large pages
+   * still apply. appliedSettings.qualityFloorHit lists what was raised.
+   */
+  qualityFloor?: QualityFloor;
+  /**
+   * When rasterizing (balanced/max), render pages that are likely images
+   * of text (scans, and pages with an OCR layer) at no less than 200 DPI,
+   * below which scanned text often becomes illegible. A warning and the
+   * protected pages are in report.textImages. Set to false to render
+   * every page at the target DPI. Default: true
+   */
+  protectTextImages?: boolean;
+  /**
+   * Record in Info and XMP that this library processed the file (library
+   * version and time), readable with wasProcessed(). Default: false
+   */
+  tagProcessed?: boolean;
+  /** With tagProcessed, the metadata key to use (default: 'PdfCompressProcessed') */
+  processedMarkerKey?: string;
+  /**
+   * Attach the document's text, in reading order, as a UTF-8 .txt file
+   * so tools without a PDF parser can search it. The text comes from the
+   * input, so it survives rasterizing. Skipped with a warning when there
+   * is no extractable text, or when the catalog is pinned or signed and
+   * can't take the attachment; see report.textSidecar. Default: false
+   */
+  attachTextSidecar?: boolean;
+  /** With attachTextSidecar, the attachment's file name (default: 'text.txt') */
+  textSidecarName?: string;
+  /**
+   * Check images for corrupt or truncated data before processing, so one
+   * broken image doesn't abort the run. Recoverable images are rebuilt;
+   * the rest are replaced by a gray placeholder ('placeholder') or removed
+   * from the page ('drop'). Default: off
+   */
+  repairImages?: ImageRepairMode;
+  /**
+   * Collapse byte-identical ICC profiles (from ICCBased color spaces and
+   * output intents) into one shared copy. Default: false
+   */
+  dedupeICCProfiles?: boolean;
+  /**
+   * Rebuild ToUnicode maps of simple fonts that contradict their glyph
+   * names, so text extracted or copied from the output matches what's
+   * drawn, and replace encodings that only restate WinAnsiEncoding with
+   * the standard one. Rendering is never changed: fonts where that can't
+   * be guaranteed are skipped and listed in report.normalizedEncodings.
+   * Default: false
+   */
+  normalizeEncoding?: boolean;
+  /**
+   * Re-encode only this many images, the largest by stored size, leaving
+   * the rest untouched; bounds CPU time on low-end devices. Applies to
+   * per-image passes (cmykToRgb, posterize, optimizePNG); balanced/max
+   * rasterization works per page and is not limited. Default: no limit
+   */
+  maxImagesToProcess?: number;
+  /**
+   * With preset 'auto', bias the chosen preset, DPI and JPEG quality
+   * toward smaller output or higher quality (default: 'balanced').
+   * Explicit targetDPI and jpegQuality still win.
+   */
+  sizeGoal?: SizeGoal;
+  /**
+   * Object numbers to carry through unchanged, e.g. a signature dictionary
+   * or a hand-tuned image. Pinned objects keep their number, changes
+   * passes make to them are undone, and the output is checked against
+   * their original bytes (see report.pinnedObjects); compression fails
+   * with PINNED_OBJECT_CHANGED if one differs. Requires the lossless
+   * preset, since the image pass renumbers every object. Pin leaf objects:
+   * undoing a pass's change to shared structure such as the page tree can
+   * leave it inconsistent. The document information dictionary can't be
+   * pinned.
+   */
+  pinObjects?: number[];
+  /**
+   * Leave signed content alone in signed documents: objects covered by a
+   * signature's byte range are carried through unchanged (changes passes
+   * make to them are undone and reported in report.signedContent), and
+   * the rest is saved as an incremental update appended to the original
+   * bytes, so every signature still covers what it signed. An incremental
+   * update only adds bytes, so the output is never smaller than the
+   * input; it's returned unchanged if nothing outside the signed content
+   * changed. Signed documents require the lossless preset: with
+   * balanced, max, or an auto choice of either, they fail. Documents
+   * without signatures are compressed as usual with any preset.
+   */
+  preserveSignedContent?: boolean;
+  /**
+   * Keep links, form fields, bookmarks and named destinations working:
+   * steps that would damage them are turned off (stripExternalLinks,
+   * page removal by pruneEmptyContent and dedupePages, printing Link or
+   * Widget annotations), and balanced/max fall back to lossless for
+   * documents that have any, since their image pass drops them. The
+   * output is checked and report.interactive compares the counts before
+   * and after, with a warning for each setting that was overridden.
+   * Default: false
+   */
+  preserveInteractive?: boolean;
+  /**
+   * Return result.changelog, one entry per change made to the document
+   * (pages removed, images re-encoded or rasterized with their DPI before
+   * and after, objects removed, metadata changed), for audit logs. Built
+   * from what the passes already record, so it costs little. Default: false
+   */
+  changelog?: boolean;
+  /**
+   * User or owner password of an encrypted input. The document is
+   * decrypted before any pass runs and the output is saved without
+   * encryption; a wrong password fails with PASSWORD_INCORRECT. An empty
+   * string opens files without a user password and fails others with
+   * PASSWORD_REQUIRED. Standard security handler only (RC4, AES-128,
+   * AES-256). Unencrypted files ignore it. Default: encrypted files are
+   * processed as they are
+   */
+  password?: string;
+}
+
+/**
+ * Minimum image settings for qualityFloor
+ */
+export interface QualityFloor {
+  /** Minimum rendering DPI */
+  minDPI?: number;
+  /** Minimum JPEG quality (0-1) */
+  minJpegQuality?: number;
 }
 
+/**
+ * Which duplicate pages dedupePages removes
+ */
+export type PageDedupeMode = 'adjacent' | 'all';
+
 /**
  * Compression result
  */
@@ -67,8 +389,414 @@ export interface CompressionResult {
   pdf: ArrayBuffer;
   /** Compression statistics */
   stats: CompressionStats;
+  /** Settings that were actually applied */
+  appliedSettings: AppliedSettings;
   /** Warning message if graceful degradation occurred */
   warning?: string;
+  /** Details of optional optimization steps (only present if any ran) */
+  report?: CompressionReport;
+  /** Marker written by tagProcessed */
+  processedMarker?: ProcessedMarker;
+  /**
+   * True if the input was smaller than minInputBytes and returned
+   * unchanged (stats then show no savings and the lossless preset)
+   */
+  skipped?: boolean;
+  /** Every change made, in the order the passes ran (with options.changelog) */
+  changelog?: ChangelogEntry[];
+}
+
+/**
+ * Kind of change recorded in the changelog
+ */
+export type ChangelogOperation =
+  | 'pageRemoved'
+  | 'contentRemoved'
+  | 'pageRasterized'
+  | 'imageReencoded'
+  | 'imageRepaired'
+  | 'imageRemoved'
+  | 'streamRecompressed'
+  | 'annotationsFlattened'
+  | 'linkRemoved'
+  | 'fontNormalized'
+  | 'formDataRemoved'
+  | 'objectsRemoved'
+  | 'metadataChanged'
+  | 'attachmentAdded';
+
+/**
+ * One change made by compression, from options.changelog
+ */
+export interface ChangelogEntry {
+  operation: ChangelogOperation;
+  /** Option or step responsible, e.g. 'posterize' or 'imagePass' */
+  source: string;
+  /** Object reference (e.g. '12 0 R') when one object changed */
+  object?: string;
+  /** 1-indexed page number when one page changed */
+  page?: number;
+  /** Value before the change, in unit */
+  before?: number;
+  /** Value after the change, in unit */
+  after?: number;
+  unit?: 'bytes' | 'dpi' | 'colors' | 'objects' | 'streams';
+  description: string;
+}
+
+/**
+ * Settings resolved from the preset and overrides
+ */
+export interface AppliedSettings {
+  /** Preset that was applied */
+  preset: CompressionPreset;
+  /** True if the preset was chosen by preset: 'auto' */
+  autoSelected: boolean;
+  /** Document classification behind an auto-selected preset */
+  classification?: DocumentClassification;
+  /** Why the document was classified that way */
+  reasoning?: string;
+  /** Size goal the auto preset was picked for */
+  sizeGoal?: SizeGoal;
+  /** Target DPI used for image compression (balanced/max only) */
+  targetDPI?: number;
+  /** JPEG quality used for image compression (balanced/max only) */
+  jpegQuality?: number;
+  /** Settings raised to meet qualityFloor (only present if any were) */
+  qualityFloorHit?: Array<'targetDPI' | 'jpegQuality'>;
+  /** Preset replaced by lossless to keep interactive features (preserveInteractive) */
+  interactiveOverride?: CompressionPreset;
+}
+
+/**
+ * Details of optional optimization steps; only steps that ran appear
+ */
+export interface CompressionReport {
+  /** Result of pruneEmptyContent */
+  prunedContent?: PruneReport;
+  /** Number of images given the default renderingIntent */
+  imagesTaggedWithIntent?: number;
+  /** Result of optimizeInlineImages */
+  inlineImages?: InlineImageReport;
+  /** Bytes saved by trimXMP */
+  xmpBytesSaved?: number;
+  /** Result of dedupePages */
+  dedupedPages?: PageDedupeReport;
+  /** Result of printAnnotations */
+  printedAnnotations?: AnnotationFlattenReport;
+  /** Result of posterize */
+  posterized?: PosterizeReport;
+  /** Result of optimizePNG */
+  optimizedPng?: PngOptimizeReport;
+  /** Result of cmykToRgb */
+  convertedCmyk?: CmykConversionReport;
+  /** Result of recombineContentStreams */
+  recombinedContent?: ContentRecombineReport;
+  /** Links removed by stripExternalLinks */
+  strippedLinks?: ExternalLink[];
+  /** Result of removeXFA */
+  xfa?: XfaRemovalReport;
+  /** Result of repairImages */
+  repairedImages?: ImageRepairReport;
+  /** Result of dedupeICCProfiles */
+  dedupedProfiles?: IccDedupeReport;
+  /** Result of normalizeEncoding */
+  normalizedEncodings?: FontEncodingReport;
+  /** Images selected by maxImagesToProcess */
+  imageLimit?: ImageLimitReport;
+  /** Outcome for each object in pinObjects */
+  pinnedObjects?: PinnedObjectReport[];
+  /** Result of preserveSignedContent (only present for signed documents) */
+  signedContent?: SignedContentReport;
+  /** Result of preserveInteractive */
+  interactive?: InteractiveFeatureReport;
+  /** Result of attachTextSidecar */
+  textSidecar?: TextSidecarReport;
+  /** Pages protectTextImages rendered above the target DPI */
+  textImages?: TextImageReport;
+  /** JPEG quality minSSIM chose for each page */
+  ssimQuality?: SsimQualityReport;
+  /** Result of jpegRestartInterval */
+  restartMarkers?: RestartMarkerReport;
+}
+
+/**
+ * What jpegRestartInterval changed
+ */
+export interface RestartMarkerReport {
+  /** MCUs between markers */
+  interval: number;
+  /** Page JPEGs given restart markers */
+  images: number;
+  /** Page JPEGs left without (not baseline, or their DC table can't code a restart) */
+  skipped: number;
+}
+
+/**
+ * What minSSIM chose
+ */
+export interface SsimQualityReport {
+  minSSIM: number;
+  pages: SsimPageQuality[];
+  /** Set when pages missed minSSIM even at full quality */
+  warning?: string;
+}
+
+/**
+ * JPEG quality chosen for one rendered page by minSSIM
+ */
+export interface SsimPageQuality {
+  page: number;
+  /** JPEG quality used (0-1) */
+  quality: number;
+  /** SSIM of the decoded JPEG against the rendering */
+  ssim: number;
+}
+
+/**
+ * Result of attachTextSidecar
+ */
+export interface TextSidecarReport {
+  /** Attachment file name */
+  name: string;
+  /** Size of the attached text in bytes (0 when skipped) */
+  bytes: number;
+  attached: boolean;
+  /** Why the sidecar was skipped */
+  warning?: string;
+}
+
+/**
+ * What protectTextImages raised
+ */
+export interface TextImageReport {
+  /** DPI the pages were raised to */
+  minDPI: number;
+  /** Target DPI the other pages were rendered at */
+  targetDPI: number;
+  /** Protected pages with the DPI each was rendered at (lower than minDPI if canvas limits applied) */
+  pages: Array<{ page: number; dpi: number }>;
+  warning: string;
+}
+
+/**
+ * Count of one kind of interactive feature before and after compression
+ */
+export interface FeatureCount {
+  before: number;
+  after: number;
+}
+
+/**
+ * What preserveInteractive checked
+ */
+export interface InteractiveFeatureReport {
+  /** Link annotations */
+  links: FeatureCount;
+  /** Terminal form fields (those holding a value) */
+  formFields: FeatureCount;
+  /** Outline items at any depth */
+  bookmarks: FeatureCount;
+  /** Entries in the Dests dictionary and name tree */
+  namedDestinations: FeatureCount;
+  /** True if every count is unchanged and links and bookmarks go to the same pages */
+  preserved: boolean;
+  /** Settings overridden to keep the features, and any feature that changed anyway */
+  warnings: string[];
+}
+
+/**
+ * What happened to one pinned object
+ */
+export interface PinnedObjectReport {
+  /** Object reference, e.g. '12 0 R' */
+  object: string;
+  /** True if the output has the object under the same number with identical bytes */
+  preserved: boolean;
+  /** True if a pass had changed the object and the original was put back */
+  restored: boolean;
+}
+
+/**
+ * What preserveSignedContent protected
+ */
+export interface SignedContentReport {
+  /** Signatures whose byte ranges were honored */
+  signatures: number;
+  /** Objects found in the signed revision and left unchanged */
+  protectedObjects: number;
+  /** Signed objects a pass would have changed, e.g. '12 0 R'; the change was skipped */
+  skippedObjects: string[];
+  /** Set when changes to signed objects were skipped */
+  warning?: string;
+}
+
+/**
+ * What removeXFA did
+ */
+export interface XfaRemovalReport {
+  /** Stored bytes of XFA data removed (0 if none was removed) */
+  bytesRemoved: number;
+  /** Set when XFA data was kept, e.g. for XFA-only forms */
+  warning?: string;
+}
+
+/**
+ * What recombineContentStreams merged
+ */
+export interface ContentRecombineReport {
+  /** Pages whose content streams were merged */
+  pagesRecombined: number;
+  /** Content streams on those pages before merging */
+  streamsBefore: number;
+  /** Content streams on those pages after merging (one per page) */
+  streamsAfter: number;
+  /** Stored stream bytes saved */
+  bytesSaved: number;
+}
+
+/**
+ * What posterize changed
+ */
+export interface PosterizeReport {
+  /** Images reduced to a palette */
+  images: PosterizedImage[];
+  /** Color images left unchanged (photographic, unreadable, or no smaller) */
+  skipped: number;
+}
+
+/**
+ * What optimizePNG changed
+ */
+export interface PngOptimizeReport {
+  /** Images re-encoded */
+  images: OptimizedPngImage[];
+  /** RGB images left unchanged (photographic, unreadable, or no smaller) */
+  skipped: number;
+}
+
+/**
+ * Lossless re-encoding of one image by optimizePNG
+ */
+export interface OptimizedPngImage {
+  /** Object reference of the image (e.g. '12 0 R') */
+  object: string;
+  width: number;
+  height: number;
+  /** 'indexed' for an exact palette, 'rgb' for predicted RGB */
+  encoding: 'indexed' | 'rgb';
+  /** Palette entries (null for 'rgb') */
+  colors: number | null;
+  /** Stored size before, in bytes */
+  bytesBefore: number;
+  /** Stored size after, in bytes */
+  bytesAfter: number;
+}
+
+/**
+ * CMYK to RGB conversion formula for cmykToRgb
+ */
+export type CmykConversion = 'naive' | 'swop';
+
+/**
+ * What cmykToRgb changed
+ */
+export interface CmykConversionReport {
+  /** Images converted to RGB */
+  converted: CmykConvertedImage[];
+  /** CMYK images left unchanged, and why */
+  skipped: SkippedImage[];
+}
+
+/**
+ * CMYK to RGB conversion of one image
+ */
+export interface CmykConvertedImage {
+  /** Object reference of the image (e.g. '12 0 R') */
+  object: string;
+  width: number;
+  height: number;
+  /**
+   * 'palette' for Indexed images (only the palette changed), 'samples'
+   * for raw or Flate data, 'jpeg' for JPEGs re-encoded after decoding
+   */
+  method: 'palette' | 'samples' | 'jpeg';
+  /** Stored size before, in bytes */
+  bytesBefore: number;
+  /** Stored size after, in bytes */
+  bytesAfter: number;
+}
+
+/**
+ * Image a pass left unchanged
+ */
+export interface SkippedImage {
+  /** Object reference of the image (e.g. '12 0 R') */
+  object: string;
+  reason: string;
+}
+
+/**
+ * Palette reduction of one image
+ */
+export interface PosterizedImage {
+  /** Object reference of the image (e.g. '12 0 R') */
+  object: string;
+  width: number;
+  height: number;
+  /** Distinct colors before */
+  colorsBefore: number;
+  /** Palette entries after */
+  colorsAfter: number;
+  /** Stored size before, in bytes */
+  bytesBefore: number;
+  /** Stored size after, in bytes */
+  bytesAfter: number;
+}
+
+/**
+ * What annotation flattening changed
+ */
+export interface AnnotationFlattenReport {
+  /** Annotations drawn into page content and removed */
+  flattened: number;
+  /** Matching annotations left in place because they have no appearance */
+  skipped: number;
+  /** Stored bytes saved by compressAppearances (only present if it ran) */
+  appearanceBytesSaved?: number;
+}
+
+/**
+ * What dedupePages removed
+ */
+export interface PageDedupeReport {
+  /** Number of pages removed */
+  pagesRemoved: number;
+  /**
+   * Removed pages and the kept page each duplicated (1-indexed, numbered
+   * after pruneEmptyContent has removed any pages)
+   */
+  removed: Array<{ page: number; survivor: number }>;
+}
+
+/**
+ * What optimizeInlineImages changed
+ */
+export interface InlineImageReport {
+  /** Inline images re-encoded or promoted */
+  processed: number;
+  /** Inline images moved to image XObjects */
+  promotedToXObjects: number;
+}
+
+/**
+ * What pruneEmptyContent removed
+ */
+export interface PruneReport {
+  /** Number of no-op content streams removed */
+  emptyStreamsRemoved: number;
+  /** Original page numbers (1-indexed) of removed pages */
+  pagesRemoved: number[];
 }
 
 /**
@@ -91,24 +819,1735 @@ export interface CompressionStats {
   processingTime: number;
   /** Number of chunks processed */
   chunksProcessed: number;
+  /** With tryMultipleEncodings, the encoding chosen for each page image */
+  imageEncodings?: PageImageEncoding[];
+}
+
+/**
+ * Stream encoding of a rasterized page image
+ */
+export type ImageEncoding = 'jpeg' | 'flate' | 'ccitt';
+
+/**
+ * Encoding chosen for one page image by tryMultipleEncodings
+ */
+export interface PageImageEncoding {
+  page: number;
+  encoding: ImageEncoding;
+  /** Encoded stream size in bytes */
+  bytes: number;
 }
 
+/**
+ * Machine-readable reason for a CompressionError
+ */
+export type CompressionErrorCode =
+  | 'OUTPUT_TOO_LARGE'
+  | 'TOO_MANY_OBJECTS'
+  | 'PASSWORD_INCORRECT'
+  | 'PASSWORD_REQUIRED'
+  | 'UNSUPPORTED_ENCRYPTION'
+  | 'PINNED_OBJECT_CHANGED'
+  | 'ALREADY_ENCRYPTED';
+
 /**
  * Custom error class for compression failures
  */
 export class CompressionError extends Error {
   constructor(
     message: string,
-    public attemptedPreset: CompressionPreset,
+    public attemptedPreset: CompressionPresetOption,
     public originalSize: number,
     public phase?: ProgressPhase,
-    public underlyingError?: Error
+    public underlyingError?: Error,
+    /** Set for failures callers may want to handle specifically */
+    public code?: CompressionErrorCode,
+    /** With OUTPUT_TOO_LARGE, the smallest size compression reached */
+    public achievedSize?: number
   ) {
     super(message);
     this.name = 'CompressionError';
   }
 }
 
+/**
+ * Signature field read from a signed PDF
+ */
+export interface SignatureInfo {
+  /** Fully qualified field name */
+  name: string;
+  /** Signed byte ranges as [offset1, length1, offset2, length2] */
+  byteRange: number[];
+  /** Signature encoding (e.g. 'adbe.pkcs7.detached', 'ETSI.CAdES.detached') */
+  subfilter?: string;
+  /** Signing time claimed by the signature dictionary (/M) */
+  signingTime?: Date;
+  /** Signer name claimed by the signature dictionary (/Name) */
+  signerName?: string;
+}
+
+/**
+ * What a signature's byte range covers
+ * - whole-file: everything except the signature value, to the end of the file
+ * - revision: a sound range, but the file was updated after signing
+ * - invalid: the range is malformed or leaves more than the signature value unsigned
+ */
+export type SignatureCoverageStatus = 'whole-file' | 'revision' | 'invalid';
+
+/**
+ * Byte range check for one signature
+ */
+export interface SignatureCoverage {
+  /** Fully qualified field name */
+  name: string;
+  /** Signed byte ranges as [offset1, length1, offset2, length2] */
+  byteRange: number[];
+  status: SignatureCoverageStatus;
+  /** The unsigned gap holds exactly the /Contents hex string */
+  gapIsContents: boolean;
+  /** The signed range ends at the end of a revision (%%EOF) */
+  endsRevision: boolean;
+  /** Bytes after the signed range, trailing whitespace aside */
+  bytesAfter: number;
+  /** Problems found; empty for a whole-file signature */
+  issues: string[];
+}
+
+/**
+ * Result of checkSignatureCoverage()
+ */
+export interface SignatureCoverageReport {
+  /** Signatures in field order */
+  signatures: SignatureCoverage[];
+  /** Bytes follow the most recent sound signature (an incremental update) */
+  modifiedAfterSigning: boolean;
+}
+
+/**
+ * Outline (bookmark) entry
+ */
+export interface Bookmark {
+  /** Bookmark title */
+  title: string;
+  /** Target page (1-indexed), or null if the destination can't be resolved */
+  page: number | null;
+  /** Nested bookmarks */
+  children: Bookmark[];
+}
+
+/**
+ * Document outline read from a PDF
+ */
+export interface BookmarkOutline {
+  /** Whether the document has an outline at all */
+  hasOutline: boolean;
+  /** Top-level bookmarks (empty when hasOutline is false) */
+  bookmarks: Bookmark[];
+}
+
+/**
+ * Options for padToAspect()
+ */
+export interface PadToAspectOptions {
+  /** Target width:height ratio, as a number (1.777) or a string ('16:9') */
+  aspect: number | string;
+  /** Padding color as a hex string (default: none, padding is left unpainted) */
+  background?: string;
+  /**
+   * Append the changes to the original bytes as an incremental update
+   * instead of rewriting the file (default: false). Keeps diffs small for
+   * versioned storage; the output is never smaller than the input, so don't
+   * combine it with compression.
+   */
+  incremental?: boolean;
+}
+
+/**
+ * Options for detectDuplicateText()
+ */
+export interface DuplicateTextOptions {
+  /** Minimum normalized block length in characters (default: 80) */
+  minBlockLength?: number;
+  /** Minimum similarity (0-1) for two blocks to be considered repeats (default: 0.9) */
+  minSimilarity?: number;
+}
+
+/**
+ * One occurrence of a repeated text block
+ */
+export interface DuplicateTextOccurrence {
+  /** Page the block was found on (1-indexed) */
+  page: number;
+  /** Block text as extracted */
+  text: string;
+  /** Similarity to the cluster's first occurrence (0-1) */
+  similarity: number;
+}
+
+/**
+ * Group of near-identical text blocks
+ */
+export interface DuplicateTextCluster {
+  /** Text of the first occurrence */
+  text: string;
+  /** Lowest similarity within the cluster (0-1) */
+  similarity: number;
+  /** Every occurrence, in document order */
+  occurrences: DuplicateTextOccurrence[];
+}
+
+/**
+ * Viewing context to check compatibility against
+ * - browser: in-browser viewers (pdf.js, Chrome, Safari)
+ * - print: printers and print RIPs
+ * - pdfa2: PDF/A-2 archiving
+ * - mobile: phone and tablet viewers
+ */
+export type CompatibilityTarget = 'browser' | 'print' | 'pdfa2' | 'mobile';
+
+/**
+ * Document features with known compatibility caveats
+ */
+export type PdfFeature = 'jbig2' | 'jpeg2000' | 'objectStreams' | 'transparency' | 'encryption' | 'xfa';
+
+/**
+ * Feature that may not work on the checked target
+ */
+export interface CompatibilityIssue {
+  /** Feature found in the document */
+  feature: PdfFeature;
+  /** Why it is a problem on the target */
+  note: string;
+  /** Suggested fix */
+  remediation?: string;
+}
+
+/**
+ * Result of checkCompatibility()
+ */
+export interface CompatibilityReport {
+  /** Target that was checked */
+  target: CompatibilityTarget;
+  /** True if no problematic features were found */
+  compatible: boolean;
+  /** Every feature the document uses, problematic or not */
+  features: PdfFeature[];
+  /** Features that may not work on the target */
+  issues: CompatibilityIssue[];
+}
+
+/**
+ * Prepress problem found by checkPrepress()
+ * - notPrintTargeted: only RGB and gray color, no output intent
+ * - overprint: an ExtGState turns on overprint (OP or op)
+ * - spotColors: Separation or DeviceN colorants other than process inks
+ * - inkCoverage: CMYK colors above 300% total ink
+ * - rgbImages: RGB images in a document that otherwise targets print
+ */
+export type PrepressIssue = 'notPrintTargeted' | 'overprint' | 'spotColors' | 'inkCoverage' | 'rgbImages';
+
+/**
+ * Prepress problem with the pages it occurs on
+ */
+export interface PrepressConcern {
+  issue: PrepressIssue;
+  message: string;
+  /** 1-indexed pages (empty for document-wide concerns) */
+  pages: number[];
+}
+
+/**
+ * Prepress findings for one page
+ */
+export interface PrepressPage {
+  /** 1-indexed page number */
+  page: number;
+  /** Whether drawing on the page turns on overprint */
+  overprint: boolean;
+  /** Spot colorant names used on the page */
+  spotColors: string[];
+  /**
+   * Highest total ink (C+M+Y+K, percent) of the CMYK colors set on the
+   * page; images aren't measured (null without CMYK colors)
+   */
+  maxInkCoverage: number | null;
+  /** Distinct RGB images drawn */
+  rgbImages: number;
+}
+
+/**
+ * Result of checkPrepress()
+ */
+export interface PrepressReport {
+  /** True when the document targets print and no concerns were found */
+  printReady: boolean;
+  /** Whether the document uses CMYK, spot colors or an output intent */
+  printTargeted: boolean;
+  pages: PrepressPage[];
+  /** Every spot colorant in the document */
+  spotColors: string[];
+  concerns: PrepressConcern[];
+}
+
+/**
+ * Merge input: a PDF, optionally with a name (usually the filename)
+ */
+export type MergeInput = ArrayBuffer | { pdf: ArrayBuffer; name?: string };
+
+/**
+ * How merge() orders its inputs
+ * - input: strictly in the order given (default)
+ * - name: natural-numeric sort on the input name
+ * - title: natural-numeric sort on the document title, falling back to the name
+ */
+export type MergeSortOrder = 'input' | 'name' | 'title';
+
+/**
+ * Merge options
+ */
+export interface MergeOptions {
+  /** Input ordering (default: 'input') */
+  sortPagesBy?: MergeSortOrder;
+  /**
+   * Keep each input's optional content groups (layers) listed and
+   * independently toggleable, grouped per input (default: false)
+   */
+  preserveLayers?: boolean;
+  /**
+   * Keep each input's named destinations so links to them still work.
+   * When inputs define the same name, the first keeps it; later ones are
+   * renamed if their own links use them and dropped otherwise
+   * (default: false)
+   */
+  dedupeDestinations?: boolean;
+  /**
+   * Label each page with its input's prefix and its page number within
+   * that input, e.g. "A-1", "A-2", "B-1". true uses letters in merge
+   * order; an array gives each input's prefix, in input order
+   * (default: false)
+   */
+  sourceLabels?: boolean | string[];
+}
+
+/**
+ * Look of the divider pages inserted by mergeWithSeparators()
+ */
+export interface DividerStyle {
+  /** Label size in points; long words are shrunk to fit (default: 28) */
+  fontSize?: number;
+  /** Bold label (default: true) */
+  bold?: boolean;
+  /** Label color as hex (default: '#000000') */
+  textColor?: string;
+  /** Page color as hex (default: none) */
+  background?: string;
+  /** Divider size in points (default: the size of the page that follows) */
+  pageSize?: [number, number];
+}
+
+/**
+ * Options for mergeWithSeparators()
+ */
+export interface SeparatorMergeOptions extends MergeOptions {
+  /** Divider label for each input, in input order (default: the input's name, or "Document n") */
+  labels?: string[];
+  /** Divider styling */
+  style?: DividerStyle;
+  /** Divider content: the input's label, or nothing (default: 'label') */
+  divider?: 'label' | 'blank';
+  /**
+   * PDF whose first page is the background of every divider, which then
+   * takes that page's size unless style.pageSize is set
+   */
+  template?: ArrayBuffer;
+  /** Divider before every input, or only between inputs (default: 'before') */
+  placement?: 'before' | 'between';
+}
+
+/**
+ * Where one input starts in the output of mergeWithSeparators()
+ */
+export interface MergeSourceStart {
+  /** Index of the input in the caller's list (0-indexed) */
+  input: number;
+  /** 1-indexed page of the input's divider (null without one) */
+  divider: number | null;
+  /** 1-indexed page of the input's first page (null for inputs without pages) */
+  firstPage: number | null;
+}
+
+/**
+ * Result of mergeWithSeparators()
+ */
+export interface SeparatorMergeResult extends MergeResult {
+  /** Page count of the output, dividers included */
+  pageCount: number;
+  /** Where each input starts, in merge order */
+  starts: MergeSourceStart[];
+}
+
+/**
+ * Options for mergePdfA()
+ */
+export interface PdfAMergeOptions extends MergeOptions {
+  /** Document title (default: the first input title found) */
+  title?: string;
+}
+
+/**
+ * PDF/A problem found while merging
+ * - inputNotPdfA: an input claims no PDF/A conformance, so its content is unchecked
+ * - outputIntentMissing: no output intent with an ICC profile
+ * - outputIntentConflict: inputs use different output profiles
+ * - identificationMissing, identifierMissing: no PDF/A XMP claim, no trailer /ID
+ * - encrypted, fontNotEmbedded, forbiddenAction, forbiddenAnnotation,
+ *   lzwCompression: content PDF/A forbids
+ */
+export type PdfAIssueCode =
+  | 'inputNotPdfA'
+  | 'outputIntentMissing'
+  | 'outputIntentConflict'
+  | 'identificationMissing'
+  | 'identifierMissing'
+  | 'encrypted'
+  | 'fontNotEmbedded'
+  | 'forbiddenAction'
+  | 'forbiddenAnnotation'
+  | 'lzwCompression';
+
+/**
+ * One PDF/A issue
+ */
+export interface PdfAIssue {
+  code: PdfAIssueCode;
+  message: string;
+  /** Inputs concerned (0-indexed), empty when found in the merged output */
+  inputs: number[];
+  /** True if the output does not conform; false for risks worth checking */
+  blocking: boolean;
+}
+
+/**
+ * Result of mergePdfA()
+ */
+export interface PdfAMergeResult extends MergeResult {
+  /** True if no blocking issue was found (not a full PDF/A validation) */
+  conformant: boolean;
+  /** Conformance each input claims, e.g. 'PDF/A-2B', or null, in input order */
+  inputConformance: Array<string | null>;
+  issues: PdfAIssue[];
+}
+
+/**
+ * Source of one page in the merged document
+ */
+export interface MergePageSource {
+  /** Index of the input in the caller's list (0-indexed) */
+  input: number;
+  /** Page number within that input (1-indexed), or 0 for a divider page */
+  page: number;
+}
+
+/**
+ * Merge result
+ */
+export interface MergeResult {
+  /** Merged PDF as ArrayBuffer */
+  pdf: ArrayBuffer;
+  /** Input indices in the order they were merged */
+  order: number[];
+  /** Source of each output page, in output order */
+  pages: MergePageSource[];
+  /** Layers in the output (preserveLayers only) */
+  layers?: MergeLayer[];
+  /** Named destinations defined by more than one input (dedupeDestinations only) */
+  destinationCollisions?: DestinationCollision[];
+}
+
+/**
+ * Named destination defined by more than one merge input
+ */
+export interface DestinationCollision {
+  /** Name as defined in the inputs */
+  name: string;
+  /** Index of the input whose destination kept the name (0-indexed) */
+  keptInput: number;
+  /** Index of the input with the later definition (0-indexed) */
+  input: number;
+  /** New name of the later definition; absent if it was dropped as unused */
+  renamedTo?: string;
+}
+
+/**
+ * Layer (optional content group) in a merged document
+ */
+export interface MergeLayer {
+  /** Layer name as shown in viewers */
+  name: string;
+  /** Index of the input it came from (0-indexed) */
+  input: number;
+  /** Whether the layer is visible by default */
+  visible: boolean;
+}
+
+/**
+ * Provenance properties read from XMP
+ */
+export interface XmpCreationInfo {
+  /** xmp:CreatorTool */
+  creatorTool?: string;
+  /** pdf:Producer */
+  producer?: string;
+  /** xmp:CreateDate */
+  createDate?: Date;
+  /** xmp:ModifyDate */
+  modifyDate?: Date;
+  /** xmp:MetadataDate */
+  metadataDate?: Date;
+  /** pdf:Trapped */
+  trapped?: string;
+}
+
+/**
+ * Field where the Info dictionary and XMP disagree
+ */
+export interface CreationInfoDiscrepancy {
+  /** Info field name; XMP counterparts are compared against it */
+  field: 'producer' | 'creator' | 'trapped' | 'creationDate' | 'modDate';
+  /** Info value (dates as ISO strings) */
+  info: string;
+  /** XMP value (dates as ISO strings) */
+  xmp: string;
+}
+
+/**
+ * Provenance summary returned by getCreationInfo()
+ */
+export interface CreationInfo {
+  /** Info /Producer */
+  producer?: string;
+  /** Info /Creator */
+  creator?: string;
+  /** Info /CreationDate */
+  creationDate?: Date;
+  /** Info /ModDate */
+  modDate?: Date;
+  /** Info /Trapped ('True', 'False' or 'Unknown') */
+  trapped?: string;
+  /** Whether the document has an XMP metadata stream */
+  hasXmp: boolean;
+  /** XMP provenance properties (absent without XMP) */
+  xmp?: XmpCreationInfo;
+  /** Fields set in both places with different values */
+  discrepancies: CreationInfoDiscrepancy[];
+}
+
+/**
+ * Software that created and modified a document, returned by getProducerChain()
+ */
+export interface ProducerChain {
+  /** Info /Producer */
+  producer?: string;
+  /** Info /Creator */
+  creator?: string;
+  /** XMP pdf:Producer */
+  xmpProducer?: string;
+  /** XMP xmp:CreatorTool */
+  creatorTool?: string;
+  /** xmpMM:History events, oldest first (empty without XMP history) */
+  history: ProducerHistoryEntry[];
+}
+
+/**
+ * One xmpMM:History event
+ */
+export interface ProducerHistoryEntry {
+  /** stEvt:action, e.g. 'created', 'converted', 'saved' */
+  action: string;
+  /** stEvt:softwareAgent */
+  software?: string;
+  /** stEvt:when */
+  when?: Date;
+  /** stEvt:changed, the parts changed (e.g. '/metadata') */
+  changed?: string;
+  /** stEvt:parameters, e.g. 'from application/x-indesign to application/pdf' */
+  parameters?: string;
+}
+
+/**
+ * Element of the tagged structure tree
+ */
+export interface StructElement {
+  /** Structure type as written (e.g. 'H1', 'P', 'Figure', or a custom type) */
+  type: string;
+  /** Standard type the custom type maps to through the RoleMap, if different */
+  role?: string;
+  /** Alternate description (/Alt, or /ActualText when there is no /Alt) */
+  alt?: string;
+  /** Whether a non-empty alternate description is present */
+  hasAlt: boolean;
+  /** Page the element is on (1-indexed), or null if unknown */
+  page: number | null;
+  /** Child elements */
+  children: StructElement[];
+}
+
+/**
+ * Accessibility view of a document's tagging
+ */
+export interface StructTreeReport {
+  /** Whether the document is tagged (has a structure tree and MarkInfo /Marked true) */
+  tagged: boolean;
+  /** Top-level structure elements (empty for untagged documents) */
+  tree: StructElement[];
+  /** Painting operations on pages that are neither tagged nor marked as artifacts */
+  untaggedContentCount: number;
+  /** Figures without alternate text */
+  figuresMissingAlt: StructElement[];
+}
+
+/**
+ * String operand, with bytes kept as Latin-1 characters
+ */
+export interface ContentString {
+  kind: 'string';
+  value: string;
+  hex: boolean;
+}
+
+/**
+ * Dictionary operand (marked-content properties, inline image parameters)
+ */
+export interface ContentDict {
+  kind: 'dict';
+  entries: Record<string, ContentOperand>;
+}
+
+/**
+ * Operand value; names are strings with their leading slash ('/F1')
+ */
+export type ContentOperand =
+  | number
+  | boolean
+  | null
+  | string
+  | ContentString
+  | ContentDict
+  | ContentOperand[];
+
+/**
+ * Content stream operator with its operands
+ */
+export interface ContentOperator {
+  /** Operator keyword (e.g. 'Tf', 'cm', 'Do'); inline images appear as 'BI' */
+  operator: string;
+  /** Operands in stream order */
+  operands: ContentOperand[];
+  /** Size of the inline image data in bytes (operator 'BI' only) */
+  inlineImageBytes?: number;
+}
+
+/**
+ * Options for getContentOperators()
+ */
+export interface ContentOperatorsOptions {
+  /** Page to inspect (1-indexed) */
+  page: number;
+  /** Maximum number of operators to return (default: 10000) */
+  maxOperators?: number;
+}
+
+/**
+ * Decoded content of one page
+ */
+export interface PageContentOperators {
+  /** Page inspected (1-indexed) */
+  page: number;
+  /** Total operators on the page */
+  totalOperators: number;
+  /** True if the list was cut off at maxOperators */
+  truncated: boolean;
+  /** Operators in drawing order */
+  operators: ContentOperator[];
+}
+
+/**
+ * What getPageAsSvg() does with content it can't convert to vectors
+ *
+ * - raster: embed a rendered image of the page, with the text on top
+ *   (transparent, still selectable)
+ * - omit: leave the unconverted content out
+ */
+export type SvgFallback = 'raster' | 'omit';
+
+/**
+ * Options for getPageAsSvg()
+ */
+export interface PageSvgOptions {
+  /** Page to convert (1-indexed) */
+  page: number;
+  /** Handling of unconvertible content (default: 'raster') */
+  fallback?: SvgFallback;
+}
+
+/**
+ * Options for removeMarkedPages()
+ */
+export interface RemoveMarkedPagesOptions {
+  /** Marker image (PNG or JPEG), e.g. a scan of the separator sheet */
+  template: ArrayBuffer | Blob;
+  /** Maximum differing hash bits (of 64) for a page to match (default: 10) */
+  maxDistance?: number;
+}
+
+/**
+ * Page removed because it matched the marker
+ */
+export interface MarkedPage {
+  /** Page number in the input (1-indexed) */
+  page: number;
+  /** Marker that matched */
+  marker: 'template';
+  /** Hash distance to the template (0 = identical) */
+  distance: number;
+}
+
+/**
+ * Result of removeMarkedPages()
+ */
+export interface RemoveMarkedPagesResult {
+  /** The PDF without the marked pages */
+  pdf: ArrayBuffer;
+  /** Removed pages, in input order */
+  removed: MarkedPage[];
+}
+
+/**
+ * QR code error correction level: recovers about 7% (L), 15% (M), 25% (Q)
+ * or 30% (H) of damaged modules
+ */
+export type QrErrorCorrection = 'L' | 'M' | 'Q' | 'H';
+
+/**
+ * Options for createQrCoverSheet()
+ */
+export interface QrCoverOptions {
+  /** Text encoded in the QR code; `{n}` is replaced by the sheet number */
+  payload: string;
+  /** Printed side of the code in points, quiet zone included (default: 216 = 3 in) */
+  size?: number;
+  /** Error correction level (default: 'M') */
+  errorCorrection?: QrErrorCorrection;
+  /** Title printed above the code; `{n}` is replaced by the sheet number */
+  title?: string;
+  /** Sheets to generate, one per page (default: 1) */
+  count?: number;
+  /** Number of the first sheet (default: 1) */
+  start?: number;
+  /** Page size in points (default: A4) */
+  pageSize?: [number, number];
+}
+
+/**
+ * Result of createQrCoverSheet()
+ */
+export interface QrCoverResult {
+  /** The cover sheets, one per page */
+  pdf: ArrayBuffer;
+  /** QR version (1-40), shared by every sheet */
+  version: number;
+  /** Modules per side, without the quiet zone */
+  modules: number;
+  /** Printed side of the code in points, quiet zone included */
+  size: number;
+  /** Side of one module in points */
+  moduleSize: number;
+  /** Encoded payloads, in page order */
+  payloads: string[];
+}
+
+/**
+ * Preset and image settings for one output of generateVariants()
+ */
+export type VariantSettings = Pick<Partial<CompressionOptions>, 'preset' | 'targetDPI' | 'jpegQuality'>;
+
+/**
+ * Named variant for generateVariants()
+ */
+export interface CompressionVariant {
+  /** Key for this variant in the result (e.g. 'web', 'print') */
+  name: string;
+  /** Settings for this variant's image pass */
+  settings: VariantSettings;
+}
+
+/**
+ * One file for compressBatch()
+ */
+export interface BatchFile {
+  /** The PDF file */
+  pdf: ArrayBuffer;
+  /** User or owner password, for encrypted files */
+  password?: string;
+  /** Label copied to the file's result, e.g. its file name */
+  name?: string;
+}
+
+/**
+ * Outcome of one compressBatch() file: its result, or the error it failed with
+ */
+export interface BatchFileResult {
+  /** The file's name, if it had one */
+  name?: string;
+  result?: CompressionResult;
+  error?: CompressionError;
+}
+
+/**
+ * Options for compressForMobile; compression options override the mobile
+ * defaults
+ */
+export interface MobileCompressionOptions extends Partial<CompressionOptions> {
+  /**
+   * Longest page side in points (default: 842, the long side of A4).
+   * Larger pages are scaled down, content and all.
+   */
+  maxPageSize?: number;
+}
+
+/**
+ * Page scaled down by compressForMobile
+ */
+export interface ScaledPage {
+  /** 1-based page number */
+  page: number;
+  /** Factor the page was scaled by (less than 1) */
+  scale: number;
+}
+
+/**
+ * Result of compressForMobile; stats compare against the original input
+ */
+export interface MobileCompressionResult extends CompressionResult {
+  /** Page size cap that was applied, in points */
+  maxPageSize: number;
+  scaledPages: ScaledPage[];
+}
+
+/**
+ * Page boundary box
+ */
+export type PageBoxName = 'MediaBox' | 'CropBox' | 'BleedBox' | 'TrimBox' | 'ArtBox';
+
+/**
+ * Problem with a page's boxes
+ */
+export interface BoxIssue {
+  /** Page number (1-indexed) */
+  page: number;
+  /** Box the problem is reported on */
+  box: PageBoxName;
+  /**
+   * - invalid: not four numbers
+   * - zero-area: zero width or height
+   * - outside-media / outside-crop / outside-bleed: extends beyond that box
+   * - missing: absent where expected (no MediaBox; no TrimBox with a
+   *   BleedBox or when other pages have one)
+   */
+  type: 'invalid' | 'zero-area' | 'outside-media' | 'outside-crop' | 'outside-bleed' | 'missing';
+  /** Human-readable description */
+  message: string;
+}
+
+/**
+ * Page size in points, in displayed orientation
+ */
+export interface TrimSize {
+  width: number;
+  height: number;
+}
+
+/**
+ * Options for normalizeForPrint()
+ */
+export interface PrintNormalizeOptions {
+  /** Trim size to enforce on every page (centered on the existing trim) */
+  trimSize?: TrimSize;
+  /** Bleed margin in points for derived BleedBoxes, clamped to the MediaBox (default: 0) */
+  bleed?: number;
+  /**
+   * Bake page rotation into the content so every page is upright without
+   * a Rotate entry; imposition tools that place pages as XObjects ignore
+   * Rotate and would lay rotated pages out sideways (default: true)
+   */
+  normalizeOrientation?: boolean;
+}
+
+/**
+ * Change made to one page box
+ */
+export interface PageBoxChange {
+  box: PageBoxName;
+  /**
+   * - added: derived because it was missing
+   * - removed: malformed or entirely outside the MediaBox
+   * - clamped: cut back to the box that contains it
+   * - resized: TrimBox set to the target trim size
+   * - expanded: BleedBox grown to contain the TrimBox
+   * - origin-aligned: page moved so the MediaBox starts at 0,0
+   */
+  action: 'added' | 'removed' | 'clamped' | 'resized' | 'expanded' | 'origin-aligned';
+}
+
+/**
+ * Result of normalizeForPrint()
+ */
+export interface PrintNormalizeResult {
+  /** The normalized PDF */
+  pdf: ArrayBuffer;
+  /** Changes per page (pages without changes are omitted) */
+  pages: Array<{ page: number; changes: PageBoxChange[] }>;
+  /** Pages whose trim size differs from the majority */
+  inconsistentPages: number[];
+  /** Pages that could not be normalized, with the reason */
+  failedPages: Array<{ page: number; reason: string }>;
+  /** Pages whose rotation was baked in, with the clockwise rotation they had */
+  reorientedPages: Array<{ page: number; rotation: number }>;
+}
+
+/**
+ * Document overview statistics
+ */
+export interface DocumentStatistics {
+  /** File size in bytes */
+  fileBytes: number;
+  pageCount: number;
+  /** Image XObjects (including soft masks) */
+  imageCount: number;
+  /** Stored (compressed) size of all images in bytes */
+  imageBytes: number;
+  /** Fonts, counting a composite font once */
+  fontCount: number;
+  /** Fonts with embedded font programs (Type 3 fonts count as embedded) */
+  embeddedFontCount: number;
+  annotationCount: number;
+  /** Has AcroForm fields or XFA */
+  hasForms: boolean;
+  /** Has embedded files or file attachment annotations */
+  hasAttachments: boolean;
+  isTagged: boolean;
+  isLinearized: boolean;
+  isEncrypted: boolean;
+  /** The largest objects, biggest first (only with the topObjects option) */
+  largestObjects?: LargeObject[];
+}
+
+/**
+ * Images on one page, returned by getPageImageSummary()
+ */
+export interface PageImageSummary {
+  /** 1-indexed page number */
+  page: number;
+  /** Distinct images drawn, counting each inline image */
+  imageCount: number;
+  /** Stored (compressed) size of the page's image XObjects in bytes; inline images aren't counted */
+  totalImageBytes: number;
+  /**
+   * Highest resolution any image is drawn at, in pixels per inch along
+   * its lower-resolution axis (null without images)
+   */
+  maxEffectiveDPI: number | null;
+}
+
+/**
+ * Options for getStatistics
+ */
+export interface StatisticsOptions {
+  /**
+   * Number of largest objects to list in largestObjects
+   * @default 0
+   */
+  topObjects?: number;
+}
+
+/**
+ * Object listed in DocumentStatistics.largestObjects
+ */
+export interface LargeObject {
+  /** Object reference, e.g. '12 0 R' */
+  object: string;
+  /** What the object is, e.g. 'Image', 'Form', 'FontFile2', 'Contents', 'EmbeddedFile' */
+  type: string;
+  /** Serialized size in bytes (stored, compressed size for streams) */
+  bytes: number;
+  /** Fraction of the file size (0-1) */
+  share: number;
+  /** 1-indexed pages that use the object (empty if no page does) */
+  pages: number[];
+}
+
+/**
+ * Encryption algorithm of an encrypted document
+ */
+export type EncryptionAlgorithm = 'RC4' | 'AES-128' | 'AES-256' | 'none' | 'unknown';
+
+/**
+ * Permissions granted by the P entry (enforced by viewers, not by the crypto)
+ */
+export interface DocumentPermissions {
+  print: boolean;
+  modify: boolean;
+  copy: boolean;
+  annotate: boolean;
+  fillForms: boolean;
+  extractForAccessibility: boolean;
+  assemble: boolean;
+  printHighQuality: boolean;
+}
+
+/**
+ * Encryption settings of a document
+ */
+export interface SecurityInfo {
+  encrypted: boolean;
+  /** Security handler (Filter), usually 'Standard' */
+  handler?: string;
+  /** Encryption dictionary V (algorithm version) */
+  version?: number;
+  /** Standard handler revision (R) */
+  revision?: number;
+  algorithm?: EncryptionAlgorithm;
+  /** Key length in bits */
+  keyLength?: number;
+  /** Whether XMP metadata is encrypted too */
+  encryptMetadata?: boolean;
+  /** True if a password is needed to open the file (undefined if unknown) */
+  userPasswordRequired?: boolean;
+  /** True if the file opens freely and only an owner password restricts it */
+  ownerPasswordOnly?: boolean;
+  permissions?: DocumentPermissions;
+  /** Problems that prevented a full reading (e.g. unsupported handlers) */
+  warnings: string[];
+}
+
+/**
+ * Options for describePermissions
+ */
+export interface DescribePermissionsOptions {
+  /** List only denied or limited permissions (default: false) */
+  restrictionsOnly?: boolean;
+}
+
+/**
+ * How the open page is fitted in the window
+ * - Fit: whole page
+ * - FitH / FitV: page width / height, scrolled to `top` / `left`
+ * - FitB, FitBH, FitBV: the same, fitting the content's bounding box
+ * - XYZ: a zoom factor at a position
+ */
+export type OpenFit = 'Fit' | 'FitH' | 'FitV' | 'FitB' | 'FitBH' | 'FitBV' | 'XYZ';
+
+/**
+ * Options for setOpenAction()
+ */
+export interface OpenActionOptions {
+  /** Page to open on (1-indexed, default: 1) */
+  page?: number;
+  /** Fit mode (default: 'Fit') */
+  fit?: OpenFit;
+  /** XYZ zoom factor, e.g. 1.5 for 150% (default: keep the viewer's zoom) */
+  zoom?: number;
+  /** XYZ, FitH and FitBH: top edge in page coordinates (default: top of the page) */
+  top?: number;
+  /** XYZ, FitV and FitBV: left edge in page coordinates (default: left of the page) */
+  left?: number;
+}
+
+/**
+ * Options for setDates
+ */
+export interface SetDatesOptions {
+  /** ISO 8601 date or date-time for CreationDate / xmp:CreateDate */
+  creationDate?: string;
+  /** ISO 8601 date or date-time for ModDate / xmp:ModifyDate */
+  modDate?: string;
+  /**
+   * Append the changes to the original bytes as an incremental update
+   * instead of rewriting the file (default: false). Keeps diffs small for
+   * versioned storage; the output is never smaller than the input, so don't
+   * combine it with compression.
+   */
+  incremental?: boolean;
+}
+
+/**
+ * Where an external link was found
+ */
+export type ExternalLinkSource = 'annotation' | 'page' | 'bookmark' | 'document';
+
+/**
+ * A URI action (external link)
+ */
+export interface ExternalLink {
+  /** Target URI as written in the document */
+  url: string;
+  /**
+   * 'annotation' for link annotations and other annotation actions,
+   * 'page' for page open/close actions, 'bookmark' for outline items,
+   * 'document' for the open action and document-level triggers
+   */
+  source: ExternalLinkSource;
+  /** 1-indexed page, for annotation and page links */
+  page?: number;
+}
+
+/**
+ * Image extracted by getFirstImage
+ */
+export interface PreviewImage {
+  /** 1-indexed page the image was found on */
+  page: number;
+  /** Width in pixels */
+  width: number;
+  /** Height in pixels */
+  height: number;
+  /**
+   * 'jpeg' and 'jpeg2000' data is a complete image file (usable as a Blob);
+   * 'raw' data is the decoded samples, described by colorSpace and
+   * bitsPerComponent
+   */
+  format: 'jpeg' | 'jpeg2000' | 'raw';
+  data: Uint8Array;
+  /** For raw images, the color space family (e.g. 'DeviceRGB', 'Indexed') */
+  colorSpace?: string;
+  /** For raw images, bits per color component */
+  bitsPerComponent?: number;
+}
+
+/**
+ * Options for getImageSequence
+ */
+export interface ImageSequenceOptions {
+  /**
+   * Share of the page (0-1) a page's only image must cover to stand in
+   * for the page
+   * @default 0.9
+   */
+  minCoverage?: number;
+}
+
+/**
+ * One page of an image sequence
+ */
+export interface ImageSequencePage {
+  /** 1-indexed page number */
+  page: number;
+  /** Page width in points (crop box, before rotation) */
+  pageWidth: number;
+  /** Page height in points (crop box, before rotation) */
+  pageHeight: number;
+  /** Clockwise page rotation in degrees; rotate the image the same way to display it */
+  rotation: number;
+  /** True when the page isn't a single image, so it must be rendered instead */
+  requiresRendering: boolean;
+  /** Why the page must be rendered */
+  reason?: string;
+  /** Image width in pixels */
+  width?: number;
+  /** Image height in pixels */
+  height?: number;
+  /**
+   * Type of data: JPEG and JPEG 2000 images are returned as stored, other
+   * images are converted to PNG. Only some browsers display JPEG 2000.
+   */
+  mimeType?: 'image/jpeg' | 'image/jp2' | 'image/png';
+  /** Complete image file, usable as a Blob */
+  data?: Uint8Array;
+}
+
+/**
+ * Metadata marker recording that this library processed a file
+ */
+export interface ProcessedMarker {
+  /** Info / XMP key the marker is stored under */
+  key: string;
+  /** Package name of the library that wrote it */
+  tool: string;
+  /** Library version that wrote it */
+  version: string;
+  /** When the file was processed */
+  timestamp: Date;
+}
+
+/**
+ * How findDuplicatePages() compares pages
+ * - exact: identical content streams, resources and page geometry
+ * - near: rendered pages with similar perceptual hashes (browser only)
+ */
+export type DuplicatePageMode = 'exact' | 'near';
+
+/**
+ * Options for findDuplicatePages()
+ */
+export interface FindDuplicatePagesOptions {
+  /** Comparison mode (default: 'exact') */
+  mode?: DuplicatePageMode;
+  /** Near mode: maximum differing hash bits (of 64) to the group's first page (default: 4) */
+  maxDistance?: number;
+}
+
+/**
+ * Pages with identical or near-identical content
+ */
+export interface DuplicatePageGroup {
+  /** Page numbers (1-indexed), in document order; the first is the group's reference */
+  pages: number[];
+  /** Largest hash distance to the first page (always 0 in exact mode) */
+  distance: number;
+}
+
+/**
+ * Trailer of the last cross-reference section, for debugging file structure
+ */
+export interface TrailerInfo {
+  /** Number of cross-reference entries (highest object number + 1) */
+  size: number;
+  /** Catalog reference, e.g. '1 0 R' */
+  root?: string;
+  /** Info dictionary reference */
+  info?: string;
+  /** File identifiers (permanent, changing) as hex */
+  id?: [string, string];
+  /** Offset of the previous cross-reference section; set after incremental updates */
+  prev?: number;
+  /** Offset of this cross-reference section (the startxref value) */
+  startXref: number;
+  /** Classic xref table or cross-reference stream (PDF 1.5+) */
+  xrefType: 'table' | 'stream';
+}
+
+/**
+ * Page count from getPageCount()
+ */
+export interface PageCountResult {
+  pageCount: number;
+  /**
+   * 'pageTree' if read from the page tree's /Count without parsing,
+   * 'fullParse' if the file had to be parsed
+   */
+  method: 'pageTree' | 'fullParse';
+}
+
+/**
+ * What repairImages does with images it can't recover
+ * - placeholder: draw a light gray box in the image's place
+ * - drop: draw nothing
+ */
+export type ImageRepairMode = 'placeholder' | 'drop';
+
+/**
+ * Image found broken by repairImages
+ */
+export interface BrokenImage {
+  /** Object reference of the image (e.g. '12 0 R') */
+  object: string;
+  /** Pages drawing the image (1-indexed, empty if only used elsewhere) */
+  pages: number[];
+  /** What is wrong with the data */
+  reason: string;
+}
+
+/**
+ * What repairImages found
+ */
+export interface ImageRepairReport {
+  /** Images rebuilt from their readable part (padded or given a JPEG end marker) */
+  recovered: BrokenImage[];
+  /** Images replaced or removed; broken masks are detached from their image */
+  unrecoverable: BrokenImage[];
+}
+
+/**
+ * Image checked by validateImages()
+ */
+export interface ImageValidation {
+  /** Page the image is used on (1-indexed) */
+  page: number;
+  /** Position among the page's images, forms and soft masks included (0-indexed) */
+  index: number;
+  /** Object reference ("12 0 R"), or null for a direct stream */
+  object: string | null;
+  /** Color space family, e.g. "DeviceRGB" or "ICCBased"; null if absent */
+  colorSpace: string | null;
+  /** Stream filters in decode order */
+  filters: string[];
+  /** Problems compression may run into; empty if none were found */
+  issues: string[];
+}
+
+/**
+ * Options for getImageHistogram()
+ */
+export interface ImageHistogramOptions {
+  /** Page the image is used on (1-indexed) */
+  page: number;
+  /** Position among the page's images, as in validateImages() (0-indexed) */
+  index: number;
+}
+
+/**
+ * What an image's pixel distribution suggests about encoding it
+ * - bilevel: nearly all black and white, suited to CCITT or JBIG2
+ * - graphic: at most 256 colors, lossless with a palette and Flate
+ * - photo: continuous tones, suited to JPEG
+ */
+export type ImageHistogramKind = 'bilevel' | 'graphic' | 'photo';
+
+/**
+ * Luminance distribution of one image, from getImageHistogram()
+ */
+export interface ImageHistogram {
+  /** Page the image is used on (1-indexed) */
+  page: number;
+  /** Position among the page's images (0-indexed) */
+  index: number;
+  /** Object reference ("12 0 R"), or null for a direct stream */
+  object: string | null;
+  /** Width in pixels */
+  width: number;
+  /** Height in pixels */
+  height: number;
+  /** Color space family, e.g. "DeviceRGB"; null if absent (image masks) */
+  colorSpace: string | null;
+  /** Pixel counts for each luminance level (256 entries, 0 = black) */
+  histogram: number[];
+  /** Mean luminance (0-255) */
+  mean: number;
+  /** Standard deviation of luminance */
+  stddev: number;
+  /** Distinct colors in the image's own color space */
+  uniqueColors: number;
+  /** What the distribution suggests */
+  kind: ImageHistogramKind;
+}
+
+/**
+ * What dedupeICCProfiles collapsed
+ */
+export interface IccDedupeReport {
+  /** Duplicate profile objects no longer referenced */
+  profilesRemoved: number;
+  /** Stored bytes of those profiles */
+  bytesSaved: number;
+}
+
+/**
+ * What normalizeEncoding changed
+ */
+export interface FontEncodingReport {
+  /** Fonts whose ToUnicode map or encoding was rewritten */
+  normalized: NormalizedFont[];
+  /** Fonts left alone because normalizing them couldn't be done safely */
+  skipped: SkippedFont[];
+}
+
+/**
+ * One font normalized by normalizeEncoding
+ */
+export interface NormalizedFont {
+  /** BaseFont name, or null if missing */
+  font: string | null;
+  /** Font dictionary reference, e.g. '12 0 R' */
+  object: string;
+  /** True if a /Differences array that restated WinAnsiEncoding was replaced by it */
+  standardEncoding: boolean;
+  /** Codes whose ToUnicode entry was rewritten or added from the glyph name */
+  toUnicodeFixed: number;
+}
+
+/**
+ * One font normalizeEncoding left alone
+ */
+export interface SkippedFont {
+  /** BaseFont name, or null if missing */
+  font: string | null;
+  /** Font dictionary reference, e.g. '12 0 R' */
+  object: string;
+  /** Why the font was skipped */
+  reason: string;
+}
+
+/**
+ * How extractText() arranges page text
+ * - reading: logical order; columns are read one after another
+ * - raw: content-stream order, as the generator wrote it
+ * - layout: spaces and line breaks approximate the page's positions, with
+ *   columns side by side
+ */
+export type TextLayoutMode = 'reading' | 'raw' | 'layout';
+
+/**
+ * Options for extractText()
+ */
+export interface ExtractTextOptions {
+  /** Layout mode (default: 'reading') */
+  layout?: TextLayoutMode;
+}
+
+/**
+ * Text of one page
+ */
+export interface PageText {
+  /** Page number (1-indexed) */
+  page: number;
+  text: string;
+}
+
+/**
+ * Options for extractWords()
+ */
+export interface ExtractWordsOptions {
+  /** Page to read (1-indexed) */
+  page: number;
+}
+
+/**
+ * Word with its bounding box in PDF user space (y up)
+ */
+export interface WordBox {
+  text: string;
+  /** Left edge */
+  x: number;
+  /** Bottom edge */
+  y: number;
+  width: number;
+  height: number;
+}
+
+/**
+ * How detectBlankPages() decides a page is blank
+ * - text: no extractable text and images covering under 5% of the page
+ * - pixels: a rendering with under 0.5% inked pixels (browser only)
+ * - both: blank by both methods
+ */
+export type BlankPageMethod = 'text' | 'pixels' | 'both';
+
+/**
+ * Options for detectBlankPages()
+ */
+export interface BlankPageOptions {
+  /** Detection method (default: 'both') */
+  method?: BlankPageMethod;
+}
+
+/**
+ * Blank page decision for one page, with the measurements behind it
+ */
+export interface BlankPageDecision {
+  /** 1-indexed page number */
+  page: number;
+  blank: boolean;
+  /** Whether the page has extractable text (text and both) */
+  hasText?: boolean;
+  /** Share of the page covered by images, 0-1 (text and both) */
+  imageCoverage?: number;
+  /** Share of rendered pixels that are inked, 0-1 (pixels and both) */
+  inkShare?: number;
+}
+
+/**
+ * Result of detectBlankPages()
+ */
+export interface BlankPageReport {
+  method: BlankPageMethod;
+  pages: BlankPageDecision[];
+  /** 1-indexed numbers of the blank pages */
+  blankPages: number[];
+}
+
+/**
+ * Text metrics from getTextStats()
+ */
+export interface TextStats {
+  /** Words across all pages */
+  wordCount: number;
+  /** Characters in those words, whitespace excluded */
+  charCount: number;
+  /** Pages with at least one word */
+  pagesWithText: number;
+  /** Pages without words that draw images (scans needing OCR) */
+  pagesImageOnly: number;
+}
+
+/**
+ * Words of one page, from extractWords()
+ */
+export interface PageWords {
+  /** Page number (1-indexed) */
+  page: number;
+  /** Visible area (crop box) as [x1, y1, x2, y2] in user space */
+  viewBox: number[];
+  /** Width of the visible area, before rotation */
+  width: number;
+  /** Height of the visible area, before rotation; screen y is viewBox[3] - y - height */
+  height: number;
+  /** Page rotation in degrees clockwise (0, 90, 180 or 270) */
+  rotation: number;
+  /**
+   * Whether the boxes already include the page rotation. Always false:
+   * boxes are in unrotated user space, so rotate them with the rendered
+   * image when rotation isn't 0
+   */
+  rotationApplied: false;
+  /** Words in content order (empty for image-only pages) */
+  words: WordBox[];
+}
+
+/**
+ * Result of extractText()
+ */
+export interface TextExtraction {
+  /** Layout mode used */
+  mode: TextLayoutMode;
+  /** Every page, in order (empty text for pages without text) */
+  pages: PageText[];
+}
+
+/**
+ * Options for flattenAnnotations()
+ */
+export interface FlattenAnnotationsOptions {
+  /**
+   * Annotation subtypes to flatten (default: markup types such as
+   * Highlight, FreeText, Stamp, Ink, Square, Line)
+   */
+  subtypes?: string[];
+  /**
+   * Re-deflate the flattened appearance streams (and forms they use),
+   * keeping each only if smaller. Default: false
+   */
+  compressAppearances?: boolean;
+}
+
+/**
+ * Result of flattenAnnotations()
+ */
+export interface FlattenAnnotationsResult extends AnnotationFlattenReport {
+  /** The PDF with the annotations drawn into the page content */
+  pdf: ArrayBuffer;
+}
+
+/**
+ * Annotation counts of one page
+ */
+export interface PageAnnotationStats {
+  /** Page number (1-indexed) */
+  page: number;
+  total: number;
+  /** Count per subtype present on the page (e.g. { Link: 3, Highlight: 1 }) */
+  bySubtype: Record<string, number>;
+}
+
+/**
+ * Result of getAnnotationStats()
+ */
+export interface AnnotationStats {
+  total: number;
+  /** Count per subtype; every standard subtype is listed, zero if absent */
+  bySubtype: Record<string, number>;
+  /** Every page, in order, including pages without annotations */
+  pages: PageAnnotationStats[];
+}
+
+/**
+ * Which images maxImagesToProcess let through
+ */
+export interface ImageLimitReport {
+  /** Object references (e.g. '12 0 R') of the images processed, largest first */
+  processed: string[];
+  /** Images left untouched, largest first */
+  skipped: string[];
+}
+
+/**
+ * Options for prepareForOcr()
+ */
+export interface OcrPrepareOptions {
+  /** Resolution pages are rendered at, 72-600 (default: 300) */
+  dpi?: number;
+  /** Store pages as 8-bit gray; false keeps RGB color (default: true) */
+  grayscale?: boolean;
+}
+
+/**
+ * One page rendered by prepareForOcr()
+ */
+export interface OcrPreparedPage {
+  /** 1-indexed page number */
+  page: number;
+  /** Image size in pixels */
+  width: number;
+  height: number;
+  /** Resolution used; lower than requested for pages too large to render at it */
+  dpi: number;
+}
+
+/**
+ * Result of trimTrailingData()
+ */
+export interface TrimTrailingDataResult {
+  /** The file without the trailing bytes (the input itself if there were none) */
+  pdf: ArrayBuffer;
+  /** Bytes removed after the last %%EOF */
+  bytesRemoved: number;
+}
+
+/**
+ * Options for upgradeEncryption()
+ */
+export interface UpgradeEncryptionOptions {
+  /** The owner password; it also recovers the user password */
+  ownerPassword: string;
+}
+
+/**
+ * Result of upgradeEncryption()
+ */
+export interface UpgradeEncryptionResult {
+  /** The AES-256 encrypted file (the input itself if it already was) */
+  pdf: ArrayBuffer;
+  /** Encryption algorithm before the upgrade */
+  previousAlgorithm: EncryptionAlgorithm;
+  /** False if the document already used AES-256 */
+  upgraded: boolean;
+}
+
+/**
+ * Encryption policy for encryptBatch(), applied to every file
+ */
+export interface EncryptBatchOptions {
+  /** Password needed to open the files (default: '', so they open freely) */
+  userPassword?: string;
+  /** Password that lifts the permission restrictions; must not be empty */
+  ownerPassword: string;
+  /** Permissions to grant; omitted ones are allowed (default: all allowed) */
+  permissions?: Partial<DocumentPermissions>;
+  /** Key length in bits; only 256 (AES-256) is written (default: 256) */
+  keyLength?: 256;
+  /** Encrypt XMP metadata as well, hiding it from search indexers (default: true) */
+  encryptMetadata?: boolean;
+}
+
+/**
+ * One file for encryptBatch()
+ */
+export interface EncryptBatchFile {
+  /** The PDF file */
+  pdf: ArrayBuffer;
+  /** Label copied to the file's result, e.g. its file name */
+  name?: string;
+}
+
+/**
+ * Outcome of one encryptBatch() file: the encrypted file, or the error it failed with
+ */
+export interface EncryptBatchFileResult {
+  /** The file's name, if it had one */
+  name?: string;
+  pdf?: ArrayBuffer;
+  error?: CompressionError;
+}
+
+/**
+ * Result of setLanguage()
+ */
+export interface SetLanguageResult {
+  pdf: ArrayBuffer;
+  /** Language tag that was replaced, or null if none was set */
+  previous: string | null;
+}
+
+/**
+ * Result of prepareForOcr()
+ */
+export interface OcrPrepareResult {
+  /** Image-only PDF, one image per page */
+  pdf: ArrayBuffer;
+  pages: OcrPreparedPage[];
+}
+
+/**
+ * Recognized words of one page, for addTextLayer()
+ */
+export interface TextLayerPage {
+  /** 1-indexed page number */
+  page: number;
+  /**
+   * Word boxes: in user space (origin bottom left, y up) like
+   * extractWords(), or in image pixels (origin top left) when imageWidth
+   * and imageHeight are given
+   */
+  words: WordBox[];
+  /** Width in pixels of the image OCR ran on, which covers the crop box */
+  imageWidth?: number;
+  /** Height in pixels of the image OCR ran on */
+  imageHeight?: number;
+}
+
+/**
+ * Options for addTextLayer()
+ */
+export interface TextLayerOptions {
+  /** Words per page; pages not listed are left alone */
+  layers: TextLayerPage[];
+}
+
+/**
+ * Options for setTabOrder()
+ */
+export interface TabOrderOptions {
+  /**
+   * Fully qualified field names in tab order, keyed by 1-indexed page
+   * number (e.g. { 1: ['name', 'address.city', 'submit'] })
+   */
+  order: Record<number, string[]>;
+}
+
+/**
+ * Options for updateFormAppearances()
+ */
+export interface FormAppearanceOptions {
+  /**
+   * Rebuild every field's appearance from its value (default: true).
+   * With false, appearances are left as-is and NeedAppearances is set so
+   * viewers rebuild them; some viewers ignore it and show stale values.
+   */
+  regenerateAppearances?: boolean;
+}
+
+/**
+ * Field whose appearance couldn't be rebuilt
+ */
+export interface FormAppearanceFailure {
+  /** Fully qualified field name */
+  field: string;
+  reason: string;
+}
+
+/**
+ * Result of updateFormAppearances()
+ */
+export interface FormAppearanceResult {
+  /** The updated PDF (unchanged for documents without a form) */
+  pdf: ArrayBuffer;
+  /** Fields whose appearances were rebuilt */
+  regenerated: string[];
+  /** Fields left with their old appearance */
+  failed: FormAppearanceFailure[];
+  /** Whether the output asks viewers to rebuild appearances */
+  needAppearances: boolean;
+}
+
 /**
  * Worker message types
  */
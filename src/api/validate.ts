@@ -0,0 +1,31 @@
+/**
+ * Shared argument validation for the public API
+ */
+
+/**
+ * Throws if the value is not a non-empty ArrayBuffer
+ */
+export function assertPdfBuffer(pdfBuffer: unknown, name = 'pdfBuffer'): asserts pdfBuffer is ArrayBuffer {
+  if (!(pdfBuffer instanceof ArrayBuffer)) {
+    throw new TypeError(`${name} must be an ArrayBuffer`);
+  }
+
+  if (pdfBuffer.byteLength === 0) {
+    throw new TypeError(`${name} must not be empty`);
+  }
+}
+
+/**
+ * Parses a CSS-style hex color ('#rgb' or '#rrggbb') into 0-1 RGB components
+ */
+export function parseHexColor(color: string, name: string): [number, number, number] {
+  const match = /^#?([0-9a-f]{3}|[0-9a-f]{6})$/i.exec(color.trim());
+  if (!match) {
+    throw new TypeError(`Invalid ${name}: ${color}. Must be a hex color like '#ffffff'.`);
+  }
+
+  const hex = match[1].length === 3
+    ? match[1].split('').map(c => c + c).join('')
+    : match[1];
+  return [0, 2, 4].map(i => parseInt(hex.slice(i, i + 2), 16) / 255) as [number, number, number];
+}
@@ -0,0 +1,167 @@
+/**
+ * Action chain editing
+ *
+ * Actions live under OpenAction, A and additional-actions (AA) triggers,
+ * and each can chain further actions through Next (a single action or an
+ * array). These helpers walk such chains and splice actions out.
+ */
+
+import { PDFArray, PDFContext, PDFDict, PDFDocument, PDFName, PDFNull, PDFNumber, PDFObject, PDFRef } from 'pdf-lib';
+import type { OpenFit } from '../api/types';
+import { lookupDict, lookupName } from './pdf-objects';
+
+/** Named actions every viewer treats as plain navigation */
+const NAVIGATION_ACTIONS = new Set(['NextPage', 'PrevPage', 'FirstPage', 'LastPage']);
+
+/** Annotation triggers that fire when the page is shown */
+const PAGE_SHOWN_TRIGGERS = ['PO', 'PV'];
+
+/**
+ * Decides whether to remove an action; may also record it
+ */
+export type ActionFilter = (action: PDFDict) => boolean;
+
+/**
+ * Filters the action chain stored under a key, deleting the key if
+ * nothing remains
+ */
+export function filterActionEntry(holder: PDFDict, key: string, remove: ActionFilter): void {
+  const name = PDFName.of(key);
+  const value = holder.get(name);
+  if (value === undefined) return;
+
+  if (filterActionChain(holder.context, value, remove) === undefined) holder.delete(name);
+}
+
+/**
+ * Filters the actions of an additional-actions (AA) dictionary, deleting
+ * it if it ends up empty
+ *
+ * @param triggers - Trigger keys to filter (default: all)
+ */
+export function filterTriggerActions(holder: PDFDict, remove: ActionFilter, triggers?: string[]): void {
+  const actions = lookupDict(holder, 'AA');
+  if (!actions) return;
+
+  const keys = triggers ?? actions.keys().map(key => key.decodeText());
+  for (const key of keys) filterActionEntry(actions, key, remove);
+  if (actions.keys().length === 0) holder.delete(PDFName.of('AA'));
+}
+
+/**
+ * Filters an action and its Next chain
+ *
+ * Values that aren't action dictionaries (such as destination arrays
+ * under OpenAction) are kept without calling the filter.
+ *
+ * @returns The value to keep in place of `value`: unchanged, or the chain
+ * with removed actions spliced out (undefined if nothing remains)
+ */
+export function filterActionChain(
+  context: PDFContext,
+  value: PDFObject,
+  remove: ActionFilter,
+  chain: Set<PDFDict> = new Set()
+): PDFObject | undefined {
+  const action = value instanceof PDFRef ? context.lookup(value) : value;
+  // Actions shared between holders are visited once per holder; chain
+  // only guards against Next loops
+  if (!(action instanceof PDFDict) || chain.has(action)) return value;
+  chain.add(action);
+
+  const removeThis = remove(action);
+
+  const nextName = PDFName.of('Next');
+  const next = action.get(nextName);
+  let keptNext: PDFObject | undefined;
+  if (next !== undefined) {
+    const nextValue = next instanceof PDFRef ? context.lookup(next) : next;
+    if (nextValue instanceof PDFArray) {
+      const items = nextValue.asArray();
+      const kept = items.map(item => filterActionChain(context, item, remove, chain));
+      const remaining = kept.filter((item): item is PDFObject => item !== undefined);
+      if (kept.every((item, i) => item === items[i])) keptNext = next;
+      else if (remaining.length > 1) keptNext = context.obj(remaining);
+      else keptNext = remaining[0];
+    } else {
+      keptNext = filterActionChain(context, next, remove, chain);
+    }
+
+    if (keptNext === undefined) action.delete(nextName);
+    else if (keptNext !== next) action.set(nextName, keptNext);
+  }
+
+  return removeThis ? keptNext : value;
+}
+
+/**
+ * Removes actions that run when the document or a page opens and could
+ * prompt or take over the viewer: JavaScript, Launch, and named actions
+ * other than page navigation (e.g. Print, FullScreen). Full-screen page
+ * mode is reset too. GoTo actions and plain destinations are kept.
+ */
+export function removePromptingActions(pdfDoc: PDFDocument): void {
+  const catalog = pdfDoc.catalog;
+
+  filterActionEntry(catalog, 'OpenAction', isPromptingAction);
+  filterTriggerActions(catalog, isPromptingAction);
+  if (lookupName(catalog, 'PageMode') === 'FullScreen') catalog.delete(PDFName.of('PageMode'));
+
+  for (const page of pdfDoc.getPages()) {
+    filterTriggerActions(page.node, isPromptingAction);
+
+    const annots = page.node.Annots();
+    if (!annots) continue;
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      if (annot instanceof PDFDict) filterTriggerActions(annot, isPromptingAction, PAGE_SHOWN_TRIGGERS);
+    }
+  }
+}
+
+function isPromptingAction(action: PDFDict): boolean {
+  switch (lookupName(action, 'S')) {
+    case 'JavaScript':
+    case 'Launch':
+      return true;
+    case 'Named':
+      return !NAVIGATION_ACTIONS.has(lookupName(action, 'N') ?? '');
+    default:
+      return false;
+  }
+}
+
+/**
+ * Sets the destination shown when the document opens, replacing any
+ * open action (JavaScript included)
+ *
+ * Unset XYZ/FitH top and XYZ/FitV left default to the crop box's top and
+ * left edges, so the page opens scrolled to its start; an unset XYZ zoom
+ * keeps the viewer's zoom.
+ */
+export function setOpenDestination(
+  pdfDoc: PDFDocument,
+  pageIndex: number,
+  fit: OpenFit,
+  position: { zoom?: number; top?: number; left?: number } = {}
+): void {
+  const page = pdfDoc.getPage(pageIndex);
+  const box = page.getCropBox();
+  const top = PDFNumber.of(position.top ?? box.y + box.height);
+  const left = PDFNumber.of(position.left ?? box.x);
+
+  const dest = PDFArray.withContext(pdfDoc.context);
+  dest.push(page.ref);
+  dest.push(PDFName.of(fit));
+  if (fit === 'XYZ') {
+    dest.push(left);
+    dest.push(top);
+    dest.push(position.zoom === undefined ? PDFNull : PDFNumber.of(position.zoom));
+  } else if (fit === 'FitH' || fit === 'FitBH') {
+    dest.push(top);
+  } else if (fit === 'FitV' || fit === 'FitBV') {
+    dest.push(left);
+  }
+
+  pdfDoc.catalog.set(PDFName.of('OpenAction'), dest);
+}
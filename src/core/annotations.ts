@@ -0,0 +1,249 @@
+/**
+ * Annotation flattening
+ *
+ * Draws an annotation's normal appearance into the page content and
+ * removes the annotation, so it prints and can't be edited. Also counts
+ * annotations for inspection.
+ */
+
+import { PDFArray, PDFContext, PDFDict, PDFDocument, PDFName, PDFNumber, PDFPage, PDFRawStream, PDFRef, PDFStream } from 'pdf-lib';
+import type { AnnotationFlattenReport, AnnotationStats, PageAnnotationStats } from '../api/types';
+import { multiplyMatrix } from './page-analysis';
+import type { Matrix } from './page-analysis';
+import { appendContent } from './pages';
+import { decodeStreamContents, lookupArray, lookupDict, lookupName, lookupNumber, toNumberArray } from './pdf-objects';
+
+/** Annotation flag: not displayed or printed */
+export const HIDDEN_FLAG = 1 << 1;
+
+/**
+ * Markup annotation subtypes
+ */
+export const MARKUP_SUBTYPES = [
+  'Highlight', 'Underline', 'StrikeOut', 'Squiggly', 'FreeText', 'Stamp',
+  'Ink', 'Square', 'Circle', 'Line', 'Polygon', 'PolyLine',
+];
+
+/**
+ * Annotation subtypes defined by the PDF specification
+ */
+export const STANDARD_SUBTYPES = [
+  'Text', 'Link', 'FreeText', 'Line', 'Square', 'Circle', 'Polygon', 'PolyLine',
+  'Highlight', 'Underline', 'Squiggly', 'StrikeOut', 'Caret', 'Stamp', 'Ink', 'Popup',
+  'FileAttachment', 'Sound', 'Movie', 'Screen', 'Widget', 'PrinterMark', 'TrapNet',
+  'Watermark', '3D', 'Redact', 'Projection', 'RichMedia',
+];
+
+/**
+ * Counts annotations by subtype, per page and for the whole document
+ *
+ * Document totals list every standard subtype (zero if absent) plus any
+ * non-standard ones found; page totals list only subtypes present.
+ * Annotations without a subtype count as 'Unknown'.
+ */
+export function countAnnotations(pdfDoc: PDFDocument): AnnotationStats {
+  const bySubtype: Record<string, number> = Object.fromEntries(STANDARD_SUBTYPES.map(subtype => [subtype, 0]));
+  const stats: AnnotationStats = { total: 0, bySubtype, pages: [] };
+
+  pdfDoc.getPages().forEach((page, index) => {
+    const pageStats: PageAnnotationStats = { page: index + 1, total: 0, bySubtype: {} };
+    stats.pages.push(pageStats);
+
+    const annots = page.node.Annots();
+    if (!annots) return;
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      if (!(annot instanceof PDFDict)) continue;
+
+      const subtype = lookupName(annot, 'Subtype') ?? 'Unknown';
+      pageStats.bySubtype[subtype] = (pageStats.bySubtype[subtype] ?? 0) + 1;
+      pageStats.total++;
+      bySubtype[subtype] = (bySubtype[subtype] ?? 0) + 1;
+      stats.total++;
+    }
+  });
+
+  return stats;
+}
+
+/**
+ * Flattens annotations of the given subtypes on every page
+ *
+ * Hidden annotations are left alone; annotations without an appearance
+ * stream can't be drawn and are counted as skipped. Popups belonging to a
+ * flattened annotation are removed with it.
+ *
+ * @param compressAppearances - Also re-deflate the drawn appearance
+ *   streams and the forms they use, keeping each only if smaller
+ */
+export function flattenAnnotations(
+  pdfDoc: PDFDocument,
+  subtypes: Set<string>,
+  compressAppearances = false
+): AnnotationFlattenReport {
+  const report: AnnotationFlattenReport = { flattened: 0, skipped: 0 };
+  const appearances = new Set<PDFRef>();
+
+  for (const page of pdfDoc.getPages()) {
+    const annots = page.node.Annots();
+    if (!annots) continue;
+
+    const operators: string[] = [];
+    const removed = new Set<PDFDict>();
+
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      if (!(annot instanceof PDFDict)) continue;
+
+      const subtype = lookupName(annot, 'Subtype');
+      if (!subtype || !subtypes.has(subtype)) continue;
+      if (((lookupNumber(annot, 'F') ?? 0) & HIDDEN_FLAG) !== 0) continue;
+
+      const drawn = drawAppearance(page, annot);
+      if (!drawn) {
+        report.skipped++;
+        continue;
+      }
+
+      operators.push(drawn.operators);
+      appearances.add(drawn.ref);
+      removed.add(annot);
+      const popup = annot.lookup(PDFName.of('Popup'));
+      if (popup instanceof PDFDict) removed.add(popup);
+      report.flattened++;
+    }
+
+    if (operators.length === 0) continue;
+
+    appendContent(page, operators.join(''));
+    removeAnnotations(page, annots, removed);
+  }
+
+  if (compressAppearances) {
+    report.appearanceBytesSaved = 0;
+    const visited = new Set<PDFRef>();
+    for (const ref of appearances) report.appearanceBytesSaved += recompressForm(pdfDoc.context, ref, visited);
+  }
+
+  return report;
+}
+
+/**
+ * Returns operators drawing the annotation's normal appearance in its
+ * rectangle, registering the appearance as a page XObject
+ */
+function drawAppearance(page: PDFPage, annot: PDFDict): { operators: string; ref: PDFRef } | undefined {
+  const placed = placeAppearance(annot);
+  if (!placed) return undefined;
+
+  // Appearances are Form XObjects; some writers omit the Subtype
+  placed.stream.dict.set(PDFName.of('Subtype'), PDFName.of('Form'));
+
+  page.node.normalize();
+  const name = page.node.newXObject('FlatAnnot', placed.ref);
+  return { operators: `q ${placed.matrix.map(formatNumber).join(' ')} cm /${name.decodeText()} Do Q\n`, ref: placed.ref };
+}
+
+/**
+ * Finds the annotation's normal appearance and the matrix that places it
+ *
+ * @returns The appearance stream, and the matrix mapping its transformed
+ *   BBox onto the annotation rectangle (to be applied after the stream's
+ *   own Matrix), or undefined if it has no usable appearance
+ */
+export function placeAppearance(annot: PDFDict): { stream: PDFStream; ref: PDFRef; matrix: Matrix } | undefined {
+  const appearance = getNormalAppearance(annot);
+  const rectArray = lookupArray(annot, 'Rect');
+  if (!appearance || !rectArray || rectArray.size() !== 4) return undefined;
+
+  const [rx1, ry1, rx2, ry2] = toNumberArray(rectArray);
+  const bboxArray = lookupArray(appearance.stream.dict, 'BBox');
+  if (!bboxArray || bboxArray.size() !== 4) return undefined;
+
+  // Map the transformed appearance box onto the annotation rectangle
+  const matrixArray = lookupArray(appearance.stream.dict, 'Matrix');
+  const formMatrix: Matrix = matrixArray && matrixArray.size() === 6
+    ? toNumberArray(matrixArray) as Matrix
+    : [1, 0, 0, 1, 0, 0];
+  const [bx1, by1, bx2, by2] = toNumberArray(bboxArray);
+  const corners = [[bx1, by1], [bx2, by1], [bx1, by2], [bx2, by2]].map(([x, y]) => multiplyMatrix([1, 0, 0, 1, x, y], formMatrix));
+  const xs = corners.map(corner => corner[4]);
+  const ys = corners.map(corner => corner[5]);
+  const [minX, maxX, minY, maxY] = [Math.min(...xs), Math.max(...xs), Math.min(...ys), Math.max(...ys)];
+  if (maxX - minX === 0 || maxY - minY === 0) return undefined;
+
+  const left = Math.min(rx1, rx2);
+  const bottom = Math.min(ry1, ry2);
+  const scaleX = (Math.max(rx1, rx2) - left) / (maxX - minX);
+  const scaleY = (Math.max(ry1, ry2) - bottom) / (maxY - minY);
+
+  return {
+    ...appearance,
+    matrix: [scaleX, 0, 0, scaleY, left - minX * scaleX, bottom - minY * scaleY],
+  };
+}
+
+function getNormalAppearance(annot: PDFDict): { stream: PDFStream; ref: PDFRef } | undefined {
+  const appearances = lookupDict(annot, 'AP');
+  if (!appearances) return undefined;
+
+  let normal = appearances.get(PDFName.of('N'));
+  let resolved = normal && annot.context.lookup(normal);
+
+  // Appearance state dictionaries select by /AS
+  if (resolved instanceof PDFDict) {
+    const state = annot.lookup(PDFName.of('AS'));
+    normal = state instanceof PDFName ? resolved.get(state) : undefined;
+    resolved = normal && annot.context.lookup(normal);
+  }
+
+  if (!(resolved instanceof PDFStream) || !(normal instanceof PDFRef)) return undefined;
+  return { stream: resolved, ref: normal };
+}
+
+/**
+ * Re-deflates a form XObject and the forms in its resources, replacing
+ * each only where the result is smaller
+ *
+ * @returns Stored bytes saved
+ */
+function recompressForm(context: PDFContext, ref: PDFRef, visited: Set<PDFRef>): number {
+  if (visited.has(ref)) return 0;
+  visited.add(ref);
+  const stream = context.lookup(ref);
+  if (!(stream instanceof PDFRawStream)) return 0;
+
+  let saved = 0;
+  const resources = lookupDict(stream.dict, 'Resources');
+  const xObjects = resources && lookupDict(resources, 'XObject');
+  for (const [, value] of xObjects?.entries() ?? []) {
+    const form = context.lookup(value);
+    if (value instanceof PDFRef && form instanceof PDFStream && lookupName(form.dict, 'Subtype') === 'Form') {
+      saved += recompressForm(context, value, visited);
+    }
+  }
+
+  const data = decodeStreamContents(stream);
+  if (!data) return saved;
+  const compressed = context.flateStream(data);
+  if (compressed.contents.length >= stream.contents.length) return saved;
+
+  const dict = stream.dict.clone(context);
+  dict.delete(PDFName.of('DecodeParms'));
+  dict.set(PDFName.of('Filter'), PDFName.of('FlateDecode'));
+  dict.set(PDFName.of('Length'), PDFNumber.of(compressed.contents.length));
+  context.assign(ref, PDFRawStream.of(dict, compressed.contents));
+  return saved + stream.contents.length - compressed.contents.length;
+}
+
+function removeAnnotations(page: PDFPage, annots: PDFArray, removed: Set<PDFDict>): void {
+  for (let i = annots.size() - 1; i >= 0; i--) {
+    const annot = annots.lookup(i);
+    if (annot instanceof PDFDict && removed.has(annot)) annots.remove(i);
+  }
+  if (annots.size() === 0) page.node.delete(PDFName.of('Annots'));
+}
+
+function formatNumber(value: number): string {
+  return Number.isInteger(value) ? String(value) : value.toFixed(4);
+}
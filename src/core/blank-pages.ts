@@ -0,0 +1,45 @@
+/**
+ * Blank page detection
+ *
+ * A page can look blank and still carry content (white-on-white, text
+ * clipped away) or have no content and still show something (a scanned
+ * sheet with specks). Two signals are combined: what the page draws, and
+ * how much ink a rendering of it shows.
+ */
+
+import type { PDFPage } from 'pdf-lib';
+import { analyzePage, imageCoverage } from './page-analysis';
+
+/** Longest side of the rendering inspected for ink, in pixels */
+export const BLANK_RENDER_SIZE = 256;
+
+/** Luminance below which a rendered pixel counts as ink */
+const INK_LUMINANCE = 230;
+
+/** Share of inked pixels up to which a rendering counts as blank (scanner specks) */
+export const MAX_BLANK_INK = 0.005;
+
+/** Share of the page images may cover and still count as insignificant */
+export const MAX_BLANK_IMAGE_COVERAGE = 0.05;
+
+/**
+ * Share of a page covered by images, from its content
+ */
+export function pageImageCoverage(page: PDFPage): number {
+  return imageCoverage(page, analyzePage(page).images);
+}
+
+/**
+ * Share of a rendering's pixels dark enough to be ink
+ */
+export function inkShare(canvas: HTMLCanvasElement): number {
+  const context = canvas.getContext('2d');
+  if (!context) throw new Error('Failed to get canvas context');
+
+  const { data } = context.getImageData(0, 0, canvas.width, canvas.height);
+  let inked = 0;
+  for (let i = 0; i < data.length; i += 4) {
+    if (0.299 * data[i] + 0.587 * data[i + 1] + 0.114 * data[i + 2] < INK_LUMINANCE) inked++;
+  }
+  return inked / Math.max(1, data.length / 4);
+}
@@ -0,0 +1,116 @@
+/**
+ * Page box consistency checks for prepress
+ */
+
+import { PDFArray, PDFDocument, PDFNumber } from 'pdf-lib';
+import type { BoxIssue, PageBoxName } from '../api/types';
+
+/** Boxes may overshoot by this much (points) before it counts */
+export const TOLERANCE = 0.01;
+
+/**
+ * Normalized rectangle (left < right, bottom < top)
+ */
+export interface Rect {
+  left: number;
+  bottom: number;
+  right: number;
+  top: number;
+}
+
+/**
+ * Checks every page's boxes against each other
+ */
+export function checkPageBoxes(pdfDoc: PDFDocument): BoxIssue[] {
+  const issues: BoxIssue[] = [];
+  const pages = pdfDoc.getPages();
+  const anyTrimBox = pages.some(page => page.node.TrimBox() !== undefined);
+
+  pages.forEach((page, index) => {
+    const pageNum = index + 1;
+    const add = (box: PageBoxName, type: BoxIssue['type'], message: string) =>
+      issues.push({ page: pageNum, box, type, message });
+
+    const boxes: Partial<Record<PageBoxName, Rect>> = {};
+    const raw: Record<PageBoxName, PDFArray | undefined> = {
+      MediaBox: page.node.MediaBox(),
+      CropBox: page.node.CropBox(),
+      BleedBox: page.node.BleedBox(),
+      TrimBox: page.node.TrimBox(),
+      ArtBox: page.node.ArtBox(),
+    };
+
+    for (const [name, array] of Object.entries(raw) as Array<[PageBoxName, PDFArray | undefined]>) {
+      if (!array) continue;
+      const rect = toRect(array);
+      if (!rect) {
+        add(name, 'invalid', `${name} is not an array of four numbers`);
+      } else if (rect.right - rect.left <= TOLERANCE || rect.top - rect.bottom <= TOLERANCE) {
+        add(name, 'zero-area', `${name} has zero area`);
+      } else {
+        boxes[name] = rect;
+      }
+    }
+
+    const media = boxes.MediaBox;
+    if (!raw.MediaBox) add('MediaBox', 'missing', 'Page has no MediaBox');
+
+    // Boxes outside the crop box are clipped to it, so the crop box
+    // stands in for the media box when checking the others
+    const crop = boxes.CropBox ?? media;
+    if (media && boxes.CropBox && !contains(media, boxes.CropBox)) {
+      add('CropBox', 'outside-media', 'CropBox extends beyond the MediaBox');
+    }
+
+    for (const name of ['BleedBox', 'TrimBox', 'ArtBox'] as const) {
+      const rect = boxes[name];
+      if (!rect) continue;
+      if (media && !contains(media, rect)) {
+        add(name, 'outside-media', `${name} extends beyond the MediaBox`);
+      } else if (crop && !contains(crop, rect)) {
+        add(name, 'outside-crop', `${name} extends beyond the CropBox`);
+      }
+    }
+
+    if (boxes.BleedBox && boxes.TrimBox && !contains(boxes.BleedBox, boxes.TrimBox)) {
+      add('TrimBox', 'outside-bleed', 'TrimBox extends beyond the BleedBox');
+    }
+
+    if (!raw.TrimBox && (raw.BleedBox || anyTrimBox)) {
+      add('TrimBox', 'missing', raw.BleedBox
+        ? 'Page has a BleedBox but no TrimBox'
+        : 'Page has no TrimBox while other pages do');
+    }
+  });
+
+  return issues;
+}
+
+/**
+ * Reads a box array as a normalized rectangle
+ *
+ * @returns undefined unless the array holds four numbers
+ */
+export function toRect(array: PDFArray): Rect | undefined {
+  if (array.size() !== 4) return undefined;
+  const values = array.asArray().map(item => array.context.lookup(item));
+  if (!values.every(value => value instanceof PDFNumber)) return undefined;
+
+  const [x1, y1, x2, y2] = values.map(value => (value as PDFNumber).asNumber());
+  return {
+    left: Math.min(x1, x2),
+    bottom: Math.min(y1, y2),
+    right: Math.max(x1, x2),
+    top: Math.max(y1, y2),
+  };
+}
+
+/**
+ * Whether inner lies within outer (with a small tolerance)
+ */
+export function contains(outer: Rect, inner: Rect): boolean {
+  return inner.left >= outer.left - TOLERANCE &&
+    inner.bottom >= outer.bottom - TOLERANCE &&
+    inner.right <= outer.right + TOLERANCE &&
+    inner.top <= outer.top + TOLERANCE;
+}
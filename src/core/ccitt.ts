@@ -0,0 +1,184 @@
+/**
+ * CCITT Group 4 (T.6) encoder for bilevel images
+ *
+ * Produces data for CCITTFaxDecode with K -1 and the default BlackIs1
+ * false, ending with an end-of-block marker.
+ */
+
+/** Terminating codes for white runs 0-63 */
+const WHITE_TERMINATING = [
+  '00110101', '000111', '0111', '1000', '1011', '1100', '1110', '1111',
+  '10011', '10100', '00111', '01000', '001000', '000011', '110100', '110101',
+  '101010', '101011', '0100111', '0001100', '0001000', '0010111', '0000011', '0000100',
+  '0101000', '0101011', '0010011', '0100100', '0011000', '00000010', '00000011', '00011010',
+  '00011011', '00010010', '00010011', '00010100', '00010101', '00010110', '00010111', '00101000',
+  '00101001', '00101010', '00101011', '00101100', '00101101', '00000100', '00000101', '00001010',
+  '00001011', '01010010', '01010011', '01010100', '01010101', '00100100', '00100101', '01011000',
+  '01011001', '01011010', '01011011', '01001010', '01001011', '00110010', '00110011', '00110100',
+];
+
+/** Terminating codes for black runs 0-63 */
+const BLACK_TERMINATING = [
+  '0000110111', '010', '11', '10', '011', '0011', '0010', '00011',
+  '000101', '000100', '0000100', '0000101', '0000111', '00000100', '00000111', '000011000',
+  '0000010111', '0000011000', '0000001000', '00001100111', '00001101000', '00001101100', '00000110111', '00000101000',
+  '00000010111', '00000011000', '000011001010', '000011001011', '000011001100', '000011001101', '000001101000', '000001101001',
+  '000001101010', '000001101011', '000011010010', '000011010011', '000011010100', '000011010101', '000011010110', '000011010111',
+  '000001101100', '000001101101', '000011011010', '000011011011', '000001010100', '000001010101', '000001010110', '000001010111',
+  '000001100100', '000001100101', '000001010010', '000001010011', '000000100100', '000000110111', '000000111000', '000000100111',
+  '000000101000', '000001011000', '000001011001', '000000101011', '000000101100', '000001011010', '000001100110', '000001100111',
+];
+
+/** Make-up codes for white runs 64-1728, in steps of 64 */
+const WHITE_MAKEUP = [
+  '11011', '10010', '010111', '0110111', '00110110', '00110111', '01100100', '01100101', '01101000',
+  '01100111', '011001100', '011001101', '011010010', '011010011', '011010100', '011010101', '011010110',
+  '011010111', '011011000', '011011001', '011011010', '011011011', '010011000', '010011001', '010011010',
+  '011000', '010011011',
+];
+
+/** Make-up codes for black runs 64-1728, in steps of 64 */
+const BLACK_MAKEUP = [
+  '0000001111', '000011001000', '000011001001', '000001011011', '000000110011', '000000110100', '000000110101',
+  '0000001101100', '0000001101101', '0000001001010', '0000001001011', '0000001001100', '0000001001101',
+  '0000001110010', '0000001110011', '0000001110100', '0000001110101', '0000001110110', '0000001110111',
+  '0000001010010', '0000001010011', '0000001010100', '0000001010101', '0000001011010', '0000001011011',
+  '0000001100100', '0000001100101',
+];
+
+/** Make-up codes shared by both colors for runs 1792-2560 */
+const EXTENDED_MAKEUP = [
+  '00000001000', '00000001100', '00000001101', '000000010010', '000000010011', '000000010100', '000000010101',
+  '000000010110', '000000010111', '000000011100', '000000011101', '000000011110', '000000011111',
+];
+
+const PASS = '0001';
+const HORIZONTAL = '001';
+/** Vertical mode codes indexed by a1 - b1 + 3 */
+const VERTICAL = ['0000010', '000010', '010', '1', '011', '000011', '0000011'];
+const EOL = '000000000001';
+
+/**
+ * Encodes a bilevel image with Group 4 compression
+ *
+ * @param pixels - One byte per pixel, row by row: 0 for white, 1 for black
+ */
+export function encodeCcittG4(pixels: Uint8Array, width: number, height: number): Uint8Array {
+  const writer = new BitWriter();
+  // The line above the first row is imaginary and all white
+  let reference = new Uint8Array(width);
+
+  for (let y = 0; y < height; y++) {
+    const line = pixels.subarray(y * width, (y + 1) * width);
+    encodeLine(writer, line, reference, width);
+    reference = line;
+  }
+
+  // End of facsimile block
+  writer.write(EOL);
+  writer.write(EOL);
+  return writer.finish();
+}
+
+function encodeLine(writer: BitWriter, line: Uint8Array, reference: Uint8Array, width: number): void {
+  let a0 = -1;
+  let color = 0;
+
+  while (a0 < width) {
+    const a1 = nextChange(line, a0, color, width);
+    const b1 = nextChange(reference, referenceStart(reference, a0, color, width), color, width);
+    const b2 = nextChange(reference, b1, 1 - color, width);
+
+    if (b2 < a1) {
+      writer.write(PASS);
+      a0 = b2;
+    } else if (Math.abs(a1 - b1) <= 3) {
+      writer.write(VERTICAL[a1 - b1 + 3]);
+      a0 = a1;
+      color = 1 - color;
+    } else {
+      const a2 = nextChange(line, a1, 1 - color, width);
+      writer.write(HORIZONTAL);
+      writeRun(writer, a1 - Math.max(a0, 0), color);
+      writeRun(writer, a2 - a1, 1 - color);
+      a0 = a2;
+    }
+  }
+}
+
+/**
+ * First position after `from` whose pixel is not `color` (width if none)
+ */
+function nextChange(line: Uint8Array, from: number, color: number, width: number): number {
+  let position = from + 1;
+  while (position < width && line[position] === color) position++;
+  return Math.min(position, width);
+}
+
+/**
+ * Position to search the reference line from so that the next change
+ * found is b1: a changing element right of a0 whose color is opposite to
+ * a0's, which means skipping any run of the opposite color already open at a0
+ */
+function referenceStart(reference: Uint8Array, a0: number, color: number, width: number): number {
+  if (a0 < 0) return -1;
+  let position = a0;
+  // Inside a run of the opposite color: b1 is the start of the next one
+  if (reference[position] !== color) {
+    while (position < width && reference[position] !== color) position++;
+  }
+  return position;
+}
+
+function writeRun(writer: BitWriter, run: number, color: number): void {
+  const terminating = color === 0 ? WHITE_TERMINATING : BLACK_TERMINATING;
+  const makeup = color === 0 ? WHITE_MAKEUP : BLACK_MAKEUP;
+
+  while (run >= 2560) {
+    writer.write(EXTENDED_MAKEUP[EXTENDED_MAKEUP.length - 1]);
+    run -= 2560;
+  }
+  if (run >= 1792) {
+    const index = Math.floor(run / 64) - 28;
+    writer.write(EXTENDED_MAKEUP[index]);
+    run -= (index + 28) * 64;
+  } else if (run >= 64) {
+    const index = Math.floor(run / 64) - 1;
+    writer.write(makeup[index]);
+    run -= (index + 1) * 64;
+  }
+  writer.write(terminating[run]);
+}
+
+class BitWriter {
+  private bytes = new Uint8Array(1024);
+  private length = 0;
+  private current = 0;
+  private bitCount = 0;
+
+  write(code: string): void {
+    for (let i = 0; i < code.length; i++) {
+      this.current = (this.current << 1) | (code.charCodeAt(i) - 48);
+      if (++this.bitCount === 8) this.flush();
+    }
+  }
+
+  finish(): Uint8Array {
+    if (this.bitCount > 0) {
+      this.current <<= 8 - this.bitCount;
+      this.flush();
+    }
+    return this.bytes.slice(0, this.length);
+  }
+
+  private flush(): void {
+    if (this.length === this.bytes.length) {
+      const grown = new Uint8Array(this.bytes.length * 2);
+      grown.set(this.bytes);
+      this.bytes = grown;
+    }
+    this.bytes[this.length++] = this.current;
+    this.current = 0;
+    this.bitCount = 0;
+  }
+}
@@ -0,0 +1,271 @@
+/**
+ * Compression changelog
+ *
+ * Audit logs need each change on its own line, with the object or page
+ * it touched. The passes already record that in the report; this flattens
+ * it, in the order the passes ran, and adds what the report leaves out:
+ * the net object count, the writer's metadata and the pages the image
+ * pass redrew.
+ */
+
+import type { ChangelogEntry, CompressionReport } from '../api/types';
+
+/**
+ * A page redrawn by the image pass
+ */
+export interface RasterizedPage {
+  page: number;
+  /** Highest effective DPI of the page's images before (null without images) */
+  dpiBefore: number | null;
+  /** DPI the page was rendered at */
+  dpiAfter: number;
+  /** Encoding of the page image */
+  encoding: string;
+}
+
+/**
+ * What compression did beyond the report
+ */
+export interface ChangelogContext {
+  /** Indirect objects before and after the structural passes */
+  objects?: { before: number; after: number };
+  /** Whether tagProcessed wrote a marker */
+  marker: boolean;
+  /** Pages redrawn by the image pass, if its output was kept */
+  rasterized: RasterizedPage[];
+  /** Whether the output is new bytes rather than the input returned unchanged */
+  rewritten: boolean;
+}
+
+/**
+ * Lists every change recorded in a report and its context
+ */
+export function buildChangelog(report: CompressionReport, context: ChangelogContext): ChangelogEntry[] {
+  const entries: ChangelogEntry[] = [];
+
+  for (const link of report.strippedLinks ?? []) {
+    entries.push({
+      operation: 'linkRemoved',
+      source: 'stripExternalLinks',
+      ...(link.page !== undefined && { page: link.page }),
+      description: `Removed ${link.source} link to ${link.url}`,
+    });
+  }
+
+  for (const image of report.repairedImages?.recovered ?? []) {
+    entries.push({
+      operation: 'imageRepaired',
+      source: 'repairImages',
+      object: image.object,
+      description: `Rebuilt the readable part of a broken image (${image.reason})`,
+    });
+  }
+  for (const image of report.repairedImages?.unrecoverable ?? []) {
+    entries.push({
+      operation: 'imageRemoved',
+      source: 'repairImages',
+      object: image.object,
+      description: `Replaced or removed an unreadable image (${image.reason})`,
+    });
+  }
+
+  if (report.xfa && report.xfa.bytesRemoved > 0) {
+    entries.push({
+      operation: 'formDataRemoved',
+      source: 'removeXFA',
+      before: report.xfa.bytesRemoved,
+      after: 0,
+      unit: 'bytes',
+      description: 'Removed XFA form data',
+    });
+  }
+
+  if (report.prunedContent) {
+    if (report.prunedContent.emptyStreamsRemoved > 0) {
+      entries.push({
+        operation: 'contentRemoved',
+        source: 'pruneEmptyContent',
+        before: report.prunedContent.emptyStreamsRemoved,
+        after: 0,
+        unit: 'streams',
+        description: `Removed ${report.prunedContent.emptyStreamsRemoved} content streams that draw nothing`,
+      });
+    }
+    for (const page of report.prunedContent.pagesRemoved) {
+      entries.push({ operation: 'pageRemoved', source: 'pruneEmptyContent', page, description: 'Removed an empty page' });
+    }
+  }
+
+  for (const { page, survivor } of report.dedupedPages?.removed ?? []) {
+    entries.push({
+      operation: 'pageRemoved',
+      source: 'dedupePages',
+      page,
+      description: `Removed a duplicate of page ${survivor}`,
+    });
+  }
+
+  const annotations = report.printedAnnotations;
+  if (annotations && annotations.flattened > 0) {
+    entries.push({
+      operation: 'annotationsFlattened',
+      source: 'printAnnotations',
+      description: `Drew ${annotations.flattened} annotations into page content`,
+    });
+  }
+  if (annotations?.appearanceBytesSaved) {
+    entries.push({
+      operation: 'streamRecompressed',
+      source: 'compressAppearances',
+      description: `Compressed annotation appearance streams, saving ${annotations.appearanceBytesSaved} bytes`,
+    });
+  }
+
+  if (report.inlineImages && report.inlineImages.processed > 0) {
+    entries.push({
+      operation: 'imageReencoded',
+      source: 'optimizeInlineImages',
+      description: `Re-encoded ${report.inlineImages.processed} inline images ` +
+        `(${report.inlineImages.promotedToXObjects} moved to image objects)`,
+    });
+  }
+
+  if (report.dedupedProfiles && report.dedupedProfiles.profilesRemoved > 0) {
+    entries.push({
+      operation: 'objectsRemoved',
+      source: 'dedupeICCProfiles',
+      before: report.dedupedProfiles.bytesSaved,
+      after: 0,
+      unit: 'bytes',
+      description: `Removed ${report.dedupedProfiles.profilesRemoved} duplicate ICC profiles`,
+    });
+  }
+
+  for (const font of report.normalizedEncodings?.normalized ?? []) {
+    entries.push({
+      operation: 'fontNormalized',
+      source: 'normalizeEncoding',
+      object: font.object,
+      description: `Rewrote the encoding of ${font.font ?? 'an unnamed font'}` +
+        (font.toUnicodeFixed > 0 ? ` (${font.toUnicodeFixed} ToUnicode entries)` : ''),
+    });
+  }
+
+  const recombined = report.recombinedContent;
+  if (recombined && recombined.pagesRecombined > 0) {
+    entries.push({
+      operation: 'streamRecompressed',
+      source: 'recombineContentStreams',
+      before: recombined.streamsBefore,
+      after: recombined.streamsAfter,
+      unit: 'streams',
+      description: `Merged the content streams of ${recombined.pagesRecombined} pages`,
+    });
+  }
+
+  for (const image of report.convertedCmyk?.converted ?? []) {
+    entries.push({
+      operation: 'imageReencoded',
+      source: 'cmykToRgb',
+      object: image.object,
+      before: image.bytesBefore,
+      after: image.bytesAfter,
+      unit: 'bytes',
+      description: `Converted a ${image.width}x${image.height} CMYK image to RGB`,
+    });
+  }
+
+  for (const image of report.posterized?.images ?? []) {
+    entries.push({
+      operation: 'imageReencoded',
+      source: 'posterize',
+      object: image.object,
+      before: image.colorsBefore,
+      after: image.colorsAfter,
+      unit: 'colors',
+      description: `Reduced a ${image.width}x${image.height} image to a palette ` +
+        `(${image.bytesBefore} to ${image.bytesAfter} bytes)`,
+    });
+  }
+
+  for (const image of report.optimizedPng?.images ?? []) {
+    entries.push({
+      operation: 'imageReencoded',
+      source: 'optimizePNG',
+      object: image.object,
+      before: image.bytesBefore,
+      after: image.bytesAfter,
+      unit: 'bytes',
+      description: `Re-encoded a ${image.width}x${image.height} image losslessly ` +
+        (image.encoding === 'indexed' ? `with ${image.colors} colors` : 'as predicted RGB'),
+    });
+  }
+
+  if (report.imagesTaggedWithIntent) {
+    entries.push({
+      operation: 'metadataChanged',
+      source: 'renderingIntent',
+      description: `Set the rendering intent of ${report.imagesTaggedWithIntent} images`,
+    });
+  }
+
+  if (report.xmpBytesSaved) {
+    entries.push({
+      operation: 'metadataChanged',
+      source: 'trimXMP',
+      description: `Trimmed XMP metadata, saving ${report.xmpBytesSaved} bytes`,
+    });
+  }
+
+  if (context.objects && context.objects.after < context.objects.before) {
+    entries.push({
+      operation: 'objectsRemoved',
+      source: 'structure',
+      before: context.objects.before,
+      after: context.objects.after,
+      unit: 'objects',
+      description: `Removed ${context.objects.before - context.objects.after} objects no longer in use`,
+    });
+  }
+
+  if (context.marker) {
+    entries.push({ operation: 'metadataChanged', source: 'tagProcessed', description: 'Wrote the processed marker to XMP' });
+  }
+
+  if (report.textSidecar?.attached) {
+    entries.push({
+      operation: 'attachmentAdded',
+      source: 'attachTextSidecar',
+      description: `Attached the extracted text as ${report.textSidecar.name} (${report.textSidecar.bytes} bytes)`,
+    });
+  }
+
+  for (const { page, dpiBefore, dpiAfter, encoding } of context.rasterized) {
+    entries.push({
+      operation: 'pageRasterized',
+      source: 'imagePass',
+      page,
+      ...(dpiBefore !== null && { before: dpiBefore }),
+      after: dpiAfter,
+      unit: 'dpi',
+      description: `Redrew the page as one ${encoding.toUpperCase()} image at ${dpiAfter} DPI` +
+        (dpiBefore !== null ? ` (its images were up to ${dpiBefore} DPI)` : ''),
+    });
+  }
+
+  if (context.rasterized.length > 0) {
+    entries.push({
+      operation: 'metadataChanged',
+      source: 'imagePass',
+      description: 'Rebuilt the document from page images, without its document information, XMP, outline or forms',
+    });
+  } else if (context.rewritten) {
+    entries.push({
+      operation: 'metadataChanged',
+      source: 'save',
+      description: 'Set the Producer and modification date in the document information dictionary',
+    });
+  }
+
+  return entries;
+}
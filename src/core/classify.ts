@@ -0,0 +1,133 @@
+/**
+ * Scanned vs. born-digital document classification
+ */
+
+import { PDFDocument } from 'pdf-lib';
+import type { CompressionPreset, DocumentClassification, SizeGoal } from '../api/types';
+import { analyzePage, imageCoverage } from './page-analysis';
+
+/**
+ * What a single page is made of
+ */
+export type PageKind = 'scanned' | 'text' | 'mixed' | 'blank';
+
+/**
+ * Document classification with per-page detail
+ */
+export interface ClassificationResult {
+  classification: DocumentClassification;
+  pageKinds: PageKind[];
+  reasoning: string;
+}
+
+/** Image coverage at which a page without visible text counts as a scan */
+const SCAN_COVERAGE = 0.85;
+/** Image coverage below which a page with text counts as text */
+const TEXT_MAX_COVERAGE = 0.25;
+/** Share of non-blank pages needed to classify the whole document */
+const MAJORITY = 0.8;
+
+/**
+ * Preset suited to each classification, per size goal
+ */
+export const PRESET_FOR_CLASSIFICATION: Record<SizeGoal, Record<DocumentClassification, CompressionPreset>> = {
+  smaller: { scanned: 'max', digital: 'balanced', mixed: 'max' },
+  balanced: { scanned: 'max', digital: 'lossless', mixed: 'balanced' },
+  quality: { scanned: 'balanced', digital: 'lossless', mixed: 'balanced' },
+};
+
+/**
+ * Image settings per classification and size goal. Scans keep enough DPI
+ * for text to stay legible; mixed pages tolerate less.
+ */
+const IMAGE_SETTINGS: Record<DocumentClassification, Record<SizeGoal, { targetDPI: number; jpegQuality: number }>> = {
+  scanned: {
+    smaller: { targetDPI: 110, jpegQuality: 0.5 },
+    balanced: { targetDPI: 150, jpegQuality: 0.6 },
+    quality: { targetDPI: 200, jpegQuality: 0.75 },
+  },
+  mixed: {
+    smaller: { targetDPI: 96, jpegQuality: 0.5 },
+    balanced: { targetDPI: 120, jpegQuality: 0.65 },
+    quality: { targetDPI: 150, jpegQuality: 0.8 },
+  },
+  digital: {
+    smaller: { targetDPI: 120, jpegQuality: 0.6 },
+    balanced: { targetDPI: 150, jpegQuality: 0.7 },
+    quality: { targetDPI: 150, jpegQuality: 0.85 },
+  },
+};
+
+/**
+ * Picks image settings for a classified document
+ *
+ * Large files get a lower DPI, as the fixed presets do, to keep rendering
+ * within memory limits.
+ */
+export function autoImageSettings(
+  classification: DocumentClassification,
+  goal: SizeGoal,
+  fileSize: number
+): { targetDPI: number; jpegQuality: number } {
+  const { targetDPI, jpegQuality } = IMAGE_SETTINGS[classification][goal];
+  const sizeFactor = fileSize > 50 * 1024 * 1024 ? 0.6 : fileSize > 20 * 1024 * 1024 ? 0.8 : 1;
+  return { targetDPI: Math.round(targetDPI * sizeFactor), jpegQuality };
+}
+
+/**
+ * Pages that are likely images of text: scans, and image pages with an
+ * OCR layer (invisible text)
+ *
+ * @returns 1-indexed page numbers
+ */
+export function findTextImagePages(pdfDoc: PDFDocument): Set<number> {
+  const pages = new Set<number>();
+  pdfDoc.getPages().forEach((page, index) => {
+    const summary = analyzePage(page);
+    if (summary.images.length === 0) return;
+    const scanned = imageCoverage(page, summary.images) >= SCAN_COVERAGE && summary.visibleTextOps === 0;
+    if (scanned || summary.invisibleTextOps > 0) pages.add(index + 1);
+  });
+  return pages;
+}
+
+/**
+ * Classifies each page, then the document by majority
+ */
+export function classifyDocument(pdfDoc: PDFDocument): ClassificationResult {
+  const pageKinds = pdfDoc.getPages().map((page): PageKind => {
+    const summary = analyzePage(page);
+    const coverage = imageCoverage(page, summary.images);
+
+    if (summary.images.length === 0 && summary.visibleTextOps === 0 && summary.vectorOps === 0) {
+      return 'blank';
+    }
+    // Invisible text (OCR layers) doesn't make a scan born-digital
+    if (coverage >= SCAN_COVERAGE && summary.visibleTextOps === 0) return 'scanned';
+    if (summary.visibleTextOps > 0 && coverage < TEXT_MAX_COVERAGE) return 'text';
+    return 'mixed';
+  });
+
+  const counted = pageKinds.filter(kind => kind !== 'blank');
+  const scanned = counted.filter(kind => kind === 'scanned').length;
+  const text = counted.filter(kind => kind === 'text').length;
+  const total = counted.length;
+
+  let classification: DocumentClassification;
+  if (total === 0) {
+    classification = 'digital';
+  } else if (scanned / total >= MAJORITY) {
+    classification = 'scanned';
+  } else if (text / total >= MAJORITY) {
+    classification = 'digital';
+  } else {
+    classification = 'mixed';
+  }
+
+  const reasoning = total === 0
+    ? 'All pages are blank; treating as born-digital'
+    : `${scanned} of ${total} non-blank pages are full-page images without visible text, ` +
+      `${text} are text with little imagery, ${total - scanned - text} are mixed`;
+
+  return { classification, pageKinds, reasoning };
+}
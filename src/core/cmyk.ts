@@ -0,0 +1,253 @@
+/**
+ * CMYK to RGB image conversion
+ *
+ * CMYK images made for print often look dark or dull on screen, since
+ * web viewers convert them without color management. Converting them to
+ * RGB up front fixes the display at the cost of print fidelity. No ICC
+ * transform is applied: 'swop' approximates the common US Web Coated
+ * (SWOP) press profile, 'naive' is the textbook formula. JPEG decoding
+ * uses the browser's decoder, which honors a profile embedded in the
+ * JPEG itself.
+ */
+
+import { PDFArray, PDFBool, PDFDocument, PDFHexString, PDFName, PDFRawStream, PDFRef, PDFStream, PDFString } from 'pdf-lib';
+import type { CmykConversion, CmykConversionReport, CmykConvertedImage } from '../api/types';
+import { decodeStreamContents, getFilters, lookupDict, lookupNumber } from './pdf-objects';
+import { createCanvas, decodeImage } from './render';
+
+/** Quality of JPEGs re-encoded after conversion */
+const JPEG_QUALITY = 0.92;
+
+/** Dictionary entries carried over to the converted image */
+const KEPT_KEYS = ['SMask', 'Intent', 'Interpolate', 'OC', 'Metadata', 'StructParent'];
+
+/**
+ * Converts the document's CMYK images (DeviceCMYK, four-component
+ * ICCBased, and Indexed images with a CMYK base) to RGB
+ *
+ * Images with a Decode array or other than 8 bits per component are
+ * skipped and reported, as are JPEGs the browser can't decode.
+ *
+ * @param selected - If given, only these images are decoded and
+ *   re-encoded; palettes are converted regardless, since that's cheap
+ */
+export async function convertCmykImages(
+  pdfDoc: PDFDocument,
+  conversion: CmykConversion,
+  selected?: Set<PDFRef>
+): Promise<CmykConversionReport> {
+  const report: CmykConversionReport = { converted: [], skipped: [] };
+  const context = pdfDoc.context;
+  const toRgb = conversion === 'naive' ? naiveToRgb : swopToRgb;
+
+  for (const [ref, object] of context.enumerateIndirectObjects()) {
+    if (!(object instanceof PDFRawStream) || !isImage(object)) continue;
+
+    const colorSpace = object.dict.lookup(PDFName.of('ColorSpace'));
+    const indexed = colorSpace instanceof PDFArray && colorSpace.lookup(0) === PDFName.of('Indexed')
+      ? colorSpace
+      : undefined;
+    if (!isCmyk(indexed ? indexed.lookup(1) : colorSpace)) continue;
+
+    const width = lookupNumber(object.dict, 'Width') ?? 0;
+    const height = lookupNumber(object.dict, 'Height') ?? 0;
+    const bytesBefore = object.getContentsSize();
+    const skip = (reason: string) => report.skipped.push({ object: ref.toString(), reason });
+
+    // Only the palette changes; the index data stays as it is
+    if (indexed) {
+      const lookup = readLookup(indexed.lookup(3));
+      if (!lookup) {
+        skip('the Indexed lookup table can\'t be read');
+        continue;
+      }
+      object.dict.set(PDFName.of('ColorSpace'), context.obj([
+        PDFName.of('Indexed'),
+        PDFName.of('DeviceRGB'),
+        indexed.get(2),
+        PDFHexString.of(toHex(convertSamples(lookup, toRgb))),
+      ]));
+      report.converted.push(describe(ref, width, height, 'palette', bytesBefore, bytesBefore));
+      continue;
+    }
+
+    if (selected && !selected.has(ref)) {
+      skip('not among the maxImagesToProcess largest images');
+      continue;
+    }
+    if (object.dict.has(PDFName.of('Decode'))) {
+      skip('the image has a Decode array');
+      continue;
+    }
+    if (lookupNumber(object.dict, 'BitsPerComponent') !== 8) {
+      skip('only 8-bit images are converted');
+      continue;
+    }
+
+    const filters = getFilters(object.dict);
+    let converted: PDFRawStream | undefined;
+    let method: CmykConvertedImage['method'];
+
+    if (filters.length === 1 && filters[0] === 'DCTDecode') {
+      converted = await convertJpeg(pdfDoc, object, width, height);
+      method = 'jpeg';
+      if (!converted) {
+        skip('the JPEG data can\'t be decoded');
+        continue;
+      }
+    } else {
+      const parms = lookupDict(object.dict, 'DecodeParms');
+      if (parms && (lookupNumber(parms, 'Predictor') ?? 1) > 1) {
+        skip('predictor-encoded data isn\'t converted');
+        continue;
+      }
+      const samples = filters.every(filter => filter === 'FlateDecode') ? decodeStreamContents(object) : undefined;
+      if (!samples || samples.length < width * height * 4) {
+        skip('the image data can\'t be decoded');
+        continue;
+      }
+      const rgb = convertSamples(samples.subarray(0, width * height * 4), toRgb);
+      converted = context.flateStream(rgb, {
+        Type: 'XObject',
+        Subtype: 'Image',
+        Width: width,
+        Height: height,
+        ColorSpace: 'DeviceRGB',
+        BitsPerComponent: 8,
+      });
+      method = 'samples';
+    }
+
+    for (const key of KEPT_KEYS) {
+      const value = object.dict.get(PDFName.of(key));
+      if (value) converted.dict.set(PDFName.of(key), value);
+    }
+    // A stencil mask still applies; a color-key mask refers to CMYK values
+    const mask = object.dict.get(PDFName.of('Mask'));
+    if (mask instanceof PDFRef) converted.dict.set(PDFName.of('Mask'), mask);
+
+    context.assign(ref, converted);
+    report.converted.push(describe(ref, width, height, method, bytesBefore, converted.getContentsSize()));
+  }
+
+  return report;
+}
+
+/**
+ * Decodes a CMYK JPEG with the browser and re-encodes it as RGB
+ */
+async function convertJpeg(
+  pdfDoc: PDFDocument,
+  stream: PDFRawStream,
+  width: number,
+  height: number
+): Promise<PDFRawStream | undefined> {
+  const bitmap = await decodeImage(stream.contents).catch(() => undefined);
+  if (!bitmap) return undefined;
+
+  const { canvas, context } = createCanvas(width, height);
+  context.drawImage(bitmap, 0, 0, width, height);
+  bitmap.close();
+  const dataUrl = canvas.toDataURL('image/jpeg', JPEG_QUALITY);
+  canvas.width = 0;
+  canvas.height = 0;
+
+  const jpeg = Uint8Array.from(atob(dataUrl.split(',')[1]), c => c.charCodeAt(0));
+  return pdfDoc.context.stream(jpeg, {
+    Type: 'XObject',
+    Subtype: 'Image',
+    Width: width,
+    Height: height,
+    ColorSpace: 'DeviceRGB',
+    BitsPerComponent: 8,
+    Filter: 'DCTDecode',
+  });
+}
+
+function isImage(stream: PDFStream): boolean {
+  const dict = stream.dict;
+  return dict.lookup(PDFName.of('Subtype')) === PDFName.of('Image') &&
+    dict.lookup(PDFName.of('ImageMask')) !== PDFBool.True;
+}
+
+function isCmyk(colorSpace: unknown): boolean {
+  if (colorSpace === PDFName.of('DeviceCMYK')) return true;
+  if (colorSpace instanceof PDFArray && colorSpace.lookup(0) === PDFName.of('ICCBased')) {
+    const profile = colorSpace.lookup(1);
+    return profile instanceof PDFStream && lookupNumber(profile.dict, 'N') === 4;
+  }
+  return false;
+}
+
+function readLookup(lookup: unknown): Uint8Array | undefined {
+  if (lookup instanceof PDFStream) return decodeStreamContents(lookup);
+  if (lookup instanceof PDFHexString || lookup instanceof PDFString) return lookup.asBytes();
+  return undefined;
+}
+
+/**
+ * Converts packed CMYK bytes to packed RGB bytes
+ */
+function convertSamples(
+  cmyk: Uint8Array,
+  toRgb: (c: number, m: number, y: number, k: number) => [number, number, number]
+): Uint8Array {
+  const pixels = Math.floor(cmyk.length / 4);
+  const rgb = new Uint8Array(pixels * 3);
+  for (let i = 0; i < pixels; i++) {
+    const [r, g, b] = toRgb(cmyk[i * 4] / 255, cmyk[i * 4 + 1] / 255, cmyk[i * 4 + 2] / 255, cmyk[i * 4 + 3] / 255);
+    rgb[i * 3] = clamp(r);
+    rgb[i * 3 + 1] = clamp(g);
+    rgb[i * 3 + 2] = clamp(b);
+  }
+  return rgb;
+}
+
+function naiveToRgb(c: number, m: number, y: number, k: number): [number, number, number] {
+  return [255 * (1 - c) * (1 - k), 255 * (1 - m) * (1 - k), 255 * (1 - y) * (1 - k)];
+}
+
+/**
+ * Polynomial fit of the US Web Coated (SWOP) profile, as used by pdf.js
+ * for DeviceCMYK
+ */
+function swopToRgb(c: number, m: number, y: number, k: number): [number, number, number] {
+  return [
+    255 +
+      c * (-4.387332384609988 * c + 54.48615194189176 * m + 18.82290502165302 * y + 212.25662451639585 * k - 285.2331026137004) +
+      m * (1.7149763477362134 * m - 5.6096736904047315 * y - 17.873870861415444 * k - 5.497006427196366) +
+      y * (-2.5217340131683033 * y - 21.248923337353073 * k + 17.5119270841813) +
+      k * (-21.86122147463605 * k - 189.48180835922747),
+    255 +
+      c * (8.841041422036149 * c + 60.118027045597366 * m + 6.871425592049007 * y + 31.159100130055922 * k - 79.2970844816548) +
+      m * (-15.310361306967817 * m + 17.575251261109482 * y + 131.35250912493976 * k - 190.9453302588951) +
+      y * (4.444339102852739 * y + 9.8632861493405 * k - 24.86741582555878) +
+      k * (-20.737325471181034 * k - 187.80453709719578),
+    255 +
+      c * (0.8842522430003296 * c + 8.078677503112928 * m + 30.89978309703729 * y - 0.23883238689178934 * k - 14.183576799673286) +
+      m * (10.49593273432072 * m + 63.02378494754052 * y + 50.606957656360734 * k - 112.23884253719248) +
+      y * (0.03296041114873217 * y + 115.60384449646641 * k - 193.58209356861505) +
+      k * (-22.33816807309886 * k - 180.12613974708367),
+  ];
+}
+
+function clamp(value: number): number {
+  return Math.max(0, Math.min(255, Math.round(value)));
+}
+
+function toHex(bytes: Uint8Array): string {
+  let hex = '';
+  for (const value of bytes) hex += value.toString(16).padStart(2, '0');
+  return hex;
+}
+
+function describe(
+  ref: PDFRef,
+  width: number,
+  height: number,
+  method: CmykConvertedImage['method'],
+  bytesBefore: number,
+  bytesAfter: number
+): CmykConvertedImage {
+  return { object: ref.toString(), width, height, method, bytesBefore, bytesAfter };
+}
@@ -0,0 +1,33 @@
+/**
+ * Color management passes
+ */
+
+import { PDFBool, PDFDocument, PDFName, PDFStream } from 'pdf-lib';
+import type { RenderingIntent } from '../api/types';
+import { lookupName } from './pdf-objects';
+
+/**
+ * Sets /Intent on image XObjects that have none
+ *
+ * Stencil masks are skipped: they paint with the fill color, so an intent
+ * on the image itself has no effect.
+ *
+ * @returns Number of images tagged
+ */
+export function applyRenderingIntent(pdfDoc: PDFDocument, intent: RenderingIntent): number {
+  const intentName = PDFName.of(intent);
+  let tagged = 0;
+
+  for (const [, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    if (!(object instanceof PDFStream) || lookupName(object.dict, 'Subtype') !== 'Image') continue;
+    if (object.dict.has(PDFName.of('Intent'))) continue;
+
+    const imageMask = object.dict.lookup(PDFName.of('ImageMask'));
+    if (imageMask instanceof PDFBool && imageMask.asBoolean()) continue;
+
+    object.dict.set(PDFName.of('Intent'), intentName);
+    tagged++;
+  }
+
+  return tagged;
+}
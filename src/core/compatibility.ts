@@ -0,0 +1,151 @@
+/**
+ * Viewer compatibility checks
+ *
+ * Detects document features that are known to cause trouble on a given
+ * target and explains how to work around them.
+ */
+
+import { PDFDict, PDFDocument, PDFName, PDFNumber } from 'pdf-lib';
+import type { CompatibilityIssue, CompatibilityTarget, PdfFeature } from '../api/types';
+import { getFilters, lookupDict, lookupName, visitDicts } from './pdf-objects';
+import { hasObjectStreams, toLatin1 } from './raw-pdf';
+
+const RERENDER_HINT = "Compress with the 'balanced' or 'max' preset to re-render pages as JPEG";
+const XFA_HINT = 'Provide an AcroForm version of the form; hybrid forms already have one (compress with removeXFA)';
+
+/**
+ * Per-target notes for features that cause problems there.
+ * Features missing from a target's table are fine on that target.
+ */
+const TARGET_NOTES: Record<CompatibilityTarget, Partial<Record<PdfFeature, Omit<CompatibilityIssue, 'feature'>>>> = {
+  browser: {
+    xfa: {
+      note: 'XFA forms are not rendered by Chrome, Edge or Safari; pdf.js support is partial',
+      remediation: XFA_HINT,
+    },
+    encryption: {
+      note: 'Encrypted documents may prompt for a password and block inline rendering',
+      remediation: 'Distribute an unencrypted copy',
+    },
+  },
+  print: {
+    jbig2: {
+      note: 'JBIG2 images are unsupported on older PostScript RIPs',
+      remediation: RERENDER_HINT,
+    },
+    jpeg2000: {
+      note: 'JPEG 2000 images are unsupported on many printers and older RIPs',
+      remediation: RERENDER_HINT,
+    },
+    transparency: {
+      note: 'Live transparency may be flattened unpredictably by print RIPs',
+      remediation: RERENDER_HINT,
+    },
+    xfa: {
+      note: 'Dynamic XFA forms print blank outside Adobe Reader',
+      remediation: XFA_HINT,
+    },
+    objectStreams: {
+      note: 'Object streams (PDF 1.5) are rejected by some legacy print workflows',
+      remediation: 'Re-save without object streams if the printer rejects the file',
+    },
+  },
+  pdfa2: {
+    encryption: {
+      note: 'PDF/A forbids encryption',
+      remediation: 'Remove the encryption before archiving',
+    },
+    xfa: {
+      note: 'PDF/A forbids XFA forms',
+      remediation: 'Compress with removeXFA to drop the XFA data and keep the AcroForm fallback',
+    },
+  },
+  mobile: {
+    jpeg2000: {
+      note: 'JPEG 2000 images are slow or unsupported in several mobile viewers',
+      remediation: RERENDER_HINT,
+    },
+    jbig2: {
+      note: 'JBIG2 images are unsupported in some lightweight mobile viewers',
+      remediation: RERENDER_HINT,
+    },
+    xfa: {
+      note: 'XFA forms are not supported by mobile viewers',
+      remediation: XFA_HINT,
+    },
+    encryption: {
+      note: 'Some mobile viewers cannot open encrypted documents',
+      remediation: 'Distribute an unencrypted copy',
+    },
+  },
+};
+
+/**
+ * Detects which compatibility-relevant features the document uses
+ */
+export function detectFeatures(pdfDoc: PDFDocument, pdfBuffer: ArrayBuffer): Set<PdfFeature> {
+  const features = new Set<PdfFeature>();
+
+  if (pdfDoc.isEncrypted || pdfDoc.context.trailerInfo.Encrypt) {
+    features.add('encryption');
+  }
+
+  const acroForm = lookupDict(pdfDoc.catalog, 'AcroForm');
+  if (acroForm && acroForm.has(PDFName.of('XFA'))) {
+    features.add('xfa');
+  }
+
+  if (hasObjectStreams(toLatin1(pdfBuffer))) {
+    features.add('objectStreams');
+  }
+
+  visitDicts(pdfDoc, (dict, _ref, stream) => {
+    if (stream) {
+      const filters = getFilters(dict);
+      if (filters.includes('JBIG2Decode')) features.add('jbig2');
+      if (filters.includes('JPXDecode')) features.add('jpeg2000');
+      if (lookupName(dict, 'Subtype') === 'Image' && dict.has(PDFName.of('SMask'))) {
+        features.add('transparency');
+      }
+    }
+
+    if (usesTransparency(dict)) features.add('transparency');
+  });
+
+  return features;
+}
+
+/**
+ * Lists the detected features that are problematic for the target
+ */
+export function checkFeatureCompatibility(
+  features: Set<PdfFeature>,
+  target: CompatibilityTarget
+): CompatibilityIssue[] {
+  const notes = TARGET_NOTES[target];
+  const issues: CompatibilityIssue[] = [];
+
+  for (const feature of features) {
+    const note = notes[feature];
+    if (note) issues.push({ feature, ...note });
+  }
+
+  return issues;
+}
+
+function usesTransparency(dict: PDFDict): boolean {
+  // Transparency group (pages and form XObjects)
+  if (lookupName(dict, 'S') === 'Transparency') return true;
+
+  // ExtGState with constant alpha, soft mask or a blend mode
+  for (const key of ['CA', 'ca']) {
+    const alpha = dict.lookup(PDFName.of(key));
+    if (alpha instanceof PDFNumber && alpha.asNumber() < 1) return true;
+  }
+
+  // Soft mask dictionary (image soft masks are streams and handled separately)
+  if (dict.lookup(PDFName.of('SMask')) instanceof PDFDict) return true;
+
+  const blendMode = lookupName(dict, 'BM');
+  return blendMode !== undefined && blendMode !== 'Normal' && blendMode !== 'Compatible';
+}
@@ -0,0 +1,395 @@
+/**
+ * Content stream tokenizer
+ *
+ * Parses decoded content stream bytes into operators with their operands.
+ * Inline images (BI ... ID ... EI) are returned as a single BI operation
+ * carrying the image dictionary and raw data. serializeContent() writes
+ * operations back out.
+ */
+
+import { PDFArray, PDFPage, PDFStream } from 'pdf-lib';
+import type { ContentDict, ContentOperand } from '../api/types';
+import { decodeStreamContents } from './pdf-objects';
+
+/**
+ * Operator with the operands that precede it
+ */
+export interface ContentOperation {
+  operator: string;
+  operands: ContentOperand[];
+  /** Raw image data for inline images (operator 'BI') */
+  inlineImageData?: Uint8Array;
+}
+
+/**
+ * Operators that paint something on the page
+ */
+export const PAINTING_OPERATORS = new Set([
+  'S', 's', 'f', 'F', 'f*', 'B', 'B*', 'b', 'b*', 'sh', 'Do', 'BI',
+  'Tj', 'TJ', "'", '"', 'd0', 'd1',
+]);
+
+const WHITESPACE = new Set([0x00, 0x09, 0x0a, 0x0c, 0x0d, 0x20]);
+const DELIMITERS = new Set([0x28, 0x29, 0x3c, 0x3e, 0x5b, 0x5d, 0x7b, 0x7d, 0x2f, 0x25]);
+
+/**
+ * Returns the decoded content streams of a page, in drawing order
+ */
+export function getPageContentStreams(page: PDFPage): PDFStream[] {
+  const contents = page.node.Contents();
+  if (contents instanceof PDFStream) return [contents];
+  if (contents instanceof PDFArray) {
+    const streams: PDFStream[] = [];
+    for (let i = 0; i < contents.size(); i++) {
+      const stream = contents.lookup(i);
+      if (stream instanceof PDFStream) streams.push(stream);
+    }
+    return streams;
+  }
+  return [];
+}
+
+/**
+ * Parses all content streams of a page as one sequence of operations
+ */
+export function parsePageContent(page: PDFPage): ContentOperation[] {
+  const operations: ContentOperation[] = [];
+  for (const stream of getPageContentStreams(page)) {
+    const bytes = decodeStreamContents(stream);
+    if (bytes) operations.push(...parseContentStream(bytes));
+  }
+  return operations;
+}
+
+/**
+ * Parses decoded content stream bytes into operations
+ */
+export function parseContentStream(bytes: Uint8Array): ContentOperation[] {
+  const operations: ContentOperation[] = [];
+  // Stack of open arrays/dicts; the bottom entry collects operands
+  const stack: ContentOperand[][] = [[]];
+  const dictMarkers: number[] = [];
+  let pos = 0;
+
+  const push = (value: ContentOperand) => stack[stack.length - 1].push(value);
+
+  while (pos < bytes.length) {
+    const byte = bytes[pos];
+
+    if (WHITESPACE.has(byte)) {
+      pos++;
+    } else if (byte === 0x25) {
+      // % comment runs to end of line
+      while (pos < bytes.length && bytes[pos] !== 0x0a && bytes[pos] !== 0x0d) pos++;
+    } else if (byte === 0x28) {
+      const [value, end] = readLiteralString(bytes, pos);
+      push({ kind: 'string', value, hex: false });
+      pos = end;
+    } else if (byte === 0x3c && bytes[pos + 1] === 0x3c) {
+      stack.push([]);
+      dictMarkers.push(stack.length - 1);
+      pos += 2;
+    } else if (byte === 0x3e && bytes[pos + 1] === 0x3e) {
+      const items = dictMarkers.length > 0 && dictMarkers[dictMarkers.length - 1] === stack.length - 1
+        ? stack.pop()!
+        : [];
+      dictMarkers.pop();
+      push(toDict(items));
+      pos += 2;
+    } else if (byte === 0x3c) {
+      const end = bytes.indexOf(0x3e, pos);
+      const hexEnd = end === -1 ? bytes.length : end;
+      push({ kind: 'string', value: decodeHex(bytes.subarray(pos + 1, hexEnd)), hex: true });
+      pos = hexEnd + 1;
+    } else if (byte === 0x5b) {
+      stack.push([]);
+      pos++;
+    } else if (byte === 0x5d) {
+      if (stack.length > 1) {
+        const items = stack.pop()!;
+        push(items);
+      }
+      pos++;
+    } else if (byte === 0x2f) {
+      const end = readRegular(bytes, pos + 1);
+      push('/' + decodeName(latin1(bytes, pos + 1, end)));
+      pos = end;
+    } else if (byte === 0x7b || byte === 0x7d || byte === 0x29 || byte === 0x3e) {
+      // Stray delimiters (PostScript calculator braces, unbalanced parens)
+      pos++;
+    } else {
+      const end = Math.max(readRegular(bytes, pos), pos + 1);
+      const token = latin1(bytes, pos, end);
+      pos = end;
+
+      if (/^[+-]?(\d+\.?\d*|\.\d+)$/.test(token)) {
+        push(parseFloat(token));
+      } else if (token === 'true' || token === 'false') {
+        push(token === 'true');
+      } else if (token === 'null') {
+        push(null);
+      } else if (stack.length > 1) {
+        // Keywords are not valid inside arrays/dicts; keep them as names
+        push(token);
+      } else if (token === 'BI') {
+        const [operation, imageEnd] = readInlineImage(bytes, pos);
+        operations.push(operation);
+        pos = imageEnd;
+        stack[0] = [];
+      } else {
+        operations.push({ operator: token, operands: stack[0] });
+        stack[0] = [];
+      }
+    }
+  }
+
+  return operations;
+}
+
+/**
+ * Whether the operations leave no mark on the page and no lasting state
+ * for content that follows (balanced q/Q, BT/ET and marked content, no
+ * state changes outside a q/Q pair)
+ */
+export function isNoOpContent(operations: ContentOperation[]): boolean {
+  let saveDepth = 0;
+  let markedDepth = 0;
+  let textDepth = 0;
+
+  for (const { operator } of operations) {
+    if (PAINTING_OPERATORS.has(operator)) return false;
+
+    switch (operator) {
+      case 'q': saveDepth++; break;
+      case 'Q': if (--saveDepth < 0) return false; break;
+      case 'BMC': case 'BDC': markedDepth++; break;
+      case 'EMC': if (--markedDepth < 0) return false; break;
+      // Text objects don't nest, and one left open swallows what follows
+      case 'BT': if (++textDepth > 1) return false; break;
+      case 'ET': if (--textDepth < 0) return false; break;
+      case 'MP': case 'DP': case 'BX': case 'EX': break;
+      default:
+        // Any other operator changes graphics or text state
+        if (saveDepth === 0) return false;
+    }
+  }
+
+  return saveDepth === 0 && markedDepth === 0 && textDepth === 0;
+}
+
+/**
+ * Writes operations back to content stream bytes
+ */
+export function serializeContent(operations: ContentOperation[]): Uint8Array {
+  const chunks: Uint8Array[] = [];
+  let length = 0;
+  const write = (text: string) => {
+    const chunk = latin1Bytes(text);
+    chunks.push(chunk);
+    length += chunk.length;
+  };
+
+  for (const { operator, operands, inlineImageData } of operations) {
+    if (operator === 'BI') {
+      const params = operands[0];
+      const entries = params && typeof params === 'object' && !Array.isArray(params) && params.kind === 'dict'
+        ? Object.entries(params.entries)
+        : [];
+      const data = inlineImageData ?? new Uint8Array(0);
+      write(`BI ${entries.map(([key, value]) => `${formatName(key)} ${formatOperand(value)}`).join(' ')} ID `);
+      chunks.push(data);
+      length += data.length;
+      write('\nEI\n');
+    } else {
+      write([...operands.map(formatOperand), operator].join(' ') + '\n');
+    }
+  }
+
+  const bytes = new Uint8Array(length);
+  let offset = 0;
+  for (const chunk of chunks) {
+    bytes.set(chunk, offset);
+    offset += chunk.length;
+  }
+  return bytes;
+}
+
+function formatOperand(operand: ContentOperand): string {
+  if (operand === null) return 'null';
+  if (typeof operand === 'number') return formatNumber(operand);
+  if (typeof operand === 'boolean') return String(operand);
+  // Keywords kept inside arrays are written back unchanged
+  if (typeof operand === 'string') return operand.startsWith('/') ? formatName(operand.slice(1)) : operand;
+  if (Array.isArray(operand)) return `[${operand.map(formatOperand).join(' ')}]`;
+  if (operand.kind === 'dict') {
+    const entries = Object.entries(operand.entries)
+      .map(([key, value]) => `${formatName(key)} ${formatOperand(value)}`);
+    return `<<${entries.join(' ')}>>`;
+  }
+  return operand.hex ? formatHexString(operand.value) : formatLiteralString(operand.value);
+}
+
+function formatNumber(value: number): string {
+  if (Number.isInteger(value)) return String(value);
+  // Content streams don't allow exponents
+  return value.toFixed(6).replace(/0+$/, '').replace(/\.$/, '');
+}
+
+function formatName(name: string): string {
+  let text = '/';
+  for (let i = 0; i < name.length; i++) {
+    const code = name.charCodeAt(i);
+    const regular = code > 0x20 && code < 0x7f && code !== 0x23 && !DELIMITERS.has(code);
+    text += regular ? name[i] : '#' + code.toString(16).padStart(2, '0');
+  }
+  return text;
+}
+
+function formatLiteralString(value: string): string {
+  return '(' + value.replace(/[\\()\r]/g, char => (char === '\r' ? '\\r' : '\\' + char)) + ')';
+}
+
+function formatHexString(value: string): string {
+  let hex = '';
+  for (let i = 0; i < value.length; i++) hex += value.charCodeAt(i).toString(16).padStart(2, '0');
+  return `<${hex}>`;
+}
+
+function latin1Bytes(text: string): Uint8Array {
+  const bytes = new Uint8Array(text.length);
+  for (let i = 0; i < text.length; i++) bytes[i] = text.charCodeAt(i) & 0xff;
+  return bytes;
+}
+
+function readRegular(bytes: Uint8Array, pos: number): number {
+  while (pos < bytes.length && !WHITESPACE.has(bytes[pos]) && !DELIMITERS.has(bytes[pos])) pos++;
+  return pos;
+}
+
+function latin1(bytes: Uint8Array, start: number, end: number): string {
+  let text = '';
+  for (let i = start; i < end; i++) text += String.fromCharCode(bytes[i]);
+  return text;
+}
+
+function decodeName(name: string): string {
+  return name.replace(/#([0-9a-fA-F]{2})/g, (_, hex) => String.fromCharCode(parseInt(hex, 16)));
+}
+
+function decodeHex(bytes: Uint8Array): string {
+  const digits = latin1(bytes, 0, bytes.length).replace(/[^0-9a-fA-F]/g, '');
+  const padded = digits.length % 2 ? digits + '0' : digits;
+  let text = '';
+  for (let i = 0; i < padded.length; i += 2) {
+    text += String.fromCharCode(parseInt(padded.slice(i, i + 2), 16));
+  }
+  return text;
+}
+
+function readLiteralString(bytes: Uint8Array, start: number): [string, number] {
+  const escapes: Record<number, string> = {
+    0x6e: '\n', 0x72: '\r', 0x74: '\t', 0x62: '\b', 0x66: '\f',
+    0x28: '(', 0x29: ')', 0x5c: '\\',
+  };
+  let text = '';
+  let depth = 1;
+  let pos = start + 1;
+
+  while (pos < bytes.length) {
+    const byte = bytes[pos];
+
+    if (byte === 0x5c) {
+      const next = bytes[pos + 1];
+      if (next >= 0x30 && next <= 0x37) {
+        // Octal escape, up to three digits
+        let octal = '';
+        let i = pos + 1;
+        while (i < bytes.length && octal.length < 3 && bytes[i] >= 0x30 && bytes[i] <= 0x37) {
+          octal += String.fromCharCode(bytes[i++]);
+        }
+        text += String.fromCharCode(parseInt(octal, 8) & 0xff);
+        pos = i;
+      } else if (next === 0x0d || next === 0x0a) {
+        // Line continuation
+        pos += next === 0x0d && bytes[pos + 2] === 0x0a ? 3 : 2;
+      } else {
+        text += escapes[next] ?? String.fromCharCode(next);
+        pos += 2;
+      }
+      continue;
+    }
+
+    if (byte === 0x28) depth++;
+    if (byte === 0x29 && --depth === 0) return [text, pos + 1];
+    text += String.fromCharCode(byte);
+    pos++;
+  }
+
+  return [text, pos];
+}
+
+function toDict(items: ContentOperand[]): ContentDict {
+  const entries: Record<string, ContentOperand> = {};
+  for (let i = 0; i + 1 < items.length; i += 2) {
+    const key = items[i];
+    if (typeof key === 'string') entries[key.replace(/^\//, '')] = items[i + 1];
+  }
+  return { kind: 'dict', entries };
+}
+
+function readInlineImage(bytes: Uint8Array, start: number): [ContentOperation, number] {
+  // Parameters run up to the ID keyword
+  const idMatch = findKeyword(bytes, start, 'ID');
+  const paramEnd = idMatch === -1 ? bytes.length : idMatch;
+  const params = parseInlineImageParams(bytes.subarray(start, paramEnd));
+
+  // Data starts after a single whitespace byte and ends before whitespace + EI
+  const dataStart = Math.min(paramEnd + 3, bytes.length);
+  let dataEnd = bytes.length;
+  let end = bytes.length;
+  for (let i = dataStart; i + 1 < bytes.length; i++) {
+    if (
+      bytes[i] === 0x45 && bytes[i + 1] === 0x49 &&
+      WHITESPACE.has(bytes[i - 1]) &&
+      (i + 2 >= bytes.length || WHITESPACE.has(bytes[i + 2]) || DELIMITERS.has(bytes[i + 2]))
+    ) {
+      dataEnd = i - 1;
+      end = i + 2;
+      break;
+    }
+  }
+
+  return [
+    {
+      operator: 'BI',
+      operands: [toDict(params)],
+      inlineImageData: bytes.slice(dataStart, Math.max(dataStart, dataEnd)),
+    },
+    end,
+  ];
+}
+
+function parseInlineImageParams(bytes: Uint8Array): ContentOperand[] {
+  // Inline image parameters contain no operators, so parsing them with a
+  // sentinel operator collects them all as operands
+  const withSentinel = new Uint8Array(bytes.length + 2);
+  withSentinel.set(bytes);
+  withSentinel.set([0x20, 0x5a], bytes.length); // " Z"
+  const operations = parseContentStream(withSentinel);
+  return operations.length > 0 ? operations[operations.length - 1].operands : [];
+}
+
+function findKeyword(bytes: Uint8Array, start: number, keyword: string): number {
+  const first = keyword.charCodeAt(0);
+  const second = keyword.charCodeAt(1);
+  for (let i = start; i + 1 < bytes.length; i++) {
+    if (
+      bytes[i] === first && bytes[i + 1] === second &&
+      (i === 0 || WHITESPACE.has(bytes[i - 1]) || DELIMITERS.has(bytes[i - 1])) &&
+      (i + 2 >= bytes.length || WHITESPACE.has(bytes[i + 2]))
+    ) {
+      return i;
+    }
+  }
+  return -1;
+}
@@ -0,0 +1,120 @@
+/**
+ * Generated sheet layouts
+ *
+ * QR cover sheets (the code centered on the page with its quiet zone, and
+ * an optional title above it) and labeled divider pages for merges.
+ */
+
+import { PDFDocument, PDFFont, PDFPage, rgb } from 'pdf-lib';
+import type { QrCode } from './qr';
+
+/** Light modules around the code that scanners need to find it */
+export const QUIET_ZONE = 4;
+
+const TITLE_FONT_SIZE = 24;
+const TITLE_GAP = 24;
+const PAGE_MARGIN = 36;
+
+/** Line height of divider labels, in font sizes */
+const LINE_SPACING = 1.25;
+
+/**
+ * Adds a page holding a QR code and an optional title
+ *
+ * @param size - Side of the code in points, quiet zone included
+ */
+export function addQrCoverPage(
+  pdfDoc: PDFDocument,
+  code: QrCode,
+  size: number,
+  pageSize: [number, number],
+  font: PDFFont,
+  title?: string
+): void {
+  const page = pdfDoc.addPage(pageSize);
+  const [width, height] = pageSize;
+  const moduleSize = size / (code.size + QUIET_ZONE * 2);
+  const left = (width - size) / 2 + QUIET_ZONE * moduleSize;
+  const top = (height + size) / 2 - QUIET_ZONE * moduleSize;
+
+  // One subpath per horizontal run of dark modules, in module units
+  let path = '';
+  code.modules.forEach((row, y) => {
+    for (let x = 0; x < row.length; x++) {
+      if (!row[x]) continue;
+      const start = x;
+      while (x + 1 < row.length && row[x + 1]) x++;
+      path += `M${start} ${y}h${x + 1 - start}v1h${start - x - 1}z`;
+    }
+  });
+  page.drawSvgPath(path, { x: left, y: top, scale: moduleSize, color: rgb(0, 0, 0) });
+
+  if (title) {
+    const fontSize = Math.min(TITLE_FONT_SIZE, (TITLE_FONT_SIZE * (width - PAGE_MARGIN * 2)) / font.widthOfTextAtSize(title, TITLE_FONT_SIZE));
+    page.drawText(title, {
+      x: (width - font.widthOfTextAtSize(title, fontSize)) / 2,
+      y: Math.min((height + size) / 2 + TITLE_GAP, height - PAGE_MARGIN - fontSize),
+      size: fontSize,
+      font,
+      color: rgb(0, 0, 0),
+    });
+  }
+}
+
+/**
+ * Draws a label centered on a divider page, wrapped at word boundaries
+ * to fit between the margins
+ *
+ * @param style.textColor - RGB components (0-1)
+ * @param style.background - RGB components (0-1); the page stays
+ *   unpainted if omitted
+ */
+export function drawDividerPage(
+  page: PDFPage,
+  label: string,
+  font: PDFFont,
+  style: { fontSize: number; textColor: [number, number, number]; background?: [number, number, number] }
+): void {
+  const { width, height } = page.getSize();
+  if (style.background) {
+    page.drawRectangle({ x: 0, y: 0, width, height, color: rgb(...style.background) });
+  }
+
+  const maxWidth = width - PAGE_MARGIN * 2;
+  const lines = wrapText(label, font, style.fontSize, maxWidth);
+  // Words too long for a line are shrunk to fit rather than broken
+  const widest = Math.max(...lines.map(line => font.widthOfTextAtSize(line, style.fontSize)));
+  const fontSize = widest > maxWidth ? (style.fontSize * maxWidth) / widest : style.fontSize;
+  const lineHeight = fontSize * LINE_SPACING;
+
+  // Center the block of lines; y is each line's baseline
+  let y = height / 2 + ((lines.length - 1) * lineHeight) / 2 - font.heightAtSize(fontSize, { descender: false }) / 2;
+  for (const line of lines) {
+    page.drawText(line, {
+      x: (width - font.widthOfTextAtSize(line, fontSize)) / 2,
+      y,
+      size: fontSize,
+      font,
+      color: rgb(...style.textColor),
+    });
+    y -= lineHeight;
+  }
+}
+
+function wrapText(text: string, font: PDFFont, fontSize: number, maxWidth: number): string[] {
+  const lines: string[] = [];
+  for (const paragraph of text.split(/\r?\n/)) {
+    let line = '';
+    for (const word of paragraph.split(/\s+/).filter(Boolean)) {
+      const candidate = line ? `${line} ${word}` : word;
+      if (line && font.widthOfTextAtSize(candidate, fontSize) > maxWidth) {
+        lines.push(line);
+        line = word;
+      } else {
+        line = candidate;
+      }
+    }
+    lines.push(line);
+  }
+  return lines;
+}
@@ -0,0 +1,143 @@
+/**
+ * Hash and cipher primitives for the PDF standard security handler
+ *
+ * MD5 and RC4 aren't available in Web Crypto, so they are implemented
+ * here; SHA-2 and AES come from crypto.subtle.
+ */
+
+const MD5_SHIFTS = [
+  7, 12, 17, 22, 7, 12, 17, 22, 7, 12, 17, 22, 7, 12, 17, 22,
+  5, 9, 14, 20, 5, 9, 14, 20, 5, 9, 14, 20, 5, 9, 14, 20,
+  4, 11, 16, 23, 4, 11, 16, 23, 4, 11, 16, 23, 4, 11, 16, 23,
+  6, 10, 15, 21, 6, 10, 15, 21, 6, 10, 15, 21, 6, 10, 15, 21,
+];
+
+const MD5_CONSTANTS = Array.from({ length: 64 }, (_, i) => Math.floor(Math.abs(Math.sin(i + 1)) * 2 ** 32) >>> 0);
+
+/**
+ * MD5 digest (RFC 1321)
+ */
+export function md5(data: Uint8Array): Uint8Array {
+  const paddedLength = (((data.length + 8) >> 6) + 1) << 6;
+  const padded = new Uint8Array(paddedLength);
+  padded.set(data);
+  padded[data.length] = 0x80;
+  const view = new DataView(padded.buffer);
+  view.setUint32(paddedLength - 8, (data.length * 8) >>> 0, true);
+  view.setUint32(paddedLength - 4, Math.floor(data.length / 0x20000000), true);
+
+  let a0 = 0x67452301;
+  let b0 = 0xefcdab89;
+  let c0 = 0x98badcfe;
+  let d0 = 0x10325476;
+
+  for (let offset = 0; offset < paddedLength; offset += 64) {
+    let a = a0;
+    let b = b0;
+    let c = c0;
+    let d = d0;
+
+    for (let i = 0; i < 64; i++) {
+      let f: number;
+      let g: number;
+      if (i < 16) {
+        f = (b & c) | (~b & d);
+        g = i;
+      } else if (i < 32) {
+        f = (d & b) | (~d & c);
+        g = (5 * i + 1) % 16;
+      } else if (i < 48) {
+        f = b ^ c ^ d;
+        g = (3 * i + 5) % 16;
+      } else {
+        f = c ^ (b | ~d);
+        g = (7 * i) % 16;
+      }
+
+      const sum = (a + f + MD5_CONSTANTS[i] + view.getUint32(offset + g * 4, true)) >>> 0;
+      a = d;
+      d = c;
+      c = b;
+      b = (b + ((sum << MD5_SHIFTS[i]) | (sum >>> (32 - MD5_SHIFTS[i])))) >>> 0;
+    }
+
+    a0 = (a0 + a) >>> 0;
+    b0 = (b0 + b) >>> 0;
+    c0 = (c0 + c) >>> 0;
+    d0 = (d0 + d) >>> 0;
+  }
+
+  const digest = new Uint8Array(16);
+  const digestView = new DataView(digest.buffer);
+  [a0, b0, c0, d0].forEach((word, i) => digestView.setUint32(i * 4, word, true));
+  return digest;
+}
+
+/**
+ * RC4 stream cipher (encryption and decryption are the same operation)
+ */
+export function rc4(key: Uint8Array, data: Uint8Array): Uint8Array {
+  const state = new Uint8Array(256);
+  for (let i = 0; i < 256; i++) state[i] = i;
+
+  for (let i = 0, j = 0; i < 256; i++) {
+    j = (j + state[i] + key[i % key.length]) & 0xff;
+    [state[i], state[j]] = [state[j], state[i]];
+  }
+
+  const output = new Uint8Array(data.length);
+  for (let n = 0, i = 0, j = 0; n < data.length; n++) {
+    i = (i + 1) & 0xff;
+    j = (j + state[i]) & 0xff;
+    [state[i], state[j]] = [state[j], state[i]];
+    output[n] = data[n] ^ state[(state[i] + state[j]) & 0xff];
+  }
+  return output;
+}
+
+/**
+ * SHA-256, SHA-384 or SHA-512 digest
+ */
+export async function sha(bits: 256 | 384 | 512, data: Uint8Array): Promise<Uint8Array> {
+  return new Uint8Array(await crypto.subtle.digest(`SHA-${bits}`, data));
+}
+
+/**
+ * AES-CBC encryption with a 128 or 256-bit key, adding PKCS#7 padding
+ * unless padded is false (block-aligned data, output the same length)
+ */
+export async function aesCbcEncrypt(key: Uint8Array, iv: Uint8Array, data: Uint8Array, padded = true): Promise<Uint8Array> {
+  const cryptoKey = await crypto.subtle.importKey('raw', key, 'AES-CBC', false, ['encrypt']);
+  const encrypted = new Uint8Array(await crypto.subtle.encrypt({ name: 'AES-CBC', iv }, cryptoKey, data));
+  // Web Crypto always appends a PKCS#7 block; aligned input makes it a whole extra block
+  return padded ? encrypted : encrypted.subarray(0, data.length);
+}
+
+/**
+ * AES-CBC decryption with a 128 or 256-bit key, removing PKCS#7 padding
+ * unless padded is false (block-aligned data without padding)
+ */
+export async function aesCbcDecrypt(key: Uint8Array, iv: Uint8Array, data: Uint8Array, padded = true): Promise<Uint8Array> {
+  const cryptoKey = await crypto.subtle.importKey('raw', key, 'AES-CBC', false, ['encrypt', 'decrypt']);
+  let input = data;
+  if (!padded) {
+    // Web Crypto requires padding, so a block that decrypts to a whole padding block is appended
+    const previous = data.length >= 16 ? data.subarray(data.length - 16) : iv;
+    const padding = await crypto.subtle.encrypt({ name: 'AES-CBC', iv: previous }, cryptoKey, new Uint8Array(16).fill(16));
+    input = concatBytes(data, new Uint8Array(padding, 0, 16));
+  }
+  return new Uint8Array(await crypto.subtle.decrypt({ name: 'AES-CBC', iv }, cryptoKey, input));
+}
+
+/**
+ * Concatenates byte arrays
+ */
+export function concatBytes(...parts: Uint8Array[]): Uint8Array {
+  const bytes = new Uint8Array(parts.reduce((sum, part) => sum + part.length, 0));
+  let offset = 0;
+  for (const part of parts) {
+    bytes.set(part, offset);
+    offset += part.length;
+  }
+  return bytes;
+}
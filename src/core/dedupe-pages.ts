@@ -0,0 +1,207 @@
+/**
+ * Identical page removal
+ *
+ * Pages are only treated as duplicates when everything that affects how
+ * they look is identical: content, resources, page boxes, rotation and
+ * transparency group. Pages with annotations or structure (tagging) are
+ * never removed, since those tie a page to document-level data.
+ * Bookmarks, destinations and links that target a removed page are
+ * pointed at the identical page that stays.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFName, PDFObject, PDFPage, PDFRef, PDFStream } from 'pdf-lib';
+import type { PageDedupeMode, PageDedupeReport } from '../api/types';
+import { getPageContentStreams } from './content-stream';
+import { decodeStreamContents, replaceReferences } from './pdf-objects';
+
+/**
+ * Removes pages identical to an earlier page
+ *
+ * @param mode - 'adjacent' only collapses runs of consecutive duplicates;
+ *   'all' removes a page identical to any earlier kept page
+ */
+export function dedupePages(pdfDoc: PDFDocument, mode: PageDedupeMode): PageDedupeReport {
+  const pages = pdfDoc.getPages();
+  const fingerprints: string[] = [];
+  const survivors = new Map<string, number[]>();
+  const removed: PageDedupeReport['removed'] = [];
+  let previous: number | undefined;
+
+  pages.forEach((page, index) => {
+    if (!isRemovable(page)) {
+      previous = undefined;
+      return;
+    }
+
+    const fingerprint = pageFingerprint(page);
+    fingerprints[index] = fingerprint;
+    const candidates = mode === 'adjacent'
+      ? (previous !== undefined ? [previous] : [])
+      : survivors.get(fingerprint) ?? [];
+
+    const match = candidates.find(candidate =>
+      fingerprints[candidate] === fingerprint && pagesEqual(pages[candidate], page)
+    );
+
+    if (match !== undefined) {
+      removed.push({ page: index + 1, survivor: match + 1 });
+      // In adjacent mode a run keeps comparing against its first page
+      return;
+    }
+
+    previous = index;
+    survivors.set(fingerprint, [...(survivors.get(fingerprint) ?? []), index]);
+  });
+
+  for (let i = removed.length - 1; i >= 0; i--) {
+    pdfDoc.removePage(removed[i].page - 1);
+  }
+  // After removal, so the page tree doesn't list a survivor twice
+  if (removed.length > 0) {
+    const retargets = new Map(removed.map(({ page, survivor }) => [pages[page - 1].ref, pages[survivor - 1].ref]));
+    replaceReferences(pdfDoc, retargets);
+  }
+
+  return { pagesRemoved: removed.length, removed };
+}
+
+/**
+ * Groups pages that look identical, without removing anything
+ *
+ * Unlike dedupePages, annotated and tagged pages are included; only what
+ * is drawn is compared.
+ *
+ * @returns Groups of two or more page numbers (1-indexed), in document order
+ */
+export function groupIdenticalPages(pdfDoc: PDFDocument): number[][] {
+  const pages = pdfDoc.getPages();
+  const buckets = new Map<string, number[][]>();
+  const groups: number[][] = [];
+
+  pages.forEach((page, index) => {
+    const fingerprint = pageFingerprint(page);
+    const bucket = buckets.get(fingerprint) ?? [];
+    const group = bucket.find(candidate => pagesEqual(pages[candidate[0]], page));
+    if (group) {
+      group.push(index);
+      return;
+    }
+    const created = [index];
+    bucket.push(created);
+    buckets.set(fingerprint, bucket);
+    groups.push(created);
+  });
+
+  return groups.filter(group => group.length > 1).map(group => group.map(index => index + 1));
+}
+
+function isRemovable(page: PDFPage): boolean {
+  const annots = page.node.Annots();
+  return (annots === undefined || annots.size() === 0) && !page.node.has(PDFName.of('StructParents'));
+}
+
+/**
+ * Cheap key for bucketing: page geometry plus a hash of the content
+ */
+function pageFingerprint(page: PDFPage): string {
+  const { x, y, width, height } = page.getMediaBox();
+  let hash = 0x811c9dc5;
+  let length = 0;
+  for (const stream of getPageContentStreams(page)) {
+    const bytes = decodeStreamContents(stream) ?? stream.getContents();
+    hash = fnv1a(bytes, hash);
+    length += bytes.length;
+  }
+  return `${x},${y},${width},${height},${page.getRotation().angle},${length},${hash >>> 0}`;
+}
+
+function pagesEqual(a: PDFPage, b: PDFPage): boolean {
+  const boxes = ['getMediaBox', 'getCropBox', 'getBleedBox', 'getTrimBox', 'getArtBox'] as const;
+  for (const box of boxes) {
+    const boxA = a[box]();
+    const boxB = b[box]();
+    if (boxA.x !== boxB.x || boxA.y !== boxB.y || boxA.width !== boxB.width || boxA.height !== boxB.height) {
+      return false;
+    }
+  }
+  if (a.getRotation().angle !== b.getRotation().angle) return false;
+
+  const streamsA = getPageContentStreams(a);
+  const streamsB = getPageContentStreams(b);
+  if (!bytesEqual(concatContent(streamsA), concatContent(streamsB))) return false;
+
+  const visited = new Set<string>();
+  return ['Group', 'UserUnit'].every(key =>
+    objectsEqual(a.node.get(PDFName.of(key)), b.node.get(PDFName.of(key)), a.doc, visited)
+  ) && objectsEqual(a.node.Resources(), b.node.Resources(), a.doc, visited);
+}
+
+/**
+ * Deep structural equality; references are followed, and a pair already
+ * being compared is assumed equal (cycles)
+ */
+function objectsEqual(
+  a: PDFObject | undefined,
+  b: PDFObject | undefined,
+  pdfDoc: PDFDocument,
+  visited: Set<string>
+): boolean {
+  if (a === b) return true;
+  if (a === undefined || b === undefined) return false;
+
+  if (a instanceof PDFRef || b instanceof PDFRef) {
+    const key = `${a.toString()}|${b.toString()}`;
+    if (visited.has(key)) return true;
+    visited.add(key);
+    return objectsEqual(pdfDoc.context.lookup(a), pdfDoc.context.lookup(b), pdfDoc, visited);
+  }
+
+  if (a instanceof PDFStream || b instanceof PDFStream) {
+    return a instanceof PDFStream && b instanceof PDFStream &&
+      objectsEqual(a.dict, b.dict, pdfDoc, visited) &&
+      bytesEqual(a.getContents(), b.getContents());
+  }
+
+  if (a instanceof PDFDict || b instanceof PDFDict) {
+    if (!(a instanceof PDFDict && b instanceof PDFDict)) return false;
+    const keysA = a.keys();
+    if (keysA.length !== b.keys().length) return false;
+    return keysA.every(key => b.has(key) && objectsEqual(a.get(key), b.get(key), pdfDoc, visited));
+  }
+
+  if (a instanceof PDFArray || b instanceof PDFArray) {
+    if (!(a instanceof PDFArray && b instanceof PDFArray) || a.size() !== b.size()) return false;
+    return a.asArray().every((item, i) => objectsEqual(item, b.get(i), pdfDoc, visited));
+  }
+
+  // Numbers, names, strings, booleans, null
+  return a.toString() === b.toString();
+}
+
+function concatContent(streams: PDFStream[]): Uint8Array {
+  const parts = streams.map(stream => decodeStreamContents(stream) ?? stream.getContents());
+  const bytes = new Uint8Array(parts.reduce((sum, part) => sum + part.length, 0));
+  let offset = 0;
+  for (const part of parts) {
+    bytes.set(part, offset);
+    offset += part.length;
+  }
+  return bytes;
+}
+
+function bytesEqual(a: Uint8Array, b: Uint8Array): boolean {
+  if (a.length !== b.length) return false;
+  for (let i = 0; i < a.length; i++) {
+    if (a[i] !== b[i]) return false;
+  }
+  return true;
+}
+
+function fnv1a(bytes: Uint8Array, seed: number): number {
+  let hash = seed;
+  for (let i = 0; i < bytes.length; i++) {
+    hash ^= bytes[i];
+    hash = Math.imul(hash, 0x01000193);
+  }
+  return hash;
+}
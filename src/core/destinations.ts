@@ -0,0 +1,107 @@
+/**
+ * Destination resolution
+ *
+ * Turns explicit destinations, named destinations and GoTo actions into
+ * concrete page numbers.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFHexString, PDFName, PDFNumber, PDFObject, PDFRef, PDFString } from 'pdf-lib';
+import { lookupDict, lookupName, readNameTree } from './pdf-objects';
+
+/**
+ * Page and named-destination tables needed to resolve destinations
+ */
+export interface DestinationLookup {
+  /** Page reference ("12 0 R") to 1-indexed page number */
+  pageNumbers: Map<string, number>;
+  /** Named destinations from the catalog /Dests dict and /Names /Dests tree */
+  namedDests: Map<string, PDFObject>;
+}
+
+/**
+ * Builds the lookup tables for a document
+ */
+export function createDestinationLookup(pdfDoc: PDFDocument): DestinationLookup {
+  const pageNumbers = new Map<string, number>();
+  pdfDoc.getPages().forEach((page, index) => {
+    pageNumbers.set(page.ref.toString(), index + 1);
+  });
+
+  const namedDests = new Map<string, PDFObject>();
+
+  // PDF 1.1 style: /Dests dictionary keyed by name
+  const destsDict = lookupDict(pdfDoc.catalog, 'Dests');
+  if (destsDict) {
+    for (const [key, value] of destsDict.entries()) {
+      namedDests.set(key.decodeText(), value);
+    }
+  }
+
+  // PDF 1.2+ style: /Names /Dests name tree keyed by string
+  const names = lookupDict(pdfDoc.catalog, 'Names');
+  const destsTree = names && lookupDict(names, 'Dests');
+  if (destsTree) {
+    for (const [key, value] of readNameTree(destsTree)) {
+      if (!namedDests.has(key)) namedDests.set(key, value);
+    }
+  }
+
+  return { pageNumbers, namedDests };
+}
+
+/**
+ * Resolves a destination (explicit array, name or string) to a 1-indexed page
+ *
+ * @returns The page number, or null if the destination can't be resolved
+ */
+export function resolveDestinationPage(
+  pdfDoc: PDFDocument,
+  dest: PDFObject | undefined,
+  lookup: DestinationLookup
+): number | null {
+  let value = dest instanceof PDFRef ? pdfDoc.context.lookup(dest) : dest;
+
+  if (value instanceof PDFName) {
+    value = lookup.namedDests.get(value.decodeText());
+  } else if (value instanceof PDFString || value instanceof PDFHexString) {
+    value = lookup.namedDests.get(value.decodeText());
+  }
+
+  if (value instanceof PDFRef) value = pdfDoc.context.lookup(value);
+
+  // Named destinations may be wrapped in a dictionary with a /D entry
+  if (value instanceof PDFDict) value = value.lookup(PDFName.of('D'));
+
+  if (!(value instanceof PDFArray) || value.size() === 0) return null;
+
+  const target = value.get(0);
+  if (target instanceof PDFRef) {
+    return lookup.pageNumbers.get(target.toString()) ?? null;
+  }
+  if (target instanceof PDFNumber) {
+    // Remote-style destinations use a 0-indexed page number
+    const index = target.asNumber();
+    return Number.isInteger(index) && index >= 0 && index < pdfDoc.getPageCount() ? index + 1 : null;
+  }
+  return null;
+}
+
+/**
+ * Resolves the target page of a dictionary carrying /Dest or a GoTo /A
+ * (outline items and link annotations)
+ */
+export function resolveItemPage(
+  pdfDoc: PDFDocument,
+  item: PDFDict,
+  lookup: DestinationLookup
+): number | null {
+  const dest = item.get(PDFName.of('Dest'));
+  if (dest) return resolveDestinationPage(pdfDoc, dest, lookup);
+
+  const action = lookupDict(item, 'A');
+  if (action && lookupName(action, 'S') === 'GoTo') {
+    return resolveDestinationPage(pdfDoc, action.get(PDFName.of('D')), lookup);
+  }
+
+  return null;
+}
@@ -0,0 +1,100 @@
+/**
+ * Repeated text block detection
+ *
+ * Blocks are compared on normalized word shingles, so whitespace,
+ * punctuation and case differences don't hide repeats.
+ */
+
+import type { DuplicateTextCluster } from '../api/types';
+
+/**
+ * Text block with the page it was found on
+ */
+export interface PageTextBlock {
+  page: number;
+  text: string;
+}
+
+interface Cluster {
+  representative: Set<string>;
+  result: DuplicateTextCluster;
+}
+
+/**
+ * Clusters blocks whose shingle similarity reaches the threshold
+ *
+ * @returns Clusters with at least two occurrences
+ */
+export function findDuplicateBlocks(
+  blocks: PageTextBlock[],
+  minBlockLength: number,
+  minSimilarity: number
+): DuplicateTextCluster[] {
+  const clusters: Cluster[] = [];
+
+  for (const block of blocks) {
+    const normalized = normalizeText(block.text);
+    if (normalized.length < minBlockLength) continue;
+
+    const shingles = toShingles(normalized);
+    let best: Cluster | undefined;
+    let bestSimilarity = 0;
+
+    for (const cluster of clusters) {
+      const similarity = jaccard(shingles, cluster.representative);
+      if (similarity >= minSimilarity && similarity > bestSimilarity) {
+        best = cluster;
+        bestSimilarity = similarity;
+      }
+    }
+
+    if (best) {
+      best.result.occurrences.push({ page: block.page, text: block.text, similarity: bestSimilarity });
+      best.result.similarity = Math.min(best.result.similarity, bestSimilarity);
+    } else {
+      clusters.push({
+        representative: shingles,
+        result: {
+          text: block.text,
+          similarity: 1,
+          occurrences: [{ page: block.page, text: block.text, similarity: 1 }],
+        },
+      });
+    }
+  }
+
+  return clusters
+    .map(cluster => cluster.result)
+    .filter(result => result.occurrences.length > 1);
+}
+
+function normalizeText(text: string): string {
+  return text
+    .toLowerCase()
+    .replace(/[^\p{L}\p{N}]+/gu, ' ')
+    .trim();
+}
+
+function toShingles(normalized: string, size = 3): Set<string> {
+  const words = normalized.split(' ');
+  const shingles = new Set<string>();
+
+  if (words.length <= size) {
+    shingles.add(words.join(' '));
+    return shingles;
+  }
+
+  for (let i = 0; i + size <= words.length; i++) {
+    shingles.add(words.slice(i, i + size).join(' '));
+  }
+  return shingles;
+}
+
+function jaccard(a: Set<string>, b: Set<string>): number {
+  let intersection = 0;
+  for (const shingle of a) {
+    if (b.has(shingle)) intersection++;
+  }
+  const union = a.size + b.size - intersection;
+  return union === 0 ? 0 : intersection / union;
+}
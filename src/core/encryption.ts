@@ -0,0 +1,287 @@
+/**
+ * Decryption and AES-256 encryption of standard security handler documents
+ *
+ * pdf-lib loads encrypted files but can't read their strings and
+ * streams, so every pass would see ciphertext. Once a password gives
+ * the file key, each object's strings and streams are decrypted in place
+ * and the encryption dictionary is removed. Object streams are encrypted
+ * as a whole, so pdf-lib fails to unpack them on load and keeps them as
+ * invalid objects; they are decrypted and unpacked here.
+ *
+ * pdf-lib can't write encrypted files either, so encryption works the
+ * same way in reverse, with revision 6 (AES-256) only.
+ */
+
+import {
+  PDFArray,
+  PDFBool,
+  PDFDict,
+  PDFDocument,
+  PDFHexString,
+  PDFInvalidObject,
+  PDFName,
+  PDFObject,
+  PDFObjectParser,
+  PDFObjectStreamParser,
+  PDFRawStream,
+  PDFRef,
+  PDFStream,
+  PDFString,
+} from 'pdf-lib';
+import { aesCbcDecrypt, aesCbcEncrypt, concatBytes, md5, rc4 } from './crypto';
+import { getFilters, lookupDict, lookupName, lookupNumber } from './pdf-objects';
+import { deriveFileKey, passwordHash } from './security';
+
+/** How strings or streams are encrypted */
+type Cipher = 'none' | 'RC4' | 'AESV2' | 'AESV3';
+
+/** Appended to the object key input for AES-128 (algorithm 1) */
+const AES_SALT = new Uint8Array([0x73, 0x41, 0x6c, 0x54]);
+
+/**
+ * Passwords and permissions for encryptAes256()
+ */
+export interface Aes256Settings {
+  userPassword: string;
+  ownerPassword: string;
+  /** Permission bits (P) */
+  permissions: number;
+  /** Whether XMP metadata streams are encrypted too */
+  encryptMetadata: boolean;
+}
+
+/**
+ * Decrypts an encrypted document in place with its user or owner password
+ *
+ * Streams with their own Crypt filter and, when EncryptMetadata is false,
+ * XMP metadata streams are not encrypted and are left as they are.
+ * Signature values are never encrypted either.
+ *
+ * @returns false if the password is wrong, leaving the document unchanged
+ * @throws If the document isn't encrypted, uses another security handler
+ *   or an unsupported revision or cipher
+ */
+export async function decryptDocument(pdfDoc: PDFDocument, password: string): Promise<boolean> {
+  const context = pdfDoc.context;
+  const encryptRef = context.trailerInfo.Encrypt;
+  const encrypt = encryptRef && context.lookup(encryptRef);
+  if (!(encrypt instanceof PDFDict)) throw new Error('The document is not encrypted');
+
+  const version = lookupNumber(encrypt, 'V') ?? 0;
+  const stringCipher = readCipher(encrypt, version, 'StrF');
+  const streamCipher = readCipher(encrypt, version, 'StmF');
+  const fileKey = await deriveFileKey(pdfDoc, encrypt, password);
+  if (!fileKey) return false;
+
+  const encryptMetadata = encrypt.lookup(PDFName.of('EncryptMetadata')) !== PDFBool.False;
+  const objectStreams: Array<[PDFRef, PDFRawStream]> = [];
+
+  for (const [ref, object] of context.enumerateIndirectObjects()) {
+    if (object === encrypt) continue;
+
+    if (object instanceof PDFInvalidObject) {
+      const stream = reparseObjectStream(pdfDoc, object);
+      if (stream) objectStreams.push([ref, stream]);
+      continue;
+    }
+
+    const stringKey = objectKey(fileKey, ref, stringCipher);
+    const decryptString = (bytes: Uint8Array) => decryptBytes(bytes, stringKey, stringCipher);
+    if (object instanceof PDFRawStream) {
+      if (stringCipher !== 'none') await mapStrings(object.dict, decryptString);
+      const filters = getFilters(object.dict);
+      const plainMetadata = !encryptMetadata && lookupName(object.dict, 'Type') === 'Metadata';
+      if (!filters.includes('Crypt') && !plainMetadata) {
+        const contents = await decryptBytes(object.contents, objectKey(fileKey, ref, streamCipher), streamCipher);
+        context.assign(ref, PDFRawStream.of(object.dict, contents));
+      }
+    } else if (stringCipher !== 'none') {
+      const decrypted = await mapStrings(object, decryptString);
+      if (decrypted) context.assign(ref, decrypted);
+    }
+  }
+
+  // The objects inside were encrypted with their stream, so only the stream is decrypted
+  for (const [ref, stream] of objectStreams) {
+    const contents = await decryptBytes(stream.contents, objectKey(fileKey, ref, streamCipher), streamCipher);
+    context.delete(ref);
+    await PDFObjectStreamParser.forStream(PDFRawStream.of(stream.dict, contents)).parseIntoContext();
+  }
+
+  delete context.trailerInfo.Encrypt;
+  if (encryptRef instanceof PDFRef) context.delete(encryptRef);
+  return true;
+}
+
+/**
+ * Encrypts an unencrypted document in place with AES-256 (revision 6)
+ *
+ * A new random file key encrypts every string and stream; the user and
+ * owner passwords each unlock it. Objects are encrypted one by one, so
+ * the document must be saved without object streams, which would need
+ * encrypting as a whole.
+ */
+export async function encryptAes256(pdfDoc: PDFDocument, settings: Aes256Settings): Promise<void> {
+  const context = pdfDoc.context;
+  if (context.trailerInfo.Encrypt) throw new Error('The document is already encrypted');
+
+  const fileKey = crypto.getRandomValues(new Uint8Array(32));
+  // Each string and stream starts with its own initialization vector
+  const encryptBytes = async (data: Uint8Array) => {
+    const iv = crypto.getRandomValues(new Uint8Array(16));
+    return concatBytes(iv, await aesCbcEncrypt(fileKey, iv, data));
+  };
+
+  for (const [ref, object] of context.enumerateIndirectObjects()) {
+    if (object instanceof PDFStream) {
+      await mapStrings(object.dict, encryptBytes);
+      if (!settings.encryptMetadata && lookupName(object.dict, 'Type') === 'Metadata') continue;
+      context.assign(ref, PDFRawStream.of(object.dict, await encryptBytes(object.getContents())));
+    } else {
+      const encrypted = await mapStrings(object, encryptBytes);
+      if (encrypted) context.assign(ref, encrypted);
+    }
+  }
+
+  // Algorithms 8 to 10: password hashes with their salts, and the file key wrapped by each password
+  const zeroIv = new Uint8Array(16);
+  const encoder = new TextEncoder();
+  const user = encoder.encode(settings.userPassword).subarray(0, 127);
+  const owner = encoder.encode(settings.ownerPassword).subarray(0, 127);
+  const [userValidationSalt, userKeySalt, ownerValidationSalt, ownerKeySalt] =
+    Array.from({ length: 4 }, () => crypto.getRandomValues(new Uint8Array(8)));
+
+  const u = concatBytes(await passwordHash(6, user, userValidationSalt, new Uint8Array(0)), userValidationSalt, userKeySalt);
+  const ue = await aesCbcEncrypt(await passwordHash(6, user, userKeySalt, new Uint8Array(0)), zeroIv, fileKey, false);
+  const o = concatBytes(await passwordHash(6, owner, ownerValidationSalt, u), ownerValidationSalt, ownerKeySalt);
+  const oe = await aesCbcEncrypt(await passwordHash(6, owner, ownerKeySalt, u), zeroIv, fileKey, false);
+
+  // Perms repeats P so readers can tell it wasn't tampered with; one block, so CBC with a zero IV is ECB
+  const perms = new Uint8Array(16);
+  new DataView(perms.buffer).setInt32(0, settings.permissions, true);
+  perms.set([0xff, 0xff, 0xff, 0xff, settings.encryptMetadata ? 0x54 : 0x46, 0x61, 0x64, 0x62], 4);
+  perms.set(crypto.getRandomValues(new Uint8Array(4)), 12);
+
+  const encrypt = context.obj({
+    Filter: 'Standard',
+    V: 5,
+    R: 6,
+    Length: 256,
+    CF: { StdCF: { AuthEvent: 'DocOpen', CFM: 'AESV3', Length: 32 } },
+    StmF: 'StdCF',
+    StrF: 'StdCF',
+    P: settings.permissions,
+  });
+  encrypt.set(PDFName.of('O'), hexString(o));
+  encrypt.set(PDFName.of('U'), hexString(u));
+  encrypt.set(PDFName.of('OE'), hexString(oe));
+  encrypt.set(PDFName.of('UE'), hexString(ue));
+  encrypt.set(PDFName.of('Perms'), hexString(await aesCbcEncrypt(fileKey, zeroIv, perms, false)));
+  if (!settings.encryptMetadata) encrypt.set(PDFName.of('EncryptMetadata'), PDFBool.False);
+  context.trailerInfo.Encrypt = context.register(encrypt);
+
+  // Encrypted files must have an identifier
+  if (!context.trailerInfo.ID) {
+    const id = hexString(crypto.getRandomValues(new Uint8Array(16)));
+    context.trailerInfo.ID = context.obj([id, id]);
+  }
+}
+
+function readCipher(encrypt: PDFDict, version: number, entry: 'StrF' | 'StmF'): Cipher {
+  if (version === 1 || version === 2 || version === 3) return 'RC4';
+  if (version !== 4 && version !== 5) throw new Error(`Encryption version ${version} is not supported`);
+
+  // Crypt filters name the method for strings and streams separately
+  const filterName = lookupName(encrypt, entry) ?? 'Identity';
+  if (filterName === 'Identity') return 'none';
+  const filters = lookupDict(encrypt, 'CF');
+  const filter = filters && lookupDict(filters, filterName);
+  const method = filter && lookupName(filter, 'CFM');
+  switch (method) {
+    case 'V2':
+      return 'RC4';
+    case 'AESV2':
+    case 'AESV3':
+      return method;
+    case 'None':
+      return 'none';
+    default:
+      throw new Error(`Crypt filter method '${method ?? 'unknown'}' is not supported`);
+  }
+}
+
+/**
+ * Algorithm 1: the key for one object (revision 5 and later use the file key)
+ */
+function objectKey(fileKey: Uint8Array, ref: PDFRef, cipher: Cipher): Uint8Array {
+  if (cipher === 'AESV3' || cipher === 'none') return fileKey;
+  const { objectNumber: number, generationNumber: generation } = ref;
+  const key = md5(concatBytes(
+    fileKey,
+    new Uint8Array([number & 0xff, (number >> 8) & 0xff, (number >> 16) & 0xff, generation & 0xff, (generation >> 8) & 0xff]),
+    cipher === 'AESV2' ? AES_SALT : new Uint8Array(0)
+  ));
+  return key.subarray(0, Math.min(fileKey.length + 5, 16));
+}
+
+async function decryptBytes(data: Uint8Array, key: Uint8Array, cipher: Cipher): Promise<Uint8Array> {
+  if (cipher === 'none') return data;
+  if (cipher === 'RC4') return rc4(key, data);
+
+  // AES data starts with its initialization vector
+  const iv = data.subarray(0, 16);
+  const encrypted = data.subarray(16);
+  if (iv.length < 16 || encrypted.length === 0) return new Uint8Array(0);
+  try {
+    return await aesCbcDecrypt(key, iv, encrypted);
+  } catch {
+    // Some writers get the padding wrong; keep every whole block instead
+    return aesCbcDecrypt(key, iv, encrypted.subarray(0, encrypted.length - (encrypted.length % 16)), false);
+  }
+}
+
+/**
+ * Maps a string, or the strings inside a dictionary or array. Signature
+ * values are skipped: they are never encrypted, so the signed bytes can
+ * be found
+ *
+ * @returns The new string, or undefined for other values (changed in place)
+ */
+async function mapStrings(value: PDFObject, map: (bytes: Uint8Array) => Promise<Uint8Array>): Promise<PDFObject | undefined> {
+  if (value instanceof PDFString || value instanceof PDFHexString) {
+    return hexString(await map(value.asBytes()));
+  }
+  if (value instanceof PDFDict) {
+    const signature = value.has(PDFName.of('ByteRange'));
+    for (const [name, entry] of value.entries()) {
+      if (signature && name === PDFName.of('Contents')) continue;
+      const mapped = await mapStrings(entry, map);
+      if (mapped) value.set(name, mapped);
+    }
+  }
+  if (value instanceof PDFArray) {
+    for (let i = 0; i < value.size(); i++) {
+      const mapped = await mapStrings(value.get(i), map);
+      if (mapped) value.set(i, mapped);
+    }
+  }
+  return undefined;
+}
+
+function hexString(bytes: Uint8Array): PDFHexString {
+  return PDFHexString.of(Array.from(bytes, byte => byte.toString(16).padStart(2, '0')).join(''));
+}
+
+/**
+ * Parses an invalid object again, returning it if it is an object stream
+ */
+function reparseObjectStream(pdfDoc: PDFDocument, object: PDFInvalidObject): PDFRawStream | undefined {
+  const bytes = new Uint8Array(object.sizeInBytes());
+  object.copyBytesInto(bytes, 0);
+  try {
+    const parsed = PDFObjectParser.forBytes(bytes, pdfDoc.context).parseObject();
+    return parsed instanceof PDFRawStream && lookupName(parsed.dict, 'Type') === 'ObjStm' ? parsed : undefined;
+  } catch {
+    return undefined;
+  }
+}
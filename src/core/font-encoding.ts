@@ -0,0 +1,291 @@
+/**
+ * Font encoding normalization
+ *
+ * Text extraction maps character codes to Unicode through a font's
+ * ToUnicode CMap, falling back to the glyph names in its encoding. OCR
+ * tools and converters sometimes write ToUnicode maps that contradict
+ * the glyphs actually drawn, so extracted text comes out scrambled. For
+ * simple fonts whose encoding names standard glyphs, the names are what
+ * selects the glyph, so the map can be rebuilt from them without
+ * touching rendering.
+ *
+ * Codes are never moved: a custom encoding whose glyphs sit at
+ * non-standard positions is kept, since changing it would mean rewriting
+ * every content stream that uses the font.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFName, PDFNumber, PDFStream } from 'pdf-lib';
+import type { FontEncodingReport } from '../api/types';
+import { decodeStreamContents, lookupDict, lookupName, lookupNumber } from './pdf-objects';
+
+/** WinAnsiEncoding glyph names for codes 0x20-0xFF ('' where undefined) */
+const WIN_ANSI_NAMES = (
+  'space exclam quotedbl numbersign dollar percent ampersand quotesingle parenleft parenright asterisk plus comma ' +
+  'hyphen period slash zero one two three four five six seven eight nine colon semicolon less equal greater ' +
+  'question at A B C D E F G H I J K L M N O P Q R S T U V W X Y Z bracketleft backslash bracketright ' +
+  'asciicircum underscore grave a b c d e f g h i j k l m n o p q r s t u v w x y z braceleft bar braceright ' +
+  'asciitilde - Euro - quotesinglbase florin quotedblbase ellipsis dagger daggerdbl circumflex perthousand Scaron ' +
+  'guilsinglleft OE - Zcaron - - quoteleft quoteright quotedblleft quotedblright bullet endash emdash tilde ' +
+  'trademark scaron guilsinglright oe - zcaron Ydieresis space exclamdown cent sterling currency yen brokenbar ' +
+  'section dieresis copyright ordfeminine guillemotleft logicalnot hyphen registered macron degree plusminus ' +
+  'twosuperior threesuperior acute mu paragraph periodcentered cedilla onesuperior ordmasculine guillemotright ' +
+  'onequarter onehalf threequarters questiondown Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla ' +
+  'Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis Eth Ntilde Ograve Oacute Ocircumflex ' +
+  'Otilde Odieresis multiply Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls agrave aacute ' +
+  'acircumflex atilde adieresis aring ae ccedilla egrave eacute ecircumflex edieresis igrave iacute icircumflex ' +
+  'idieresis eth ntilde ograve oacute ocircumflex otilde odieresis divide oslash ugrave uacute ucircumflex ' +
+  'udieresis yacute thorn ydieresis'
+).split(' ').map(name => (name === '-' ? '' : name));
+
+/** Unicode values of Windows-1252 codes 0x80-0x9F (0 where undefined) */
+const CP1252_HIGH = [
+  0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021, 0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+  0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014, 0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+];
+
+/** Common glyph names outside WinAnsiEncoding */
+const EXTRA_GLYPHS: Record<string, number> = {
+  ff: 0xfb00, fi: 0xfb01, fl: 0xfb02, ffi: 0xfb03, ffl: 0xfb04,
+  dotlessi: 0x0131, Lslash: 0x0141, lslash: 0x0142, fraction: 0x2044, minus: 0x2212,
+  breve: 0x02d8, caron: 0x02c7, dotaccent: 0x02d9, hungarumlaut: 0x02dd, ogonek: 0x02db, ring: 0x02da,
+  nbspace: 0x00a0, sfthyphen: 0x00ad, Delta: 0x2206, Omega: 0x2126, mu1: 0x00b5,
+};
+
+const SYMBOLIC_FLAG = 1 << 2;
+const SIMPLE_FONTS = new Set(['Type1', 'MMType1', 'TrueType']);
+
+/** bfchar entries per block, the CMap limit */
+const BFCHAR_BLOCK = 100;
+
+let glyphUnicode: Map<string, number> | undefined;
+
+/**
+ * Rebuilds contradictory ToUnicode maps of simple fonts from their glyph
+ * names, and replaces encodings that only restate WinAnsiEncoding with
+ * the standard name
+ *
+ * Symbolic TrueType fonts (whose glyphs are chosen by code, not name) and
+ * fonts whose glyph names don't identify characters are reported as
+ * skipped when extraction depends on them.
+ */
+export function normalizeFontEncodings(pdfDoc: PDFDocument): FontEncodingReport {
+  const context = pdfDoc.context;
+  const report: FontEncodingReport = { normalized: [], skipped: [] };
+
+  for (const [ref, object] of context.enumerateIndirectObjects()) {
+    if (!(object instanceof PDFDict) || lookupName(object, 'Type') !== 'Font') continue;
+    const subtype = lookupName(object, 'Subtype');
+    if (!subtype || !SIMPLE_FONTS.has(subtype)) continue;
+
+    const font = lookupName(object, 'BaseFont') ?? null;
+    const encoding = object.lookup(PDFName.of('Encoding'));
+    const differences = encoding instanceof PDFDict ? readDifferences(encoding) : new Map<number, string>();
+    const baseEncoding = encoding instanceof PDFName ? encoding.decodeText()
+      : encoding instanceof PDFDict ? lookupName(encoding, 'BaseEncoding') : undefined;
+
+    // Only WinAnsiEncoding is known here; other bases contribute no names
+    const names = new Map<number, string>();
+    if (baseEncoding === 'WinAnsiEncoding') {
+      WIN_ANSI_NAMES.forEach((name, i) => name && names.set(i + 0x20, name));
+    }
+    for (const [code, name] of differences) names.set(code, name);
+    if (names.size === 0) continue;
+
+    const toUnicodeStream = object.lookup(PDFName.of('ToUnicode'));
+    const toUnicode = toUnicodeStream instanceof PDFStream ? readToUnicode(toUnicodeStream) : new Map<number, string>();
+    if (!toUnicode) continue; // Multi-byte or unreadable map; leave it to its author
+
+    const descriptor = lookupDict(object, 'FontDescriptor');
+    const symbolic = ((descriptor && lookupNumber(descriptor, 'Flags')) ?? 0) & SYMBOLIC_FLAG;
+    if (subtype === 'TrueType' && symbolic) {
+      if (differences.size > 0) {
+        report.skipped.push({
+          font,
+          object: ref.toString(),
+          reason: 'symbolic TrueType font: glyphs are chosen by code, so its glyph names don\'t identify characters',
+        });
+      }
+      continue;
+    }
+
+    // Codes whose text can only come from a glyph name that means nothing
+    const unknown = [...differences].filter(([code, name]) => !toUnicode.has(code) && glyphToUnicode(name) === undefined);
+    if (unknown.length > 0) {
+      report.skipped.push({
+        font,
+        object: ref.toString(),
+        reason: `${unknown.length} glyph name(s) such as "${unknown[0][1]}" don't identify characters and no ToUnicode entry covers them`,
+      });
+      continue;
+    }
+
+    // Only codes the font defines or maps, so unused base codes aren't added
+    let toUnicodeFixed = 0;
+    const rebuilt = new Map(toUnicode);
+    for (const code of new Set([...differences.keys(), ...toUnicode.keys()])) {
+      const name = names.get(code);
+      const text = name === undefined ? undefined : glyphToUnicode(name);
+      if (text === undefined) continue;
+      const mapped = toUnicode.get(code);
+      if (mapped === undefined && !toUnicodeStream) continue; // Extractors already use the name
+      if (mapped !== undefined && mapped.normalize('NFKC') === text.normalize('NFKC')) continue;
+      rebuilt.set(code, text);
+      toUnicodeFixed++;
+    }
+
+    const redundant = encoding instanceof PDFDict && baseEncoding === 'WinAnsiEncoding' &&
+      [...differences].every(([code, name]) => code >= 0x20 && WIN_ANSI_NAMES[code - 0x20] === name);
+
+    if (toUnicodeFixed === 0 && !redundant) continue;
+    if (toUnicodeFixed > 0) {
+      object.set(PDFName.of('ToUnicode'), context.register(context.flateStream(writeToUnicode(rebuilt))));
+    }
+    if (redundant) object.set(PDFName.of('Encoding'), PDFName.of('WinAnsiEncoding'));
+    report.normalized.push({ font, object: ref.toString(), standardEncoding: redundant, toUnicodeFixed });
+  }
+
+  return report;
+}
+
+/**
+ * Reads an encoding's /Differences array as code to glyph name
+ */
+function readDifferences(encoding: PDFDict): Map<number, string> {
+  const differences = new Map<number, string>();
+  const array = encoding.lookup(PDFName.of('Differences'));
+  if (!(array instanceof PDFArray)) return differences;
+
+  let code = 0;
+  for (let i = 0; i < array.size(); i++) {
+    const item = array.lookup(i);
+    if (item instanceof PDFNumber) {
+      code = item.asNumber();
+    } else if (item instanceof PDFName) {
+      if (code >= 0 && code <= 0xff) differences.set(code, item.decodeText());
+      code++;
+    }
+  }
+  return differences;
+}
+
+/**
+ * Unicode text for a glyph name, following the Adobe Glyph List rules:
+ * suffixes after a period are dropped, and ligatures are joined with
+ * underscores
+ */
+function glyphToUnicode(name: string): string | undefined {
+  if (!glyphUnicode) {
+    glyphUnicode = new Map(Object.entries(EXTRA_GLYPHS));
+    WIN_ANSI_NAMES.forEach((glyph, i) => {
+      const code = i + 0x20;
+      const unicode = code >= 0x80 && code < 0xa0 ? CP1252_HIGH[code - 0x80] : code;
+      // The first code wins, so space and hyphen aren't their 0xA0/0xAD duplicates
+      if (glyph && !glyphUnicode!.has(glyph)) glyphUnicode!.set(glyph, unicode);
+    });
+  }
+
+  const base = name.split('.')[0];
+  if (!base) return undefined;
+  let text = '';
+  for (const component of base.split('_')) {
+    const known = glyphUnicode.get(component);
+    if (known !== undefined) {
+      text += String.fromCodePoint(known);
+      continue;
+    }
+    const uni = /^uni((?:[0-9A-F]{4})+)$/.exec(component);
+    const u = /^u([0-9A-F]{4,6})$/.exec(component);
+    if (uni) {
+      for (let i = 0; i < uni[1].length; i += 4) text += String.fromCharCode(parseInt(uni[1].slice(i, i + 4), 16));
+    } else if (u && parseInt(u[1], 16) <= 0x10ffff) {
+      text += String.fromCodePoint(parseInt(u[1], 16));
+    } else {
+      return undefined;
+    }
+  }
+  return text;
+}
+
+/**
+ * Reads single-byte bfchar and bfrange mappings from a ToUnicode CMap
+ *
+ * @returns Undefined if the map can't be decoded or uses multi-byte codes
+ */
+function readToUnicode(stream: PDFStream): Map<number, string> | undefined {
+  const data = decodeStreamContents(stream);
+  if (!data) return undefined;
+  const cmap = Array.from(data, byte => String.fromCharCode(byte)).join('');
+  const map = new Map<number, string>();
+
+  for (const [, body] of cmap.matchAll(/begincodespacerange([\s\S]*?)endcodespacerange/g)) {
+    for (const [, low] of body.matchAll(/<([0-9A-Fa-f]*)>\s*<[0-9A-Fa-f]*>/g)) {
+      if (low.length !== 2) return undefined;
+    }
+  }
+
+  for (const [, body] of cmap.matchAll(/beginbfchar([\s\S]*?)endbfchar/g)) {
+    for (const [, source, target] of body.matchAll(/<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]*)>/g)) {
+      if (source.length !== 2) return undefined;
+      map.set(parseInt(source, 16), utf16(target));
+    }
+  }
+
+  for (const [, body] of cmap.matchAll(/beginbfrange([\s\S]*?)endbfrange/g)) {
+    const ranges = body.matchAll(/<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*(<[0-9A-Fa-f]*>|\[[^\]]*\])/g);
+    for (const [, lowHex, highHex, target] of ranges) {
+      if (lowHex.length !== 2 || highHex.length !== 2) return undefined;
+      const low = parseInt(lowHex, 16);
+      const high = parseInt(highHex, 16);
+      if (target.startsWith('[')) {
+        const targets = [...target.matchAll(/<([0-9A-Fa-f]*)>/g)].map(match => utf16(match[1]));
+        targets.slice(0, high - low + 1).forEach((text, i) => map.set(low + i, text));
+      } else {
+        // The last UTF-16 unit is incremented across the range
+        const units = hexUnits(target.slice(1, -1));
+        for (let code = low; code <= high && units.length > 0; code++) {
+          const last = units[units.length - 1] + (code - low);
+          map.set(code, String.fromCharCode(...units.slice(0, -1), last));
+        }
+      }
+    }
+  }
+  return map;
+}
+
+/**
+ * Writes a single-byte ToUnicode CMap
+ */
+function writeToUnicode(map: Map<number, string>): Uint8Array {
+  const hex = (value: number, digits: number) => value.toString(16).toUpperCase().padStart(digits, '0');
+  const entries = [...map].sort(([a], [b]) => a - b);
+
+  let blocks = '';
+  for (let i = 0; i < entries.length; i += BFCHAR_BLOCK) {
+    const block = entries.slice(i, i + BFCHAR_BLOCK);
+    blocks += `${block.length} beginbfchar\n`;
+    for (const [code, text] of block) {
+      const units = Array.from({ length: text.length }, (_, j) => hex(text.charCodeAt(j), 4)).join('');
+      blocks += `<${hex(code, 2)}> <${units}>\n`;
+    }
+    blocks += 'endbfchar\n';
+  }
+
+  const cmap =
+    '/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n' +
+    '/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n' +
+    '/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n' +
+    '1 begincodespacerange\n<00> <FF>\nendcodespacerange\n' +
+    blocks +
+    'endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n';
+  return new TextEncoder().encode(cmap);
+}
+
+function hexUnits(hex: string): number[] {
+  const units: number[] = [];
+  for (let i = 0; i + 4 <= hex.length; i += 4) units.push(parseInt(hex.slice(i, i + 4), 16));
+  return units;
+}
+
+function utf16(hex: string): string {
+  return String.fromCharCode(...hexUnits(hex));
+}
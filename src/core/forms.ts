@@ -0,0 +1,108 @@
+/**
+ * Form field appearances
+ *
+ * Viewers draw fields from their appearance streams. After a value change
+ * those streams are stale until rebuilt, or until a viewer honors
+ * NeedAppearances and rebuilds them itself (many don't, which is why
+ * filled forms can look blank).
+ */
+
+import { PDFBool, PDFDict, PDFDocument, PDFName, PDFObject, PDFPage, PDFSignature, StandardFonts } from 'pdf-lib';
+import type { FormAppearanceFailure } from '../api/types';
+import { lookupDict, lookupName, lookupText } from './pdf-objects';
+
+/**
+ * Whether the document has an interactive (AcroForm) form
+ */
+export function hasAcroForm(pdfDoc: PDFDocument): boolean {
+  return lookupDict(pdfDoc.catalog, 'AcroForm') !== undefined;
+}
+
+/**
+ * Rebuilds the appearance streams of every field from its current value
+ * and clears NeedAppearances
+ *
+ * Fields whose appearances are missing a font use Helvetica. Signature
+ * fields are left alone.
+ *
+ * @returns Names of the fields rebuilt, and those that couldn't be
+ */
+export async function regenerateFieldAppearances(
+  pdfDoc: PDFDocument
+): Promise<{ regenerated: string[]; failed: FormAppearanceFailure[] }> {
+  const form = pdfDoc.getForm();
+  const fields = form.getFields().filter(field => !(field instanceof PDFSignature));
+  const regenerated: string[] = [];
+  const failed: FormAppearanceFailure[] = [];
+  if (fields.length === 0) return { regenerated, failed };
+
+  const font = await pdfDoc.embedFont(StandardFonts.Helvetica);
+  for (const field of fields) {
+    const name = field.getName();
+    try {
+      field.defaultUpdateAppearances(font);
+      regenerated.push(name);
+    } catch (error) {
+      failed.push({ field: name, reason: error instanceof Error ? error.message : String(error) });
+    }
+  }
+
+  form.acroForm.dict.delete(PDFName.of('NeedAppearances'));
+  return { regenerated, failed };
+}
+
+/**
+ * Asks viewers to rebuild field appearances, leaving the streams as they are
+ */
+export function setNeedAppearances(pdfDoc: PDFDocument): void {
+  lookupDict(pdfDoc.catalog, 'AcroForm')?.set(PDFName.of('NeedAppearances'), PDFBool.True);
+}
+
+/**
+ * Puts a page's form fields first in its annotation list, in the given
+ * order, and sets /Tabs to A so viewers tab in annotation order
+ *
+ * A field with several widgets on the page keeps their relative order.
+ * Other annotations follow the fields in their original order.
+ *
+ * @param fieldNames - Fully qualified field names (e.g. 'address.city')
+ * @returns Names without a widget on the page; the page is left
+ *   unchanged if there are any
+ */
+export function setPageTabOrder(pdfDoc: PDFDocument, page: PDFPage, fieldNames: string[]): string[] {
+  const annots = page.node.Annots();
+  const entries: PDFObject[] = [];
+  const names: Array<string | undefined> = [];
+  if (annots) {
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      entries.push(annots.get(i));
+      names.push(annot instanceof PDFDict && lookupName(annot, 'Subtype') === 'Widget' ? fullFieldName(annot) : undefined);
+    }
+  }
+
+  const missing = fieldNames.filter(name => !names.includes(name));
+  if (missing.length > 0) return missing;
+
+  const ordered = fieldNames.flatMap(name => entries.filter((_, i) => names[i] === name));
+  const rest = entries.filter((_, i) => !fieldNames.includes(names[i] ?? ''));
+
+  page.node.set(PDFName.of('Annots'), pdfDoc.context.obj([...ordered, ...rest]));
+  page.node.set(PDFName.of('Tabs'), PDFName.of('A'));
+  return [];
+}
+
+/**
+ * Fully qualified name of the field a widget belongs to: the partial
+ * names (/T) up the parent chain joined with dots
+ */
+function fullFieldName(widget: PDFDict): string | undefined {
+  const parts: string[] = [];
+  const visited = new Set<PDFDict>();
+  for (let node: PDFDict | undefined = widget; node && !visited.has(node); node = lookupDict(node, 'Parent')) {
+    visited.add(node);
+    const partial = lookupText(node, 'T');
+    if (partial !== undefined) parts.unshift(partial);
+  }
+  return parts.length > 0 ? parts.join('.') : undefined;
+}
@@ -0,0 +1,53 @@
+/**
+ * Unreferenced object removal
+ *
+ * pdf-lib writes every object in its context, including objects that
+ * nothing points to any more (orphans left by earlier incremental updates
+ * or by passes that detach content). This sweeps them away.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFObject, PDFRef, PDFStream } from 'pdf-lib';
+
+/**
+ * Deletes every indirect object not reachable from the trailer
+ *
+ * @param keep - Objects to keep even if unreferenced, with everything they
+ *   reference
+ * @returns Number of objects removed
+ */
+export function removeUnreferencedObjects(pdfDoc: PDFDocument, keep: Iterable<PDFRef> = []): number {
+  const context = pdfDoc.context;
+  const reachable = new Set<PDFRef>();
+  const pending: PDFObject[] = [...keep];
+
+  const { Root, Info, Encrypt } = context.trailerInfo;
+  for (const root of [Root, Info, Encrypt]) {
+    if (root) pending.push(root);
+  }
+
+  while (pending.length > 0) {
+    const object = pending.pop()!;
+
+    if (object instanceof PDFRef) {
+      if (reachable.has(object)) continue;
+      reachable.add(object);
+      const target = context.lookup(object);
+      if (target) pending.push(target);
+    } else if (object instanceof PDFStream) {
+      pending.push(object.dict);
+    } else if (object instanceof PDFDict) {
+      for (const [, value] of object.entries()) pending.push(value);
+    } else if (object instanceof PDFArray) {
+      pending.push(...object.asArray());
+    }
+  }
+
+  let removed = 0;
+  for (const [ref] of context.enumerateIndirectObjects()) {
+    if (!reachable.has(ref)) {
+      context.delete(ref);
+      removed++;
+    }
+  }
+  return removed;
+}
@@ -0,0 +1,107 @@
+/**
+ * ICC profile deduplication
+ *
+ * Some tools embed a fresh copy of the same ICC profile for every image
+ * or page. Profiles are a few hundred bytes to a few megabytes each, so
+ * pointing every use at one copy can save a lot in color-managed files.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFName, PDFObject, PDFRef, PDFStream } from 'pdf-lib';
+import type { IccDedupeReport } from '../api/types';
+import { decodeStreamContents, lookupNumber, replaceReferences } from './pdf-objects';
+
+/** Profile dictionary entries that must match besides the data */
+const MATCHED_KEYS = ['N', 'Alternate', 'Range'];
+
+interface Profile {
+  ref: PDFRef;
+  stream: PDFStream;
+  data: Uint8Array;
+}
+
+/**
+ * Points every use of a byte-identical ICC profile at a single copy
+ *
+ * Profiles are those referenced from ICCBased color spaces and output
+ * intents; they match when their decoded data and their N, Alternate and
+ * Range entries are equal. The smallest stored copy is kept. Replaced
+ * copies are left unreferenced for the garbage pass.
+ */
+export function dedupeIccProfiles(pdfDoc: PDFDocument): IccDedupeReport {
+  const context = pdfDoc.context;
+  const report: IccDedupeReport = { profilesRemoved: 0, bytesSaved: 0 };
+
+  const buckets = new Map<string, Profile[][]>();
+  for (const ref of findProfileRefs(pdfDoc)) {
+    const stream = context.lookup(ref);
+    if (!(stream instanceof PDFStream)) continue;
+    const data = decodeStreamContents(stream);
+    if (!data) continue;
+
+    const key = `${lookupNumber(stream.dict, 'N') ?? ''}|${data.length}`;
+    const groups = buckets.get(key) ?? [];
+    const group = groups.find(candidate => sameProfile(candidate[0], stream, data));
+    if (group) group.push({ ref, stream, data });
+    else groups.push([{ ref, stream, data }]);
+    buckets.set(key, groups);
+  }
+
+  const replacements = new Map<PDFRef, PDFRef>();
+  for (const groups of buckets.values()) {
+    for (const group of groups) {
+      if (group.length < 2) continue;
+      const kept = group.reduce((best, profile) =>
+        profile.stream.getContentsSize() < best.stream.getContentsSize() ? profile : best
+      );
+      for (const profile of group) {
+        if (profile === kept) continue;
+        replacements.set(profile.ref, kept.ref);
+        report.profilesRemoved++;
+        report.bytesSaved += profile.stream.getContentsSize();
+      }
+    }
+  }
+
+  if (replacements.size > 0) replaceReferences(pdfDoc, replacements);
+
+  return report;
+}
+
+/**
+ * Collects the profile streams of ICCBased color spaces and output intents
+ */
+function findProfileRefs(pdfDoc: PDFDocument): Set<PDFRef> {
+  const refs = new Set<PDFRef>();
+
+  const visit = (object: PDFObject): void => {
+    if (object instanceof PDFStream) {
+      visit(object.dict);
+    } else if (object instanceof PDFDict) {
+      const profile = object.get(PDFName.of('DestOutputProfile'));
+      if (profile instanceof PDFRef) refs.add(profile);
+      for (const [, value] of object.entries()) visit(value);
+    } else if (object instanceof PDFArray) {
+      const profile = object.get(1);
+      if (object.get(0) === PDFName.of('ICCBased') && profile instanceof PDFRef) refs.add(profile);
+      for (const value of object.asArray()) visit(value);
+    }
+  };
+
+  for (const [, object] of pdfDoc.context.enumerateIndirectObjects()) visit(object);
+  return refs;
+}
+
+function sameProfile(profile: Profile, stream: PDFStream, data: Uint8Array): boolean {
+  const matches = MATCHED_KEYS.every(key =>
+    String(profile.stream.dict.get(PDFName.of(key))) === String(stream.dict.get(PDFName.of(key)))
+  );
+  return matches && bytesEqual(profile.data, data);
+}
+
+function bytesEqual(a: Uint8Array, b: Uint8Array): boolean {
+  if (a.length !== b.length) return false;
+  for (let i = 0; i < a.length; i++) {
+    if (a[i] !== b[i]) return false;
+  }
+  return true;
+}
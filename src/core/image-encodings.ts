@@ -0,0 +1,134 @@
+/**
+ * Encoding selection for rasterized pages
+ *
+ * JPEG suits photographs but loses to Flate on flat graphics and to CCITT
+ * on black-and-white text. Each rendered page is encoded every applicable
+ * way and the smallest stream is kept.
+ */
+
+import { PDFDocument, PDFRawStream } from 'pdf-lib';
+import type { ImageEncoding } from '../api/types';
+import { encodeCcittG4 } from './ccitt';
+
+/** Channel spread below which a pixel counts as gray */
+const GRAY_TOLERANCE = 2;
+/** Share of near-black or near-white pixels for a page to count as bilevel */
+const BILEVEL_SHARE = 0.99;
+/** Luminance distance from pure black or white that still counts as extreme */
+const BILEVEL_MARGIN = 32;
+
+export interface EncodedImage {
+  encoding: ImageEncoding;
+  /** Image XObject stream, not yet registered */
+  stream: PDFRawStream;
+}
+
+/**
+ * Returns the smallest encoding of a rendered page image
+ *
+ * @param image - The rendered page pixels
+ * @param jpegBytes - The page already encoded as JPEG (always a candidate)
+ */
+export function encodeSmallest(pdfDoc: PDFDocument, image: ImageData, jpegBytes: Uint8Array): EncodedImage {
+  const { width, height, data } = image;
+  const context = pdfDoc.context;
+  const imageDict = { Type: 'XObject', Subtype: 'Image', Width: width, Height: height };
+
+  const candidates: EncodedImage[] = [
+    {
+      encoding: 'jpeg',
+      stream: context.stream(jpegBytes, {
+        ...imageDict,
+        ColorSpace: 'DeviceRGB',
+        BitsPerComponent: 8,
+        Filter: 'DCTDecode',
+      }),
+    },
+  ];
+
+  const gray = toGray(data);
+  if (!gray) {
+    const rgb = new Uint8Array(width * height * 3);
+    for (let i = 0, j = 0; i < data.length; i += 4, j += 3) {
+      rgb[j] = data[i];
+      rgb[j + 1] = data[i + 1];
+      rgb[j + 2] = data[i + 2];
+    }
+    candidates.push({
+      encoding: 'flate',
+      stream: context.flateStream(rgb, { ...imageDict, ColorSpace: 'DeviceRGB', BitsPerComponent: 8 }),
+    });
+  } else if (!isBilevel(gray)) {
+    candidates.push({
+      encoding: 'flate',
+      stream: context.flateStream(gray, { ...imageDict, ColorSpace: 'DeviceGray', BitsPerComponent: 8 }),
+    });
+  } else {
+    const black = gray.map(value => (value < 128 ? 1 : 0));
+    candidates.push(
+      {
+        encoding: 'flate',
+        stream: context.flateStream(packBits(black, width, height), {
+          ...imageDict,
+          ColorSpace: 'DeviceGray',
+          BitsPerComponent: 1,
+        }),
+      },
+      {
+        encoding: 'ccitt',
+        stream: context.stream(encodeCcittG4(black, width, height), {
+          ...imageDict,
+          ColorSpace: 'DeviceGray',
+          BitsPerComponent: 1,
+          Filter: 'CCITTFaxDecode',
+          DecodeParms: { K: -1, Columns: width, Rows: height },
+        }),
+      }
+    );
+  }
+
+  return candidates.reduce((best, candidate) =>
+    candidate.stream.getContentsSize() < best.stream.getContentsSize() ? candidate : best
+  );
+}
+
+/**
+ * Returns one luminance byte per pixel, or undefined if any pixel has color
+ */
+function toGray(rgba: Uint8ClampedArray): Uint8Array | undefined {
+  const gray = new Uint8Array(rgba.length / 4);
+  for (let i = 0, j = 0; i < rgba.length; i += 4, j++) {
+    const r = rgba[i];
+    const g = rgba[i + 1];
+    const b = rgba[i + 2];
+    if (Math.max(r, g, b) - Math.min(r, g, b) > GRAY_TOLERANCE) return undefined;
+    gray[j] = Math.round((r + g + b) / 3);
+  }
+  return gray;
+}
+
+/**
+ * Whether thresholding would barely change the image (text and line art
+ * with little antialiasing)
+ */
+function isBilevel(gray: Uint8Array): boolean {
+  let extreme = 0;
+  for (const value of gray) {
+    if (value < BILEVEL_MARGIN || value > 255 - BILEVEL_MARGIN) extreme++;
+  }
+  return extreme >= gray.length * BILEVEL_SHARE;
+}
+
+/**
+ * Packs black flags into 1-bit DeviceGray rows (0 is black)
+ */
+function packBits(black: Uint8Array, width: number, height: number): Uint8Array {
+  const rowBytes = Math.ceil(width / 8);
+  const packed = new Uint8Array(rowBytes * height).fill(0xff);
+  for (let y = 0; y < height; y++) {
+    for (let x = 0; x < width; x++) {
+      if (black[y * width + x]) packed[y * rowBytes + (x >> 3)] &= ~(0x80 >> (x & 7));
+    }
+  }
+  return packed;
+}
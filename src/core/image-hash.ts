@@ -0,0 +1,51 @@
+/**
+ * Perceptual image hashing
+ *
+ * A difference hash compares the brightness of neighbouring cells on a
+ * 9x8 grayscale thumbnail, so it survives rescaling, recompression and
+ * small scan noise, but not rotation.
+ */
+
+import { createCanvas } from './render';
+
+const HASH_WIDTH = 9;
+const HASH_HEIGHT = 8;
+
+/**
+ * 64-bit difference hash, one bit per entry
+ */
+export type ImageHash = Uint8Array;
+
+/**
+ * Computes the difference hash of an image or canvas
+ */
+export function differenceHash(source: CanvasImageSource): ImageHash {
+  const { context } = createCanvas(HASH_WIDTH, HASH_HEIGHT);
+  context.imageSmoothingQuality = 'high';
+  context.drawImage(source, 0, 0, HASH_WIDTH, HASH_HEIGHT);
+  const { data } = context.getImageData(0, 0, HASH_WIDTH, HASH_HEIGHT);
+
+  const gray = new Float64Array(HASH_WIDTH * HASH_HEIGHT);
+  for (let i = 0; i < gray.length; i++) {
+    gray[i] = 0.299 * data[i * 4] + 0.587 * data[i * 4 + 1] + 0.114 * data[i * 4 + 2];
+  }
+
+  const hash = new Uint8Array((HASH_WIDTH - 1) * HASH_HEIGHT);
+  for (let y = 0; y < HASH_HEIGHT; y++) {
+    for (let x = 0; x < HASH_WIDTH - 1; x++) {
+      hash[y * (HASH_WIDTH - 1) + x] = gray[y * HASH_WIDTH + x] < gray[y * HASH_WIDTH + x + 1] ? 1 : 0;
+    }
+  }
+  return hash;
+}
+
+/**
+ * Number of differing bits between two hashes
+ */
+export function hashDistance(a: ImageHash, b: ImageHash): number {
+  let distance = 0;
+  for (let i = 0; i < a.length; i++) {
+    if (a[i] !== b[i]) distance++;
+  }
+  return distance;
+}
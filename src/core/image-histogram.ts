@@ -0,0 +1,231 @@
+/**
+ * Image luminance statistics
+ *
+ * Summarizes how an image's pixels are distributed, to pick an encoding:
+ * scans that are nearly all black and white suit CCITT or JBIG2, flat
+ * graphics with few colors suit Flate, and smooth tones suit JPEG.
+ * JPEG decoding uses the browser's decoder.
+ */
+
+import { PDFArray, PDFBool, PDFHexString, PDFName, PDFRawStream, PDFStream, PDFString } from 'pdf-lib';
+import type { ImageHistogramKind } from '../api/types';
+import { componentCount } from './image-repair';
+import { colorSpaceName } from './image-validation';
+import { decodeStreamContents, getFilters, lookupArray, lookupDict, lookupNumber, toNumberArray } from './pdf-objects';
+import { createCanvas, decodeImage } from './render';
+
+/**
+ * Share of pixels in the darkest and lightest quarters above which an
+ * image is treated as bilevel
+ */
+const BILEVEL_SHARE = 0.95;
+
+/** Most distinct colors a graphic has; a palette of this size is lossless */
+const GRAPHIC_COLORS = 256;
+
+/**
+ * Decoded pixels as 8-bit components
+ */
+interface Pixels {
+  /** Components per pixel: 1 (gray), 3 (RGB) or 4 (CMYK) */
+  components: 1 | 3 | 4;
+  /** Interleaved components, one byte each */
+  samples: Uint8Array;
+  /** True for one-component data measuring ink (Separation) */
+  inverted?: boolean;
+}
+
+/**
+ * Histogram and statistics of an image's luminance
+ */
+export interface LuminanceStats {
+  width: number;
+  height: number;
+  colorSpace: string | null;
+  histogram: number[];
+  mean: number;
+  stddev: number;
+  uniqueColors: number;
+  kind: ImageHistogramKind;
+}
+
+/**
+ * Computes the luminance histogram of an image, with Rec. 601 weights
+ *
+ * @throws If the image's data or color space can't be decoded here
+ */
+export async function imageLuminanceStats(stream: PDFRawStream): Promise<LuminanceStats> {
+  const width = lookupNumber(stream.dict, 'Width') ?? 0;
+  const height = lookupNumber(stream.dict, 'Height') ?? 0;
+  if (!(width > 0 && height > 0)) throw new Error('the image has no valid Width and Height');
+
+  const pixels = await readPixels(stream, width, height);
+  const { components, samples, inverted } = pixels;
+  const histogram = new Array<number>(256).fill(0);
+  const colors = new Set<number>();
+
+  for (let i = 0; i + components <= samples.length; i += components) {
+    let luminance: number;
+    let color: number;
+    if (components === 1) {
+      luminance = inverted ? 255 - samples[i] : samples[i];
+      color = samples[i];
+    } else if (components === 3) {
+      luminance = 0.299 * samples[i] + 0.587 * samples[i + 1] + 0.114 * samples[i + 2];
+      color = (samples[i] << 16) | (samples[i + 1] << 8) | samples[i + 2];
+    } else {
+      const k = 1 - samples[i + 3] / 255;
+      luminance = k * (
+        0.299 * (255 - samples[i]) + 0.587 * (255 - samples[i + 1]) + 0.114 * (255 - samples[i + 2])
+      );
+      color = samples[i] * 0x1000000 + ((samples[i + 1] << 16) | (samples[i + 2] << 8) | samples[i + 3]);
+    }
+    histogram[Math.round(luminance)]++;
+    colors.add(color);
+  }
+
+  const count = histogram.reduce((total, n) => total + n, 0);
+  const mean = histogram.reduce((total, n, level) => total + n * level, 0) / count;
+  const variance = histogram.reduce((total, n, level) => total + n * (level - mean) ** 2, 0) / count;
+  const extremes = histogram.reduce((total, n, level) => (level < 64 || level >= 192 ? total + n : total), 0);
+
+  return {
+    width,
+    height,
+    colorSpace: colorSpaceName(stream.dict.lookup(PDFName.of('ColorSpace'))),
+    histogram,
+    mean,
+    stddev: Math.sqrt(variance),
+    uniqueColors: colors.size,
+    kind: extremes / count >= BILEVEL_SHARE && colors.size <= GRAPHIC_COLORS ? 'bilevel'
+      : colors.size <= GRAPHIC_COLORS ? 'graphic'
+        : 'photo',
+  };
+}
+
+async function readPixels(stream: PDFRawStream, width: number, height: number): Promise<Pixels> {
+  const filters = getFilters(stream.dict);
+  const last = filters[filters.length - 1];
+
+  // The browser applies the JPEG's own color transform; read back RGB
+  if (last === 'DCTDecode' && filters.length === 1) {
+    const bitmap = await decodeImage(stream.contents).catch(() => undefined);
+    if (!bitmap) throw new Error('the JPEG data can\'t be decoded');
+
+    const { canvas, context } = createCanvas(width, height);
+    context.drawImage(bitmap, 0, 0, width, height);
+    bitmap.close();
+    const rgba = context.getImageData(0, 0, width, height).data;
+    canvas.width = 0;
+    canvas.height = 0;
+
+    const samples = new Uint8Array(width * height * 3);
+    for (let i = 0, j = 0; i < rgba.length; i += 4, j += 3) {
+      samples[j] = rgba[i];
+      samples[j + 1] = rgba[i + 1];
+      samples[j + 2] = rgba[i + 2];
+    }
+    return { components: 3, samples };
+  }
+
+  if (last === 'DCTDecode' || last === 'JPXDecode' || last === 'JBIG2Decode' || last === 'CCITTFaxDecode') {
+    throw new Error(`${last} data can't be decoded here`);
+  }
+  const parms = lookupDict(stream.dict, 'DecodeParms');
+  if (parms && (lookupNumber(parms, 'Predictor') ?? 1) > 1) {
+    throw new Error('predictor-encoded data can\'t be decoded here');
+  }
+  const data = decodeStreamContents(stream);
+  if (!data) throw new Error('the stream data can\'t be decoded');
+
+  const dict = stream.dict;
+  if (dict.lookup(PDFName.of('ImageMask')) === PDFBool.True) {
+    // Mask samples of 0 paint by default; show them as black
+    const decode = lookupArray(dict, 'Decode');
+    const paintsOnes = decode !== undefined && toNumberArray(decode)[0] === 1;
+    const bits = unpack(data, width, height, 1, 1);
+    return { components: 1, samples: bits.map(bit => ((bit === 1) === paintsOnes ? 0 : 255)) };
+  }
+
+  const bitsPerComponent = lookupNumber(dict, 'BitsPerComponent') ?? 8;
+  const colorSpace = dict.lookup(PDFName.of('ColorSpace'));
+
+  if (colorSpace instanceof PDFArray && colorSpace.lookup(0) === PDFName.of('Indexed')) {
+    const base = colorSpace.lookup(1);
+    const baseComponents = componentCount(base);
+    const table = readLookup(colorSpace.lookup(3));
+    if (!table || (baseComponents !== 1 && baseComponents !== 3 && baseComponents !== 4)) {
+      throw new Error('the Indexed color space can\'t be decoded here');
+    }
+    const indices = unpack(data, width, height, 1, bitsPerComponent);
+    const samples = new Uint8Array(indices.length * baseComponents);
+    indices.forEach((index, i) => {
+      for (let c = 0; c < baseComponents; c++) samples[i * baseComponents + c] = table[index * baseComponents + c] ?? 0;
+    });
+    return { components: baseComponents, samples };
+  }
+
+  const family = colorSpace instanceof PDFArray ? colorSpace.lookup(0) : colorSpace;
+  const components = componentCount(colorSpace);
+  const separation = family === PDFName.of('Separation');
+  const unsupported = family === PDFName.of('Lab') || family === PDFName.of('DeviceN');
+  if (unsupported || (components !== 1 && components !== 3 && components !== 4)) {
+    throw new Error('the color space can\'t be converted to luminance here');
+  }
+
+  const samples = unpack(data, width, height, components, bitsPerComponent);
+  if (bitsPerComponent < 8) {
+    const scale = 255 / ((1 << bitsPerComponent) - 1);
+    for (let i = 0; i < samples.length; i++) samples[i] = Math.round(samples[i] * scale);
+  }
+  applyDecode(samples, lookupArray(dict, 'Decode'), components);
+  return { components, samples, inverted: separation };
+}
+
+/**
+ * Unpacks rows of 1-16 bit samples into bytes: values as stored for up
+ * to 8 bits, the high byte for 16
+ */
+function unpack(data: Uint8Array, width: number, height: number, components: number, bitsPerComponent: number): Uint8Array {
+  const rowBytes = Math.ceil((width * components * bitsPerComponent) / 8);
+  if (data.length < rowBytes * height) throw new Error('the image data is shorter than its dimensions');
+
+  const samples = new Uint8Array(width * height * components);
+  const mask = (1 << bitsPerComponent) - 1;
+  let s = 0;
+  for (let y = 0; y < height; y++) {
+    const row = y * rowBytes;
+    for (let x = 0; x < width * components; x++) {
+      if (bitsPerComponent === 8) {
+        samples[s++] = data[row + x];
+      } else if (bitsPerComponent === 16) {
+        samples[s++] = data[row + x * 2];
+      } else {
+        const bit = x * bitsPerComponent;
+        samples[s++] = (data[row + (bit >> 3)] >> (8 - bitsPerComponent - (bit & 7))) & mask;
+      }
+    }
+  }
+  return samples;
+}
+
+/**
+ * Applies a Decode array to 8-bit samples in place
+ */
+function applyDecode(samples: Uint8Array, decode: PDFArray | undefined, components: number): void {
+  if (!decode) return;
+  const ranges = toNumberArray(decode);
+  if (ranges.length < components * 2) return;
+  for (let i = 0; i < samples.length; i++) {
+    const c = i % components;
+    const [min, max] = [ranges[c * 2], ranges[c * 2 + 1]];
+    samples[i] = Math.round(Math.min(1, Math.max(0, min + (samples[i] / 255) * (max - min))) * 255);
+  }
+}
+
+function readLookup(lookup: unknown): Uint8Array | undefined {
+  if (lookup instanceof PDFStream) return decodeStreamContents(lookup);
+  if (lookup instanceof PDFHexString) return lookup.asBytes();
+  if (lookup instanceof PDFString) return lookup.asBytes();
+  return undefined;
+}
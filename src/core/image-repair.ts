@@ -0,0 +1,319 @@
+/**
+ * Broken image repair
+ *
+ * Partially corrupted uploads often contain a few images whose data is
+ * truncated or undecodable, and one such image can make rendering fail.
+ * Images are checked as far as the stream decoders allow; recoverable ones
+ * are rebuilt and the rest are replaced so the document still renders.
+ */
+
+import {
+  PDFArray,
+  PDFBool,
+  PDFContext,
+  PDFDict,
+  PDFDocument,
+  PDFName,
+  PDFRawStream,
+  PDFRef,
+  PDFStream,
+  decodePDFRawStream,
+} from 'pdf-lib';
+import type { BrokenImage, ImageRepairMode, ImageRepairReport } from '../api/types';
+import { decodeOuterFilters, decodeStreamContents, getFilters, lookupDict, lookupName, lookupNumber } from './pdf-objects';
+
+/** Filters the stream decoder can undo; data in other filters isn't checked */
+const DECODABLE_FILTERS = new Set(['FlateDecode', 'LZWDecode', 'ASCIIHexDecode', 'ASCII85Decode', 'RunLengthDecode']);
+
+/** Components per color space family */
+const FAMILY_COMPONENTS: Record<string, number> = {
+  DeviceGray: 1,
+  CalGray: 1,
+  Indexed: 1,
+  Separation: 1,
+  DeviceRGB: 3,
+  CalRGB: 3,
+  Lab: 3,
+  DeviceCMYK: 4,
+};
+
+/** Bytes read per step when salvaging a stream that fails to decode */
+const SALVAGE_CHUNK = 1024;
+
+const TRAILING_PADDING = new Set([0x00, 0x0a, 0x0d, 0x20]);
+const JPEG_SOI = [0xff, 0xd8];
+const JPEG_EOI = [0xff, 0xd9];
+const JP2_SIGNATURE = [0x00, 0x00, 0x00, 0x0c, 0x6a, 0x50, 0x20, 0x20];
+const J2K_SIGNATURE = [0xff, 0x4f, 0xff, 0x51];
+
+interface ImageCheck {
+  reason: string;
+  /** Rebuilt image, when the data could be recovered */
+  repaired?: PDFRawStream;
+}
+
+/**
+ * Checks every image XObject and repairs or replaces broken ones
+ *
+ * Truncated JPEGs get their end marker back, and short or partly
+ * decodable samples are padded to full size. Anything else is replaced:
+ * with a gray placeholder in 'placeholder' mode, or with an empty form in
+ * 'drop' mode. Broken soft masks and stencil masks are detached, leaving
+ * their image unmasked.
+ */
+export function repairImages(pdfDoc: PDFDocument, mode: ImageRepairMode): ImageRepairReport {
+  const context = pdfDoc.context;
+  const pages = mapImagePages(pdfDoc);
+  const report: ImageRepairReport = { recovered: [], unrecoverable: [] };
+
+  const images: Array<[PDFRef, PDFRawStream]> = [];
+  const maskOwners = new Map<PDFRef, Array<{ owner: PDFDict; key: PDFName }>>();
+  for (const [ref, object] of context.enumerateIndirectObjects()) {
+    if (!(object instanceof PDFRawStream) || lookupName(object.dict, 'Subtype') !== 'Image') continue;
+    images.push([ref, object]);
+    for (const key of [PDFName.of('SMask'), PDFName.of('Mask')]) {
+      const mask = object.dict.get(key);
+      if (mask instanceof PDFRef) maskOwners.set(mask, [...(maskOwners.get(mask) ?? []), { owner: object.dict, key }]);
+    }
+  }
+
+  for (const [ref, stream] of images) {
+    const check = checkImage(stream);
+    if (!check) continue;
+
+    const image: BrokenImage = { object: ref.toString(), pages: pages.get(ref) ?? [], reason: check.reason };
+    if (check.repaired) {
+      context.assign(ref, check.repaired);
+      report.recovered.push(image);
+      continue;
+    }
+
+    const owners = maskOwners.get(ref);
+    if (owners) {
+      for (const { owner, key } of owners) owner.delete(key);
+    } else {
+      context.assign(ref, mode === 'drop' ? emptyForm(context) : placeholderImage(context));
+    }
+    report.unrecoverable.push(image);
+  }
+
+  return report;
+}
+
+/**
+ * Checks an image's data without changing anything
+ *
+ * @returns Why the image is broken, or undefined if it decodes or can't
+ *   be checked
+ */
+export function findImageDamage(stream: PDFRawStream): string | undefined {
+  return checkImage(stream)?.reason;
+}
+
+/**
+ * @returns Why the image is broken (and a repaired copy when possible), or
+ * undefined if it decodes or can't be checked
+ */
+function checkImage(stream: PDFRawStream): ImageCheck | undefined {
+  const filters = getFilters(stream.dict);
+  const last = filters[filters.length - 1];
+  const isCodec = last === 'DCTDecode' || last === 'JPXDecode';
+  const outer = isCodec ? filters.slice(0, -1) : filters;
+  if (!outer.every(filter => DECODABLE_FILTERS.has(filter))) return undefined;
+
+  if (isCodec) {
+    const data = outer.length === 0 ? stream.contents : decodeOuterFilters(stream, outer.length);
+    if (!data) return { reason: `data around the ${last} image is corrupt` };
+    return last === 'DCTDecode' ? checkJpeg(stream, data) : checkJpx(data);
+  }
+
+  const predictor = readPredictor(stream.dict);
+  const expected = expectedLength(stream.dict, predictor);
+
+  let data = decodeStreamContents(stream);
+  let reason: string;
+  if (!data) {
+    data = salvage(stream);
+    reason = 'stream data is corrupt or truncated';
+  } else if (expected !== undefined && data.length < expected) {
+    reason = `image data is short (${data.length} of ${expected} bytes)`;
+  } else {
+    return undefined;
+  }
+
+  // Padding predicted rows would need a valid predictor tag per row
+  if (!data || data.length === 0 || expected === undefined || predictor > 1) return { reason };
+
+  const padded = new Uint8Array(expected).fill(paddingByte(stream.dict));
+  padded.set(data.subarray(0, expected));
+  const repaired = stream.dict.context.flateStream(padded);
+  for (const [key, value] of stream.dict.entries()) {
+    if (!['Filter', 'DecodeParms', 'Length'].includes(key.decodeText())) repaired.dict.set(key, value);
+  }
+  return { reason, repaired };
+}
+
+function checkJpeg(stream: PDFRawStream, data: Uint8Array): ImageCheck | undefined {
+  if (!startsWith(data, JPEG_SOI)) return { reason: 'JPEG data has no start marker' };
+
+  // Some writers pad after the end marker
+  let end = data.length;
+  while (end > 0 && TRAILING_PADDING.has(data[end - 1])) end--;
+  if (data[end - 2] === JPEG_EOI[0] && data[end - 1] === JPEG_EOI[1]) return undefined;
+
+  // Decoders show everything up to the cut once the end marker is there
+  const fixed = new Uint8Array(end + 2);
+  fixed.set(data.subarray(0, end));
+  fixed.set(JPEG_EOI, end);
+  const dict = stream.dict.clone();
+  dict.set(PDFName.of('Filter'), PDFName.of('DCTDecode'));
+  dict.delete(PDFName.of('DecodeParms'));
+  return { reason: 'JPEG data is truncated', repaired: PDFRawStream.of(dict, fixed) };
+}
+
+function checkJpx(data: Uint8Array): ImageCheck | undefined {
+  return startsWith(data, JP2_SIGNATURE) || startsWith(data, J2K_SIGNATURE)
+    ? undefined
+    : { reason: 'JPEG 2000 data has no valid signature' };
+}
+
+/**
+ * Decodes as much of a failing stream as possible
+ */
+function salvage(stream: PDFRawStream): Uint8Array | undefined {
+  const chunks: Uint8Array[] = [];
+  try {
+    const decoder = decodePDFRawStream(stream);
+    for (;;) {
+      const chunk = decoder.getBytes(SALVAGE_CHUNK);
+      if (chunk.length === 0) break;
+      chunks.push(chunk.slice());
+      if (chunk.length < SALVAGE_CHUNK) break;
+    }
+  } catch {
+    // Keep what was decoded before the damage
+  }
+  if (chunks.length === 0) return undefined;
+
+  const data = new Uint8Array(chunks.reduce((total, chunk) => total + chunk.length, 0));
+  let offset = 0;
+  for (const chunk of chunks) {
+    data.set(chunk, offset);
+    offset += chunk.length;
+  }
+  return data;
+}
+
+/**
+ * Largest predictor in the decode parameters (1 if none)
+ */
+function readPredictor(dict: PDFDict): number {
+  const parms = dict.lookup(PDFName.of('DecodeParms'));
+  const list = parms instanceof PDFArray ? parms.asArray().map(item => dict.context.lookup(item)) : [parms];
+  return Math.max(1, ...list.map(item => (item instanceof PDFDict ? lookupNumber(item, 'Predictor') ?? 1 : 1)));
+}
+
+/**
+ * Decoded size of the samples, or undefined for color spaces whose
+ * component count isn't known
+ */
+function expectedLength(dict: PDFDict, predictor: number): number | undefined {
+  const width = lookupNumber(dict, 'Width');
+  const height = lookupNumber(dict, 'Height');
+  if (!width || !height) return undefined;
+
+  const isMask = dict.lookup(PDFName.of('ImageMask')) === PDFBool.True;
+  const components = isMask ? 1 : componentCount(dict.lookup(PDFName.of('ColorSpace')));
+  const bitsPerComponent = isMask ? 1 : lookupNumber(dict, 'BitsPerComponent');
+  if (components === undefined || bitsPerComponent === undefined) return undefined;
+
+  // PNG predictors prefix each row with a tag byte
+  const rowBytes = Math.ceil((width * components * bitsPerComponent) / 8) + (predictor >= 10 ? 1 : 0);
+  return rowBytes * height;
+}
+
+/**
+ * Components per sample of a color space, or undefined if unknown
+ */
+export function componentCount(colorSpace: unknown): number | undefined {
+  if (colorSpace instanceof PDFName) return FAMILY_COMPONENTS[colorSpace.decodeText()];
+  if (!(colorSpace instanceof PDFArray)) return undefined;
+
+  const family = colorSpace.lookup(0);
+  if (!(family instanceof PDFName)) return undefined;
+  switch (family.decodeText()) {
+    case 'ICCBased': {
+      const profile = colorSpace.lookup(1);
+      return profile instanceof PDFStream ? lookupNumber(profile.dict, 'N') : undefined;
+    }
+    case 'DeviceN': {
+      const names = colorSpace.lookup(1);
+      return names instanceof PDFArray ? names.size() : undefined;
+    }
+    default:
+      return FAMILY_COMPONENTS[family.decodeText()];
+  }
+}
+
+/**
+ * Byte that pads missing samples with white (or no ink for CMYK)
+ */
+function paddingByte(dict: PDFDict): number {
+  const colorSpace = dict.lookup(PDFName.of('ColorSpace'));
+  return colorSpace === PDFName.of('DeviceCMYK') ? 0x00 : 0xff;
+}
+
+/**
+ * 1x1 light gray image, stretched over the broken image's area
+ */
+function placeholderImage(context: PDFContext): PDFRawStream {
+  return context.stream(new Uint8Array([0xc0]), {
+    Type: 'XObject',
+    Subtype: 'Image',
+    Width: 1,
+    Height: 1,
+    ColorSpace: 'DeviceGray',
+    BitsPerComponent: 8,
+  });
+}
+
+/**
+ * Form XObject that draws nothing, so Do operators stay valid
+ */
+function emptyForm(context: PDFContext): PDFRawStream {
+  return context.stream(new Uint8Array(0), { Type: 'XObject', Subtype: 'Form', BBox: [0, 0, 0, 0] });
+}
+
+/**
+ * Maps image references to the pages that draw them (directly or through
+ * forms)
+ */
+function mapImagePages(pdfDoc: PDFDocument): Map<PDFRef, number[]> {
+  const pages = new Map<PDFRef, number[]>();
+
+  const visit = (resources: PDFDict | undefined, page: number, visited: Set<PDFDict>): void => {
+    const xObjects = resources && lookupDict(resources, 'XObject');
+    if (!xObjects || visited.has(xObjects)) return;
+    visited.add(xObjects);
+
+    for (const [name, value] of xObjects.entries()) {
+      const xObject = xObjects.lookup(name);
+      if (!(xObject instanceof PDFStream)) continue;
+      const subtype = lookupName(xObject.dict, 'Subtype');
+      if (subtype === 'Image' && value instanceof PDFRef) {
+        const list = pages.get(value) ?? [];
+        if (!list.includes(page)) list.push(page);
+        pages.set(value, list);
+      } else if (subtype === 'Form') {
+        visit(lookupDict(xObject.dict, 'Resources'), page, visited);
+      }
+    }
+  };
+
+  pdfDoc.getPages().forEach((page, index) => visit(page.node.Resources(), index + 1, new Set()));
+  return pages;
+}
+
+function startsWith(data: Uint8Array, prefix: number[]): boolean {
+  return prefix.every((byte, i) => data[i] === byte);
+}
@@ -0,0 +1,244 @@
+/**
+ * Page image sequences
+ *
+ * A scanned document is one image per page, so a continuous-scroll viewer
+ * can show the images themselves instead of rendering pages. This picks
+ * out the image standing in for each page and returns it as a file
+ * browsers can display: JPEGs as stored, other samples as PNG.
+ */
+
+import {
+  PDFArray,
+  PDFBool,
+  PDFContext,
+  PDFDict,
+  PDFHexString,
+  PDFName,
+  PDFNumber,
+  PDFPage,
+  PDFRawStream,
+  PDFStream,
+  PDFString,
+} from 'pdf-lib';
+import type { ImageSequencePage } from '../api/types';
+import { componentCount } from './image-repair';
+import { analyzePage, imageCoverage } from './page-analysis';
+import { decodeOuterFilters, decodeStreamContents, getFilters, lookupDict, lookupNumber } from './pdf-objects';
+
+/** Matrix entries smaller than this count as zero */
+const EPSILON = 1e-6;
+
+/** Color space families whose samples PNG stores as they are */
+const PNG_FAMILIES = new Set(['DeviceGray', 'DeviceRGB', 'CalGray', 'CalRGB', 'ICCBased']);
+
+const PNG_SIGNATURE = new Uint8Array([0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a]);
+
+let crcTable: Uint32Array | undefined;
+
+/**
+ * Returns the image a page consists of, or why the page must be rendered
+ *
+ * A page qualifies when it draws exactly one upright image covering at
+ * least minCoverage of the crop box, with no visible text or vector
+ * drawing. Invisible text (OCR layers) is ignored.
+ */
+export function readPageImage(
+  context: PDFContext,
+  page: PDFPage,
+  index: number,
+  minCoverage: number
+): ImageSequencePage {
+  const box = page.getCropBox();
+  const base = {
+    page: index + 1,
+    pageWidth: box.width,
+    pageHeight: box.height,
+    rotation: ((page.getRotation().angle % 360) + 360) % 360,
+  };
+  const render = (reason: string): ImageSequencePage => ({ ...base, requiresRendering: true, reason });
+
+  const summary = analyzePage(page);
+  if (summary.images.length === 0) return render('the page has no image');
+  if (summary.images.length > 1) return render(`the page has ${summary.images.length} images`);
+  if (summary.visibleTextOps > 0) return render('the page has visible text');
+  if (summary.vectorOps > 0) return render('the page has vector drawing');
+  if (imageCoverage(page, summary.images) < minCoverage) return render('the image doesn\'t cover the page');
+
+  const [image] = summary.images;
+  const [a, b, c, d] = image.matrix;
+  if (Math.abs(b) > EPSILON || Math.abs(c) > EPSILON || a <= 0 || d <= 0) {
+    return render('the image is drawn rotated or flipped');
+  }
+  if (!(image.stream instanceof PDFRawStream)) return render('the image is inline');
+
+  try {
+    return {
+      ...base,
+      requiresRendering: false,
+      width: image.width,
+      height: image.height,
+      ...encodeImage(context, image.stream, image.width, image.height),
+    };
+  } catch (error) {
+    return render(error instanceof Error ? error.message : 'the image can\'t be extracted');
+  }
+}
+
+/**
+ * @throws If the image can't be shown without a renderer
+ */
+function encodeImage(
+  context: PDFContext,
+  stream: PDFRawStream,
+  width: number,
+  height: number
+): Pick<ImageSequencePage, 'mimeType' | 'data'> {
+  const dict = stream.dict;
+  if (dict.lookup(PDFName.of('ImageMask')) === PDFBool.True) throw new Error('the image is a stencil mask');
+  if (dict.has(PDFName.of('SMask')) || dict.has(PDFName.of('Mask'))) throw new Error('the image has transparency');
+  if (dict.has(PDFName.of('Decode'))) throw new Error('the image has a Decode array');
+
+  const filters = getFilters(dict);
+  const last = filters[filters.length - 1];
+
+  if (last === 'DCTDecode' || last === 'JPXDecode') {
+    const data = filters.length === 1 ? stream.contents : decodeOuterFilters(stream, filters.length - 1);
+    if (!data) throw new Error('the image data can\'t be decoded');
+    return { mimeType: last === 'DCTDecode' ? 'image/jpeg' : 'image/jp2', data };
+  }
+  if (last === 'JBIG2Decode' || last === 'CCITTFaxDecode') throw new Error(`${last} data needs a renderer`);
+
+  // PNG predictors leave the rows already filtered the way PNG stores them
+  const parms = lookupDict(dict, 'DecodeParms');
+  const predictor = (parms && lookupNumber(parms, 'Predictor')) ?? 1;
+  if (predictor > 1 && predictor < 10) throw new Error('TIFF-predicted data can\'t be converted');
+
+  const data = decodeStreamContents(stream);
+  if (!data) throw new Error('the image data can\'t be decoded');
+  const predictorParms = predictor >= 10 ? parms : undefined;
+  return { mimeType: 'image/png', data: encodePng(context, stream, data, width, height, predictorParms) };
+}
+
+function encodePng(
+  context: PDFContext,
+  stream: PDFRawStream,
+  data: Uint8Array,
+  width: number,
+  height: number,
+  predictorParms: PDFDict | undefined
+): Uint8Array {
+  const bitsPerComponent = lookupNumber(stream.dict, 'BitsPerComponent') ?? 8;
+  if (![1, 2, 4, 8, 16].includes(bitsPerComponent)) {
+    throw new Error(`${bitsPerComponent}-bit samples can't be converted`);
+  }
+
+  const colorSpace = stream.dict.lookup(PDFName.of('ColorSpace'));
+  const family = colorSpace instanceof PDFArray ? colorSpace.lookup(0) : colorSpace;
+  let colorType: number;
+  let components: number;
+  let palette: Uint8Array | undefined;
+
+  if (colorSpace instanceof PDFArray && family === PDFName.of('Indexed')) {
+    palette = readPalette(colorSpace);
+    if (!palette || bitsPerComponent > 8) throw new Error('the Indexed color space can\'t be converted');
+    colorType = 3;
+    components = 1;
+  } else {
+    components = componentCount(colorSpace) ?? 0;
+    const supported = family instanceof PDFName && PNG_FAMILIES.has(family.decodeText());
+    if (supported && components === 1) {
+      colorType = 0;
+    } else if (supported && components === 3 && bitsPerComponent >= 8) {
+      colorType = 2;
+    } else {
+      throw new Error('the color space can\'t be converted');
+    }
+  }
+
+  // Rows are byte-aligned in both formats; PNG adds a filter type byte
+  const rowBytes = Math.ceil((width * components * bitsPerComponent) / 8);
+  let rows: Uint8Array;
+  if (predictorParms) {
+    const matches = (lookupNumber(predictorParms, 'Columns') ?? 1) === width
+      && (lookupNumber(predictorParms, 'Colors') ?? 1) === components
+      && (lookupNumber(predictorParms, 'BitsPerComponent') ?? 8) === bitsPerComponent;
+    if (!matches) throw new Error('the predictor parameters don\'t match the image');
+    if (data.length < (rowBytes + 1) * height) throw new Error('the image data is shorter than its dimensions');
+    rows = data.subarray(0, (rowBytes + 1) * height);
+  } else {
+    if (data.length < rowBytes * height) throw new Error('the image data is shorter than its dimensions');
+    rows = new Uint8Array((rowBytes + 1) * height);
+    for (let y = 0; y < height; y++) {
+      rows.set(data.subarray(y * rowBytes, (y + 1) * rowBytes), y * (rowBytes + 1) + 1);
+    }
+  }
+
+  const header = new Uint8Array(13);
+  const view = new DataView(header.buffer);
+  view.setUint32(0, width);
+  view.setUint32(4, height);
+  header.set([bitsPerComponent, colorType, 0, 0, 0], 8);
+
+  return concat([
+    PNG_SIGNATURE,
+    pngChunk('IHDR', header),
+    ...(palette ? [pngChunk('PLTE', palette)] : []),
+    pngChunk('IDAT', context.flateStream(rows).contents),
+    pngChunk('IEND', new Uint8Array(0)),
+  ]);
+}
+
+/**
+ * Reads an Indexed color space's lookup table as RGB palette entries
+ */
+function readPalette(colorSpace: PDFArray): Uint8Array | undefined {
+  const baseComponents = componentCount(colorSpace.lookup(1));
+  const hival = colorSpace.lookup(2);
+  const lookup = colorSpace.lookup(3);
+  const table = lookup instanceof PDFStream ? decodeStreamContents(lookup)
+    : lookup instanceof PDFHexString || lookup instanceof PDFString ? lookup.asBytes()
+      : undefined;
+  if (!table || !(hival instanceof PDFNumber) || (baseComponents !== 1 && baseComponents !== 3)) return undefined;
+
+  const entries = Math.min(hival.asNumber() + 1, 256, Math.floor(table.length / baseComponents));
+  if (entries < 1) return undefined;
+  const palette = new Uint8Array(entries * 3);
+  for (let i = 0; i < entries; i++) {
+    for (let c = 0; c < 3; c++) palette[i * 3 + c] = table[i * baseComponents + (baseComponents === 3 ? c : 0)];
+  }
+  return palette;
+}
+
+function pngChunk(type: string, data: Uint8Array): Uint8Array {
+  const chunk = new Uint8Array(data.length + 12);
+  const view = new DataView(chunk.buffer);
+  view.setUint32(0, data.length);
+  for (let i = 0; i < 4; i++) chunk[4 + i] = type.charCodeAt(i);
+  chunk.set(data, 8);
+  view.setUint32(data.length + 8, crc32(chunk.subarray(4, data.length + 8)));
+  return chunk;
+}
+
+function crc32(bytes: Uint8Array): number {
+  if (!crcTable) {
+    crcTable = new Uint32Array(256);
+    for (let n = 0; n < 256; n++) {
+      let c = n;
+      for (let k = 0; k < 8; k++) c = c & 1 ? 0xedb88320 ^ (c >>> 1) : c >>> 1;
+      crcTable[n] = c >>> 0;
+    }
+  }
+  let crc = 0xffffffff;
+  for (const byte of bytes) crc = crcTable[(crc ^ byte) & 0xff] ^ (crc >>> 8);
+  return (crc ^ 0xffffffff) >>> 0;
+}
+
+function concat(parts: Uint8Array[]): Uint8Array {
+  const result = new Uint8Array(parts.reduce((total, part) => total + part.length, 0));
+  let offset = 0;
+  for (const part of parts) {
+    result.set(part, offset);
+    offset += part.length;
+  }
+  return result;
+}
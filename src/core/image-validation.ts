@@ -0,0 +1,147 @@
+/**
+ * Image validation
+ *
+ * Flags images that compression would skip, re-encode wrongly or fail
+ * on, before anything is changed. Nothing is repaired here; see
+ * repairImages for that.
+ */
+
+import { PDFArray, PDFBool, PDFDict, PDFDocument, PDFName, PDFPage, PDFRawStream, PDFRef, PDFStream } from 'pdf-lib';
+import type { ImageValidation } from '../api/types';
+import { componentCount, findImageDamage } from './image-repair';
+import { getFilters, lookupArray, lookupDict, lookupName, lookupNumber, toNumberArray } from './pdf-objects';
+
+/** Filters pdf-lib and the browser can decode */
+const KNOWN_FILTERS = new Set([
+  'FlateDecode', 'LZWDecode', 'ASCIIHexDecode', 'ASCII85Decode', 'RunLengthDecode',
+  'DCTDecode', 'JPXDecode', 'JBIG2Decode', 'CCITTFaxDecode', 'Crypt',
+]);
+
+/** Codecs whose images pass through compression unchanged */
+const PASSTHROUGH_CODECS: Record<string, string> = {
+  JPXDecode: 'JPEG 2000 data can\'t be re-encoded; the image is kept as is',
+  JBIG2Decode: 'JBIG2 data can\'t be re-encoded; the image is kept as is',
+  CCITTFaxDecode: 'CCITT fax data can\'t be re-encoded; the image is kept as is',
+};
+
+const BITS_PER_COMPONENT = [1, 2, 4, 8, 16];
+
+/**
+ * Checks every image used on each page, in the order found in the page
+ * resources (forms included)
+ */
+export function validateImages(pdfDoc: PDFDocument): ImageValidation[] {
+  const context = pdfDoc.context;
+  const refs = new Map<PDFRawStream, PDFRef>();
+  for (const [ref, object] of context.enumerateIndirectObjects()) {
+    if (object instanceof PDFRawStream) refs.set(object, ref);
+  }
+
+  const results: ImageValidation[] = [];
+  const damage = new Map<PDFRawStream, string | undefined>();
+  pdfDoc.getPages().forEach((page, pageIndex) => {
+    collectPageImages(page).forEach((stream, index) => {
+      if (!damage.has(stream)) damage.set(stream, findImageDamage(stream));
+      const colorSpace = stream.dict.lookup(PDFName.of('ColorSpace'));
+      results.push({
+        page: pageIndex + 1,
+        index,
+        object: refs.get(stream)?.toString() ?? null,
+        colorSpace: colorSpaceName(colorSpace),
+        filters: getFilters(stream.dict),
+        issues: findIssues(stream, damage.get(stream)),
+      });
+    });
+  });
+  return results;
+}
+
+function findIssues(stream: PDFRawStream, damage: string | undefined): string[] {
+  const dict = stream.dict;
+  const issues: string[] = [];
+  const filters = getFilters(dict);
+  const last = filters[filters.length - 1];
+  const isMask = dict.lookup(PDFName.of('ImageMask')) === PDFBool.True;
+  const colorSpace = dict.lookup(PDFName.of('ColorSpace'));
+
+  for (const filter of filters) {
+    if (!KNOWN_FILTERS.has(filter)) issues.push(`unknown filter ${filter}; the data can't be decoded`);
+  }
+  if (last && PASSTHROUGH_CODECS[last]) issues.push(PASSTHROUGH_CODECS[last]);
+
+  const width = lookupNumber(dict, 'Width');
+  const height = lookupNumber(dict, 'Height');
+  if (!width || !height || width < 0 || height < 0) issues.push('missing or invalid Width or Height');
+
+  // JPEG 2000 carries its own color space and depth
+  if (!isMask && last !== 'JPXDecode') {
+    const bitsPerComponent = lookupNumber(dict, 'BitsPerComponent');
+    if (bitsPerComponent === undefined || !BITS_PER_COMPONENT.includes(bitsPerComponent)) {
+      issues.push(`invalid BitsPerComponent ${bitsPerComponent ?? '(missing)'}`);
+    }
+    if (colorSpace === undefined) {
+      issues.push('no color space');
+    } else if (componentCount(colorSpace) === undefined) {
+      issues.push(`unsupported color space ${colorSpaceName(colorSpace) ?? '(unknown)'}`);
+    }
+  }
+
+  if (last === 'DCTDecode' && componentCount(colorSpace) === 4) {
+    const decode = lookupArray(dict, 'Decode');
+    if (decode && toNumberArray(decode)[0] === 1) {
+      issues.push('CMYK JPEG with an inverted Decode array; colors may come out inverted after re-encoding');
+    } else {
+      issues.push('CMYK JPEG; browsers decode these inconsistently, so re-encoding may shift colors');
+    }
+  }
+
+  if (damage) issues.push(damage);
+  return issues;
+}
+
+/**
+ * Images used on a page, in the order found in its resources (forms
+ * included), each followed by its soft mask; positions are the image
+ * index used by validateImages and getImageHistogram
+ */
+export function collectPageImages(page: PDFPage): PDFRawStream[] {
+  const images: PDFRawStream[] = [];
+  collectImages(page.node.Resources(), images, new Set());
+  return images;
+}
+
+/**
+ * Color space family, e.g. "DeviceRGB" or "ICCBased"
+ */
+export function colorSpaceName(colorSpace: unknown): string | null {
+  if (colorSpace instanceof PDFName) return colorSpace.decodeText();
+  if (colorSpace instanceof PDFArray) {
+    const family = colorSpace.lookup(0);
+    if (family instanceof PDFName) return family.decodeText();
+  }
+  return null;
+}
+
+/**
+ * Collects image XObjects from a resource dictionary and the forms it
+ * uses, with their soft masks
+ */
+function collectImages(resources: PDFDict | undefined, images: PDFRawStream[], visited: Set<PDFDict>): void {
+  const xObjects = resources && lookupDict(resources, 'XObject');
+  if (!xObjects || visited.has(xObjects)) return;
+  visited.add(xObjects);
+
+  for (const [name] of xObjects.entries()) {
+    const xObject = xObjects.lookup(name);
+    if (!(xObject instanceof PDFStream)) continue;
+
+    const subtype = lookupName(xObject.dict, 'Subtype');
+    if (subtype === 'Image' && xObject instanceof PDFRawStream) {
+      if (!images.includes(xObject)) images.push(xObject);
+      const mask = xObject.dict.lookup(PDFName.of('SMask'));
+      if (mask instanceof PDFRawStream && !images.includes(mask)) images.push(mask);
+    } else if (subtype === 'Form') {
+      collectImages(lookupDict(xObject.dict, 'Resources'), images, visited);
+    }
+  }
+}
@@ -0,0 +1,222 @@
+/**
+ * Incremental updates
+ *
+ * An incremental update appends the changed objects and a new
+ * cross-reference section to the original file, which is left byte for
+ * byte intact. Versioned storage then only has to keep the appended tail.
+ */
+
+import { PDFDocument, PDFRef } from 'pdf-lib';
+import { bytesEqual, serializeObject } from './pdf-objects';
+import { openPdfjsDocument } from './pdfjs';
+import { findStartXref, isXrefStream, readXrefSize, toLatin1 } from './raw-pdf';
+
+/** Serialized objects, keyed by reference */
+export type ObjectSnapshot = Map<PDFRef, Uint8Array>;
+
+const encoder = new TextEncoder();
+
+/**
+ * Records every indirect object before editing, so the changes can be
+ * found afterwards
+ *
+ * Also reserves the original's object numbers: pdf-lib drops object and
+ * cross-reference streams on load, and a new object must not reuse their
+ * numbers.
+ *
+ * @param original - The bytes the document was loaded from
+ */
+export function snapshotObjects(pdfDoc: PDFDocument, original: ArrayBuffer): ObjectSnapshot {
+  const raw = toLatin1(original);
+  const startXref = findStartXref(raw);
+  const size = startXref !== undefined ? readXrefSize(raw, startXref) : undefined;
+  if (size !== undefined) {
+    pdfDoc.context.largestObjectNumber = Math.max(pdfDoc.context.largestObjectNumber, size - 1);
+  }
+
+  const snapshot: ObjectSnapshot = new Map();
+  for (const [ref, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    snapshot.set(ref, serializeObject(object));
+  }
+  return snapshot;
+}
+
+/**
+ * Whether any indirect object was changed, added or removed since the
+ * snapshot
+ */
+export function hasChanges(pdfDoc: PDFDocument, snapshot: ObjectSnapshot): boolean {
+  const objects = pdfDoc.context.enumerateIndirectObjects();
+  if (objects.length !== snapshot.size) return true;
+  return objects.some(([ref, object]) => {
+    const before = snapshot.get(ref);
+    return !before || !bytesEqual(before, serializeObject(object));
+  });
+}
+
+/**
+ * Appends the objects that changed since the snapshot to the original
+ * bytes, then checks that the result opens with the same page count
+ *
+ * The new cross-reference section matches the original's kind (table or
+ * stream), as the spec requires.
+ *
+ * @param original - The unmodified file the document was loaded from
+ * @param snapshot - Objects recorded before editing
+ */
+export async function saveIncremental(
+  pdfDoc: PDFDocument,
+  original: ArrayBuffer,
+  snapshot: ObjectSnapshot
+): Promise<ArrayBuffer> {
+  const context = pdfDoc.context;
+  if (context.trailerInfo.Encrypt) {
+    throw new Error('Incremental updates of encrypted documents are not supported');
+  }
+
+  const raw = toLatin1(original);
+  const prev = findStartXref(raw);
+  if (prev === undefined) {
+    throw new Error('Cannot append an incremental update: the original has no startxref');
+  }
+
+  // Embeds pending fonts and images and finalizes form fields
+  await pdfDoc.flush();
+
+  const originalBytes = new Uint8Array(original);
+  const parts: Uint8Array[] = [originalBytes, encoder.encode('\n')];
+  let offset = originalBytes.length + 1;
+  const entries = new Map<number, XrefEntry>();
+
+  const current = new Set<PDFRef>();
+  for (const [ref, object] of context.enumerateIndirectObjects()) {
+    current.add(ref);
+    const bytes = serializeObject(object);
+    const before = snapshot.get(ref);
+    if (before && bytesEqual(before, bytes)) continue;
+
+    const framed = concat([
+      encoder.encode(`${ref.objectNumber} ${ref.generationNumber} obj\n`),
+      bytes,
+      encoder.encode('\nendobj\n'),
+    ]);
+    entries.set(ref.objectNumber, { offset, generation: ref.generationNumber, inUse: true });
+    parts.push(framed);
+    offset += framed.length;
+  }
+  for (const ref of snapshot.keys()) {
+    if (!current.has(ref)) {
+      entries.set(ref.objectNumber, { offset: 0, generation: ref.generationNumber + 1, inUse: false });
+    }
+  }
+
+  const trailer = [
+    context.trailerInfo.Root && `/Root ${context.trailerInfo.Root}`,
+    context.trailerInfo.Info && `/Info ${context.trailerInfo.Info}`,
+    context.trailerInfo.ID && `/ID ${context.trailerInfo.ID}`,
+    `/Prev ${prev}`,
+  ].filter(Boolean).join(' ');
+
+  const size = context.largestObjectNumber + 1;
+  const section = isXrefStream(raw, prev)
+    ? xrefStreamSection(entries, size, trailer, offset)
+    : xrefTableSection(entries, size, trailer, offset);
+  parts.push(section);
+
+  const output = concat(parts).buffer as ArrayBuffer;
+  await verifyPageCount(output, pdfDoc.getPageCount());
+  return output;
+}
+
+interface XrefEntry {
+  offset: number;
+  generation: number;
+  inUse: boolean;
+}
+
+function xrefTableSection(entries: Map<number, XrefEntry>, size: number, trailer: string, offset: number): Uint8Array {
+  let table = 'xref\n';
+  for (const run of consecutiveRuns([...entries.keys()])) {
+    table += `${run[0]} ${run.length}\n`;
+    for (const objectNumber of run) {
+      const entry = entries.get(objectNumber)!;
+      const position = String(entry.offset).padStart(10, '0');
+      const generation = String(entry.generation).padStart(5, '0');
+      table += `${position} ${generation} ${entry.inUse ? 'n' : 'f'}\r\n`;
+    }
+  }
+  table += `trailer\n<< /Size ${size} ${trailer} >>\nstartxref\n${offset}\n%%EOF\n`;
+  return encoder.encode(table);
+}
+
+/**
+ * Writes the section as an uncompressed cross-reference stream, which
+ * gets the next free object number
+ */
+function xrefStreamSection(entries: Map<number, XrefEntry>, size: number, trailer: string, offset: number): Uint8Array {
+  const streamNumber = size;
+  entries.set(streamNumber, { offset, generation: 0, inUse: true });
+
+  // Fields: type (1 byte), offset (4 bytes), generation (2 bytes)
+  const index: number[] = [];
+  const rows: number[] = [];
+  for (const run of consecutiveRuns([...entries.keys()])) {
+    index.push(run[0], run.length);
+    for (const objectNumber of run) {
+      const entry = entries.get(objectNumber)!;
+      const position = entry.offset;
+      rows.push(
+        entry.inUse ? 1 : 0,
+        (position >>> 24) & 0xff, (position >>> 16) & 0xff, (position >>> 8) & 0xff, position & 0xff,
+        (entry.generation >>> 8) & 0xff, entry.generation & 0xff
+      );
+    }
+  }
+
+  const dict = `<< /Type /XRef /Size ${size + 1} /W [1 4 2] /Index [${index.join(' ')}] ` +
+    `/Length ${rows.length} ${trailer} >>`;
+  return concat([
+    encoder.encode(`${streamNumber} 0 obj\n${dict}\nstream\n`),
+    new Uint8Array(rows),
+    encoder.encode(`\nendstream\nendobj\nstartxref\n${offset}\n%%EOF\n`),
+  ]);
+}
+
+/**
+ * Splits sorted object numbers into runs of consecutive numbers (xref
+ * subsections)
+ */
+function consecutiveRuns(objectNumbers: number[]): number[][] {
+  const runs: number[][] = [];
+  for (const objectNumber of objectNumbers.sort((a, b) => a - b)) {
+    const run = runs[runs.length - 1];
+    if (run && run[run.length - 1] === objectNumber - 1) run.push(objectNumber);
+    else runs.push([objectNumber]);
+  }
+  return runs;
+}
+
+/**
+ * pdf.js reads files through their cross-reference sections, so a broken
+ * update shows up as missing pages
+ */
+async function verifyPageCount(output: ArrayBuffer, expected: number): Promise<void> {
+  const pdfDocument = await openPdfjsDocument(output);
+  try {
+    if (pdfDocument.numPages !== expected) {
+      throw new Error(`Incremental update is unreadable: expected ${expected} pages, found ${pdfDocument.numPages}`);
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+}
+
+function concat(parts: Uint8Array[]): Uint8Array {
+  const bytes = new Uint8Array(parts.reduce((total, part) => total + part.length, 0));
+  let offset = 0;
+  for (const part of parts) {
+    bytes.set(part, offset);
+    offset += part.length;
+  }
+  return bytes;
+}
@@ -0,0 +1,187 @@
+/**
+ * Inline image optimization
+ *
+ * Inline images (BI ... ID ... EI) live inside content streams, so the
+ * image passes that work on XObjects never see them. This rewrites page
+ * content: large inline images become image XObjects, and uncompressed
+ * small ones are Flate-encoded in place. Re-encoding is lossless; the
+ * balanced/max rasterization resamples inline images along with the page.
+ */
+
+import {
+  PDFArray,
+  PDFBool,
+  PDFDict,
+  PDFDocument,
+  PDFHexString,
+  PDFName,
+  PDFNull,
+  PDFNumber,
+  PDFObject,
+  PDFPage,
+} from 'pdf-lib';
+import type { ContentDict, ContentOperand, InlineImageReport } from '../api/types';
+import { parsePageContent, serializeContent } from './content-stream';
+import type { ContentOperation } from './content-stream';
+import { lookupDict } from './pdf-objects';
+
+/**
+ * Inline images with more data than this are promoted to XObjects (the
+ * PDF specification recommends inline images stay under 4 KB)
+ */
+const PROMOTE_THRESHOLD = 4096;
+
+const KEY_ABBREVIATIONS: Record<string, string> = {
+  BPC: 'BitsPerComponent', CS: 'ColorSpace', D: 'Decode', DP: 'DecodeParms',
+  F: 'Filter', H: 'Height', IM: 'ImageMask', I: 'Interpolate', W: 'Width', L: 'Length',
+};
+
+const VALUE_ABBREVIATIONS: Record<string, string> = {
+  G: 'DeviceGray', RGB: 'DeviceRGB', CMYK: 'DeviceCMYK', I: 'Indexed',
+  AHx: 'ASCIIHexDecode', A85: 'ASCII85Decode', LZW: 'LZWDecode', Fl: 'FlateDecode',
+  RL: 'RunLengthDecode', CCF: 'CCITTFaxDecode', DCT: 'DCTDecode',
+};
+
+/**
+ * Promotes or re-encodes the inline images on every page
+ */
+export function optimizeInlineImages(pdfDoc: PDFDocument): InlineImageReport {
+  const report: InlineImageReport = { processed: 0, promotedToXObjects: 0 };
+
+  for (const page of pdfDoc.getPages()) {
+    const operations = parsePageContent(page);
+    if (!operations.some(operation => operation.operator === 'BI')) continue;
+
+    let changed = false;
+    const rewritten = operations.map(operation => {
+      if (operation.operator !== 'BI') return operation;
+
+      const replacement = optimizeInlineImage(pdfDoc, page, operation);
+      if (!replacement) return operation;
+
+      changed = true;
+      report.processed++;
+      if (replacement.operator === 'Do') report.promotedToXObjects++;
+      return replacement;
+    });
+
+    if (changed) {
+      const contents = pdfDoc.context.flateStream(serializeContent(rewritten));
+      page.node.set(PDFName.of('Contents'), pdfDoc.context.register(contents));
+    }
+  }
+
+  return report;
+}
+
+function optimizeInlineImage(
+  pdfDoc: PDFDocument,
+  page: PDFPage,
+  operation: ContentOperation
+): ContentOperation | undefined {
+  const params = operation.operands[0];
+  const data = operation.inlineImageData;
+  if (!data || !isContentDict(params)) return undefined;
+
+  const entries = expandEntries(params.entries);
+  const unfiltered = entries.Filter === undefined ||
+    (Array.isArray(entries.Filter) && entries.Filter.length === 0);
+
+  if (data.length > PROMOTE_THRESHOLD) {
+    return promoteToXObject(pdfDoc, page, entries, data, unfiltered);
+  }
+
+  if (unfiltered) {
+    const compressed = pdfDoc.context.flateStream(data).contents;
+    if (compressed.length >= data.length) return undefined;
+    const rewrittenEntries: Record<string, ContentOperand> = { F: '/Fl' };
+    for (const [key, value] of Object.entries(params.entries)) {
+      if (key !== 'L' && key !== 'Length' && key !== 'F' && key !== 'Filter') rewrittenEntries[key] = value;
+    }
+    return {
+      operator: 'BI',
+      operands: [{ kind: 'dict', entries: rewrittenEntries }],
+      inlineImageData: compressed,
+    };
+  }
+
+  return undefined;
+}
+
+function promoteToXObject(
+  pdfDoc: PDFDocument,
+  page: PDFPage,
+  entries: Record<string, ContentOperand>,
+  data: Uint8Array,
+  unfiltered: boolean
+): ContentOperation {
+  const context = pdfDoc.context;
+  const stream = unfiltered ? context.flateStream(data) : context.stream(data);
+  stream.dict.set(PDFName.of('Type'), PDFName.of('XObject'));
+  stream.dict.set(PDFName.of('Subtype'), PDFName.of('Image'));
+
+  const colorSpaces = lookupColorSpaces(page);
+  for (const [key, value] of Object.entries(entries)) {
+    if (key === 'Length') continue;
+    // A named color space refers to the page's /ColorSpace resources
+    const resolved = key === 'ColorSpace' && typeof value === 'string'
+      ? colorSpaces?.get(PDFName.of(value.slice(1)))
+      : undefined;
+    stream.dict.set(PDFName.of(key), resolved ?? toPdfObject(pdfDoc, value));
+  }
+
+  page.node.normalize();
+  const name = page.node.newXObject('InlineIm', context.register(stream));
+  return { operator: 'Do', operands: ['/' + name.decodeText()] };
+}
+
+function lookupColorSpaces(page: PDFPage): PDFDict | undefined {
+  const resources = page.node.Resources();
+  return resources && lookupDict(resources, 'ColorSpace');
+}
+
+/**
+ * Expands abbreviated inline image keys and values to their full names
+ */
+function expandEntries(entries: Record<string, ContentOperand>): Record<string, ContentOperand> {
+  const expanded: Record<string, ContentOperand> = {};
+  for (const [key, value] of Object.entries(entries)) {
+    const fullKey = KEY_ABBREVIATIONS[key] ?? key;
+    expanded[fullKey] = fullKey === 'ColorSpace' || fullKey === 'Filter' ? expandValue(value) : value;
+  }
+  return expanded;
+}
+
+function expandValue(value: ContentOperand): ContentOperand {
+  if (typeof value === 'string' && value.startsWith('/')) {
+    const full = VALUE_ABBREVIATIONS[value.slice(1)];
+    return full ? '/' + full : value;
+  }
+  // Filter arrays and [/I base hival lookup] color spaces
+  if (Array.isArray(value)) return value.map(item => expandValue(item));
+  return value;
+}
+
+function toPdfObject(pdfDoc: PDFDocument, value: ContentOperand): PDFObject {
+  if (value === null) return PDFNull;
+  if (typeof value === 'number') return PDFNumber.of(value);
+  if (typeof value === 'boolean') return value ? PDFBool.True : PDFBool.False;
+  if (typeof value === 'string') return PDFName.of(value.replace(/^\//, ''));
+  if (Array.isArray(value)) {
+    const array = PDFArray.withContext(pdfDoc.context);
+    for (const item of value) array.push(toPdfObject(pdfDoc, item));
+    return array;
+  }
+  if (value.kind === 'dict') {
+    const dict = PDFDict.withContext(pdfDoc.context);
+    for (const [key, item] of Object.entries(value.entries)) dict.set(PDFName.of(key), toPdfObject(pdfDoc, item));
+    return dict;
+  }
+  let hex = '';
+  for (let i = 0; i < value.value.length; i++) hex += value.value.charCodeAt(i).toString(16).padStart(2, '0');
+  return PDFHexString.of(hex);
+}
+
+function isContentDict(operand: ContentOperand | undefined): operand is ContentDict {
+  return typeof operand === 'object' && operand !== null && !Array.isArray(operand) && operand.kind === 'dict';
+}
@@ -0,0 +1,181 @@
+/**
+ * Interactive feature preservation
+ *
+ * Filled forms and linked documents break when compression drops links,
+ * fields or bookmarks, or removes the pages they point to. This turns off
+ * the steps that would, counts the features before compression, and
+ * checks the output still has them all.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFName } from 'pdf-lib';
+import type { Bookmark, CompressionOptions, CompressionPreset, InteractiveFeatureReport } from '../api/types';
+import { createDestinationLookup } from './destinations';
+import { readOutline } from './outline';
+import { readDestinationTargets } from './page-tree';
+import { lookupArray, lookupDict, lookupName } from './pdf-objects';
+
+/** Annotation subtypes that are the interactive features themselves */
+const INTERACTIVE_SUBTYPES = ['Link', 'Widget'];
+
+/**
+ * Interactive features of a document, counted before compression
+ */
+export interface InteractiveFeatures {
+  links: number;
+  formFields: number;
+  bookmarks: number;
+  namedDestinations: number;
+  /** Target page of each link and bookmark, from readDestinationTargets */
+  targets: Array<number | null>;
+}
+
+/**
+ * Counts links, form fields, bookmarks and named destinations
+ */
+export function readInteractiveFeatures(pdfDoc: PDFDocument): InteractiveFeatures {
+  let links = 0;
+  for (const page of pdfDoc.getPages()) {
+    const annots = page.node.Annots();
+    if (!annots) continue;
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      if (annot instanceof PDFDict && lookupName(annot, 'Subtype') === 'Link') links++;
+    }
+  }
+
+  const acroForm = lookupDict(pdfDoc.catalog, 'AcroForm');
+  const fields = acroForm && lookupArray(acroForm, 'Fields');
+
+  return {
+    links,
+    formFields: countTerminalFields(dictItems(fields), new Set()),
+    bookmarks: countBookmarks(readOutline(pdfDoc).bookmarks),
+    namedDestinations: createDestinationLookup(pdfDoc).namedDests.size,
+    targets: readDestinationTargets(pdfDoc),
+  };
+}
+
+/**
+ * Whether the document has any feature the image pass would drop
+ */
+export function hasInteractiveFeatures(features: InteractiveFeatures): boolean {
+  return features.links + features.formFields + features.bookmarks + features.namedDestinations > 0;
+}
+
+/**
+ * Turns off the structural passes that remove links, fields or the pages
+ * they point to
+ *
+ * @returns Options for the structural passes, and a warning for each
+ *   setting that was changed
+ */
+export function restrictInteractiveOptions(options: CompressionOptions): { options: CompressionOptions; warnings: string[] } {
+  const restricted = { ...options };
+  const warnings: string[] = [];
+
+  if (options.stripExternalLinks) {
+    restricted.stripExternalLinks = false;
+    warnings.push('stripExternalLinks was turned off: it removes links');
+  }
+  if (options.pruneEmptyContent && (options.removeEmptyPages || options.removeBlankLayout)) {
+    restricted.removeEmptyPages = false;
+    restricted.removeBlankLayout = false;
+    warnings.push('Empty pages were kept: removing pages breaks links and bookmarks that point to them');
+  }
+  if (options.dedupePages) {
+    restricted.dedupePages = undefined;
+    warnings.push('dedupePages was turned off: removing pages breaks links and bookmarks that point to them');
+  }
+  if (options.printAnnotations && options.printAnnotationSubtypes) {
+    const kept = options.printAnnotationSubtypes.filter(subtype => !INTERACTIVE_SUBTYPES.includes(subtype));
+    if (kept.length < options.printAnnotationSubtypes.length) {
+      restricted.printAnnotationSubtypes = kept;
+      warnings.push('Link and Widget annotations were not printed: printing replaces them with static drawings');
+    }
+  }
+
+  return { options: restricted, warnings };
+}
+
+/**
+ * Warning for a balanced/max preset replaced by lossless
+ */
+export function imagePassWarning(preset: CompressionPreset): string {
+  return `The ${preset} preset was replaced by lossless: its image pass drops links, form fields and bookmarks`;
+}
+
+/**
+ * Compares the features of the saved output against those counted
+ * before compression
+ *
+ * @param warnings - Warnings from restrictInteractiveOptions; a warning
+ *   is added for each feature that changed
+ */
+export async function verifyInteractiveFeatures(
+  pdfBytes: Uint8Array,
+  before: InteractiveFeatures,
+  warnings: string[]
+): Promise<InteractiveFeatureReport> {
+  const saved = await PDFDocument.load(pdfBytes, {
+    ignoreEncryption: true,
+    throwOnInvalidObject: false,
+    updateMetadata: false,
+  });
+  const after = readInteractiveFeatures(saved);
+
+  const report: InteractiveFeatureReport = {
+    links: { before: before.links, after: after.links },
+    formFields: { before: before.formFields, after: after.formFields },
+    bookmarks: { before: before.bookmarks, after: after.bookmarks },
+    namedDestinations: { before: before.namedDestinations, after: after.namedDestinations },
+    preserved: true,
+    warnings: [...warnings],
+  };
+
+  const labels = { links: 'links', formFields: 'form fields', bookmarks: 'bookmarks', namedDestinations: 'named destinations' };
+  for (const key of ['links', 'formFields', 'bookmarks', 'namedDestinations'] as const) {
+    if (report[key].before !== report[key].after) {
+      report.preserved = false;
+      report.warnings.push(`The output has ${report[key].after} ${labels[key]}, the input had ${report[key].before}`);
+    }
+  }
+
+  const moved = before.targets.length === after.targets.length &&
+    before.targets.some((page, i) => page !== after.targets[i]);
+  if (moved) {
+    report.preserved = false;
+    report.warnings.push('Some links or bookmarks point to different pages than in the input');
+  }
+
+  return report;
+}
+
+/**
+ * Counts fields that hold a value: those without child fields (kids that
+ * are only widgets don't count as children)
+ */
+function countTerminalFields(fields: PDFDict[], visited: Set<PDFDict>): number {
+  let count = 0;
+  for (const field of fields) {
+    if (visited.has(field)) continue;
+    visited.add(field);
+
+    const children = dictItems(lookupArray(field, 'Kids')).filter(kid => kid.has(PDFName.of('T')));
+    count += children.length > 0 ? countTerminalFields(children, visited) : 1;
+  }
+  return count;
+}
+
+function dictItems(array: PDFArray | undefined): PDFDict[] {
+  if (!array) return [];
+  const items: PDFDict[] = [];
+  for (let i = 0; i < array.size(); i++) {
+    const item = array.lookup(i);
+    if (item instanceof PDFDict) items.push(item);
+  }
+  return items;
+}
+
+function countBookmarks(bookmarks: Bookmark[]): number {
+  return bookmarks.reduce((total, bookmark) => total + 1 + countBookmarks(bookmark.children), 0);
+}
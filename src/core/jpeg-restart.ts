@@ -0,0 +1,333 @@
+/**
+ * JPEG restart markers
+ *
+ * Restart markers split a JPEG's entropy-coded data into independently
+ * decodable intervals, so a transmission error corrupts one strip of the
+ * image instead of everything after it. Browsers' encoders can't write
+ * them, so they are added afterwards, losslessly, as jpegtran -restart
+ * does: the Huffman-coded blocks are copied, each interval is padded to
+ * a byte boundary and followed by an RSTn marker, and the DC value of the
+ * first block after each marker is re-coded, since the DC predictor
+ * restarts at zero. Only single-scan baseline (Huffman, sequential)
+ * JPEGs are handled, which is what canvas encoders produce.
+ *
+ * Progressive output isn't built on this: it needs every block decoded
+ * to coefficients, split into spectral-band scans with end-of-band runs
+ * and coded with new Huffman tables per scan, which is a full entropy
+ * encoder rather than a copy of the existing codes.
+ */
+
+interface HuffmanTable {
+  /** Decoding: per code length, the first and last code and the index of the first symbol */
+  minCode: Int32Array;
+  maxCode: Int32Array;
+  valueIndex: Int32Array;
+  symbols: Uint8Array;
+  /** Encoding: code and length per symbol (length 0 if the table has no code for it) */
+  codes: Uint16Array;
+  lengths: Uint8Array;
+}
+
+interface ScanComponent {
+  /** Blocks per MCU */
+  blocks: number;
+  dcTable: HuffmanTable;
+  acTable: HuffmanTable;
+}
+
+/** Start-of-frame markers of sequential Huffman JPEGs (baseline and extended) */
+const SEQUENTIAL_SOF = new Set([0xc0, 0xc1]);
+
+/** Start-of-frame markers of everything else (progressive, lossless, arithmetic) */
+const OTHER_SOF = new Set([0xc2, 0xc3, 0xc5, 0xc6, 0xc7, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf]);
+
+/**
+ * Rewrites a JPEG with a restart marker every interval MCUs
+ *
+ * @returns The new JPEG, or undefined if the image isn't a single-scan
+ *   baseline JPEG, already has restart markers, or its DC table can't
+ *   code a restarted DC value
+ */
+export function addRestartMarkers(jpeg: Uint8Array, interval: number): Uint8Array | undefined {
+  if (jpeg[0] !== 0xff || jpeg[1] !== 0xd8) return undefined;
+
+  const dcTables: Array<HuffmanTable | undefined> = [];
+  const acTables: Array<HuffmanTable | undefined> = [];
+  let frame: { width: number; height: number; components: Array<{ id: number; h: number; v: number }> } | undefined;
+
+  let offset = 2;
+  while (offset + 4 <= jpeg.length) {
+    if (jpeg[offset] !== 0xff) return undefined;
+    const marker = jpeg[offset + 1];
+    if (marker === 0xff) {
+      offset++;
+      continue;
+    }
+    const length = (jpeg[offset + 2] << 8) | jpeg[offset + 3];
+    const segment = jpeg.subarray(offset + 4, offset + 2 + length);
+
+    if (OTHER_SOF.has(marker)) return undefined;
+    if (marker === 0xdd && ((segment[0] << 8) | segment[1]) !== 0) return undefined;
+    if (SEQUENTIAL_SOF.has(marker)) {
+      const components = [];
+      for (let i = 0; i < segment[5]; i++) {
+        const base = 6 + i * 3;
+        components.push({ id: segment[base], h: segment[base + 1] >> 4, v: segment[base + 1] & 15 });
+      }
+      frame = { height: (segment[1] << 8) | segment[2], width: (segment[3] << 8) | segment[4], components };
+    } else if (marker === 0xc4) {
+      readHuffmanTables(segment, dcTables, acTables);
+    } else if (marker === 0xda) {
+      if (!frame) return undefined;
+      return rewriteScan(jpeg, offset, offset + 2 + length, segment, frame, dcTables, acTables, interval);
+    }
+    offset += 2 + length;
+  }
+  return undefined;
+}
+
+function readHuffmanTables(
+  segment: Uint8Array,
+  dcTables: Array<HuffmanTable | undefined>,
+  acTables: Array<HuffmanTable | undefined>
+): void {
+  let offset = 0;
+  while (offset + 17 <= segment.length) {
+    const tableClass = segment[offset] >> 4;
+    const id = segment[offset] & 15;
+    const counts = segment.subarray(offset + 1, offset + 17);
+    const total = counts.reduce((sum, count) => sum + count, 0);
+    const symbols = segment.slice(offset + 17, offset + 17 + total);
+    (tableClass === 0 ? dcTables : acTables)[id] = buildTable(counts, symbols);
+    offset += 17 + total;
+  }
+}
+
+function buildTable(counts: Uint8Array, symbols: Uint8Array): HuffmanTable {
+  const minCode = new Int32Array(17);
+  const maxCode = new Int32Array(17).fill(-1);
+  const valueIndex = new Int32Array(17);
+  const codes = new Uint16Array(256);
+  const lengths = new Uint8Array(256);
+
+  let code = 0;
+  let index = 0;
+  for (let length = 1; length <= 16; length++) {
+    valueIndex[length] = index;
+    minCode[length] = code;
+    for (let i = 0; i < counts[length - 1]; i++) {
+      codes[symbols[index]] = code;
+      lengths[symbols[index]] = length;
+      index++;
+      code++;
+    }
+    maxCode[length] = counts[length - 1] > 0 ? code - 1 : -1;
+    code <<= 1;
+  }
+  return { minCode, maxCode, valueIndex, symbols, codes, lengths };
+}
+
+function rewriteScan(
+  jpeg: Uint8Array,
+  sosOffset: number,
+  dataOffset: number,
+  header: Uint8Array,
+  frame: { width: number; height: number; components: Array<{ id: number; h: number; v: number }> },
+  dcTables: Array<HuffmanTable | undefined>,
+  acTables: Array<HuffmanTable | undefined>,
+  interval: number
+): Uint8Array | undefined {
+  // A progressive-style split into several scans isn't handled
+  if (header[0] !== frame.components.length) return undefined;
+
+  const maxH = Math.max(...frame.components.map(component => component.h));
+  const maxV = Math.max(...frame.components.map(component => component.v));
+  const single = frame.components.length === 1;
+
+  const components: ScanComponent[] = [];
+  for (let i = 0; i < header[0]; i++) {
+    const id = header[1 + i * 2];
+    const tables = header[2 + i * 2];
+    const component = frame.components.find(candidate => candidate.id === id);
+    const dcTable = dcTables[tables >> 4];
+    const acTable = acTables[tables & 15];
+    if (!component || !dcTable || !acTable) return undefined;
+    // A single-component scan is not interleaved: its MCU is one block
+    components.push({ blocks: single ? 1 : component.h * component.v, dcTable, acTable });
+  }
+
+  const mcus = single
+    ? Math.ceil((frame.width * frame.components[0].h) / maxH / 8) * Math.ceil((frame.height * frame.components[0].v) / maxV / 8)
+    : Math.ceil(frame.width / (8 * maxH)) * Math.ceil(frame.height / (8 * maxV));
+
+  const reader = new BitReader(jpeg, dataOffset);
+  const writer = new BitWriter(jpeg.length + Math.ceil(mcus / interval) * 4);
+  const predictors = new Int32Array(components.length);
+  const written = new Int32Array(components.length);
+
+  for (let mcu = 0; mcu < mcus; mcu++) {
+    if (mcu > 0 && mcu % interval === 0) {
+      writer.restart(((mcu / interval) - 1) % 8);
+      written.fill(0);
+    }
+
+    for (let c = 0; c < components.length; c++) {
+      const { blocks, dcTable, acTable } = components[c];
+      for (let block = 0; block < blocks; block++) {
+        // DC: the difference to the previous block, re-coded against the restarted predictor
+        const category = reader.decode(dcTable);
+        if (category < 0) return undefined;
+        predictors[c] += extend(reader.read(category), category);
+        const difference = predictors[c] - written[c];
+        written[c] = predictors[c];
+        const newCategory = magnitudeCategory(difference);
+        if (dcTable.lengths[newCategory] === 0) return undefined;
+        writer.write(dcTable.codes[newCategory], dcTable.lengths[newCategory]);
+        writer.write(difference < 0 ? difference + (1 << newCategory) - 1 : difference, newCategory);
+
+        // AC: copied symbol by symbol
+        for (let k = 1; k < 64;) {
+          const symbol = reader.decode(acTable);
+          if (symbol < 0) return undefined;
+          writer.write(acTable.codes[symbol], acTable.lengths[symbol]);
+          const size = symbol & 15;
+          if (size === 0) {
+            if (symbol !== 0xf0) break;
+            k += 16;
+            continue;
+          }
+          writer.write(reader.read(size), size);
+          k += (symbol >> 4) + 1;
+        }
+      }
+    }
+    if (reader.failed) return undefined;
+  }
+  writer.flush();
+
+  const dri = new Uint8Array([0xff, 0xdd, 0x00, 0x04, (interval >> 8) & 0xff, interval & 0xff]);
+  const data = writer.bytes();
+  const output = new Uint8Array(sosOffset + dri.length + (dataOffset - sosOffset) + data.length + 2);
+  output.set(jpeg.subarray(0, sosOffset), 0);
+  output.set(dri, sosOffset);
+  output.set(jpeg.subarray(sosOffset, dataOffset), sosOffset + dri.length);
+  output.set(data, sosOffset + dri.length + dataOffset - sosOffset);
+  output.set([0xff, 0xd9], output.length - 2);
+  return output;
+}
+
+/**
+ * Reads entropy-coded bits, removing stuffed zero bytes
+ */
+class BitReader {
+  private buffer = 0;
+  private count = 0;
+  /** Set when the data ran out or hit a marker */
+  failed = false;
+
+  constructor(private readonly data: Uint8Array, private offset: number) {}
+
+  read(bits: number): number {
+    let value = 0;
+    for (let i = 0; i < bits; i++) value = (value << 1) | this.bit();
+    return value;
+  }
+
+  /**
+   * Decodes one Huffman symbol, or returns -1 for an invalid code
+   */
+  decode(table: HuffmanTable): number {
+    let code = this.bit();
+    for (let length = 1; length <= 16; length++) {
+      if (table.maxCode[length] >= code && code >= table.minCode[length] && table.maxCode[length] >= 0) {
+        return table.symbols[table.valueIndex[length] + code - table.minCode[length]];
+      }
+      code = (code << 1) | this.bit();
+    }
+    return -1;
+  }
+
+  private bit(): number {
+    if (this.count === 0) {
+      const byte = this.data[this.offset];
+      if (byte === undefined || (byte === 0xff && this.data[this.offset + 1] !== 0x00)) {
+        this.failed = true;
+        return 0;
+      }
+      this.offset += byte === 0xff ? 2 : 1;
+      this.buffer = byte;
+      this.count = 8;
+    }
+    this.count--;
+    return (this.buffer >> this.count) & 1;
+  }
+}
+
+/**
+ * Writes entropy-coded bits, stuffing a zero after each 0xFF byte
+ */
+class BitWriter {
+  private output: Uint8Array;
+  private length = 0;
+  private buffer = 0;
+  private count = 0;
+
+  constructor(capacity: number) {
+    this.output = new Uint8Array(capacity);
+  }
+
+  write(value: number, bits: number): void {
+    for (let i = bits - 1; i >= 0; i--) {
+      this.buffer = (this.buffer << 1) | ((value >> i) & 1);
+      if (++this.count === 8) {
+        this.push(this.buffer);
+        if (this.buffer === 0xff) this.push(0x00);
+        this.buffer = 0;
+        this.count = 0;
+      }
+    }
+  }
+
+  /**
+   * Pads the last byte with one bits, as the standard requires
+   */
+  flush(): void {
+    if (this.count > 0) this.write((1 << (8 - this.count)) - 1, 8 - this.count);
+  }
+
+  restart(index: number): void {
+    this.flush();
+    this.push(0xff);
+    this.push(0xd0 + index);
+  }
+
+  bytes(): Uint8Array {
+    return this.output.subarray(0, this.length);
+  }
+
+  private push(byte: number): void {
+    if (this.length === this.output.length) {
+      const grown = new Uint8Array(this.output.length * 2);
+      grown.set(this.output);
+      this.output = grown;
+    }
+    this.output[this.length++] = byte;
+  }
+}
+
+/**
+ * Decodes a category's extra bits to a signed value (JPEG's EXTEND)
+ */
+function extend(bits: number, category: number): number {
+  return category === 0 || bits >= 1 << (category - 1) ? bits : bits - (1 << category) + 1;
+}
+
+function magnitudeCategory(value: number): number {
+  let magnitude = Math.abs(value);
+  let category = 0;
+  while (magnitude > 0) {
+    category++;
+    magnitude >>= 1;
+  }
+  return category;
+}
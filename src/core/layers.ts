@@ -0,0 +1,96 @@
+/**
+ * Optional content (layer) merging
+ *
+ * copyPages() carries each page's optional content groups along with its
+ * resources, but not the catalog /OCProperties that lists them, so merged
+ * layers stop being toggleable. This rebuilds one /OCProperties from every
+ * input's, grouping each input's layers under its own label.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFHexString, PDFName, PDFRef } from 'pdf-lib';
+import type { MergeLayer } from '../api/types';
+import { lookupArray, lookupDict, lookupName, lookupText } from './pdf-objects';
+
+/**
+ * One input's /OCProperties, already copied into the merged document
+ */
+export interface LayerSource {
+  /** Position in the caller's input list (0-indexed) */
+  input: number;
+  /** Label grouping this input's layers in the layer panel */
+  label: string;
+  ocProperties: PDFDict;
+}
+
+/**
+ * Writes a combined /OCProperties to the merged catalog
+ *
+ * @returns Every layer in the output, in merge order
+ */
+export function combineOptionalContent(merged: PDFDocument, sources: LayerSource[]): MergeLayer[] {
+  const context = merged.context;
+  const ocgs = PDFArray.withContext(context);
+  const order = PDFArray.withContext(context);
+  const off = PDFArray.withContext(context);
+  const rbGroups = PDFArray.withContext(context);
+  const locked = PDFArray.withContext(context);
+  const autoStates = PDFArray.withContext(context);
+  const layers: MergeLayer[] = [];
+
+  for (const { input, label, ocProperties } of sources) {
+    const groups = refsOf(lookupArray(ocProperties, 'OCGs'));
+    if (groups.length === 0) continue;
+
+    const config = lookupDict(ocProperties, 'D');
+    const baseOff = config !== undefined && lookupName(config, 'BaseState') === 'OFF';
+    const onRefs = new Set(refsOf(config && lookupArray(config, 'ON')).map(ref => ref.toString()));
+    const offRefs = new Set(refsOf(config && lookupArray(config, 'OFF')).map(ref => ref.toString()));
+
+    for (const ref of groups) {
+      // The merged configuration uses BaseState ON, so only OFF is listed
+      const visible = baseOff ? onRefs.has(ref.toString()) : !offRefs.has(ref.toString());
+      ocgs.push(ref);
+      if (!visible) off.push(ref);
+
+      const group = context.lookup(ref);
+      layers.push({
+        name: (group instanceof PDFDict ? lookupText(group, 'Name') : undefined) ?? '',
+        input,
+        visible,
+      });
+    }
+
+    // A nested array starting with a text string is a labeled group
+    const inputOrder = config && lookupArray(config, 'Order');
+    const labeled = PDFArray.withContext(context);
+    labeled.push(PDFHexString.fromText(label));
+    for (const item of inputOrder ? inputOrder.asArray() : groups) labeled.push(item);
+    order.push(labeled);
+
+    for (const [key, target] of [['RBGroups', rbGroups], ['Locked', locked], ['AS', autoStates]] as const) {
+      const items = config && lookupArray(config, key);
+      if (items) items.asArray().forEach(item => target.push(item));
+    }
+  }
+
+  if (ocgs.size() === 0) return [];
+
+  const config = context.obj({ Name: PDFHexString.fromText('Merged'), BaseState: 'ON' });
+  config.set(PDFName.of('Order'), order);
+  if (off.size() > 0) config.set(PDFName.of('OFF'), off);
+  if (rbGroups.size() > 0) config.set(PDFName.of('RBGroups'), rbGroups);
+  if (locked.size() > 0) config.set(PDFName.of('Locked'), locked);
+  if (autoStates.size() > 0) config.set(PDFName.of('AS'), autoStates);
+
+  const properties = context.obj({});
+  properties.set(PDFName.of('OCGs'), ocgs);
+  properties.set(PDFName.of('D'), config);
+  merged.catalog.set(PDFName.of('OCProperties'), context.register(properties));
+
+  return layers;
+}
+
+function refsOf(array: PDFArray | undefined): PDFRef[] {
+  if (!array) return [];
+  return array.asArray().filter((item): item is PDFRef => item instanceof PDFRef);
+}
@@ -0,0 +1,83 @@
+/**
+ * External link discovery and removal
+ *
+ * URI actions can hide in link annotations, other annotations' actions and
+ * additional-actions (AA) triggers, page and document actions, bookmarks,
+ * and the Next chains of any of these.
+ */
+
+import { PDFDict, PDFDocument, PDFName } from 'pdf-lib';
+import type { ExternalLink, ExternalLinkSource } from '../api/types';
+import { filterActionEntry, filterTriggerActions } from './actions';
+import type { ActionFilter } from './actions';
+import { lookupDict, lookupName, lookupText } from './pdf-objects';
+
+/**
+ * Lists every URI action in the document
+ */
+export function findExternalLinks(pdfDoc: PDFDocument): ExternalLink[] {
+  return walkLinks(pdfDoc, false);
+}
+
+/**
+ * Removes every URI action; link annotations left without an action or
+ * destination are removed too (their text stays on the page)
+ *
+ * @returns The links that were removed
+ */
+export function stripExternalLinks(pdfDoc: PDFDocument): ExternalLink[] {
+  return walkLinks(pdfDoc, true);
+}
+
+function walkLinks(pdfDoc: PDFDocument, strip: boolean): ExternalLink[] {
+  const links: ExternalLink[] = [];
+
+  // Records URI actions, and selects them for removal when stripping
+  const uriFilter = (source: ExternalLinkSource, page?: number): ActionFilter => action => {
+    if (lookupName(action, 'S') !== 'URI') return false;
+    links.push({ url: lookupText(action, 'URI') ?? '', source, ...(page !== undefined && { page }) });
+    return strip;
+  };
+
+  const catalog = pdfDoc.catalog;
+  filterActionEntry(catalog, 'OpenAction', uriFilter('document'));
+  filterTriggerActions(catalog, uriFilter('document'));
+
+  pdfDoc.getPages().forEach((page, index) => {
+    const pageNumber = index + 1;
+    filterTriggerActions(page.node, uriFilter('page', pageNumber));
+
+    const annots = page.node.Annots();
+    if (!annots) return;
+    const deadLinks: number[] = [];
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      if (!(annot instanceof PDFDict)) continue;
+
+      const filter = uriFilter('annotation', pageNumber);
+      filterActionEntry(annot, 'A', filter);
+      filterTriggerActions(annot, filter);
+
+      const isLink = lookupName(annot, 'Subtype') === 'Link';
+      if (isLink && !annot.has(PDFName.of('A')) && !annot.has(PDFName.of('Dest'))) deadLinks.push(i);
+    }
+    if (strip) {
+      for (let i = deadLinks.length - 1; i >= 0; i--) annots.remove(deadLinks[i]);
+    }
+  });
+
+  const outlines = lookupDict(catalog, 'Outlines');
+  const first = outlines && lookupDict(outlines, 'First');
+  if (first) walkOutline(first, uriFilter('bookmark'), new Set());
+
+  return links;
+}
+
+function walkOutline(first: PDFDict, filter: ActionFilter, visited: Set<PDFDict>): void {
+  for (let item: PDFDict | undefined = first; item && !visited.has(item); item = lookupDict(item, 'Next')) {
+    visited.add(item);
+    filterActionEntry(item, 'A', filter);
+    const child = lookupDict(item, 'First');
+    if (child) walkOutline(child, filter, visited);
+  }
+}
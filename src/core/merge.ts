@@ -0,0 +1,152 @@
+/**
+ * Document merging
+ */
+
+import { PDFDict, PDFDocument, PDFHexString, PDFName, PDFNumber, PDFObject, PDFObjectCopier, PDFPage } from 'pdf-lib';
+import type { DestinationCollision, MergeLayer, MergePageSource, MergeSortOrder } from '../api/types';
+import { combineOptionalContent } from './layers';
+import type { LayerSource } from './layers';
+import { combineNamedDestinations, copyNamedDestinations } from './named-destinations';
+import type { DestinationSource } from './named-destinations';
+import { lookupDict } from './pdf-objects';
+
+/**
+ * Loaded merge input with its position in the caller's list
+ */
+export interface MergeSource {
+  /** Position in the caller's input list (0-indexed) */
+  index: number;
+  /** Caller-supplied name (usually the filename) */
+  name?: string;
+  pdfDoc: PDFDocument;
+}
+
+const naturalCompare = new Intl.Collator(undefined, { numeric: true, sensitivity: 'base' }).compare;
+
+/**
+ * Orders sources for merging; sorting is stable, so ties keep input order
+ */
+export function sortSources(sources: MergeSource[], sortBy: MergeSortOrder): MergeSource[] {
+  if (sortBy === 'input') return sources;
+
+  const keyOf = (source: MergeSource): string =>
+    sortBy === 'name'
+      ? source.name ?? ''
+      : source.pdfDoc.getTitle() ?? source.name ?? '';
+
+  return [...sources].sort((a, b) => naturalCompare(keyOf(a), keyOf(b)));
+}
+
+/**
+ * Copies every page of every source, in order, into a new document
+ *
+ * @param preserveLayers - Also merge each source's optional content
+ *   properties so its layers stay listed and toggleable
+ * @param dedupeDestinations - Also merge each source's named
+ *   destinations, resolving name collisions
+ * @returns The merged document, where each page came from, the layers
+ *   when preserveLayers is set and the destination collisions when
+ *   dedupeDestinations is set
+ */
+export async function mergeSources(
+  sources: MergeSource[],
+  preserveLayers = false,
+  dedupeDestinations = false
+): Promise<{
+  merged: PDFDocument;
+  pages: MergePageSource[];
+  layers?: MergeLayer[];
+  destinationCollisions?: DestinationCollision[];
+}> {
+  const merged = await PDFDocument.create();
+  const pages: MergePageSource[] = [];
+  const layerSources: LayerSource[] = [];
+  const destinationSources: DestinationSource[] = [];
+
+  for (const source of sources) {
+    let copied: PDFPage[];
+
+    if (preserveLayers) {
+      // One copier for the pages and /OCProperties, so both point at the
+      // same copies of the optional content groups
+      const copier = PDFObjectCopier.for(source.pdfDoc.context, merged.context);
+      copied = source.pdfDoc.getPages().map(page => {
+        const node = copier.copy(page.node);
+        return PDFPage.of(node, merged.context.register(node), merged);
+      });
+
+      const ocProperties = lookupDict(source.pdfDoc.catalog, 'OCProperties');
+      if (ocProperties) {
+        layerSources.push({
+          input: source.index,
+          label: source.name ?? `Document ${source.index + 1}`,
+          ocProperties: copier.copy(ocProperties) as PDFDict,
+        });
+      }
+    } else {
+      copied = await merged.copyPages(source.pdfDoc, source.pdfDoc.getPageIndices());
+    }
+
+    copied.forEach((page, pageIndex) => {
+      merged.addPage(page);
+      pages.push({ input: source.index, page: pageIndex + 1 });
+    });
+
+    if (dedupeDestinations) {
+      destinationSources.push({
+        input: source.index,
+        dests: copyNamedDestinations(source.pdfDoc, merged, copied),
+        pages: copied,
+      });
+    }
+  }
+
+  return {
+    merged,
+    pages,
+    ...(preserveLayers && { layers: combineOptionalContent(merged, layerSources) }),
+    ...(dedupeDestinations && { destinationCollisions: combineNamedDestinations(merged, destinationSources) }),
+  };
+}
+
+/**
+ * Letter prefix for the nth merged input: A-Z, then AA, AB, ...
+ */
+export function sourcePrefix(position: number): string {
+  let prefix = '';
+  for (let n = position + 1; n > 0; n = Math.floor((n - 1) / 26)) {
+    prefix = String.fromCharCode(65 + ((n - 1) % 26)) + prefix;
+  }
+  return prefix;
+}
+
+/**
+ * Labels each merged page with its input's prefix and its page number
+ * within that input ("A-1", "A-2", "B-1"), replacing any labels
+ *
+ * A divider page (page 0) is labeled with the prefix alone.
+ *
+ * @param prefixes - Prefix for each input, by index in the caller's list
+ */
+export function setSourcePageLabels(pdfDoc: PDFDocument, pages: MergePageSource[], prefixes: string[]): void {
+  const context = pdfDoc.context;
+  const nums: PDFObject[] = [];
+
+  pages.forEach((source, index) => {
+    const prefix = prefixes[source.input];
+    if (source.page === 0) {
+      nums.push(PDFNumber.of(index), context.obj({ P: PDFHexString.fromText(prefix) }));
+      return;
+    }
+    // A range continues while pages follow on from the same input
+    const previous = pages[index - 1];
+    if (previous && previous.input === source.input && previous.page === source.page - 1) return;
+    nums.push(PDFNumber.of(index), context.obj({
+      S: 'D',
+      P: PDFHexString.fromText(`${prefix}-`),
+      ...(source.page > 1 && { St: source.page }),
+    }));
+  });
+
+  pdfDoc.catalog.set(PDFName.of('PageLabels'), context.register(context.obj({ Nums: nums })));
+}
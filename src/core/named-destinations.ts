@@ -0,0 +1,151 @@
+/**
+ * Named destination merging
+ *
+ * copyPages() carries link annotations that jump to named destinations,
+ * but not the catalog name tables that define them, so those links go
+ * nowhere in a merged document. Inputs also reuse the same names ("page1",
+ * "section.2"), so simply combining the tables would send links to the
+ * wrong input. This rebuilds one /Dests name tree from every input's,
+ * keeping the first definition of each name. Later duplicates that the
+ * input's own links use are renamed and those links rewritten; unused
+ * ones are dropped.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFHexString, PDFName, PDFObject, PDFPage, PDFRef, PDFString } from 'pdf-lib';
+import type { DestinationCollision } from '../api/types';
+import { createDestinationLookup } from './destinations';
+import { lookupDict, lookupName } from './pdf-objects';
+
+/**
+ * One input's named destinations and pages, already copied into the
+ * merged document
+ */
+export interface DestinationSource {
+  /** Position in the caller's input list (0-indexed) */
+  input: number;
+  /** Destinations by name, from copyNamedDestinations() */
+  dests: Map<string, PDFObject>;
+  /** The input's pages in the merged document */
+  pages: PDFPage[];
+}
+
+/**
+ * Reads a source's named destinations as explicit destinations on its
+ * copied pages
+ *
+ * Destinations are rebuilt rather than copied: copying the page
+ * reference would copy the page itself again.
+ *
+ * @param copied - The source's pages in the merged document, in order
+ */
+export function copyNamedDestinations(source: PDFDocument, merged: PDFDocument, copied: PDFPage[]): Map<string, PDFObject> {
+  const pageRefs = new Map<string, PDFRef>();
+  source.getPages().forEach((page, index) => pageRefs.set(page.ref.toString(), copied[index].ref));
+
+  const dests = new Map<string, PDFObject>();
+  for (const [name, dest] of createDestinationLookup(source).namedDests) {
+    let value = dest instanceof PDFRef ? source.context.lookup(dest) : dest;
+    // Named destinations may be wrapped in a dictionary with a /D entry
+    if (value instanceof PDFDict) value = value.lookup(PDFName.of('D'));
+    if (!(value instanceof PDFArray) || value.size() === 0) continue;
+
+    const target = value.get(0);
+    const page = target instanceof PDFRef ? pageRefs.get(target.toString()) : undefined;
+    if (!page) continue;
+
+    // The rest is a fit type and numbers, which don't belong to a context
+    const copy = PDFArray.withContext(merged.context);
+    copy.push(page);
+    for (let i = 1; i < value.size(); i++) copy.push(value.lookup(i)!);
+    dests.set(name, copy);
+  }
+  return dests;
+}
+
+/**
+ * Writes a combined /Dests name tree to the merged catalog and points each
+ * input's links at its own destinations
+ *
+ * @returns Names defined by more than one input, with what happened to
+ *   each later definition
+ */
+export function combineNamedDestinations(merged: PDFDocument, sources: DestinationSource[]): DestinationCollision[] {
+  const combined = new Map<string, { input: number; dest: PDFObject }>();
+  const collisions: DestinationCollision[] = [];
+
+  for (const { input, dests, pages } of sources) {
+    const links = collectNamedLinks(pages);
+    const used = new Set(links.map(link => link.name));
+    const names = new Map<string, string>();
+
+    for (const [name, dest] of dests) {
+      const kept = combined.get(name);
+      if (!kept) {
+        combined.set(name, { input, dest });
+        names.set(name, name);
+        continue;
+      }
+
+      if (!used.has(name)) {
+        collisions.push({ name, keptInput: kept.input, input });
+        continue;
+      }
+
+      let renamed = `${name}-${input + 1}`;
+      for (let n = 2; combined.has(renamed) || dests.has(renamed); n++) renamed = `${name}-${input + 1}-${n}`;
+      combined.set(renamed, { input, dest });
+      names.set(name, renamed);
+      collisions.push({ name, keptInput: kept.input, input, renamedTo: renamed });
+    }
+
+    // Links are rewritten as strings, since only the name tree is written
+    for (const { holder, key, name } of links) {
+      const target = names.get(name);
+      if (target !== undefined) holder.set(PDFName.of(key), PDFHexString.fromText(target));
+    }
+  }
+
+  if (combined.size === 0) return collisions;
+
+  // Name tree keys must be sorted
+  const entries = PDFArray.withContext(merged.context);
+  for (const name of [...combined.keys()].sort((a, b) => (a < b ? -1 : a > b ? 1 : 0))) {
+    entries.push(PDFHexString.fromText(name));
+    entries.push(combined.get(name)!.dest);
+  }
+
+  const tree = merged.context.obj({});
+  tree.set(PDFName.of('Names'), entries);
+  const namesDict = lookupDict(merged.catalog, 'Names') ?? merged.context.obj({});
+  namesDict.set(PDFName.of('Dests'), merged.context.register(tree));
+  merged.catalog.set(PDFName.of('Names'), namesDict);
+  return collisions;
+}
+
+/**
+ * Finds link annotations and GoTo actions on the pages that target a
+ * destination by name
+ */
+function collectNamedLinks(pages: PDFPage[]): Array<{ holder: PDFDict; key: string; name: string }> {
+  const links: Array<{ holder: PDFDict; key: string; name: string }> = [];
+
+  const add = (holder: PDFDict, key: string): void => {
+    const value = holder.lookup(PDFName.of(key));
+    if (value instanceof PDFName || value instanceof PDFString || value instanceof PDFHexString) {
+      links.push({ holder, key, name: value.decodeText() });
+    }
+  };
+
+  for (const page of pages) {
+    const annots = page.node.Annots();
+    if (!annots) continue;
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      if (!(annot instanceof PDFDict)) continue;
+      add(annot, 'Dest');
+      const action = lookupDict(annot, 'A');
+      if (action && lookupName(action, 'S') === 'GoTo') add(action, 'D');
+    }
+  }
+  return links;
+}
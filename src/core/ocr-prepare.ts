@@ -0,0 +1,84 @@
+/**
+ * Page images for OCR
+ *
+ * OCR engines work best on upright page images at one known resolution,
+ * without compression artifacts around glyphs. Each page is rendered at
+ * the requested DPI and stored losslessly (Flate) as the only content of
+ * a page the same size as the original.
+ */
+
+import {
+  PDFDocument,
+  concatTransformationMatrix,
+  drawObject,
+  popGraphicsState,
+  pushGraphicsState,
+} from 'pdf-lib';
+import type { PDFDocumentProxy } from 'pdfjs-dist';
+import type { OcrPreparedPage } from '../api/types';
+import { createCanvas } from './render';
+
+/** Longest canvas side, in pixels; larger pages are rendered at a lower DPI */
+const MAX_DIMENSION = 8192;
+
+/**
+ * Renders one page and adds it to the target as a single image
+ *
+ * The page's rotation is applied while rendering, so the image is
+ * upright and the new page has no Rotate entry.
+ */
+export async function addOcrPage(
+  target: PDFDocument,
+  pdfDocument: PDFDocumentProxy,
+  pageNum: number,
+  dpi: number,
+  grayscale: boolean
+): Promise<OcrPreparedPage> {
+  const page = await pdfDocument.getPage(pageNum);
+  const unscaled = page.getViewport({ scale: 1 });
+  const scale = Math.min(dpi / 72, MAX_DIMENSION / Math.max(unscaled.width, unscaled.height));
+  const viewport = page.getViewport({ scale });
+
+  const { canvas, context } = createCanvas(viewport.width, viewport.height);
+  context.fillStyle = '#ffffff';
+  context.fillRect(0, 0, canvas.width, canvas.height);
+  await page.render({ canvasContext: context as any, viewport }).promise;
+  page.cleanup();
+
+  const { width, height } = canvas;
+  const rgba = context.getImageData(0, 0, width, height).data;
+  canvas.width = 0;
+  canvas.height = 0;
+
+  const components = grayscale ? 1 : 3;
+  const samples = new Uint8Array(width * height * components);
+  for (let i = 0, j = 0; i < rgba.length; i += 4, j += components) {
+    if (grayscale) {
+      samples[j] = Math.round(0.299 * rgba[i] + 0.587 * rgba[i + 1] + 0.114 * rgba[i + 2]);
+    } else {
+      samples[j] = rgba[i];
+      samples[j + 1] = rgba[i + 1];
+      samples[j + 2] = rgba[i + 2];
+    }
+  }
+
+  const stream = target.context.flateStream(samples, {
+    Type: 'XObject',
+    Subtype: 'Image',
+    Width: width,
+    Height: height,
+    ColorSpace: grayscale ? 'DeviceGray' : 'DeviceRGB',
+    BitsPerComponent: 8,
+  });
+
+  const newPage = target.addPage([unscaled.width, unscaled.height]);
+  const imageName = newPage.node.newXObject('Image', target.context.register(stream));
+  newPage.pushOperators(
+    pushGraphicsState(),
+    concatTransformationMatrix(unscaled.width, 0, 0, unscaled.height, 0, 0),
+    drawObject(imageName),
+    popGraphicsState()
+  );
+
+  return { page: pageNum, width, height, dpi: Math.round(scale * 72) };
+}
@@ -0,0 +1,137 @@
+/**
+ * Structural optimization passes
+ *
+ * Passes run on the loaded document before the lossless save, and only
+ * when their option is set. Each returns what it changed so the result
+ * can report it.
+ */
+
+import type { PDFDocument, PDFRef } from 'pdf-lib';
+import type { CompressionOptions, CompressionReport } from '../api/types';
+import { flattenAnnotations, MARKUP_SUBTYPES } from './annotations';
+import { convertCmykImages } from './cmyk';
+import { applyRenderingIntent } from './color';
+import { dedupePages } from './dedupe-pages';
+import { normalizeFontEncodings } from './font-encoding';
+import { removeUnreferencedObjects } from './garbage';
+import { dedupeIccProfiles } from './icc';
+import { repairImages } from './image-repair';
+import { optimizeInlineImages } from './inline-images';
+import { stripExternalLinks } from './links';
+import { restorePinnedObjects } from './pinned';
+import type { PinnedObjects } from './pinned';
+import { optimizePngImages } from './png-optimize';
+import { posterizeImages, selectLargestImages } from './posterize';
+import { pruneEmptyContent } from './prune-content';
+import { recombineContentStreams } from './recombine-content';
+import { removeXfa } from './xfa';
+import { trimXmpStreams } from './xmp';
+
+/**
+ * Runs the requested structural passes
+ *
+ * @param pinned - Objects to restore if a pass changed them, and to keep
+ *   even if a pass left them unreferenced
+ * @returns Report entries for the passes that ran (empty if none did)
+ */
+export async function runStructuralPasses(
+  pdfDoc: PDFDocument,
+  options: CompressionOptions,
+  pinned?: PinnedObjects
+): Promise<CompressionReport> {
+  const report: CompressionReport = {};
+
+  // First, so reported pages are numbered as in the input
+  if (options.stripExternalLinks) {
+    report.strippedLinks = stripExternalLinks(pdfDoc);
+  }
+
+  // Before any pass that decodes images
+  if (options.repairImages) {
+    report.repairedImages = repairImages(pdfDoc, options.repairImages);
+  }
+
+  if (options.removeXFA) {
+    report.xfa = removeXfa(pdfDoc);
+  }
+
+  if (options.pruneEmptyContent) {
+    report.prunedContent = pruneEmptyContent(
+      pdfDoc,
+      options.removeEmptyPages === true,
+      options.removeBlankLayout === true
+    );
+  }
+
+  if (options.dedupePages) {
+    report.dedupedPages = dedupePages(pdfDoc, options.dedupePages);
+  }
+
+  if (options.printAnnotations) {
+    const subtypes = new Set(options.printAnnotationSubtypes ?? MARKUP_SUBTYPES);
+    report.printedAnnotations = flattenAnnotations(pdfDoc, subtypes, options.compressAppearances === true);
+  }
+
+  if (options.optimizeInlineImages) {
+    report.inlineImages = optimizeInlineImages(pdfDoc);
+  }
+
+  if (options.dedupeICCProfiles) {
+    report.dedupedProfiles = dedupeIccProfiles(pdfDoc);
+  }
+
+  if (options.normalizeEncoding) {
+    report.normalizedEncodings = normalizeFontEncodings(pdfDoc);
+  }
+
+  // After the passes that add or rewrite content streams
+  if (options.recombineContentStreams) {
+    report.recombinedContent = recombineContentStreams(pdfDoc);
+  }
+
+  let selected: Set<PDFRef> | undefined;
+  if ((options.cmykToRgb || options.posterize || options.optimizePNG) && options.maxImagesToProcess !== undefined) {
+    const selection = selectLargestImages(pdfDoc, options.maxImagesToProcess);
+    selected = selection.selected;
+    report.imageLimit = selection.report;
+  }
+
+  // Before posterize, which only reduces RGB images
+  if (options.cmykToRgb) {
+    report.convertedCmyk = await convertCmykImages(pdfDoc, options.cmykConversion ?? 'swop', selected);
+  }
+
+  if (options.posterize) {
+    report.posterized = await posterizeImages(
+      pdfDoc,
+      options.posterizeColors ?? 16,
+      options.posterizePhotos === true,
+      selected
+    );
+  }
+
+  // After posterize, whose indexed images it leaves alone
+  if (options.optimizePNG) {
+    report.optimizedPng = await optimizePngImages(pdfDoc, selected);
+  }
+
+  if (options.renderingIntent) {
+    report.imagesTaggedWithIntent = applyRenderingIntent(pdfDoc, options.renderingIntent);
+  }
+
+  if (options.trimXMP) {
+    report.xmpBytesSaved = trimXmpStreams(pdfDoc, options.xmpSafelist ?? []);
+  }
+
+  // Last, undoing whatever the passes changed in pinned objects
+  if (pinned) {
+    report.pinnedObjects = restorePinnedObjects(pdfDoc, pinned);
+  }
+
+  // Passes detach objects rather than deleting them; drop the orphans
+  if (Object.keys(report).length > 0) {
+    removeUnreferencedObjects(pdfDoc, pinned?.keys());
+  }
+
+  return report;
+}
@@ -0,0 +1,47 @@
+/**
+ * Document outline (bookmarks) reading
+ */
+
+import { PDFDict, PDFDocument } from 'pdf-lib';
+import type { Bookmark, BookmarkOutline } from '../api/types';
+import { createDestinationLookup, resolveItemPage } from './destinations';
+import type { DestinationLookup } from './destinations';
+import { lookupDict, lookupText } from './pdf-objects';
+
+/**
+ * Reads the outline as a nested tree with resolved page numbers
+ */
+export function readOutline(pdfDoc: PDFDocument): BookmarkOutline {
+  const outlines = lookupDict(pdfDoc.catalog, 'Outlines');
+  const first = outlines && lookupDict(outlines, 'First');
+  if (!first) {
+    return { hasOutline: false, bookmarks: [] };
+  }
+
+  const lookup = createDestinationLookup(pdfDoc);
+  const bookmarks = readSiblings(pdfDoc, first, lookup, new Set());
+  return { hasOutline: bookmarks.length > 0, bookmarks };
+}
+
+function readSiblings(
+  pdfDoc: PDFDocument,
+  first: PDFDict,
+  lookup: DestinationLookup,
+  visited: Set<PDFDict>
+): Bookmark[] {
+  const bookmarks: Bookmark[] = [];
+
+  // Malformed outlines can loop back on themselves, so track visited items
+  for (let item: PDFDict | undefined = first; item && !visited.has(item); item = lookupDict(item, 'Next')) {
+    visited.add(item);
+
+    const firstChild = lookupDict(item, 'First');
+    bookmarks.push({
+      title: lookupText(item, 'Title') ?? '',
+      page: resolveItemPage(pdfDoc, item, lookup),
+      children: firstChild ? readSiblings(pdfDoc, firstChild, lookup, visited) : [],
+    });
+  }
+
+  return bookmarks;
+}
@@ -0,0 +1,216 @@
+/**
+ * Page content analysis
+ *
+ * Walks a page's content (and the form XObjects it draws) tracking the
+ * current transformation matrix, to find where images are placed and how
+ * much visible text and vector drawing the page has.
+ */
+
+import { PDFDict, PDFName, PDFPage, PDFRef, PDFStream } from 'pdf-lib';
+import { PAINTING_OPERATORS, parseContentStream, parsePageContent } from './content-stream';
+import type { ContentOperation } from './content-stream';
+import {
+  decodeStreamContents,
+  lookupArray,
+  lookupDict,
+  lookupName,
+  lookupNumber,
+  toNumberArray,
+} from './pdf-objects';
+
+/**
+ * Affine matrix [a b c d e f]
+ */
+export type Matrix = [number, number, number, number, number, number];
+
+/**
+ * Image drawn on a page
+ */
+export interface ImagePlacement {
+  /** XObject resource name without the slash ('Im1'), or 'BI' for inline images */
+  name: string;
+  /** Image XObject reference (absent for inline and direct images) */
+  ref?: PDFRef;
+  /** Image XObject stream (absent for inline images) */
+  stream?: PDFStream;
+  /** Image width in pixels */
+  width: number;
+  /** Image height in pixels */
+  height: number;
+  /** Drawn width in points */
+  placedWidth: number;
+  /** Drawn height in points */
+  placedHeight: number;
+  /** Transformation from the image's unit square to page space */
+  matrix: Matrix;
+}
+
+/**
+ * Summary of what a page draws
+ */
+export interface PageContentSummary {
+  images: ImagePlacement[];
+  /** Text showing operators with a visible render mode */
+  visibleTextOps: number;
+  /** Text showing operators in render mode 3 (e.g. OCR layers) */
+  invisibleTextOps: number;
+  /** Path painting and shading operators */
+  vectorOps: number;
+}
+
+const IDENTITY: Matrix = [1, 0, 0, 1, 0, 0];
+const TEXT_OPERATORS = new Set(['Tj', 'TJ', "'", '"']);
+const MAX_FORM_DEPTH = 8;
+
+/**
+ * Multiplies two matrices (m applied first, then n)
+ */
+export function multiplyMatrix(m: Matrix, n: Matrix): Matrix {
+  return [
+    m[0] * n[0] + m[1] * n[2],
+    m[0] * n[1] + m[1] * n[3],
+    m[2] * n[0] + m[3] * n[2],
+    m[2] * n[1] + m[3] * n[3],
+    m[4] * n[0] + m[5] * n[2] + n[4],
+    m[4] * n[1] + m[5] * n[3] + n[5],
+  ];
+}
+
+/**
+ * Analyzes a page's content
+ */
+export function analyzePage(page: PDFPage): PageContentSummary {
+  const summary: PageContentSummary = { images: [], visibleTextOps: 0, invisibleTextOps: 0, vectorOps: 0 };
+  walkContent(parsePageContent(page), page.node.Resources(), IDENTITY, 0, summary, new Set());
+  return summary;
+}
+
+/**
+ * Fraction of the page's visible area covered by images (0-1, overlaps
+ * are not subtracted, so the sum is capped)
+ */
+export function imageCoverage(page: PDFPage, images: ImagePlacement[]): number {
+  const box = page.getCropBox();
+  const pageArea = Math.abs(box.width * box.height);
+  if (pageArea === 0) return 0;
+
+  const imageArea = images.reduce((sum, image) => sum + image.placedWidth * image.placedHeight, 0);
+  return Math.min(1, imageArea / pageArea);
+}
+
+function walkContent(
+  operations: ContentOperation[],
+  resources: PDFDict | undefined,
+  baseMatrix: Matrix,
+  depth: number,
+  summary: PageContentSummary,
+  activeForms: Set<PDFStream>
+): void {
+  const stack: Array<{ ctm: Matrix; renderMode: number }> = [];
+  let ctm = baseMatrix;
+  let renderMode = 0;
+
+  for (const { operator, operands } of operations) {
+    switch (operator) {
+      case 'q':
+        stack.push({ ctm, renderMode });
+        break;
+      case 'Q': {
+        const state = stack.pop();
+        if (state) ({ ctm, renderMode } = state);
+        break;
+      }
+      case 'cm':
+        if (operands.length === 6 && operands.every(value => typeof value === 'number')) {
+          ctm = multiplyMatrix(operands as Matrix, ctm);
+        }
+        break;
+      case 'Tr':
+        if (typeof operands[0] === 'number') renderMode = operands[0];
+        break;
+      case 'Do':
+        if (typeof operands[0] === 'string') {
+          drawXObject(operands[0].slice(1), resources, ctm, depth, summary, activeForms);
+        }
+        break;
+      case 'BI': {
+        const params = operands[0];
+        if (params && typeof params === 'object' && !Array.isArray(params) && params.kind === 'dict') {
+          const width = params.entries.W ?? params.entries.Width;
+          const height = params.entries.H ?? params.entries.Height;
+          summary.images.push(placement('BI', undefined, undefined,
+            typeof width === 'number' ? width : 0,
+            typeof height === 'number' ? height : 0,
+            ctm));
+        }
+        break;
+      }
+      default:
+        if (TEXT_OPERATORS.has(operator)) {
+          if (renderMode === 3) summary.invisibleTextOps++;
+          else summary.visibleTextOps++;
+        } else if (PAINTING_OPERATORS.has(operator)) {
+          summary.vectorOps++;
+        }
+    }
+  }
+}
+
+function drawXObject(
+  name: string,
+  resources: PDFDict | undefined,
+  ctm: Matrix,
+  depth: number,
+  summary: PageContentSummary,
+  activeForms: Set<PDFStream>
+): void {
+  const xObjects = resources && lookupDict(resources, 'XObject');
+  if (!xObjects) return;
+
+  const key = PDFName.of(name);
+  const xObject = xObjects.lookup(key);
+  if (!(xObject instanceof PDFStream)) return;
+
+  const raw = xObjects.get(key);
+  const ref = raw instanceof PDFRef ? raw : undefined;
+  const subtype = lookupName(xObject.dict, 'Subtype');
+
+  if (subtype === 'Image') {
+    summary.images.push(placement(name, ref, xObject,
+      lookupNumber(xObject.dict, 'Width') ?? 0,
+      lookupNumber(xObject.dict, 'Height') ?? 0,
+      ctm));
+  } else if (subtype === 'Form' && depth < MAX_FORM_DEPTH && !activeForms.has(xObject)) {
+    const bytes = decodeStreamContents(xObject);
+    if (!bytes) return;
+
+    const matrixArray = lookupArray(xObject.dict, 'Matrix');
+    const formMatrix = matrixArray && matrixArray.size() === 6 ? toNumberArray(matrixArray) as Matrix : IDENTITY;
+    const formResources = lookupDict(xObject.dict, 'Resources') ?? resources;
+
+    activeForms.add(xObject);
+    walkContent(parseContentStream(bytes), formResources, multiplyMatrix(formMatrix, ctm), depth + 1, summary, activeForms);
+    activeForms.delete(xObject);
+  }
+}
+
+function placement(
+  name: string,
+  ref: PDFRef | undefined,
+  stream: PDFStream | undefined,
+  width: number,
+  height: number,
+  ctm: Matrix
+): ImagePlacement {
+  // Images fill the unit square, so the matrix columns give the drawn size
+  return {
+    name,
+    ...(ref && { ref }),
+    ...(stream && { stream }),
+    width,
+    height,
+    placedWidth: Math.hypot(ctm[0], ctm[1]),
+    placedHeight: Math.hypot(ctm[2], ctm[3]),
+    matrix: ctm,
+  };
+}
@@ -0,0 +1,112 @@
+/**
+ * Page tree rebuilding
+ *
+ * Reordering and removing pages leaves deep or lopsided page trees, with
+ * page objects numbered in whatever order they were created. Rebuilding
+ * gives one flat Pages node and numbers the pages in reading order.
+ */
+
+import { PDFArray, PDFDict, PDFDocument, PDFName, PDFNumber, PDFRef } from 'pdf-lib';
+import type { Bookmark } from '../api/types';
+import { createDestinationLookup, resolveItemPage } from './destinations';
+import { readOutline } from './outline';
+import { lookupName, replaceReferences } from './pdf-objects';
+
+/** Page attributes that may be inherited from Pages nodes */
+const INHERITABLE_KEYS = ['Resources', 'MediaBox', 'CropBox', 'Rotate'];
+
+/**
+ * Replaces the page tree with a single Pages node whose kids are the
+ * pages in order, renumbered consecutively after the node itself
+ *
+ * Inherited attributes are copied onto each page first, and every
+ * reference to a page (links, bookmarks, destinations, structure) is
+ * pointed at its new number. Pages pdf-lib has already loaded keep their
+ * old references, so the document should be saved and reloaded before
+ * further page work.
+ */
+export function rebuildPageTree(pdfDoc: PDFDocument): void {
+  const context = pdfDoc.context;
+  const pages = pdfDoc.getPages();
+
+  const oldNodes: PDFRef[] = [];
+  const oldRoot = pdfDoc.catalog.get(PDFName.of('Pages'));
+  if (oldRoot instanceof PDFRef) collectTreeNodes(pdfDoc, oldRoot, oldNodes, new Set());
+
+  for (const page of pages) {
+    for (const key of INHERITABLE_KEYS) {
+      const name = PDFName.of(key);
+      const value = page.node.getInheritableAttribute(name);
+      if (value !== undefined && !page.node.has(name)) page.node.set(name, value);
+    }
+  }
+
+  const root = context.nextRef();
+  const replacements = new Map<PDFRef, PDFRef>();
+  const kids = pages.map(page => {
+    const ref = context.nextRef();
+    replacements.set(page.ref, ref);
+    page.node.set(PDFName.of('Parent'), root);
+    context.assign(ref, page.node);
+    return ref;
+  });
+
+  context.assign(root, context.obj({
+    Type: 'Pages',
+    Kids: kids,
+    Count: PDFNumber.of(kids.length),
+  }));
+  if (oldRoot instanceof PDFRef) replacements.set(oldRoot, root);
+
+  pdfDoc.catalog.set(PDFName.of('Pages'), root);
+  for (const ref of [...oldNodes, ...replacements.keys()]) context.delete(ref);
+  replaceReferences(pdfDoc, replacements);
+}
+
+/**
+ * Target page of every bookmark and link annotation, in outline then page
+ * order (null where it doesn't resolve)
+ *
+ * Compared before and after rebuildPageTree to check nothing moved.
+ */
+export function readDestinationTargets(pdfDoc: PDFDocument): Array<number | null> {
+  const targets: Array<number | null> = [];
+  const addBookmarks = (bookmarks: Bookmark[]): void => {
+    for (const bookmark of bookmarks) {
+      targets.push(bookmark.page);
+      addBookmarks(bookmark.children);
+    }
+  };
+  addBookmarks(readOutline(pdfDoc).bookmarks);
+
+  const lookup = createDestinationLookup(pdfDoc);
+  for (const page of pdfDoc.getPages()) {
+    const annots = page.node.Annots();
+    if (!annots) continue;
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      if (annot instanceof PDFDict && lookupName(annot, 'Subtype') === 'Link') {
+        targets.push(resolveItemPage(pdfDoc, annot, lookup));
+      }
+    }
+  }
+  return targets;
+}
+
+/**
+ * Collects the intermediate Pages nodes of a page tree
+ */
+function collectTreeNodes(pdfDoc: PDFDocument, ref: PDFRef, nodes: PDFRef[], visited: Set<PDFRef>): void {
+  if (visited.has(ref)) return;
+  visited.add(ref);
+
+  const node = pdfDoc.context.lookup(ref);
+  if (!(node instanceof PDFDict) || lookupName(node, 'Type') !== 'Pages') return;
+  nodes.push(ref);
+
+  const kids = node.lookup(PDFName.of('Kids'));
+  if (!(kids instanceof PDFArray)) return;
+  for (const kid of kids.asArray()) {
+    if (kid instanceof PDFRef) collectTreeNodes(pdfDoc, kid, nodes, visited);
+  }
+}
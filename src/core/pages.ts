@@ -0,0 +1,164 @@
+/**
+ * Page-level geometry and content helpers
+ */
+
+import { PDFArray, PDFName, PDFPage } from 'pdf-lib';
+
+/**
+ * Rectangle in PDF user space
+ */
+export interface Box {
+  x: number;
+  y: number;
+  width: number;
+  height: number;
+}
+
+/**
+ * Returns the page rotation normalized to 0, 90, 180 or 270
+ */
+export function getPageRotation(page: PDFPage): number {
+  return ((page.getRotation().angle % 360) + 360) % 360;
+}
+
+/**
+ * Inserts raw content stream operators before the page's existing content
+ */
+export function prependContent(page: PDFPage, operators: string): void {
+  const context = page.doc.context;
+  const streamRef = context.register(context.flateStream(operators));
+  const contentsKey = PDFName.of('Contents');
+  const existing = page.node.get(contentsKey);
+  const contents = page.node.Contents();
+
+  if (contents instanceof PDFArray) {
+    contents.insert(0, streamRef);
+  } else if (existing) {
+    page.node.set(contentsKey, context.obj([streamRef, existing]));
+  } else {
+    page.node.set(contentsKey, streamRef);
+  }
+}
+
+/**
+ * Draws raw content stream operators on top of the page's existing content
+ *
+ * The existing content is wrapped in q/Q so graphics state it leaves
+ * behind doesn't affect the appended operators.
+ */
+export function appendContent(page: PDFPage, operators: string): void {
+  const context = page.doc.context;
+  prependContent(page, 'q\n');
+
+  const streamRef = context.register(context.flateStream(`Q\n${operators}`));
+  const contentsKey = PDFName.of('Contents');
+  const existing = page.node.get(contentsKey);
+  const contents = page.node.Contents();
+  if (contents instanceof PDFArray) {
+    contents.push(streamRef);
+  } else {
+    page.node.set(contentsKey, existing ? context.obj([existing, streamRef]) : streamRef);
+  }
+}
+
+/**
+ * Grows the visible area of a page to the given width:height ratio by
+ * adding equal margins, optionally filled with a background color.
+ * Content is never scaled.
+ *
+ * @returns true if the page was padded
+ */
+export function padPageToAspect(
+  page: PDFPage,
+  aspect: number,
+  background?: [number, number, number]
+): boolean {
+  const box = page.getCropBox();
+  const rotated = getPageRotation(page) % 180 !== 0;
+
+  // Work in displayed orientation, then map back to the unrotated box
+  const shownWidth = rotated ? box.height : box.width;
+  const shownHeight = rotated ? box.width : box.height;
+  const currentAspect = shownWidth / shownHeight;
+  if (Math.abs(currentAspect - aspect) < 1e-3) return false;
+
+  let padShownX = 0;
+  let padShownY = 0;
+  if (currentAspect < aspect) {
+    padShownX = (shownHeight * aspect - shownWidth) / 2;
+  } else {
+    padShownY = (shownWidth / aspect - shownHeight) / 2;
+  }
+  const padX = rotated ? padShownY : padShownX;
+  const padY = rotated ? padShownX : padShownY;
+
+  const padded: Box = {
+    x: box.x - padX,
+    y: box.y - padY,
+    width: box.width + 2 * padX,
+    height: box.height + 2 * padY,
+  };
+
+  page.setMediaBox(padded.x, padded.y, padded.width, padded.height);
+  page.setCropBox(padded.x, padded.y, padded.width, padded.height);
+
+  if (background) {
+    // Fill only the margins so transparent page content keeps its look
+    const [r, g, b] = background;
+    const margins: Box[] = padX > 0
+      ? [
+          { x: padded.x, y: padded.y, width: padX, height: padded.height },
+          { x: box.x + box.width, y: padded.y, width: padX, height: padded.height },
+        ]
+      : [
+          { x: padded.x, y: padded.y, width: padded.width, height: padY },
+          { x: padded.x, y: box.y + box.height, width: padded.width, height: padY },
+        ];
+    const rects = margins.map(m => `${m.x} ${m.y} ${m.width} ${m.height} re`).join('\n');
+    prependContent(page, `q\n${r} ${g} ${b} rg\n${rects}\nf\nQ\n`);
+  }
+
+  return true;
+}
+
+/** Page boxes scaled along with the content */
+const PAGE_BOXES: Record<string, (page: PDFPage) => Box> = {
+  MediaBox: page => page.getMediaBox(),
+  CropBox: page => page.getCropBox(),
+  BleedBox: page => page.getBleedBox(),
+  TrimBox: page => page.getTrimBox(),
+  ArtBox: page => page.getArtBox(),
+};
+
+/**
+ * Scales a page down so the longer side of its visible area is at most
+ * maxSize points. Content, page boxes and annotations are scaled together,
+ * so the page looks the same, only smaller.
+ *
+ * @returns The scale factor, or 1 if the page already fits
+ */
+export function scalePageToFit(page: PDFPage, maxSize: number): number {
+  const { width, height } = page.getCropBox();
+  const longest = Math.max(width, height);
+  if (longest <= maxSize + 1e-3) return 1;
+
+  const scale = maxSize / longest;
+  // Read every box before changing any, since missing ones default to others
+  const boxes = Object.entries(PAGE_BOXES)
+    .filter(([key]) => key === 'MediaBox' || key === 'CropBox' || page.node.get(PDFName.of(key)) !== undefined)
+    .map(([key, getBox]) => [key, getBox(page)] as const);
+
+  // Set on the page itself, overriding boxes inherited from the page tree
+  for (const [key, box] of boxes) {
+    page.node.set(PDFName.of(key), page.doc.context.obj([
+      box.x * scale,
+      box.y * scale,
+      (box.x + box.width) * scale,
+      (box.y + box.height) * scale,
+    ]));
+  }
+
+  prependContent(page, `${scale} 0 0 ${scale} 0 0 cm\n`);
+  page.scaleAnnotations(scale, scale);
+  return scale;
+}
@@ -7,8 +7,58 @@
  * 3. Choose the smallest result
  */
 
-import { PDFDocument } from 'pdf-lib';
-import type { CompressionPreset, CompressionResult, CompressionOptions, ProgressEvent } from '../api/types';
+import {
+  PDFDocument,
+  concatTransformationMatrix,
+  drawObject,
+  popGraphicsState,
+  pushGraphicsState,
+} from 'pdf-lib';
+import type { PDFDocumentProxy } from 'pdfjs-dist';
+import type {
+  AppliedSettings,
+  CompressionPreset,
+  CompressionReport,
+  CompressionResult,
+  CompressionOptions,
+  PageImageEncoding,
+  PageImageSummary,
+  ProcessedMarker,
+  ProgressEvent,
+  RestartMarkerReport,
+  SsimPageQuality,
+  SsimQualityReport,
+  TextImageReport,
+} from '../api/types';
+import { buildChangelog } from './changelog';
+import type { RasterizedPage } from './changelog';
+import { PRESET_FOR_CLASSIFICATION, autoImageSettings, classifyDocument, findTextImagePages } from './classify';
+import { encodeSmallest } from './image-encodings';
+import { addRestartMarkers } from './jpeg-restart';
+import { hasChanges, saveIncremental, snapshotObjects } from './incremental';
+import {
+  hasInteractiveFeatures,
+  imagePassWarning,
+  readInteractiveFeatures,
+  restrictInteractiveOptions,
+  verifyInteractiveFeatures,
+} from './interactive';
+import { runStructuralPasses } from './optimize';
+import { openPdfjsDocument } from './pdfjs';
+import { pinObjects, verifyPinnedObjects } from './pinned';
+import { DEFAULT_MARKER_KEY, MARKER_NS, createMarker, writeMarker } from './processed-marker';
+import { findSignedObjects, splitSignedReport } from './signed-content';
+import { readSignatures } from './signatures';
+import { searchJpegQuality } from './ssim';
+import { readPageImageSummaries } from './statistics';
+import { DEFAULT_SIDECAR_NAME, attachTextSidecar, createTextSidecar, hasAttachment } from './text-sidecar';
+import type { TextSidecar } from './text-sidecar';
+
+/** Lowest DPI protectTextImages renders scanned text at */
+const TEXT_IMAGE_MIN_DPI = 200;
+
+/** Lowest JPEG quality the minSSIM search tries (unless qualityFloor sets one) */
+const SSIM_MIN_QUALITY = 0.1;
 
 /**
  * Gets JPEG quality based on compression preset
@@ -22,6 +72,102 @@ function getCompressionQuality(preset: CompressionPreset): number {
   }
 }
 
+/**
+ * Resolves the preset to apply, classifying the document for 'auto'
+ *
+ * Auto presets other than lossless also get image settings for the
+ * document's classification, size goal and file size. With
+ * preserveInteractive, documents with links, fields or bookmarks get
+ * lossless instead of an image pass.
+ */
+function resolvePreset(pdfDoc: PDFDocument, options: CompressionOptions, fileSize: number): AppliedSettings {
+  const settings = selectPreset(pdfDoc, options, fileSize);
+
+  // The image pass redraws pages as pictures, dropping links, fields and bookmarks
+  if (
+    options.preserveInteractive &&
+    settings.preset !== 'lossless' &&
+    hasInteractiveFeatures(readInteractiveFeatures(pdfDoc))
+  ) {
+    console.log(`[Compressor] ${imagePassWarning(settings.preset)}`);
+    const lossless: AppliedSettings = { ...settings, preset: 'lossless', interactiveOverride: settings.preset };
+    delete lossless.targetDPI;
+    delete lossless.jpegQuality;
+    return lossless;
+  }
+
+  // Checked per document: unsigned documents are compressed as usual
+  if (options.preserveSignedContent && settings.preset !== 'lossless' && readSignatures(pdfDoc).length > 0) {
+    const choice = settings.autoSelected
+      ? `the auto preset chose "${settings.preset}" for this ${settings.classification} document`
+      : `the "${settings.preset}" preset was requested`;
+    throw new Error(
+      `preserveSignedContent can't be honored: ${choice}, and its image pass rewrites the signed content. ` +
+      'Use the lossless preset.'
+    );
+  }
+  return settings;
+}
+
+/**
+ * Picks the preset from the options, classifying the document for 'auto'
+ */
+function selectPreset(pdfDoc: PDFDocument, options: CompressionOptions, fileSize: number): AppliedSettings {
+  if (options.preset !== 'auto') {
+    return { preset: options.preset, autoSelected: false };
+  }
+
+  const sizeGoal = options.sizeGoal ?? 'balanced';
+  const { classification, reasoning } = classifyDocument(pdfDoc);
+  const preset = PRESET_FOR_CLASSIFICATION[sizeGoal][classification];
+  console.log(`[Compressor] Auto preset: ${classification} document, ${sizeGoal} goal, using "${preset}"`);
+
+  // Explicit presets are checked with the other options
+  if (options.pinObjects?.length && preset !== 'lossless') {
+    throw new Error(
+      `pinObjects can't be honored: the auto preset chose "${preset}" for this ${classification} document, ` +
+      'and its image pass rebuilds the document with new object numbers. Use the lossless preset.'
+    );
+  }
+  return {
+    preset,
+    autoSelected: true,
+    classification,
+    reasoning,
+    sizeGoal,
+    ...(preset !== 'lossless' && autoImageSettings(classification, sizeGoal, fileSize)),
+  };
+}
+
+/**
+ * Document parsed and structurally optimized once, ready for one or more
+ * image passes
+ */
+interface PreparedDocument {
+  /** The original input */
+  pdfBuffer: ArrayBuffer;
+  /** Structurally optimized (lossless) bytes */
+  optimizedPdfBytes: Uint8Array;
+  /** Page count after the structural passes */
+  numPages: number;
+  /** What the structural passes changed */
+  report: CompressionReport;
+  /** Marker written by tagProcessed, also added to image-compressed output */
+  marker?: ProcessedMarker;
+  /** Text attached by attachTextSidecar, also added to image-compressed output */
+  sidecar?: TextSidecar;
+  /** Pages protectTextImages renders at TEXT_IMAGE_MIN_DPI or more */
+  textImagePages?: Set<number>;
+  /** False if the optimized bytes are the input, unchanged */
+  rewritten: boolean;
+  /** Indirect objects before and after the structural passes (with changelog) */
+  objectCounts?: { before: number; after: number };
+  /** Image resolution of each page after the structural passes (with changelog) */
+  pageImages?: PageImageSummary[];
+  /** pdf.js document for the optimized bytes, opened by the first image pass */
+  pdfjsDocument?: PDFDocumentProxy;
+}
+
 /**
  * Compresses a PDF using multi-strategy approach
  */
@@ -30,288 +176,673 @@ export async function compressPDF(
   options: CompressionOptions
 ): Promise<CompressionResult> {
   const startTime = Date.now();
-  const originalSize = pdfBuffer.byteLength;
-  const preset = options.preset;
 
-  console.log(`[Compressor] Starting compression with preset: ${preset}`);
-  console.log(`[Compressor] File size: ${(originalSize / 1024 / 1024).toFixed(2)} MB`);
+  console.log(`[Compressor] Starting compression with preset: ${options.preset}`);
+  console.log(`[Compressor] File size: ${(pdfBuffer.byteLength / 1024 / 1024).toFixed(2)} MB`);
+
+  if (isBelowMinimum(pdfBuffer, options)) {
+    return skippedResult(pdfBuffer, options, startTime);
+  }
+
+  try {
+    const originalPdf = await loadOriginal(pdfBuffer, options);
+
+    // Resolve the auto preset from the document's content
+    const appliedSettings = resolvePreset(originalPdf, options, pdfBuffer.byteLength);
+
+    const prepared = await prepareDocument(pdfBuffer, originalPdf, options);
+    try {
+      return await compressPrepared(prepared, appliedSettings, options, startTime);
+    } finally {
+      await prepared.pdfjsDocument?.destroy();
+    }
+  } catch (error) {
+    throw new Error(
+      `PDF compression failed: ${error instanceof Error ? error.message : 'Unknown error'}`
+    );
+  }
+}
 
+/**
+ * Compresses one PDF into several variants from a single parse
+ *
+ * The document is loaded, structurally optimized and (when a variant
+ * needs it) opened in pdf.js once; only the image pass runs per variant.
+ * Auto presets are resolved against the document before structural passes.
+ *
+ * @param options - Shared options for loading and the structural passes
+ * @param variants - Per-variant options (preset and image settings)
+ */
+export async function compressVariants(
+  pdfBuffer: ArrayBuffer,
+  options: CompressionOptions,
+  variants: Array<{ name: string; options: CompressionOptions }>
+): Promise<Record<string, CompressionResult>> {
+  const startTime = Date.now();
+
+  if (isBelowMinimum(pdfBuffer, options)) {
+    return Object.fromEntries(variants.map(({ name, options: variantOptions }) => [
+      name,
+      skippedResult(pdfBuffer, variantOptions, startTime),
+    ]));
+  }
+
+  try {
+    const originalPdf = await loadOriginal(pdfBuffer, options);
+    const settings = variants.map(variant => resolvePreset(originalPdf, variant.options, pdfBuffer.byteLength));
+
+    const prepared = await prepareDocument(pdfBuffer, originalPdf, options);
+    const results: Record<string, CompressionResult> = {};
+    try {
+      for (let i = 0; i < variants.length; i++) {
+        const { name, options: variantOptions } = variants[i];
+        console.log(`[Compressor] Variant "${name}" with preset: ${settings[i].preset}`);
+        const result = await compressPrepared(prepared, settings[i], variantOptions, Date.now());
+        // Variants that fall back to the lossless or original bytes would
+        // otherwise share one ArrayBuffer
+        if (result.pdf === prepared.optimizedPdfBytes.buffer || result.pdf === pdfBuffer) {
+          result.pdf = result.pdf.slice(0);
+        }
+        results[name] = result;
+      }
+    } finally {
+      await prepared.pdfjsDocument?.destroy();
+    }
+
+    console.log(`[Compressor] ${variants.length} variants in ${Date.now() - startTime} ms`);
+    return results;
+  } catch (error) {
+    throw new Error(
+      `PDF compression failed: ${error instanceof Error ? error.message : 'Unknown error'}`
+    );
+  }
+}
+
+function isBelowMinimum(pdfBuffer: ArrayBuffer, options: CompressionOptions): boolean {
+  if (options.minInputBytes === undefined || pdfBuffer.byteLength >= options.minInputBytes) return false;
+  console.log(`[Compressor] Input below minInputBytes (${options.minInputBytes}) - returning it unchanged`);
+  return true;
+}
+
+/**
+ * Result for an input returned as-is by minInputBytes
+ */
+function skippedResult(pdfBuffer: ArrayBuffer, options: CompressionOptions, startTime: number): CompressionResult {
+  const size = pdfBuffer.byteLength;
+  return {
+    pdf: pdfBuffer.slice(0),
+    stats: {
+      originalSize: size,
+      compressedSize: size,
+      ratio: 1,
+      bytesSaved: 0,
+      percentageSaved: 0,
+      presetUsed: 'lossless',
+      processingTime: Date.now() - startTime,
+      chunksProcessed: 0,
+    },
+    appliedSettings: { preset: 'lossless', autoSelected: false },
+    skipped: true,
+    ...(options.changelog && { changelog: [] }),
+  };
+}
+
+/**
+ * Loads the original PDF for compression
+ */
+async function loadOriginal(pdfBuffer: ArrayBuffer, options: CompressionOptions): Promise<PDFDocument> {
   emitProgress(options.onProgress, {
     phase: 'compressing',
     progress: 0,
     message: 'Loading PDF...',
   });
 
-  try {
-    // Load the original PDF
-    const originalPdf = await PDFDocument.load(pdfBuffer, {
-      ignoreEncryption: true,
-      throwOnInvalidObject: false,
-    });
-    const numPages = originalPdf.getPageCount();
+  const pdfDoc = await PDFDocument.load(pdfBuffer, {
+    ignoreEncryption: true,
+    throwOnInvalidObject: false,
+  });
+  await yieldToCaller(options);
+  return pdfDoc;
+}
 
-    emitProgress(options.onProgress, {
-      phase: 'compressing',
-      progress: 20,
-      message: 'Optimizing PDF structure...',
-    });
+/**
+ * Runs the structural passes and the lossless save
+ */
+async function prepareDocument(
+  pdfBuffer: ArrayBuffer,
+  pdfDoc: PDFDocument,
+  options: CompressionOptions
+): Promise<PreparedDocument> {
+  emitProgress(options.onProgress, {
+    phase: 'compressing',
+    progress: 20,
+    message: 'Optimizing PDF structure...',
+  });
 
+  // Signed objects are pinned like pinObjects, and the other changes are
+  // appended to the original bytes
+  const signed = options.preserveSignedContent ? await findSignedObjects(pdfDoc, pdfBuffer) : undefined;
+  const pinNumbers = [...new Set([...(options.pinObjects ?? []), ...(signed?.objectNumbers ?? [])])];
+  const pinned = pinNumbers.length ? pinObjects(pdfDoc, pinNumbers) : undefined;
+  const snapshot = signed ? snapshotObjects(pdfDoc, pdfBuffer) : undefined;
+
+  const marker = options.tagProcessed ? createMarker(options.processedMarkerKey ?? DEFAULT_MARKER_KEY) : undefined;
+  // The marker goes in before the passes, so a pinned or signed XMP stream
+  // is restored like any other change
+  if (marker) writeMarker(pdfDoc, marker);
+
+  const interactive = options.preserveInteractive ? readInteractiveFeatures(pdfDoc) : undefined;
+  const restricted = options.preserveInteractive ? restrictInteractiveOptions(options) : undefined;
+  restricted?.warnings.forEach(warning => console.log(`[Compressor] ${warning}`));
+  let passOptions = restricted?.options ?? options;
+  // trimXMP would otherwise drop the marker it was just given
+  if (marker && passOptions.trimXMP) {
+    passOptions = { ...passOptions, xmpSafelist: [...(passOptions.xmpSafelist ?? []), MARKER_NS] };
+  }
+
+  // Text is read from the input, before any pass can drop it. It's attached
+  // before the passes, so a pinned or signed catalog is restored over it
+  const text = options.attachTextSidecar
+    ? await createTextSidecar(pdfBuffer, options.textSidecarName ?? DEFAULT_SIDECAR_NAME)
+    : undefined;
+  if (text?.sidecar) await attachTextSidecar(pdfDoc, text.sidecar);
+
+  const objectsBefore = options.changelog ? pdfDoc.context.enumerateIndirectObjects().length : 0;
+
+  // Optional structural passes (pruning etc.) change what gets saved and
+  // rendered, so the page count is taken afterwards
+  const report = await runStructuralPasses(pdfDoc, passOptions, pinned);
+  const numPages = pdfDoc.getPageCount();
+  const objectCounts = options.changelog
+    ? { before: objectsBefore, after: pdfDoc.context.enumerateIndirectObjects().length }
+    : undefined;
+  const pageImages = options.changelog && options.preset !== 'lossless' ? readPageImageSummaries(pdfDoc) : undefined;
+  const textImagePages = options.protectTextImages !== false && options.preset !== 'lossless'
+    ? findTextImagePages(pdfDoc)
+    : undefined;
+
+  if (signed) {
+    const { pinnedObjects, signedContent } = splitSignedReport(report.pinnedObjects ?? [], signed, options.pinObjects ?? []);
+    if (pinnedObjects.length > 0) report.pinnedObjects = pinnedObjects;
+    else delete report.pinnedObjects;
+    report.signedContent = signedContent;
+    if (signedContent.warning) console.log(`[Compressor] ${signedContent.warning}`);
+  }
+
+  let sidecar = text?.sidecar;
+  if (text) {
+    report.textSidecar = text.report;
+    if (sidecar && !hasAttachment(pdfDoc, sidecar.name)) {
+      report.textSidecar = {
+        name: sidecar.name,
+        bytes: 0,
+        attached: false,
+        warning: 'No sidecar was attached: the catalog is pinned or signed, so adding it was undone',
+      };
+      sidecar = undefined;
+    }
+    if (report.textSidecar.warning) console.log(`[Compressor] ${report.textSidecar.warning}`);
+  }
+
+  let optimizedPdfBytes: Uint8Array;
+  let rewritten = true;
+  if (snapshot) {
+    // An incremental update can only add bytes; skip it if there's nothing to add
+    rewritten = hasChanges(pdfDoc, snapshot);
+    optimizedPdfBytes = rewritten
+      ? new Uint8Array(await saveIncremental(pdfDoc, pdfBuffer, snapshot))
+      : new Uint8Array(pdfBuffer.slice(0));
+  } else {
     // Strategy 1: Lossless optimization (good for text-heavy PDFs)
-    const optimizedPdfBytes = await originalPdf.save({
+    optimizedPdfBytes = await pdfDoc.save({
       useObjectStreams: true,
       addDefaultPage: false,
     });
+  }
 
-    const optimizedSize = optimizedPdfBytes.length;
+  if (pinned && report.pinnedObjects) {
+    await verifyPinnedObjects(optimizedPdfBytes, pinned, report.pinnedObjects);
+  }
 
-    emitProgress(options.onProgress, {
-      phase: 'compressing',
-      progress: 40,
-      message: `Lossless optimization: ${((1 - optimizedSize / originalSize) * 100).toFixed(1)}% reduction`,
-    });
+  if (interactive) {
+    report.interactive = await verifyInteractiveFeatures(optimizedPdfBytes, interactive, restricted?.warnings ?? []);
+  }
 
-    // ONLY return early for lossless preset
-    // For balanced/max presets, ALWAYS try image compression for better results
-    if (preset === 'lossless') {
-      // Lossless preset requested - return structural optimization only
-      console.log(`[Compressor] Lossless preset - returning early with ${((1 - optimizedSize / originalSize) * 100).toFixed(1)}% reduction`);
-      const processingTime = Date.now() - startTime;
-      const bytesSaved = originalSize - optimizedSize;
-      const percentageSaved = (bytesSaved / originalSize) * 100;
-
-      emitProgress(options.onProgress, {
-        phase: 'compressing',
-        progress: 100,
-        message: 'Lossless compression complete',
-      });
+  return {
+    pdfBuffer,
+    optimizedPdfBytes,
+    numPages,
+    report,
+    marker,
+    sidecar,
+    textImagePages,
+    rewritten,
+    objectCounts,
+    pageImages,
+  };
+}
 
-      return {
-        pdf: optimizedPdfBytes.buffer as ArrayBuffer,
-        stats: {
-          originalSize,
-          compressedSize: optimizedSize,
-          ratio: optimizedSize / originalSize,
-          bytesSaved,
-          percentageSaved,
-          presetUsed: preset,
-          processingTime,
-          chunksProcessed: 1,
-        },
-      };
-    }
+/**
+ * Finishes compression of a prepared document with one preset: returns the
+ * lossless result, or runs the image pass and keeps the smallest output
+ */
+async function compressPrepared(
+  prepared: PreparedDocument,
+  appliedSettings: AppliedSettings,
+  options: CompressionOptions,
+  startTime: number
+): Promise<CompressionResult> {
+  const { pdfBuffer, optimizedPdfBytes, numPages, marker, sidecar, textImagePages } = prepared;
+  const originalSize = pdfBuffer.byteLength;
+  const report = withInteractiveOverride(prepared.report, appliedSettings);
+  const hasReport = Object.keys(report).length > 0;
+  const preset = appliedSettings.preset;
+
+  const optimizedSize = optimizedPdfBytes.length;
+  await yieldToCaller(options);
+
+  emitProgress(options.onProgress, {
+    phase: 'compressing',
+    progress: 40,
+    message: `Lossless optimization: ${((1 - optimizedSize / originalSize) * 100).toFixed(1)}% reduction`,
+  });
 
-    // For balanced/max: ALWAYS proceed to image compression
-    console.log(`[Compressor] Preset "${preset}" - proceeding to image compression (lossless saved ${((1 - optimizedSize / originalSize) * 100).toFixed(1)}%, but will try for more)`);
+  // ONLY return early for lossless preset
+  // For balanced/max presets, ALWAYS try image compression for better results
+  if (preset === 'lossless') {
+    // Lossless preset requested - return structural optimization only
+    console.log(`[Compressor] Lossless preset - returning early with ${((1 - optimizedSize / originalSize) * 100).toFixed(1)}% reduction`);
+    const processingTime = Date.now() - startTime;
+    const bytesSaved = originalSize - optimizedSize;
+    const percentageSaved = (bytesSaved / originalSize) * 100;
 
-    // Strategy 2: Image compression for image-heavy PDFs
     emitProgress(options.onProgress, {
       phase: 'compressing',
-      progress: 45,
-      message: 'Starting image compression...',
+      progress: 100,
+      message: 'Lossless compression complete',
     });
 
-    const quality = getCompressionQuality(preset);
-    const isLargeFile = originalSize > 20 * 1024 * 1024; // 20MB threshold
-    const isVeryLargeFile = originalSize > 50 * 1024 * 1024; // 50MB threshold
-
-    // Calculate target DPI and quality based on file size AND preset
-    let TARGET_DPI: number;
-    let imageQuality: number;
-
-    if (isVeryLargeFile) {
-      // 50MB+ files: Very aggressive to prevent crashes, but balanced is less aggressive
-      TARGET_DPI = preset === 'max' ? 50 : 75; // balanced uses higher DPI = better quality
-      imageQuality = preset === 'max' ? Math.min(quality, 0.35) : Math.min(quality, 0.50); // balanced keeps more quality
-    } else if (isLargeFile) {
-      // 20-50MB files: Clear difference between presets
-      TARGET_DPI = preset === 'max' ? 72 : 120; // balanced uses much higher DPI
-      imageQuality = preset === 'max' ? quality * 0.75 : quality; // balanced uses full preset quality
-    } else if (originalSize > 10 * 1024 * 1024) {
-      // 10-20MB files: Full quality difference
-      TARGET_DPI = preset === 'max' ? 100 : 150;
-      imageQuality = quality; // Use preset quality as-is
-    } else {
-      // <10MB files: Maximum quality difference
-      TARGET_DPI = preset === 'max' ? 120 : 150;
-      imageQuality = quality;
-    }
+    return {
+      pdf: optimizedPdfBytes.buffer as ArrayBuffer,
+      stats: {
+        originalSize,
+        compressedSize: optimizedSize,
+        ratio: optimizedSize / originalSize,
+        bytesSaved,
+        percentageSaved,
+        presetUsed: preset,
+        processingTime,
+        chunksProcessed: 1,
+      },
+      appliedSettings,
+      ...(hasReport && { report }),
+      ...(marker && { processedMarker: marker }),
+      ...(options.changelog && {
+        changelog: buildChangelog(report, {
+          objects: prepared.objectCounts,
+          marker: marker !== undefined,
+          rasterized: [],
+          rewritten: prepared.rewritten,
+        }),
+      }),
+    };
+  }
 
-    console.log(`[Compressor] Image compression settings: DPI=${TARGET_DPI}, quality=${imageQuality}, preset quality=${quality}`);
+  // For balanced/max: ALWAYS proceed to image compression
+  console.log(`[Compressor] Preset "${preset}" - proceeding to image compression (lossless saved ${((1 - optimizedSize / originalSize) * 100).toFixed(1)}%, but will try for more)`);
 
-    // Create new PDF for image compression
-    const compressedPdf = await PDFDocument.create();
+  // Strategy 2: Image compression for image-heavy PDFs
+  emitProgress(options.onProgress, {
+    phase: 'compressing',
+    progress: 45,
+    message: 'Starting image compression...',
+  });
 
-    // Dynamically import PDF.js
-    const pdfjsLib = await import('pdfjs-dist');
+  const quality = getCompressionQuality(preset);
+  const isLargeFile = originalSize > 20 * 1024 * 1024; // 20MB threshold
+  const isVeryLargeFile = originalSize > 50 * 1024 * 1024; // 50MB threshold
+
+  // Calculate target DPI and quality based on file size AND preset
+  let TARGET_DPI: number;
+  let imageQuality: number;
+
+  if (isVeryLargeFile) {
+    // 50MB+ files: Very aggressive to prevent crashes, but balanced is less aggressive
+    TARGET_DPI = preset === 'max' ? 50 : 75; // balanced uses higher DPI = better quality
+    imageQuality = preset === 'max' ? Math.min(quality, 0.35) : Math.min(quality, 0.50); // balanced keeps more quality
+  } else if (isLargeFile) {
+    // 20-50MB files: Clear difference between presets
+    TARGET_DPI = preset === 'max' ? 72 : 120; // balanced uses much higher DPI
+    imageQuality = preset === 'max' ? quality * 0.75 : quality; // balanced uses full preset quality
+  } else if (originalSize > 10 * 1024 * 1024) {
+    // 10-20MB files: Full quality difference
+    TARGET_DPI = preset === 'max' ? 100 : 150;
+    imageQuality = quality; // Use preset quality as-is
+  } else {
+    // <10MB files: Maximum quality difference
+    TARGET_DPI = preset === 'max' ? 120 : 150;
+    imageQuality = quality;
+  }
 
-    // Configure worker - try to use local worker first, fall back to CDN
-    if (typeof window !== 'undefined') {
-      try {
-        // Try local worker first
-        pdfjsLib.GlobalWorkerOptions.workerSrc = '/pdf.js/pdf.worker.min.mjs';
-      } catch {
-        // Fall back to CDN
-        pdfjsLib.GlobalWorkerOptions.workerSrc = `https://cdn.jsdelivr.net/npm/pdfjs-dist@${pdfjsLib.version}/build/pdf.worker.min.mjs`;
-      }
-    }
+  // Auto presets bring settings picked for the document and size goal
+  if (appliedSettings.targetDPI !== undefined) TARGET_DPI = appliedSettings.targetDPI;
+  if (appliedSettings.jpegQuality !== undefined) imageQuality = appliedSettings.jpegQuality;
 
-    const loadingTask = pdfjsLib.getDocument({ data: pdfBuffer });
-    const pdfDocument = await loadingTask.promise;
+  // Explicit settings override the preset's choices
+  if (options.targetDPI !== undefined) TARGET_DPI = options.targetDPI;
+  if (options.jpegQuality !== undefined) imageQuality = options.jpegQuality;
 
-    // Process each page sequentially
-    for (let pageNum = 1; pageNum <= numPages; pageNum++) {
-      const progressPercent = 45 + ((pageNum / numPages) * 45);
-      emitProgress(options.onProgress, {
-        phase: 'compressing',
-        progress: Math.round(progressPercent),
-        message: `Compressing page ${pageNum}/${numPages}...`,
-      });
+  // The quality floor beats both presets and explicit settings
+  const floor = options.qualityFloor;
+  const floorHit: Array<'targetDPI' | 'jpegQuality'> = [];
+  if (floor?.minDPI !== undefined && TARGET_DPI < floor.minDPI) {
+    TARGET_DPI = floor.minDPI;
+    floorHit.push('targetDPI');
+  }
+  if (floor?.minJpegQuality !== undefined && imageQuality < floor.minJpegQuality) {
+    imageQuality = floor.minJpegQuality;
+    floorHit.push('jpegQuality');
+  }
+  if (floorHit.length > 0) appliedSettings.qualityFloorHit = floorHit;
 
-      // Get page from PDF.js
-      const page = await pdfDocument.getPage(pageNum);
-
-      // Get original dimensions (PDF.js uses 72 DPI by default)
-      const originalViewport = page.getViewport({ scale: 1.0 });
-
-      // Calculate scale to achieve target DPI
-      const baseDPI = 72;
-      let scale = Math.min(TARGET_DPI / baseDPI, 2.5);
-
-      // Calculate canvas dimensions
-      let canvasWidth = Math.floor(originalViewport.width * scale);
-      let canvasHeight = Math.floor(originalViewport.height * scale);
-
-      // Limit canvas size to prevent memory issues
-      const MAX_DIMENSION = isVeryLargeFile ? 1536 : isLargeFile ? 2560 : 4096;
-      if (canvasWidth > MAX_DIMENSION || canvasHeight > MAX_DIMENSION) {
-        const widthScale = MAX_DIMENSION / canvasWidth;
-        const heightScale = MAX_DIMENSION / canvasHeight;
-        const limitScale = Math.min(widthScale, heightScale);
-        scale *= limitScale;
-        canvasWidth = Math.floor(originalViewport.width * scale);
-        canvasHeight = Math.floor(originalViewport.height * scale);
-      }
+  appliedSettings.targetDPI = TARGET_DPI;
+  appliedSettings.jpegQuality = imageQuality;
 
-      const viewport = page.getViewport({ scale });
+  console.log(`[Compressor] Image compression settings: DPI=${TARGET_DPI}, quality=${imageQuality}, preset quality=${quality}`);
 
-      // Create canvas (browser only)
-      if (typeof document === 'undefined') {
-        throw new Error('Image compression requires a browser environment');
-      }
+  // Create new PDF for image compression
+  const compressedPdf = await PDFDocument.create();
 
-      const canvas = document.createElement('canvas');
-      const context = canvas.getContext('2d', {
-        alpha: false,
-        willReadFrequently: false,
-      });
-      if (!context) throw new Error('Failed to get canvas context');
+  const imageEncodings: PageImageEncoding[] = [];
+  const protectedPages: TextImageReport['pages'] = [];
+  const rasterized: RasterizedPage[] = [];
+  const ssimPages: SsimPageQuality[] = [];
+  const restartMarkers: RestartMarkerReport | undefined = options.jpegRestartInterval
+    ? { interval: options.jpegRestartInterval, images: 0, skipped: 0 }
+    : undefined;
+
+  // Render the structurally optimized document so structural passes apply
+  prepared.pdfjsDocument ??= await openPdfjsDocument(optimizedPdfBytes.buffer as ArrayBuffer);
+  const pdfDocument = prepared.pdfjsDocument;
+
+  // Process each page sequentially
+  for (let pageNum = 1; pageNum <= numPages; pageNum++) {
+    const progressPercent = 45 + ((pageNum / numPages) * 45);
+    emitProgress(options.onProgress, {
+      phase: 'compressing',
+      progress: Math.round(progressPercent),
+      message: `Compressing page ${pageNum}/${numPages}...`,
+    });
+
+    // Get page from PDF.js
+    const page = await pdfDocument.getPage(pageNum);
+
+    // Get original dimensions (PDF.js uses 72 DPI by default)
+    const originalViewport = page.getViewport({ scale: 1.0 });
+
+    // Calculate scale to achieve target DPI; scanned text needs more
+    const baseDPI = 72;
+    const protectText = textImagePages?.has(pageNum) === true && TARGET_DPI < TEXT_IMAGE_MIN_DPI;
+    let scale = protectText ? TEXT_IMAGE_MIN_DPI / baseDPI : Math.min(TARGET_DPI / baseDPI, 2.5);
+
+    // Calculate canvas dimensions
+    let canvasWidth = Math.floor(originalViewport.width * scale);
+    let canvasHeight = Math.floor(originalViewport.height * scale);
+
+    // Limit canvas size to prevent memory issues
+    const MAX_DIMENSION = isVeryLargeFile ? 1536 : isLargeFile ? 2560 : 4096;
+    if (canvasWidth > MAX_DIMENSION || canvasHeight > MAX_DIMENSION) {
+      const widthScale = MAX_DIMENSION / canvasWidth;
+      const heightScale = MAX_DIMENSION / canvasHeight;
+      const limitScale = Math.min(widthScale, heightScale);
+      scale *= limitScale;
+      canvasWidth = Math.floor(originalViewport.width * scale);
+      canvasHeight = Math.floor(originalViewport.height * scale);
+    }
 
-      canvas.width = canvasWidth;
-      canvas.height = canvasHeight;
+    const viewport = page.getViewport({ scale });
+    if (protectText) protectedPages.push({ page: pageNum, dpi: Math.round(scale * baseDPI) });
 
-      // Render PDF page to canvas
-      await page.render({
-        canvasContext: context as any,
-        viewport: viewport,
-      }).promise;
+    // Create canvas (browser only)
+    if (typeof document === 'undefined') {
+      throw new Error('Image compression requires a browser environment');
+    }
 
-      // Convert canvas to JPEG
+    const canvas = document.createElement('canvas');
+    const context = canvas.getContext('2d', {
+      alpha: false,
+      willReadFrequently: false,
+    });
+    if (!context) throw new Error('Failed to get canvas context');
+
+    canvas.width = canvasWidth;
+    canvas.height = canvasHeight;
+
+    // Render PDF page to canvas
+    await page.render({
+      canvasContext: context as any,
+      viewport: viewport,
+    }).promise;
+    await yieldToCaller(options);
+
+    // Convert canvas to JPEG, at the lowest quality keeping minSSIM if set
+    let jpegBytes: Uint8Array;
+    if (options.minSSIM !== undefined) {
+      const pixels = context.getImageData(0, 0, canvasWidth, canvasHeight);
+      const chosen = await searchJpegQuality(canvas, pixels, options.minSSIM, floor?.minJpegQuality ?? SSIM_MIN_QUALITY);
+      jpegBytes = chosen.bytes;
+      ssimPages.push({ page: pageNum, quality: chosen.quality, ssim: Math.round(chosen.ssim * 10000) / 10000 });
+    } else {
       const jpegDataUrl = canvas.toDataURL('image/jpeg', imageQuality);
       const base64Data = jpegDataUrl.split(',')[1];
-      const jpegBytes = Uint8Array.from(atob(base64Data), c => c.charCodeAt(0));
+      jpegBytes = Uint8Array.from(atob(base64Data), c => c.charCodeAt(0));
+    }
+    if (restartMarkers) {
+      const restarted = addRestartMarkers(jpegBytes, restartMarkers.interval);
+      if (restarted) {
+        jpegBytes = restarted;
+        restartMarkers.images++;
+      } else {
+        restartMarkers.skipped++;
+      }
+    }
 
+    const newPage = compressedPdf.addPage([originalViewport.width, originalViewport.height]);
+
+    if (options.tryMultipleEncodings) {
+      // Keep whichever of JPEG, Flate or CCITT is smallest for this page
+      const pixels = context.getImageData(0, 0, canvasWidth, canvasHeight);
+      const { encoding, stream } = encodeSmallest(compressedPdf, pixels, jpegBytes);
+      const imageName = newPage.node.newXObject('Image', compressedPdf.context.register(stream));
+      newPage.pushOperators(
+        pushGraphicsState(),
+        concatTransformationMatrix(originalViewport.width, 0, 0, originalViewport.height, 0, 0),
+        drawObject(imageName),
+        popGraphicsState()
+      );
+      imageEncodings.push({ page: pageNum, encoding, bytes: stream.getContentsSize() });
+      if (options.changelog) rasterized.push(rasterizedPage(prepared, pageNum, scale * baseDPI, encoding));
+    } else {
       // Embed JPEG in new PDF with original dimensions
       const jpegImage = await compressedPdf.embedJpg(jpegBytes);
-      const newPage = compressedPdf.addPage([originalViewport.width, originalViewport.height]);
-
       newPage.drawImage(jpegImage, {
         x: 0,
         y: 0,
         width: originalViewport.width,
         height: originalViewport.height,
       });
+      if (options.changelog) rasterized.push(rasterizedPage(prepared, pageNum, scale * baseDPI, 'jpeg'));
+    }
 
-      // Clean up canvas
-      canvas.width = 0;
-      canvas.height = 0;
-      context.clearRect(0, 0, 1, 1);
+    // Clean up canvas
+    canvas.width = 0;
+    canvas.height = 0;
+    context.clearRect(0, 0, 1, 1);
 
-      // Allow UI updates and garbage collection
-      const delayMs = isVeryLargeFile ? 100 : isLargeFile ? 50 : 10;
-      await new Promise(resolve => setTimeout(resolve, delayMs));
+    // Allow UI updates and garbage collection
+    const delayMs = isVeryLargeFile ? 100 : isLargeFile ? 50 : 10;
+    await new Promise(resolve => setTimeout(resolve, delayMs));
 
-      // Force cleanup every 10 pages for very large files
-      if (isVeryLargeFile && pageNum % 10 === 0) {
-        await new Promise(resolve => setTimeout(resolve, 200));
-      }
+    // Force cleanup every 10 pages for very large files
+    if (isVeryLargeFile && pageNum % 10 === 0) {
+      await new Promise(resolve => setTimeout(resolve, 200));
     }
 
-    emitProgress(options.onProgress, {
-      phase: 'compressing',
-      progress: 90,
-      message: 'Finalizing compression...',
-    });
+    await yieldToCaller(options);
+  }
 
-    // Save image-compressed PDF
-    const imageCompressedBytes = await compressedPdf.save({
-      useObjectStreams: true,
-      addDefaultPage: false,
-    });
+  emitProgress(options.onProgress, {
+    phase: 'compressing',
+    progress: 90,
+    message: 'Finalizing compression...',
+  });
 
-    const imageCompressedSize = imageCompressedBytes.length;
+  if (marker) writeMarker(compressedPdf, marker);
+  if (sidecar) await attachTextSidecar(compressedPdf, sidecar);
 
-    emitProgress(options.onProgress, {
-      phase: 'compressing',
-      progress: 95,
-      message: `Image compression: ${((1 - imageCompressedSize / originalSize) * 100).toFixed(1)}% reduction`,
-    });
+  // Save image-compressed PDF
+  const imageCompressedBytes = await compressedPdf.save({
+    useObjectStreams: true,
+    addDefaultPage: false,
+  });
 
-    // Strategy 3: Choose the smallest result
-    let finalSize: number;
-    let finalBytes: Uint8Array;
-
-    if (imageCompressedSize < optimizedSize && imageCompressedSize < originalSize) {
-      // Image compression worked best
-      finalSize = imageCompressedSize;
-      finalBytes = imageCompressedBytes;
-    } else if (optimizedSize < originalSize) {
-      // Lossless optimization was better
-      finalSize = optimizedSize;
-      finalBytes = optimizedPdfBytes;
-    } else {
-      // Neither method reduced size, use original
-      finalSize = originalSize;
-      finalBytes = new Uint8Array(pdfBuffer);
+  const imageCompressedSize = imageCompressedBytes.length;
+
+  emitProgress(options.onProgress, {
+    phase: 'compressing',
+    progress: 95,
+    message: `Image compression: ${((1 - imageCompressedSize / originalSize) * 100).toFixed(1)}% reduction`,
+  });
+
+  // Strategy 3: Choose the smallest result
+  let finalSize: number;
+  let finalBytes: Uint8Array;
+  let rewritten = true;
+  const imageCompressionUsed = imageCompressedSize < optimizedSize && imageCompressedSize < originalSize;
+
+  if (imageCompressionUsed) {
+    // Image compression worked best
+    finalSize = imageCompressedSize;
+    finalBytes = imageCompressedBytes;
+  } else if (optimizedSize < originalSize) {
+    // Lossless optimization was better
+    finalSize = optimizedSize;
+    finalBytes = optimizedPdfBytes;
+  } else if (!hasReport && !marker) {
+    // Neither method reduced size, use original
+    finalSize = originalSize;
+    finalBytes = new Uint8Array(pdfBuffer);
+    rewritten = false;
+  } else {
+    // Keep the requested structural changes (or marker) even without a size win
+    finalSize = optimizedSize;
+    finalBytes = optimizedPdfBytes;
+  }
+  if (finalBytes === optimizedPdfBytes) rewritten = prepared.rewritten;
+
+  const processingTime = Date.now() - startTime;
+  const bytesSaved = originalSize - finalSize;
+  const percentageSaved = (bytesSaved / originalSize) * 100;
+
+  emitProgress(options.onProgress, {
+    phase: 'compressing',
+    progress: 100,
+    message: 'Compression complete',
+  });
+
+  const textImages: TextImageReport | undefined = imageCompressionUsed && protectedPages.length > 0
+    ? {
+      minDPI: TEXT_IMAGE_MIN_DPI,
+      targetDPI: TARGET_DPI,
+      pages: protectedPages,
+      warning: `${TARGET_DPI} DPI would likely make scanned text illegible; ` +
+        `${protectedPages.length} page(s) were rendered at up to ${TEXT_IMAGE_MIN_DPI} DPI instead`,
     }
+    : undefined;
+  if (textImages) console.log(`[Compressor] ${textImages.warning}`);
+
+  const ssimQuality = imageCompressionUsed && options.minSSIM !== undefined
+    ? ssimReport(options.minSSIM, ssimPages)
+    : undefined;
+  if (ssimQuality?.warning) console.log(`[Compressor] ${ssimQuality.warning}`);
+  const finalReport: CompressionReport = {
+    ...report,
+    ...(textImages && { textImages }),
+    ...(ssimQuality && { ssimQuality }),
+    ...(imageCompressionUsed && restartMarkers && { restartMarkers }),
+  };
+
+  return {
+    pdf: finalBytes.buffer as ArrayBuffer,
+    stats: {
+      originalSize,
+      compressedSize: finalSize,
+      ratio: finalSize / originalSize,
+      bytesSaved,
+      percentageSaved,
+      presetUsed: preset,
+      processingTime,
+      chunksProcessed: 1,
+      ...(imageCompressionUsed && options.tryMultipleEncodings && { imageEncodings }),
+    },
+    appliedSettings,
+    ...(Object.keys(finalReport).length > 0 && { report: finalReport }),
+    ...(marker && { processedMarker: marker }),
+    ...(options.changelog && {
+      // The input returned unchanged has nothing to log
+      changelog: rewritten
+        ? buildChangelog(report, {
+          objects: prepared.objectCounts,
+          marker: marker !== undefined,
+          rasterized: imageCompressionUsed ? rasterized : [],
+          rewritten,
+        })
+        : [],
+    }),
+  };
+}
 
-    const processingTime = Date.now() - startTime;
-    const bytesSaved = originalSize - finalSize;
-    const percentageSaved = (bytesSaved / originalSize) * 100;
+/**
+ * Summarizes the qualities minSSIM chose, warning about pages that
+ * missed the target even at full quality
+ */
+function ssimReport(minSSIM: number, pages: SsimPageQuality[]): SsimQualityReport {
+  const missed = pages.filter(page => page.ssim < minSSIM);
+  return {
+    minSSIM,
+    pages,
+    ...(missed.length > 0 && {
+      warning: `${missed.length} page(s) stayed below SSIM ${minSSIM} even at full JPEG quality: ` +
+        missed.map(page => page.page).join(', '),
+    }),
+  };
+}
 
-    emitProgress(options.onProgress, {
-      phase: 'compressing',
-      progress: 100,
-      message: 'Compression complete',
-    });
+/**
+ * Changelog record of a page the image pass redrew
+ */
+function rasterizedPage(prepared: PreparedDocument, pageNum: number, dpi: number, encoding: string): RasterizedPage {
+  return {
+    page: pageNum,
+    dpiBefore: prepared.pageImages?.[pageNum - 1]?.maxEffectiveDPI ?? null,
+    dpiAfter: Math.round(dpi),
+    encoding,
+  };
+}
 
-    return {
-      pdf: finalBytes.buffer as ArrayBuffer,
-      stats: {
-        originalSize,
-        compressedSize: finalSize,
-        ratio: finalSize / originalSize,
-        bytesSaved,
-        percentageSaved,
-        presetUsed: preset,
-        processingTime,
-        chunksProcessed: 1,
-      },
-    };
-  } catch (error) {
-    throw new Error(
-      `PDF compression failed: ${error instanceof Error ? error.message : 'Unknown error'}`
-    );
-  }
+/**
+ * Adds the warning for a preset preserveInteractive replaced to the
+ * report, copying it since variants share the prepared report
+ */
+function withInteractiveOverride(report: CompressionReport, appliedSettings: AppliedSettings): CompressionReport {
+  if (!report.interactive || !appliedSettings.interactiveOverride) return report;
+  return {
+    ...report,
+    interactive: {
+      ...report.interactive,
+      warnings: [...report.interactive.warnings, imagePassWarning(appliedSettings.interactiveOverride)],
+    },
+  };
 }
 
 /**
@@ -325,3 +856,14 @@ function emitProgress(
     onProgress(event);
   }
 }
+
+/**
+ * Yields to the event loop (or the caller's yield callback) when requested
+ */
+async function yieldToCaller(options: CompressionOptions): Promise<void> {
+  if (typeof options.yield === 'function') {
+    await options.yield();
+  } else if (options.yield) {
+    await new Promise(resolve => setTimeout(resolve, 0));
+  }
+}
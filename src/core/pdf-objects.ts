@@ -0,0 +1,307 @@
+/**
+ * Low-level helpers for reading pdf-lib object graphs
+ */
+
+import {
+  PDFArray,
+  PDFContentStream,
+  PDFDict,
+  PDFDocument,
+  PDFHexString,
+  PDFName,
+  PDFNumber,
+  PDFObject,
+  PDFRawStream,
+  PDFRef,
+  PDFStream,
+  PDFString,
+  decodePDFRawStream,
+} from 'pdf-lib';
+
+/**
+ * Loads a PDF for inspection or editing without touching its metadata
+ * (pdf-lib rewrites Producer/ModDate on load unless told otherwise)
+ */
+export async function loadDocument(pdfBuffer: ArrayBuffer): Promise<PDFDocument> {
+  return PDFDocument.load(pdfBuffer, {
+    ignoreEncryption: true,
+    throwOnInvalidObject: false,
+    updateMetadata: false,
+  });
+}
+
+/**
+ * Returns the trailer /Info dictionary, if the document has one
+ */
+export function getInfoDict(pdfDoc: PDFDocument): PDFDict | undefined {
+  const info = pdfDoc.context.trailerInfo.Info;
+  const dict = info ? pdfDoc.context.lookup(info) : undefined;
+  return dict instanceof PDFDict ? dict : undefined;
+}
+
+/**
+ * Returns the trailer /Info dictionary, creating an empty one if needed
+ */
+export function ensureInfoDict(pdfDoc: PDFDocument): PDFDict {
+  const existing = getInfoDict(pdfDoc);
+  if (existing) return existing;
+
+  const info = pdfDoc.context.obj({});
+  pdfDoc.context.trailerInfo.Info = pdfDoc.context.register(info);
+  return info;
+}
+
+/**
+ * Looks up a dictionary entry, returning it only if it resolves to a dictionary
+ */
+export function lookupDict(dict: PDFDict, key: string): PDFDict | undefined {
+  const value = dict.lookup(PDFName.of(key));
+  return value instanceof PDFDict ? value : undefined;
+}
+
+/**
+ * Looks up a dictionary entry, returning it only if it resolves to an array
+ */
+export function lookupArray(dict: PDFDict, key: string): PDFArray | undefined {
+  const value = dict.lookup(PDFName.of(key));
+  return value instanceof PDFArray ? value : undefined;
+}
+
+/**
+ * Looks up a numeric dictionary entry
+ */
+export function lookupNumber(dict: PDFDict, key: string): number | undefined {
+  const value = dict.lookup(PDFName.of(key));
+  return value instanceof PDFNumber ? value.asNumber() : undefined;
+}
+
+/**
+ * Looks up a name dictionary entry, returning it without the leading slash
+ */
+export function lookupName(dict: PDFDict, key: string): string | undefined {
+  const value = dict.lookup(PDFName.of(key));
+  return value instanceof PDFName ? value.decodeText() : undefined;
+}
+
+/**
+ * Looks up a text string dictionary entry (literal or hex)
+ */
+export function lookupText(dict: PDFDict, key: string): string | undefined {
+  const value = dict.lookup(PDFName.of(key));
+  if (value instanceof PDFString || value instanceof PDFHexString) {
+    return value.decodeText();
+  }
+  return undefined;
+}
+
+/**
+ * Converts a PDF array of numbers to a plain number array
+ */
+export function toNumberArray(array: PDFArray): number[] {
+  const numbers: number[] = [];
+  for (let i = 0; i < array.size(); i++) {
+    const value = array.lookup(i);
+    if (value instanceof PDFNumber) numbers.push(value.asNumber());
+  }
+  return numbers;
+}
+
+/**
+ * Parses a PDF date string (D:YYYYMMDDHHmmSSOHH'mm') into a Date
+ */
+export function parsePdfDate(value: string): Date | undefined {
+  const match = /^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?([Zz+-])?(\d{2})?'?(\d{2})?'?/.exec(value.trim());
+  if (!match) return undefined;
+
+  const [, year, month = '01', day = '01', hour = '00', minute = '00', second = '00', tz, tzHour = '00', tzMinute = '00'] = match;
+  const utc = Date.UTC(+year, +month - 1, +day, +hour, +minute, +second);
+  const offset = (+tzHour * 60 + +tzMinute) * 60000;
+
+  if (tz === '+') return new Date(utc - offset);
+  if (tz === '-') return new Date(utc + offset);
+  return new Date(utc);
+}
+
+/**
+ * Reads all key/value pairs of a name tree (e.g. /Dests, /EmbeddedFiles)
+ */
+export function readNameTree(root: PDFDict): Map<string, PDFObject> {
+  const entries = new Map<string, PDFObject>();
+  collectNameTree(root, entries, new Set());
+  return entries;
+}
+
+function collectNameTree(node: PDFDict, entries: Map<string, PDFObject>, visited: Set<PDFDict>): void {
+  if (visited.has(node)) return;
+  visited.add(node);
+
+  const names = lookupArray(node, 'Names');
+  if (names) {
+    for (let i = 0; i + 1 < names.size(); i += 2) {
+      const key = names.lookup(i);
+      if (key instanceof PDFString || key instanceof PDFHexString) {
+        const name = key.decodeText();
+        if (!entries.has(name)) entries.set(name, names.get(i + 1));
+      }
+    }
+  }
+
+  const kids = lookupArray(node, 'Kids');
+  if (kids) {
+    for (let i = 0; i < kids.size(); i++) {
+      const kid = kids.lookup(i);
+      if (kid instanceof PDFDict) collectNameTree(kid, entries, visited);
+    }
+  }
+}
+
+/**
+ * Saves a document with the same structural settings as lossless compression
+ */
+export async function saveDocument(pdfDoc: PDFDocument): Promise<ArrayBuffer> {
+  const bytes = await pdfDoc.save({
+    useObjectStreams: true,
+    addDefaultPage: false,
+  });
+  return bytes.buffer as ArrayBuffer;
+}
+
+/**
+ * Returns the stream filter names of a stream dictionary, in decode order
+ */
+export function getFilters(dict: PDFDict): string[] {
+  const filter = dict.lookup(PDFName.of('Filter'));
+  if (filter instanceof PDFName) return [filter.decodeText()];
+  if (filter instanceof PDFArray) {
+    const names: string[] = [];
+    for (let i = 0; i < filter.size(); i++) {
+      const name = filter.lookup(i);
+      if (name instanceof PDFName) names.push(name.decodeText());
+    }
+    return names;
+  }
+  return [];
+}
+
+/**
+ * Calls the visitor for every dictionary in the document, including
+ * stream dictionaries and dictionaries nested directly inside other
+ * objects. References are not followed; each indirect object is visited
+ * once on its own.
+ */
+export function visitDicts(
+  pdfDoc: PDFDocument,
+  visitor: (dict: PDFDict, ref: PDFRef, stream?: PDFStream) => void
+): void {
+  for (const [ref, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    visitNested(object, ref, visitor);
+  }
+}
+
+function visitNested(
+  object: PDFObject,
+  ref: PDFRef,
+  visitor: (dict: PDFDict, ref: PDFRef, stream?: PDFStream) => void
+): void {
+  if (object instanceof PDFStream) {
+    visitor(object.dict, ref, object);
+    for (const [, value] of object.dict.entries()) visitNested(value, ref, visitor);
+  } else if (object instanceof PDFDict) {
+    visitor(object, ref);
+    for (const [, value] of object.entries()) visitNested(value, ref, visitor);
+  } else if (object instanceof PDFArray) {
+    for (const value of object.asArray()) visitNested(value, ref, visitor);
+  }
+}
+
+/**
+ * Decodes a stream's data through its filters
+ *
+ * @returns The decoded bytes, or undefined if a filter is unsupported
+ * (image codecs such as DCTDecode) or the data is corrupt
+ */
+export function decodeStreamContents(stream: PDFStream): Uint8Array | undefined {
+  try {
+    if (stream instanceof PDFRawStream) {
+      return getFilters(stream.dict).length === 0
+        ? stream.contents
+        : decodePDFRawStream(stream).decode();
+    }
+    // Operator streams created by pdf-lib in this session (page drawing)
+    if (stream instanceof PDFContentStream) {
+      return stream.getUnencodedContents();
+    }
+    return stream.getContents();
+  } catch {
+    return undefined;
+  }
+}
+
+/**
+ * Applies the first `count` filters of a filter chain (e.g. Flate around
+ * DCT), leaving the data in the remaining filters' encoding
+ */
+export function decodeOuterFilters(stream: PDFRawStream, count: number): Uint8Array | undefined {
+  const dict = stream.dict.clone();
+  const filter = stream.dict.lookup(PDFName.of('Filter'));
+  if (!(filter instanceof PDFArray)) return undefined;
+
+  dict.set(PDFName.of('Filter'), stream.dict.context.obj(filter.asArray().slice(0, count)));
+  const parms = stream.dict.lookup(PDFName.of('DecodeParms'));
+  if (parms instanceof PDFArray) {
+    dict.set(PDFName.of('DecodeParms'), stream.dict.context.obj(parms.asArray().slice(0, count)));
+  }
+  return decodeStreamContents(PDFRawStream.of(dict, stream.contents));
+}
+
+/**
+ * Points every reference to a key of `replacements` at its value, in all
+ * indirect objects and the direct objects nested in them
+ */
+export function replaceReferences(pdfDoc: PDFDocument, replacements: Map<PDFRef, PDFRef>): void {
+  for (const [, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    replaceRefs(object, replacements, new Set());
+  }
+}
+
+/**
+ * Rewrites references in an object and the direct objects nested in it
+ */
+function replaceRefs(object: PDFObject, replacements: Map<PDFRef, PDFRef>, visited: Set<PDFObject>): void {
+  if (visited.has(object)) return;
+  visited.add(object);
+
+  if (object instanceof PDFStream) {
+    replaceRefs(object.dict, replacements, visited);
+  } else if (object instanceof PDFDict) {
+    for (const [key, value] of object.entries()) {
+      const replacement = value instanceof PDFRef ? replacements.get(value) : undefined;
+      if (replacement) object.set(key, replacement);
+      else replaceRefs(value, replacements, visited);
+    }
+  } else if (object instanceof PDFArray) {
+    object.asArray().forEach((value, index) => {
+      const replacement = value instanceof PDFRef ? replacements.get(value) : undefined;
+      if (replacement) object.set(index, replacement);
+      else replaceRefs(value, replacements, visited);
+    });
+  }
+}
+
+/**
+ * Returns an object's bytes as pdf-lib would write them, for comparing
+ * objects across documents or revisions
+ */
+export function serializeObject(object: PDFObject): Uint8Array {
+  const bytes = new Uint8Array(object.sizeInBytes());
+  object.copyBytesInto(bytes, 0);
+  return bytes;
+}
+
+export function bytesEqual(a: Uint8Array, b: Uint8Array): boolean {
+  if (a.length !== b.length) return false;
+  for (let i = 0; i < a.length; i++) {
+    if (a[i] !== b[i]) return false;
+  }
+  return true;
+}
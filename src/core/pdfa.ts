@@ -0,0 +1,194 @@
+/**
+ * PDF/A-2b for merged documents
+ *
+ * Merging conforming files breaks conformance in predictable ways: the
+ * new document has no output intent, no XMP identification, no file
+ * identifier, and its document information matches no XMP. These are
+ * restored, and the merged content is checked for what PDF/A-2 forbids
+ * and inputs can bring along (unembedded fonts, scripts, LZW). This is
+ * not a full validator: rules about individual color spaces or glyph
+ * widths are not checked.
+ */
+
+import { PDFDict, PDFDocument, PDFHexString, PDFName, PDFObjectCopier, PDFStream } from 'pdf-lib';
+import type { PdfAIssue } from '../api/types';
+import type { MergeSource } from './merge';
+import { decodeStreamContents, getFilters, lookupArray, lookupName, visitDicts } from './pdf-objects';
+import { isEmbeddedFont } from './statistics';
+import { encodeXmlEntities, getXmpValue, readXmp, writeXmp } from './xmp';
+
+/** Actions PDF/A-2 forbids (ISO 19005-2, 6.5.1) */
+const FORBIDDEN_ACTIONS = new Set([
+  'Launch', 'Sound', 'Movie', 'ResetForm', 'ImportData', 'JavaScript', 'Hide', 'SetOCGState', 'Rendition', 'Trans', 'GoTo3DView',
+]);
+
+/** Annotation types PDF/A-2 forbids (ISO 19005-2, 6.3.1) */
+const FORBIDDEN_ANNOTATIONS = new Set(['Sound', 'Movie', 'Screen', '3D', 'RichMedia']);
+
+/**
+ * PDF/A identification read from a document's XMP
+ */
+export interface PdfAClaim {
+  part: number;
+  conformance: string;
+}
+
+/**
+ * Reads the PDF/A part and conformance level a document claims
+ */
+export function readPdfAClaim(pdfDoc: PDFDocument): PdfAClaim | undefined {
+  const xmp = readXmp(pdfDoc);
+  const part = xmp && Number(getXmpValue(xmp, 'pdfaid:part'));
+  if (!xmp || !part) return undefined;
+  return { part, conformance: (getXmpValue(xmp, 'pdfaid:conformance') ?? '').toUpperCase() };
+}
+
+/**
+ * Copies the first input's PDF/A output intent into the merged document
+ *
+ * A document has one output profile, so inputs with a different profile
+ * have their device colors interpreted by the first one's.
+ *
+ * @returns Issues with the inputs' output intents
+ */
+export function mergeOutputIntents(merged: PDFDocument, sources: MergeSource[]): PdfAIssue[] {
+  const intents = sources.map(source => ({
+    input: source.index,
+    pdfDoc: source.pdfDoc,
+    intent: findPdfAIntent(source.pdfDoc),
+  }));
+  const first = intents.find(entry => entry.intent);
+  if (!first?.intent) {
+    return [{
+      code: 'outputIntentMissing',
+      message: 'No input has a PDF/A output intent to carry over; one with an ICC profile is required',
+      inputs: [],
+      blocking: true,
+    }];
+  }
+
+  const copy = PDFObjectCopier.for(first.pdfDoc.context, merged.context).copy(first.intent);
+  merged.catalog.set(PDFName.of('OutputIntents'), merged.context.obj([merged.context.register(copy)]));
+
+  const profile = profileBytes(first.intent);
+  const differing = intents.filter(entry =>
+    entry !== first && (!entry.intent || !sameBytes(profileBytes(entry.intent), profile)));
+  if (differing.length === 0) return [];
+  return [{
+    code: 'outputIntentConflict',
+    message: 'These inputs have no output intent or a different ICC profile; their device colors now use the first input\'s profile',
+    inputs: differing.map(entry => entry.input),
+    blocking: false,
+  }];
+}
+
+/**
+ * Writes PDF/A-2b identification: XMP mirroring the document
+ * information, dated now, and a new file identifier
+ */
+export function writePdfAIdentification(pdfDoc: PDFDocument, title?: string): void {
+  const now = new Date();
+  pdfDoc.setCreationDate(now);
+  pdfDoc.setModificationDate(now);
+  if (title !== undefined) pdfDoc.setTitle(title);
+
+  const date = now.toISOString().replace(/\.\d{3}Z$/, 'Z');
+  const producer = pdfDoc.getProducer();
+  const creator = pdfDoc.getCreator();
+  const properties = [
+    '<pdfaid:part>2</pdfaid:part>',
+    '<pdfaid:conformance>B</pdfaid:conformance>',
+    `<xmp:CreateDate>${date}</xmp:CreateDate>`,
+    `<xmp:ModifyDate>${date}</xmp:ModifyDate>`,
+    `<xmp:MetadataDate>${date}</xmp:MetadataDate>`,
+    creator !== undefined && `<xmp:CreatorTool>${encodeXmlEntities(creator)}</xmp:CreatorTool>`,
+    producer !== undefined && `<pdf:Producer>${encodeXmlEntities(producer)}</pdf:Producer>`,
+    title !== undefined &&
+      `<dc:title><rdf:Alt><rdf:li xml:lang="x-default">${encodeXmlEntities(title)}</rdf:li></rdf:Alt></dc:title>`,
+  ].filter(Boolean);
+
+  writeXmp(pdfDoc, [
+    '<?xpacket begin="﻿" id="W5M0MpCehiHzreSzNTczkc9d"?>',
+    '<x:xmpmeta xmlns:x="adobe:ns:meta/">',
+    '<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">',
+    '<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/" ' +
+      'xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" ' +
+      'xmlns:dc="http://purl.org/dc/elements/1.1/">',
+    ...properties,
+    '</rdf:Description>',
+    '</rdf:RDF>',
+    '</x:xmpmeta>',
+    '<?xpacket end="w"?>',
+  ].join('\n'));
+
+  const id = PDFHexString.of([...crypto.getRandomValues(new Uint8Array(16))]
+    .map(byte => byte.toString(16).padStart(2, '0'))
+    .join(''));
+  pdfDoc.context.trailerInfo.ID = pdfDoc.context.obj([id, id]);
+}
+
+/**
+ * Checks a saved document for the PDF/A-2b requirements merging affects
+ */
+export function checkPdfA(pdfDoc: PDFDocument): PdfAIssue[] {
+  const issues: PdfAIssue[] = [];
+  const add = (code: PdfAIssue['code'], message: string) => issues.push({ code, message, inputs: [], blocking: true });
+
+  const claim = readPdfAClaim(pdfDoc);
+  if (!claim || claim.part !== 2 || claim.conformance !== 'B') {
+    add('identificationMissing', 'The XMP does not identify the file as PDF/A-2b');
+  }
+  if (!findPdfAIntent(pdfDoc)) add('outputIntentMissing', 'The document has no PDF/A output intent');
+  if (!pdfDoc.context.trailerInfo.ID) add('identifierMissing', 'The trailer has no file identifier');
+  if (pdfDoc.isEncrypted || pdfDoc.context.trailerInfo.Encrypt) add('encrypted', 'PDF/A forbids encryption');
+
+  const fonts = new Set<string>();
+  const actions = new Set<string>();
+  const annotations = new Set<string>();
+  let lzw = false;
+  // Actions and annotations are often direct objects, so nested dictionaries are visited too
+  visitDicts(pdfDoc, (dict, _ref, stream) => {
+    const type = lookupName(dict, 'Type');
+    const subtype = lookupName(dict, 'Subtype');
+    if (stream && getFilters(dict).includes('LZWDecode')) lzw = true;
+    if (type === 'Font' && subtype !== 'CIDFontType0' && subtype !== 'CIDFontType2' && !isEmbeddedFont(dict)) {
+      fonts.add(lookupName(dict, 'BaseFont') ?? 'unnamed font');
+    }
+    if (subtype && FORBIDDEN_ANNOTATIONS.has(subtype) && (type === 'Annot' || dict.has(PDFName.of('Rect')))) {
+      annotations.add(subtype);
+    }
+    const action = lookupName(dict, 'S');
+    if (action && FORBIDDEN_ACTIONS.has(action)) actions.add(action);
+  });
+
+  if (fonts.size > 0) add('fontNotEmbedded', `Fonts are not embedded: ${[...fonts].sort().join(', ')}`);
+  if (actions.size > 0) add('forbiddenAction', `Forbidden actions: ${[...actions].sort().join(', ')}`);
+  if (annotations.size > 0) add('forbiddenAnnotation', `Forbidden annotation types: ${[...annotations].sort().join(', ')}`);
+  if (lzw) add('lzwCompression', 'Streams use LZW compression, which PDF/A forbids');
+
+  return issues;
+}
+
+function findPdfAIntent(pdfDoc: PDFDocument): PDFDict | undefined {
+  const intents = lookupArray(pdfDoc.catalog, 'OutputIntents');
+  if (!intents) return undefined;
+  for (let i = 0; i < intents.size(); i++) {
+    const intent = intents.lookup(i);
+    if (intent instanceof PDFDict && lookupName(intent, 'S') === 'GTS_PDFA1') return intent;
+  }
+  return undefined;
+}
+
+function profileBytes(intent: PDFDict): Uint8Array | undefined {
+  const profile = intent.lookup(PDFName.of('DestOutputProfile'));
+  if (!(profile instanceof PDFStream)) return undefined;
+  return decodeStreamContents(profile) ?? profile.getContents();
+}
+
+function sameBytes(a: Uint8Array | undefined, b: Uint8Array | undefined): boolean {
+  if (!a || !b || a.length !== b.length) return false;
+  for (let i = 0; i < a.length; i++) {
+    if (a[i] !== b[i]) return false;
+  }
+  return true;
+}
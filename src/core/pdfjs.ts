@@ -0,0 +1,30 @@
+/**
+ * pdf.js loading
+ *
+ * pdf.js is imported lazily so the lossless path never pays for it.
+ */
+
+import type { PDFDocumentProxy } from 'pdfjs-dist';
+
+/**
+ * Opens a PDF with pdf.js, configuring the worker on first use
+ */
+export async function openPdfjsDocument(pdfBuffer: ArrayBuffer): Promise<PDFDocumentProxy> {
+  // Dynamically import PDF.js
+  const pdfjsLib = await import('pdfjs-dist');
+
+  // Configure worker - try to use local worker first, fall back to CDN
+  if (typeof window !== 'undefined') {
+    try {
+      // Try local worker first
+      pdfjsLib.GlobalWorkerOptions.workerSrc = '/pdf.js/pdf.worker.min.mjs';
+    } catch {
+      // Fall back to CDN
+      pdfjsLib.GlobalWorkerOptions.workerSrc = `https://cdn.jsdelivr.net/npm/pdfjs-dist@${pdfjsLib.version}/build/pdf.worker.min.mjs`;
+    }
+  }
+
+  // pdf.js transfers the data to its worker, so give it a copy
+  const loadingTask = pdfjsLib.getDocument({ data: new Uint8Array(pdfBuffer.slice(0)) });
+  return loadingTask.promise;
+}
@@ -0,0 +1,83 @@
+/**
+ * Pinned objects
+ *
+ * Some integrations (external signing, hand-tuned images) need specific
+ * objects to come through optimization untouched. Pinned objects keep
+ * their number, any pass that changes one has the change undone, and the
+ * saved output is checked against the original bytes.
+ */
+
+import { PDFDocument, PDFObjectParser, PDFRef } from 'pdf-lib';
+import type { PinnedObjectReport } from '../api/types';
+import { bytesEqual, serializeObject } from './pdf-objects';
+
+/**
+ * Serialized pinned objects, keyed by reference
+ */
+export type PinnedObjects = Map<PDFRef, Uint8Array>;
+
+/**
+ * Records the current bytes of the objects to pin
+ *
+ * @throws If an object doesn't exist or is the document information
+ *   dictionary, which pdf-lib rewrites on every load and save
+ */
+export function pinObjects(pdfDoc: PDFDocument, objectNumbers: number[]): PinnedObjects {
+  const context = pdfDoc.context;
+  const refs = new Map<number, PDFRef>();
+  for (const [ref] of context.enumerateIndirectObjects()) refs.set(ref.objectNumber, ref);
+
+  const pinned: PinnedObjects = new Map();
+  for (const number of objectNumbers) {
+    const ref = refs.get(number);
+    if (!ref) {
+      throw new Error(`Pinned object ${number} does not exist in the document`);
+    }
+    if (ref === context.trailerInfo.Info) {
+      throw new Error(`Pinned object ${number} is the document information dictionary, which is rewritten on save`);
+    }
+    pinned.set(ref, serializeObject(context.lookup(ref)!));
+  }
+  return pinned;
+}
+
+/**
+ * Puts back pinned objects that a pass changed
+ *
+ * @returns Report entries; preserved is provisional until
+ *   verifyPinnedObjects has checked the saved output
+ */
+export function restorePinnedObjects(pdfDoc: PDFDocument, pinned: PinnedObjects): PinnedObjectReport[] {
+  const context = pdfDoc.context;
+  const report: PinnedObjectReport[] = [];
+
+  for (const [ref, bytes] of pinned) {
+    const current = context.lookup(ref);
+    const restored = !current || !bytesEqual(serializeObject(current), bytes);
+    if (restored) context.assign(ref, PDFObjectParser.forBytes(bytes, context).parseObject());
+    report.push({ object: ref.toString(), preserved: true, restored });
+  }
+  return report;
+}
+
+/**
+ * Checks that saved output holds every pinned object under its original
+ * number with its original bytes, updating preserved in the report
+ */
+export async function verifyPinnedObjects(
+  pdfBytes: Uint8Array,
+  pinned: PinnedObjects,
+  report: PinnedObjectReport[]
+): Promise<void> {
+  const saved = await PDFDocument.load(pdfBytes, {
+    ignoreEncryption: true,
+    throwOnInvalidObject: false,
+    updateMetadata: false,
+  });
+
+  for (const [ref, bytes] of pinned) {
+    const entry = report.find(item => item.object === ref.toString());
+    const object = saved.context.lookup(ref);
+    if (entry) entry.preserved = object !== undefined && bytesEqual(serializeObject(object), bytes);
+  }
+}
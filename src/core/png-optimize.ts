@@ -0,0 +1,230 @@
+/**
+ * Lossless re-encoding of screenshot-like images
+ *
+ * Screenshots and UI captures are mostly flat areas in few colors. JPEG
+ * adds ringing around their edges and Flate without a predictor barely
+ * compresses them; the PNG approach of an exact palette where possible
+ * plus per-row prediction filters is smaller and keeps every pixel.
+ * Photographs are left alone. JPEG decoding uses the browser's decoder.
+ */
+
+import { PDFDocument, PDFHexString, PDFName, PDFObject, PDFRawStream, PDFRef } from 'pdf-lib';
+import type { PngOptimizeReport } from '../api/types';
+import { lookupNumber } from './pdf-objects';
+import { isRgbImage, readRgbPixels } from './posterize';
+
+/** Images smaller than this (in either dimension) aren't worth it */
+const MIN_DIMENSION = 16;
+
+/**
+ * Share of pixels equal to their left neighbor above which an image
+ * counts as flat; photographs and JPEG-decoded photos are far below it
+ */
+const FLAT_SHARE = 0.5;
+
+/** Largest palette an Indexed image can hold */
+const MAX_PALETTE = 256;
+
+/** Dictionary entries carried over to the re-encoded image */
+const KEPT_KEYS = ['SMask', 'Intent', 'Interpolate', 'OC', 'Metadata', 'StructParent'];
+
+/**
+ * Re-encodes flat RGB images with an exact palette (up to 256 colors) or
+ * as predicted RGB, keeping the result only when it is smaller
+ *
+ * @param only - Limit to these images (default: all)
+ */
+export async function optimizePngImages(pdfDoc: PDFDocument, only?: Set<PDFRef>): Promise<PngOptimizeReport> {
+  const report: PngOptimizeReport = { images: [], skipped: 0 };
+
+  for (const [ref, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    if (only && !only.has(ref)) continue;
+    if (!(object instanceof PDFRawStream) || !isRgbImage(object)) continue;
+
+    const width = lookupNumber(object.dict, 'Width') ?? 0;
+    const height = lookupNumber(object.dict, 'Height') ?? 0;
+    if (width < MIN_DIMENSION || height < MIN_DIMENSION) continue;
+
+    const pixels = await readRgbPixels(object, width, height);
+    if (!pixels || flatShare(pixels) < FLAT_SHARE) {
+      report.skipped++;
+      continue;
+    }
+
+    // The original RGB space (possibly ICC-based) stays, as the palette's base
+    const colorSpace = object.dict.get(PDFName.of('ColorSpace')) ?? PDFName.of('DeviceRGB');
+    const palette = exactPalette(pixels);
+    const encoded = palette
+      ? encodeIndexed(pdfDoc, width, height, colorSpace, palette)
+      : encodeRgb(pdfDoc, pixels, width, height, colorSpace);
+    const bytesBefore = object.getContentsSize();
+    const bytesAfter = encoded.getContentsSize();
+    if (bytesAfter >= bytesBefore) {
+      report.skipped++;
+      continue;
+    }
+
+    for (const key of KEPT_KEYS) {
+      const value = object.dict.get(PDFName.of(key));
+      if (value) encoded.dict.set(PDFName.of(key), value);
+    }
+    // A stencil mask still applies; a color-key mask refers to RGB values
+    const mask = object.dict.get(PDFName.of('Mask'));
+    if (mask instanceof PDFRef) encoded.dict.set(PDFName.of('Mask'), mask);
+
+    pdfDoc.context.assign(ref, encoded);
+    report.images.push({
+      object: ref.toString(),
+      width,
+      height,
+      encoding: palette ? 'indexed' : 'rgb',
+      colors: palette ? palette.colors.length : null,
+      bytesBefore,
+      bytesAfter,
+    });
+  }
+
+  return report;
+}
+
+/**
+ * Share of pixels with the same color as the pixel to their left
+ */
+function flatShare(pixels: Uint8Array): number {
+  let same = 0;
+  for (let i = 3; i < pixels.length; i += 3) {
+    if (pixels[i] === pixels[i - 3] && pixels[i + 1] === pixels[i - 2] && pixels[i + 2] === pixels[i - 1]) same++;
+  }
+  return same / Math.max(1, pixels.length / 3 - 1);
+}
+
+/**
+ * Every distinct color with each pixel's index, or undefined for more
+ * than 256 colors
+ */
+function exactPalette(pixels: Uint8Array): { colors: number[]; indices: Uint8Array } | undefined {
+  const lookup = new Map<number, number>();
+  const indices = new Uint8Array(pixels.length / 3);
+  for (let i = 0, p = 0; i < pixels.length; i += 3, p++) {
+    const color = (pixels[i] << 16) | (pixels[i + 1] << 8) | pixels[i + 2];
+    let index = lookup.get(color);
+    if (index === undefined) {
+      if (lookup.size === MAX_PALETTE) return undefined;
+      index = lookup.size;
+      lookup.set(color, index);
+    }
+    indices[p] = index;
+  }
+  return { colors: [...lookup.keys()], indices };
+}
+
+function encodeIndexed(
+  pdfDoc: PDFDocument,
+  width: number,
+  height: number,
+  base: PDFObject,
+  palette: { colors: number[]; indices: Uint8Array }
+): PDFRawStream {
+  const entries = palette.colors.length;
+  const bits = entries <= 2 ? 1 : entries <= 4 ? 2 : entries <= 16 ? 4 : 8;
+
+  const rowBytes = Math.ceil((width * bits) / 8);
+  const packed = new Uint8Array(rowBytes * height);
+  for (let y = 0; y < height; y++) {
+    for (let x = 0; x < width; x++) {
+      const bitOffset = x * bits;
+      packed[y * rowBytes + (bitOffset >> 3)] |= palette.indices[y * width + x] << (8 - bits - (bitOffset & 7));
+    }
+  }
+
+  let lookup = '';
+  for (const color of palette.colors) lookup += color.toString(16).padStart(6, '0');
+
+  const context = pdfDoc.context;
+  const stream = context.flateStream(pngFilter(packed, rowBytes, height, 1), {
+    Type: 'XObject',
+    Subtype: 'Image',
+    Width: width,
+    Height: height,
+    BitsPerComponent: bits,
+    DecodeParms: { Predictor: 15, Colors: 1, BitsPerComponent: bits, Columns: width },
+  });
+  stream.dict.set(
+    PDFName.of('ColorSpace'),
+    context.obj([PDFName.of('Indexed'), base, entries - 1, PDFHexString.of(lookup)])
+  );
+  return stream;
+}
+
+function encodeRgb(
+  pdfDoc: PDFDocument,
+  pixels: Uint8Array,
+  width: number,
+  height: number,
+  colorSpace: PDFObject
+): PDFRawStream {
+  const stream = pdfDoc.context.flateStream(pngFilter(pixels, width * 3, height, 3), {
+    Type: 'XObject',
+    Subtype: 'Image',
+    Width: width,
+    Height: height,
+    BitsPerComponent: 8,
+    DecodeParms: { Predictor: 15, Colors: 3, BitsPerComponent: 8, Columns: width },
+  });
+  stream.dict.set(PDFName.of('ColorSpace'), colorSpace);
+  return stream;
+}
+
+/**
+ * Applies PNG row filters, choosing per row the filter with the smallest
+ * sum of absolute residuals (the heuristic libpng uses)
+ *
+ * @param bytesPerPixel - Distance to the left neighbor (1 below 8 bits)
+ */
+function pngFilter(data: Uint8Array, rowBytes: number, height: number, bytesPerPixel: number): Uint8Array {
+  const output = new Uint8Array((rowBytes + 1) * height);
+  const candidate = new Uint8Array(rowBytes);
+  const best = new Uint8Array(rowBytes);
+
+  for (let y = 0; y < height; y++) {
+    const row = data.subarray(y * rowBytes, (y + 1) * rowBytes);
+    const above = y > 0 ? data.subarray((y - 1) * rowBytes, y * rowBytes) : undefined;
+    let bestType = 0;
+    let bestScore = Infinity;
+
+    for (let type = 0; type < 5; type++) {
+      let score = 0;
+      for (let x = 0; x < rowBytes; x++) {
+        const left = x >= bytesPerPixel ? row[x - bytesPerPixel] : 0;
+        const up = above ? above[x] : 0;
+        const upLeft = above && x >= bytesPerPixel ? above[x - bytesPerPixel] : 0;
+        const predicted = type === 0 ? 0
+          : type === 1 ? left
+            : type === 2 ? up
+              : type === 3 ? (left + up) >> 1
+                : paeth(left, up, upLeft);
+        const value = (row[x] - predicted) & 0xff;
+        candidate[x] = value;
+        score += value < 128 ? value : 256 - value;
+      }
+      if (score < bestScore) {
+        bestScore = score;
+        bestType = type;
+        best.set(candidate);
+      }
+    }
+
+    output[y * (rowBytes + 1)] = bestType;
+    output.set(best, y * (rowBytes + 1) + 1);
+  }
+  return output;
+}
+
+function paeth(left: number, up: number, upLeft: number): number {
+  const estimate = left + up - upLeft;
+  const dLeft = Math.abs(estimate - left);
+  const dUp = Math.abs(estimate - up);
+  const dUpLeft = Math.abs(estimate - upLeft);
+  if (dLeft <= dUp && dLeft <= dUpLeft) return left;
+  return dUp <= dUpLeft ? up : upLeft;
+}
@@ -0,0 +1,320 @@
+/**
+ * Palette reduction (posterization) of color images
+ *
+ * Color images are quantized to a small palette with median cut and
+ * rewritten as Indexed images with packed indices, which compress far
+ * better. Intended for internal laser printing where full color is
+ * wasted. JPEG decoding uses the browser's decoder.
+ */
+
+import { PDFArray, PDFBool, PDFDocument, PDFHexString, PDFName, PDFRawStream, PDFRef, PDFStream } from 'pdf-lib';
+import type { ImageLimitReport, PosterizedImage, PosterizeReport } from '../api/types';
+import { decodeStreamContents, getFilters, lookupDict, lookupNumber } from './pdf-objects';
+import { createCanvas, decodeImage } from './render';
+
+/** Images smaller than this (in either dimension) aren't worth it */
+const MIN_DIMENSION = 32;
+
+/** Pixels sampled to build the palette */
+const MAX_SAMPLES = 65536;
+
+/**
+ * Mean per-channel error above which the palette visibly loses detail;
+ * photographs typically land well above it
+ */
+const PHOTO_ERROR_THRESHOLD = 10;
+
+/** Dictionary entries carried over to the indexed image */
+const KEPT_KEYS = ['SMask', 'Intent', 'Interpolate', 'OC', 'Metadata', 'StructParent'];
+
+/**
+ * Posterizes the document's RGB images
+ *
+ * @param colors - Palette size (2-256)
+ * @param includePhotos - Also posterize images the palette represents poorly
+ * @param only - Limit to these images (default: all)
+ */
+export async function posterizeImages(
+  pdfDoc: PDFDocument,
+  colors: number,
+  includePhotos: boolean,
+  only?: Set<PDFRef>
+): Promise<PosterizeReport> {
+  const report: PosterizeReport = { images: [], skipped: 0 };
+
+  for (const [ref, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    if (only && !only.has(ref)) continue;
+    if (!(object instanceof PDFRawStream) || !isRgbImage(object)) continue;
+
+    const width = lookupNumber(object.dict, 'Width') ?? 0;
+    const height = lookupNumber(object.dict, 'Height') ?? 0;
+    if (width < MIN_DIMENSION || height < MIN_DIMENSION) continue;
+
+    const pixels = await readRgbPixels(object, width, height);
+    if (!pixels) {
+      report.skipped++;
+      continue;
+    }
+
+    const palette = medianCut(pixels, colors);
+    const { indices, meanError } = mapToPalette(pixels, palette);
+    if (meanError > PHOTO_ERROR_THRESHOLD && !includePhotos) {
+      report.skipped++;
+      continue;
+    }
+
+    const indexed = buildIndexedImage(pdfDoc, object, width, height, palette, indices);
+    const bytesBefore = object.getContentsSize();
+    const bytesAfter = indexed.getContentsSize();
+    if (bytesAfter >= bytesBefore) {
+      report.skipped++;
+      continue;
+    }
+
+    pdfDoc.context.assign(ref, indexed);
+    report.images.push(describe(ref, width, height, countColors(pixels), palette.length / 3, bytesBefore, bytesAfter));
+  }
+
+  return report;
+}
+
+/**
+ * Picks the images with the largest stored size
+ *
+ * @returns The chosen images and a report of all images, largest first
+ */
+export function selectLargestImages(
+  pdfDoc: PDFDocument,
+  limit: number
+): { selected: Set<PDFRef>; report: ImageLimitReport } {
+  const images: Array<{ ref: PDFRef; size: number }> = [];
+  for (const [ref, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    if (object instanceof PDFStream && object.dict.lookup(PDFName.of('Subtype')) === PDFName.of('Image')) {
+      images.push({ ref, size: object.getContentsSize() });
+    }
+  }
+  images.sort((a, b) => b.size - a.size);
+
+  const chosen = images.slice(0, limit);
+  return {
+    selected: new Set(chosen.map(image => image.ref)),
+    report: {
+      processed: chosen.map(image => image.ref.toString()),
+      skipped: images.slice(limit).map(image => image.ref.toString()),
+    },
+  };
+}
+
+/**
+ * Whether a stream is an 8-bit RGB image without a Decode array
+ */
+export function isRgbImage(stream: PDFStream): boolean {
+  const dict = stream.dict;
+  if (dict.lookup(PDFName.of('Subtype')) !== PDFName.of('Image')) return false;
+  if (dict.lookup(PDFName.of('ImageMask')) === PDFBool.True) return false;
+  if (dict.has(PDFName.of('Decode')) || lookupNumber(dict, 'BitsPerComponent') !== 8) return false;
+
+  const colorSpace = dict.lookup(PDFName.of('ColorSpace'));
+  if (colorSpace === PDFName.of('DeviceRGB')) return true;
+
+  // [/ICCBased stream] with three components
+  if (colorSpace instanceof PDFArray && colorSpace.lookup(0) === PDFName.of('ICCBased')) {
+    const profile = colorSpace.lookup(1);
+    return profile instanceof PDFStream && lookupNumber(profile.dict, 'N') === 3;
+  }
+  return false;
+}
+
+/**
+ * Reads RGB pixels (3 bytes per pixel) from unfiltered, Flate or JPEG data
+ */
+export async function readRgbPixels(stream: PDFRawStream, width: number, height: number): Promise<Uint8Array | undefined> {
+  const filters = getFilters(stream.dict);
+
+  if (filters.length === 1 && filters[0] === 'DCTDecode') {
+    const bitmap = await decodeImage(stream.contents).catch(() => undefined);
+    if (!bitmap) return undefined;
+
+    const { canvas, context } = createCanvas(width, height);
+    context.drawImage(bitmap, 0, 0, width, height);
+    bitmap.close();
+    const rgba = context.getImageData(0, 0, width, height).data;
+    canvas.width = 0;
+    canvas.height = 0;
+
+    const rgb = new Uint8Array(width * height * 3);
+    for (let i = 0, j = 0; i < rgba.length; i += 4, j += 3) {
+      rgb[j] = rgba[i];
+      rgb[j + 1] = rgba[i + 1];
+      rgb[j + 2] = rgba[i + 2];
+    }
+    return rgb;
+  }
+
+  // Predictors aren't undone by the stream decoder
+  const parms = lookupDict(stream.dict, 'DecodeParms');
+  if (parms && (lookupNumber(parms, 'Predictor') ?? 1) > 1) return undefined;
+  if (filters.some(filter => filter !== 'FlateDecode')) return undefined;
+
+  const bytes = decodeStreamContents(stream);
+  return bytes && bytes.length >= width * height * 3 ? bytes.subarray(0, width * height * 3) : undefined;
+}
+
+/**
+ * Median cut quantization
+ *
+ * @returns Palette as packed RGB bytes
+ */
+function medianCut(pixels: Uint8Array, colors: number): Uint8Array {
+  const pixelCount = pixels.length / 3;
+  const step = Math.max(1, Math.floor(pixelCount / MAX_SAMPLES));
+  const samples: number[] = [];
+  for (let i = 0; i < pixelCount; i += step) samples.push(i * 3);
+
+  let boxes: number[][] = [samples];
+  while (boxes.length < colors) {
+    // Split the box with the widest channel range
+    let best = -1;
+    let bestChannel = 0;
+    let bestRange = 0;
+    boxes.forEach((box, index) => {
+      if (box.length < 2) return;
+      for (let channel = 0; channel < 3; channel++) {
+        let min = 255;
+        let max = 0;
+        for (const offset of box) {
+          const value = pixels[offset + channel];
+          if (value < min) min = value;
+          if (value > max) max = value;
+        }
+        if (max - min > bestRange) {
+          bestRange = max - min;
+          best = index;
+          bestChannel = channel;
+        }
+      }
+    });
+    if (best === -1) break;
+
+    const box = boxes[best].sort((a, b) => pixels[a + bestChannel] - pixels[b + bestChannel]);
+    const middle = box.length >> 1;
+    boxes = [...boxes.slice(0, best), box.slice(0, middle), box.slice(middle), ...boxes.slice(best + 1)];
+  }
+
+  const palette = new Uint8Array(boxes.length * 3);
+  boxes.forEach((box, index) => {
+    for (let channel = 0; channel < 3; channel++) {
+      let sum = 0;
+      for (const offset of box) sum += pixels[offset + channel];
+      palette[index * 3 + channel] = Math.round(sum / Math.max(1, box.length));
+    }
+  });
+  return palette;
+}
+
+/**
+ * Maps each pixel to its nearest palette entry (cached per 15-bit color)
+ */
+function mapToPalette(pixels: Uint8Array, palette: Uint8Array): { indices: Uint8Array; meanError: number } {
+  const pixelCount = pixels.length / 3;
+  const indices = new Uint8Array(pixelCount);
+  const cache = new Int16Array(32768).fill(-1);
+  let totalError = 0;
+
+  for (let i = 0; i < pixelCount; i++) {
+    const r = pixels[i * 3];
+    const g = pixels[i * 3 + 1];
+    const b = pixels[i * 3 + 2];
+    const key = ((r >> 3) << 10) | ((g >> 3) << 5) | (b >> 3);
+
+    let index = cache[key];
+    if (index === -1) {
+      let bestDistance = Infinity;
+      for (let p = 0; p < palette.length / 3; p++) {
+        const dr = r - palette[p * 3];
+        const dg = g - palette[p * 3 + 1];
+        const db = b - palette[p * 3 + 2];
+        const distance = dr * dr + dg * dg + db * db;
+        if (distance < bestDistance) {
+          bestDistance = distance;
+          index = p;
+        }
+      }
+      cache[key] = index;
+    }
+
+    indices[i] = index;
+    totalError += Math.abs(r - palette[index * 3]) + Math.abs(g - palette[index * 3 + 1]) +
+      Math.abs(b - palette[index * 3 + 2]);
+  }
+
+  return { indices, meanError: totalError / (pixelCount * 3) };
+}
+
+function buildIndexedImage(
+  pdfDoc: PDFDocument,
+  original: PDFStream,
+  width: number,
+  height: number,
+  palette: Uint8Array,
+  indices: Uint8Array
+): PDFRawStream {
+  const entries = palette.length / 3;
+  const bits = entries <= 2 ? 1 : entries <= 4 ? 2 : entries <= 16 ? 4 : 8;
+
+  // Rows are padded to whole bytes
+  const rowBytes = Math.ceil((width * bits) / 8);
+  const packed = new Uint8Array(rowBytes * height);
+  for (let y = 0; y < height; y++) {
+    for (let x = 0; x < width; x++) {
+      const bitOffset = x * bits;
+      packed[y * rowBytes + (bitOffset >> 3)] |= indices[y * width + x] << (8 - bits - (bitOffset & 7));
+    }
+  }
+
+  let lookup = '';
+  for (const value of palette) lookup += value.toString(16).padStart(2, '0');
+
+  const context = pdfDoc.context;
+  const stream = context.flateStream(packed, {
+    Type: 'XObject',
+    Subtype: 'Image',
+    Width: width,
+    Height: height,
+    BitsPerComponent: bits,
+  });
+  stream.dict.set(
+    PDFName.of('ColorSpace'),
+    context.obj([PDFName.of('Indexed'), PDFName.of('DeviceRGB'), entries - 1, PDFHexString.of(lookup)])
+  );
+
+  for (const key of KEPT_KEYS) {
+    const value = original.dict.get(PDFName.of(key));
+    if (value) stream.dict.set(PDFName.of(key), value);
+  }
+  // A stencil mask still applies; a color-key mask refers to the old values
+  const mask = original.dict.get(PDFName.of('Mask'));
+  if (mask instanceof PDFRef) stream.dict.set(PDFName.of('Mask'), mask);
+
+  return stream;
+}
+
+function countColors(pixels: Uint8Array): number {
+  const seen = new Set<number>();
+  for (let i = 0; i < pixels.length; i += 3) {
+    seen.add((pixels[i] << 16) | (pixels[i + 1] << 8) | pixels[i + 2]);
+  }
+  return seen.size;
+}
+
+function describe(
+  ref: PDFRef,
+  width: number,
+  height: number,
+  colorsBefore: number,
+  colorsAfter: number,
+  bytesBefore: number,
+  bytesAfter: number
+): PosterizedImage {
+  return { object: ref.toString(), width, height, colorsBefore, colorsAfter, bytesBefore, bytesAfter };
+}
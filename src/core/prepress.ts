@@ -0,0 +1,308 @@
+/**
+ * Prepress checks
+ *
+ * Walks each page's content (and the forms it draws) for what print
+ * shops check before accepting a file: overprint, spot colors, heavy ink
+ * and RGB images in a CMYK job. Colors are read from the operators and
+ * resources used, not from rendered separations, so ink coverage only
+ * counts CMYK fill and stroke colors, not images.
+ */
+
+import { PDFArray, PDFBool, PDFDict, PDFDocument, PDFName, PDFStream } from 'pdf-lib';
+import type { ContentOperand, PrepressConcern, PrepressPage, PrepressReport } from '../api/types';
+import { parseContentStream, parsePageContent } from './content-stream';
+import type { ContentOperation } from './content-stream';
+import { decodeStreamContents, lookupDict, lookupName, lookupNumber } from './pdf-objects';
+
+/** Total area coverage (C+M+Y+K, in percent) most presses accept */
+const INK_LIMIT = 300;
+
+const MAX_FORM_DEPTH = 8;
+
+/** DeviceN colorants that are process inks, not spot colors */
+const PROCESS_COLORANTS = new Set(['Cyan', 'Magenta', 'Yellow', 'Black', 'None', 'All']);
+
+/** Abbreviated color space names used by inline images */
+const INLINE_NAMES: Record<string, string> = { G: 'DeviceGray', RGB: 'DeviceRGB', CMYK: 'DeviceCMYK' };
+
+type ColorKind = 'gray' | 'rgb' | 'cmyk' | 'spot' | 'other';
+
+interface ColorUse {
+  kind: ColorKind;
+  /** Spot colorant names (spot only) */
+  spots: string[];
+}
+
+/**
+ * What one page uses, gathered while walking its content
+ */
+interface PageUsage {
+  overprint: boolean;
+  spots: Set<string>;
+  cmyk: boolean;
+  rgbImages: Set<PDFStream | ContentOperand>;
+  maxInk: number | null;
+}
+
+/**
+ * Checks every page and assesses whether the document is ready for print
+ */
+export function assessPrepress(pdfDoc: PDFDocument): PrepressReport {
+  const usages = pdfDoc.getPages().map(page => {
+    const usage: PageUsage = {
+      overprint: false,
+      spots: new Set(),
+      cmyk: false,
+      rgbImages: new Set(),
+      maxInk: null,
+    };
+    walkContent(parsePageContent(page), page.node.Resources(), 0, usage, new Set());
+    return usage;
+  });
+
+  const pages: PrepressPage[] = usages.map((usage, index) => ({
+    page: index + 1,
+    overprint: usage.overprint,
+    spotColors: [...usage.spots].sort(),
+    maxInkCoverage: usage.maxInk,
+    rgbImages: usage.rgbImages.size,
+  }));
+  const spotColors = [...new Set(pages.flatMap(page => page.spotColors))].sort();
+
+  // Without CMYK, spot colors or an output intent the file was made for screens
+  const printTargeted = usages.some(usage => usage.cmyk || usage.spots.size > 0) ||
+    pdfDoc.catalog.has(PDFName.of('OutputIntents'));
+
+  const concerns: PrepressConcern[] = [];
+  const pagesWhere = (test: (page: PrepressPage) => boolean) => pages.filter(test).map(page => page.page);
+
+  if (!printTargeted) {
+    concerns.push({
+      issue: 'notPrintTargeted',
+      message: 'The document uses only RGB and gray color and has no output intent; it was not prepared for print',
+      pages: [],
+    });
+  }
+
+  const overprint = pagesWhere(page => page.overprint);
+  if (overprint.length > 0) {
+    concerns.push({ issue: 'overprint', message: 'Overprint is turned on; check it is intended', pages: overprint });
+  }
+
+  const spots = pagesWhere(page => page.spotColors.length > 0);
+  if (spots.length > 0) {
+    concerns.push({
+      issue: 'spotColors',
+      message: `Spot colors are used (${spotColors.join(', ')}); each prints as an extra plate unless converted`,
+      pages: spots,
+    });
+  }
+
+  const heavyInk = pagesWhere(page => (page.maxInkCoverage ?? 0) > INK_LIMIT);
+  if (heavyInk.length > 0) {
+    concerns.push({ issue: 'inkCoverage', message: `CMYK colors exceed ${INK_LIMIT}% total ink`, pages: heavyInk });
+  }
+
+  const rgbImages = pagesWhere(page => page.rgbImages > 0);
+  if (printTargeted && rgbImages.length > 0) {
+    concerns.push({ issue: 'rgbImages', message: 'RGB images in a print document are converted by the RIP', pages: rgbImages });
+  }
+
+  return { printReady: concerns.length === 0, printTargeted, pages, spotColors, concerns };
+}
+
+function walkContent(
+  operations: ContentOperation[],
+  resources: PDFDict | undefined,
+  depth: number,
+  usage: PageUsage,
+  activeForms: Set<PDFStream>
+): void {
+  const stack: Array<{ fill: ColorKind; stroke: ColorKind }> = [];
+  let fill: ColorKind = 'gray';
+  let stroke: ColorKind = 'gray';
+
+  for (const { operator, operands } of operations) {
+    switch (operator) {
+      case 'q':
+        stack.push({ fill, stroke });
+        break;
+      case 'Q': {
+        const state = stack.pop();
+        if (state) ({ fill, stroke } = state);
+        break;
+      }
+      case 'g':
+        fill = 'gray';
+        break;
+      case 'G':
+        stroke = 'gray';
+        break;
+      case 'rg':
+        fill = 'rgb';
+        break;
+      case 'RG':
+        stroke = 'rgb';
+        break;
+      case 'k':
+        fill = 'cmyk';
+        usage.cmyk = true;
+        recordInk(operands, usage);
+        break;
+      case 'K':
+        stroke = 'cmyk';
+        usage.cmyk = true;
+        recordInk(operands, usage);
+        break;
+      case 'cs':
+      case 'CS':
+        if (typeof operands[0] === 'string') {
+          const kind = record(namedColorSpace(operands[0].slice(1), resources), usage);
+          if (operator === 'cs') fill = kind;
+          else stroke = kind;
+        }
+        break;
+      case 'sc':
+      case 'scn':
+        if (fill === 'cmyk') recordInk(operands, usage);
+        break;
+      case 'SC':
+      case 'SCN':
+        if (stroke === 'cmyk') recordInk(operands, usage);
+        break;
+      case 'gs':
+        if (typeof operands[0] === 'string') checkExtGState(operands[0].slice(1), resources, usage);
+        break;
+      case 'sh': {
+        const shadings = resources && lookupDict(resources, 'Shading');
+        const shading = typeof operands[0] === 'string' && shadings?.lookup(PDFName.of(operands[0].slice(1)));
+        const dict = shading instanceof PDFStream ? shading.dict : shading;
+        if (dict instanceof PDFDict) record(classify(dict.lookup(PDFName.of('ColorSpace')), resources), usage);
+        break;
+      }
+      case 'Do':
+        if (typeof operands[0] === 'string') drawXObject(operands[0].slice(1), resources, depth, usage, activeForms);
+        break;
+      case 'BI': {
+        const params = operands[0];
+        if (params && typeof params === 'object' && !Array.isArray(params) && params.kind === 'dict') {
+          const colorSpace = params.entries.CS ?? params.entries.ColorSpace;
+          if (typeof colorSpace === 'string') {
+            const name = colorSpace.slice(1);
+            const kind = record(namedColorSpace(INLINE_NAMES[name] ?? name, resources), usage);
+            if (kind === 'rgb') usage.rgbImages.add(params);
+          }
+        }
+        break;
+      }
+    }
+  }
+}
+
+function drawXObject(
+  name: string,
+  resources: PDFDict | undefined,
+  depth: number,
+  usage: PageUsage,
+  activeForms: Set<PDFStream>
+): void {
+  const xObjects = resources && lookupDict(resources, 'XObject');
+  const xObject = xObjects?.lookup(PDFName.of(name));
+  if (!(xObject instanceof PDFStream)) return;
+
+  const subtype = lookupName(xObject.dict, 'Subtype');
+  if (subtype === 'Image') {
+    // Stencil masks paint with the current fill color, already counted
+    if (xObject.dict.lookup(PDFName.of('ImageMask')) === PDFBool.True) return;
+    const kind = record(classify(xObject.dict.lookup(PDFName.of('ColorSpace')), resources), usage);
+    if (kind === 'rgb') usage.rgbImages.add(xObject);
+  } else if (subtype === 'Form' && depth < MAX_FORM_DEPTH && !activeForms.has(xObject)) {
+    const bytes = decodeStreamContents(xObject);
+    if (!bytes) return;
+
+    activeForms.add(xObject);
+    walkContent(parseContentStream(bytes), lookupDict(xObject.dict, 'Resources') ?? resources, depth + 1, usage, activeForms);
+    activeForms.delete(xObject);
+  }
+}
+
+function checkExtGState(name: string, resources: PDFDict | undefined, usage: PageUsage): void {
+  const states = resources && lookupDict(resources, 'ExtGState');
+  const state = states?.lookup(PDFName.of(name));
+  if (!(state instanceof PDFDict)) return;
+  if (state.lookup(PDFName.of('OP')) === PDFBool.True || state.lookup(PDFName.of('op')) === PDFBool.True) {
+    usage.overprint = true;
+  }
+}
+
+/**
+ * Records a CMYK color's total ink, in percent
+ */
+function recordInk(operands: ContentOperand[], usage: PageUsage): void {
+  if (operands.length !== 4 || !operands.every(value => typeof value === 'number')) return;
+  const ink = Math.round((operands as number[]).reduce((total, value) => total + value, 0) * 100);
+  usage.maxInk = Math.max(usage.maxInk ?? 0, ink);
+}
+
+function record(use: ColorUse, usage: PageUsage): ColorKind {
+  if (use.kind === 'cmyk') usage.cmyk = true;
+  for (const spot of use.spots) usage.spots.add(spot);
+  return use.kind;
+}
+
+/**
+ * Classifies a color space given by name: a device space, or an entry of
+ * the ColorSpace resources
+ */
+function namedColorSpace(name: string, resources: PDFDict | undefined, depth = 0): ColorUse {
+  if (['DeviceGray', 'DeviceRGB', 'DeviceCMYK', 'Pattern'].includes(name)) return classify(PDFName.of(name), resources, depth);
+  const colorSpaces = resources && lookupDict(resources, 'ColorSpace');
+  return classify(colorSpaces?.lookup(PDFName.of(name)), resources, depth + 1);
+}
+
+function classify(colorSpace: unknown, resources: PDFDict | undefined, depth = 0): ColorUse {
+  const none: ColorUse = { kind: 'other', spots: [] };
+  if (colorSpace instanceof PDFName) {
+    const name = colorSpace.decodeText();
+    if (name === 'DeviceGray' || name === 'G') return { kind: 'gray', spots: [] };
+    if (name === 'DeviceRGB' || name === 'RGB') return { kind: 'rgb', spots: [] };
+    if (name === 'DeviceCMYK' || name === 'CMYK') return { kind: 'cmyk', spots: [] };
+    // Other names refer to the ColorSpace resources
+    return depth < 4 && name !== 'Pattern' ? namedColorSpace(name, resources, depth) : none;
+  }
+  if (!(colorSpace instanceof PDFArray) || depth > 4) return none;
+
+  const family = colorSpace.lookup(0);
+  switch (family instanceof PDFName ? family.decodeText() : undefined) {
+    case 'CalGray':
+      return { kind: 'gray', spots: [] };
+    case 'CalRGB':
+      return { kind: 'rgb', spots: [] };
+    case 'ICCBased': {
+      const profile = colorSpace.lookup(1);
+      const components = profile instanceof PDFStream ? lookupNumber(profile.dict, 'N') : undefined;
+      return components === 1 ? { kind: 'gray', spots: [] }
+        : components === 3 ? { kind: 'rgb', spots: [] }
+          : components === 4 ? { kind: 'cmyk', spots: [] }
+            : none;
+    }
+    case 'Indexed':
+    case 'Pattern':
+      return colorSpace.size() > 1 ? classify(colorSpace.lookup(1), resources, depth + 1) : none;
+    case 'Separation': {
+      const colorant = colorSpace.lookup(1);
+      const name = colorant instanceof PDFName ? colorant.decodeText() : undefined;
+      return name && !PROCESS_COLORANTS.has(name) ? { kind: 'spot', spots: [name] } : { kind: 'cmyk', spots: [] };
+    }
+    case 'DeviceN': {
+      const colorants = colorSpace.lookup(1);
+      const names = colorants instanceof PDFArray
+        ? colorants.asArray().flatMap(item => (item instanceof PDFName ? [item.decodeText()] : []))
+        : [];
+      const spots = names.filter(name => !PROCESS_COLORANTS.has(name));
+      return spots.length > 0 ? { kind: 'spot', spots } : { kind: 'cmyk', spots: [] };
+    }
+    default:
+      return none;
+  }
+}
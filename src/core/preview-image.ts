@@ -0,0 +1,102 @@
+/**
+ * Preview image lookup
+ *
+ * Scanned documents are usually one large image per page, so the biggest
+ * image on the first page makes a cheap thumbnail without rendering.
+ */
+
+import { PDFArray, PDFBool, PDFDict, PDFDocument, PDFName, PDFRawStream, PDFStream } from 'pdf-lib';
+import type { PreviewImage } from '../api/types';
+import { decodeOuterFilters, decodeStreamContents, getFilters, lookupDict, lookupName, lookupNumber } from './pdf-objects';
+
+/** Images smaller than this on either side are icons or decoration */
+const MIN_IMAGE_SIDE = 32;
+
+/**
+ * Returns the largest usable image on the first page that has one
+ *
+ * Images whose data can't be extracted (JBIG2, CCITT, predictor-encoded
+ * samples) are passed over in favor of the next largest.
+ */
+export function findPreviewImage(pdfDoc: PDFDocument): PreviewImage | null {
+  const pages = pdfDoc.getPages();
+
+  for (let index = 0; index < pages.length; index++) {
+    const images = new Set<PDFRawStream>();
+    collectImages(pages[index].node.Resources(), images, new Set());
+
+    const candidates = [...images]
+      .map(stream => ({
+        stream,
+        width: lookupNumber(stream.dict, 'Width') ?? 0,
+        height: lookupNumber(stream.dict, 'Height') ?? 0,
+      }))
+      .filter(({ width, height }) => width >= MIN_IMAGE_SIDE && height >= MIN_IMAGE_SIDE)
+      .sort((a, b) => b.width * b.height - a.width * a.height);
+
+    for (const { stream, width, height } of candidates) {
+      const image = extractImage(stream, width, height);
+      if (image) return { page: index + 1, ...image };
+    }
+  }
+
+  return null;
+}
+
+/**
+ * Collects image XObjects from a resource dictionary and the forms it uses
+ */
+function collectImages(resources: PDFDict | undefined, images: Set<PDFRawStream>, visited: Set<PDFDict>): void {
+  const xObjects = resources && lookupDict(resources, 'XObject');
+  if (!xObjects || visited.has(xObjects)) return;
+  visited.add(xObjects);
+
+  for (const [name] of xObjects.entries()) {
+    const xObject = xObjects.lookup(name);
+    if (!(xObject instanceof PDFStream)) continue;
+
+    const subtype = lookupName(xObject.dict, 'Subtype');
+    if (subtype === 'Image' && xObject instanceof PDFRawStream) {
+      // Stencil masks have no colors of their own
+      if (xObject.dict.lookup(PDFName.of('ImageMask')) !== PDFBool.True) images.add(xObject);
+    } else if (subtype === 'Form') {
+      collectImages(lookupDict(xObject.dict, 'Resources'), images, visited);
+    }
+  }
+}
+
+function extractImage(stream: PDFRawStream, width: number, height: number): Omit<PreviewImage, 'page'> | undefined {
+  const filters = getFilters(stream.dict);
+  const last = filters[filters.length - 1];
+
+  // Image codecs: strip any outer filters and return the encoded file
+  if (last === 'DCTDecode' || last === 'JPXDecode') {
+    const data = filters.length === 1 ? stream.contents : decodeOuterFilters(stream, filters.length - 1);
+    return data && { width, height, format: last === 'DCTDecode' ? 'jpeg' : 'jpeg2000', data };
+  }
+
+  const parms = stream.dict.lookup(PDFName.of('DecodeParms'));
+  if (parms instanceof PDFDict && (lookupNumber(parms, 'Predictor') ?? 1) > 1) return undefined;
+
+  const data = decodeStreamContents(stream);
+  if (!data) return undefined;
+
+  return {
+    width,
+    height,
+    format: 'raw',
+    data,
+    colorSpace: readColorSpaceName(stream.dict),
+    bitsPerComponent: lookupNumber(stream.dict, 'BitsPerComponent'),
+  };
+}
+
+function readColorSpaceName(dict: PDFDict): string | undefined {
+  const colorSpace = dict.lookup(PDFName.of('ColorSpace'));
+  if (colorSpace instanceof PDFName) return colorSpace.decodeText();
+  if (colorSpace instanceof PDFArray) {
+    const family = colorSpace.lookup(0);
+    return family instanceof PDFName ? family.decodeText() : undefined;
+  }
+  return undefined;
+}
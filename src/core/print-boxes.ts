@@ -0,0 +1,325 @@
+/**
+ * Page box normalization for print imposition
+ */
+
+import { PDFArray, PDFDict, PDFName, PDFNumber, PDFPage, PDFStream, degrees } from 'pdf-lib';
+import type { PageBoxName, PageBoxChange, TrimSize } from '../api/types';
+import { contains, toRect, TOLERANCE } from './boxes';
+import type { Rect } from './boxes';
+import { multiplyMatrix } from './page-analysis';
+import type { Matrix } from './page-analysis';
+import { getPageRotation, prependContent } from './pages';
+
+/** Trim sizes within this many points count as the same size */
+const SIZE_TOLERANCE = 0.5;
+
+/** Annotation flag: keep the appearance upright when the page is rotated */
+const NO_ROTATE = 1 << 4;
+
+const BOX_NAMES = ['MediaBox', 'CropBox', 'BleedBox', 'TrimBox', 'ArtBox'] as const;
+
+/**
+ * Outcome of normalizing one page
+ */
+export interface PageNormalizeResult {
+  changes: PageBoxChange[];
+  /** Set if the page could not be normalized */
+  failure?: string;
+  /** Displayed trim size after normalization */
+  trimSize?: TrimSize;
+}
+
+/**
+ * Gives a page a valid TrimBox and BleedBox inside a MediaBox at the origin
+ *
+ * @param bleed - Bleed margin (points) for derived BleedBoxes
+ * @param targetTrim - Displayed trim size to enforce, centered on the current trim
+ */
+export function normalizePageBoxes(page: PDFPage, bleed: number, targetTrim?: TrimSize): PageNormalizeResult {
+  const changes: PageBoxChange[] = [];
+  const mediaArray = page.node.MediaBox();
+  let media = mediaArray && toRect(mediaArray);
+  if (!media || !hasArea(media)) {
+    return { changes, failure: 'MediaBox is missing or invalid' };
+  }
+
+  // Move the origin to 0,0; some imposition tools assume it
+  if (Math.abs(media.left) > TOLERANCE || Math.abs(media.bottom) > TOLERANCE) {
+    shiftPage(page, -media.left, -media.bottom);
+    changes.push({ box: 'MediaBox', action: 'origin-aligned' });
+    media = toRect(page.node.MediaBox())!;
+  }
+
+  // Drop malformed boxes and clamp the rest to the media box
+  const boxes: Partial<Record<PageBoxName, Rect>> = {};
+  for (const name of ['CropBox', 'BleedBox', 'TrimBox', 'ArtBox'] as const) {
+    const array = page.node[name]();
+    if (!array) continue;
+
+    const rect = toRect(array);
+    const clamped = rect && intersect(rect, media);
+    if (!clamped) {
+      page.node.delete(PDFName.of(name));
+      // An inherited CropBox can't be deleted here, so override it
+      if (name === 'CropBox' && page.node.CropBox()) setBox(page, 'CropBox', media);
+      changes.push({ box: name, action: 'removed' });
+    } else {
+      if (!contains(media, rect!)) {
+        setBox(page, name, clamped);
+        changes.push({ box: name, action: 'clamped' });
+      }
+      boxes[name] = clamped;
+    }
+  }
+
+  const crop = boxes.CropBox ?? media;
+
+  let trim = boxes.TrimBox;
+  if (!trim) {
+    trim = crop;
+    setBox(page, 'TrimBox', trim);
+    changes.push({ box: 'TrimBox', action: 'added' });
+  } else if (!contains(crop, trim)) {
+    trim = intersect(trim, crop) ?? crop;
+    setBox(page, 'TrimBox', trim);
+    changes.push({ box: 'TrimBox', action: 'clamped' });
+  }
+
+  const rotated = getPageRotation(page) % 180 !== 0;
+  if (targetTrim) {
+    // Target size is in displayed orientation
+    const width = rotated ? targetTrim.height : targetTrim.width;
+    const height = rotated ? targetTrim.width : targetTrim.height;
+
+    if (
+      Math.abs(trim.right - trim.left - width) > SIZE_TOLERANCE ||
+      Math.abs(trim.top - trim.bottom - height) > SIZE_TOLERANCE
+    ) {
+      const centerX = (trim.left + trim.right) / 2;
+      const centerY = (trim.bottom + trim.top) / 2;
+      const resized = {
+        left: centerX - width / 2,
+        bottom: centerY - height / 2,
+        right: centerX + width / 2,
+        top: centerY + height / 2,
+      };
+      if (!contains(media, resized)) {
+        return { changes, failure: 'Target trim size does not fit within the MediaBox' };
+      }
+      trim = resized;
+      setBox(page, 'TrimBox', trim);
+      changes.push({ box: 'TrimBox', action: 'resized' });
+    }
+  }
+
+  const bleedBox = boxes.BleedBox;
+  if (!bleedBox) {
+    const derived = intersect(expand(trim, bleed), media)!;
+    setBox(page, 'BleedBox', derived);
+    changes.push({ box: 'BleedBox', action: 'added' });
+  } else if (!contains(bleedBox, trim)) {
+    setBox(page, 'BleedBox', union(bleedBox, trim));
+    changes.push({ box: 'BleedBox', action: 'expanded' });
+  }
+
+  const trimWidth = trim.right - trim.left;
+  const trimHeight = trim.top - trim.bottom;
+  return {
+    changes,
+    trimSize: rotated
+      ? { width: trimHeight, height: trimWidth }
+      : { width: trimWidth, height: trimHeight },
+  };
+}
+
+/**
+ * Whether two trim sizes match within tolerance
+ */
+export function sameTrimSize(a: TrimSize, b: TrimSize): boolean {
+  return Math.abs(a.width - b.width) <= SIZE_TOLERANCE && Math.abs(a.height - b.height) <= SIZE_TOLERANCE;
+}
+
+/**
+ * Bakes a page's rotation into its content, so it is upright without a
+ * Rotate entry and looks the same
+ *
+ * Imposition tools often place pages as form XObjects, which ignore
+ * Rotate, so rotated pages would end up sideways. Content, boxes and
+ * annotations are turned together; the MediaBox ends up at the origin.
+ *
+ * @returns The rotation removed, or 0 if the page was already upright
+ *   or its MediaBox is invalid
+ */
+export function uprightPage(page: PDFPage): number {
+  const rotation = getPageRotation(page);
+  const mediaArray = page.node.MediaBox();
+  const media = mediaArray && toRect(mediaArray);
+  if (rotation % 90 !== 0 || rotation === 0 || !media || !hasArea(media)) return 0;
+
+  const { left, bottom, right, top } = media;
+  // Maps unrotated user space to the displayed (clockwise-rotated) page
+  const matrix: Matrix =
+    rotation === 90 ? [0, -1, 1, 0, -bottom, right]
+    : rotation === 180 ? [-1, 0, 0, -1, right, top]
+    : [0, 1, -1, 0, top, -left];
+
+  transformPage(page, matrix);
+  page.setRotation(degrees(0));
+  return rotation;
+}
+
+/**
+ * Translates a page's boxes, content and annotations
+ */
+function shiftPage(page: PDFPage, dx: number, dy: number): void {
+  transformPage(page, [1, 0, 0, 1, dx, dy]);
+}
+
+/**
+ * Transforms a page's boxes, content and annotations by a matrix that
+ * keeps boxes axis-aligned (translations and quarter turns)
+ */
+function transformPage(page: PDFPage, matrix: Matrix): void {
+  // Read every box before changing any, since the MediaBox may be inherited
+  const boxes = BOX_NAMES
+    .map(name => [name, page.node[name]()] as const)
+    .map(([name, array]) => [name, array && toRect(array)] as const);
+  for (const [name, rect] of boxes) {
+    if (rect) setBox(page, name, transformRect(rect, matrix));
+  }
+
+  prependContent(page, `${matrix.join(' ')} cm\n`);
+
+  const annots = page.node.Annots();
+  if (!annots) return;
+  const turns = matrix[1] !== 0 || matrix[0] !== 1 || matrix[3] !== 1;
+  const turned = new Set<PDFStream>();
+  for (let i = 0; i < annots.size(); i++) {
+    const annot = annots.lookup(i);
+    if (!(annot instanceof PDFDict)) continue;
+
+    const flags = annot.lookup(PDFName.of('F'));
+    const noRotate = turns && flags instanceof PDFNumber && (flags.asNumber() & NO_ROTATE) !== 0;
+    const rectArray = annot.lookup(PDFName.of('Rect'));
+    const rect = rectArray instanceof PDFArray ? toRect(rectArray) : undefined;
+    if (rect && noRotate) {
+      // Upright annotations stay pinned at their upper-left corner
+      const [x, y] = transformPoint(rect.left, rect.top, matrix);
+      const width = rect.right - rect.left;
+      const height = rect.top - rect.bottom;
+      annot.set(PDFName.of('Rect'), page.doc.context.obj([x, y - height, x + width, y]));
+    } else if (rect) {
+      const { left, bottom, right, top } = transformRect(rect, matrix);
+      annot.set(PDFName.of('Rect'), page.doc.context.obj([left, bottom, right, top]));
+    }
+
+    for (const key of ['QuadPoints', 'Vertices', 'L', 'InkList']) {
+      const value = annot.lookup(PDFName.of(key));
+      if (value instanceof PDFArray) transformCoordinates(value, matrix);
+    }
+    // Appearances are fitted into Rect, so they only need turning
+    if (turns && !noRotate) turnAppearances(annot, [matrix[0], matrix[1], matrix[2], matrix[3], 0, 0], turned);
+  }
+}
+
+/**
+ * Applies a rotation to every appearance stream of an annotation, once
+ * per stream even if annotations share it
+ */
+function turnAppearances(annot: PDFDict, rotation: Matrix, turned: Set<PDFStream>): void {
+  const appearances = annot.lookup(PDFName.of('AP'));
+  if (!(appearances instanceof PDFDict)) return;
+
+  for (const key of ['N', 'R', 'D']) {
+    const entry = appearances.lookup(PDFName.of(key));
+    // An appearance is a stream, or a dictionary of streams per state
+    const streams = entry instanceof PDFStream
+      ? [entry]
+      : entry instanceof PDFDict
+        ? entry.keys().map(state => entry.lookup(state)).filter((value): value is PDFStream => value instanceof PDFStream)
+        : [];
+    for (const stream of streams) {
+      if (turned.has(stream)) continue;
+      turned.add(stream);
+      const existing = stream.dict.lookup(PDFName.of('Matrix'));
+      const values = existing instanceof PDFArray ? existing.asArray().map(item => stream.dict.context.lookup(item)) : [];
+      const current: Matrix = values.length === 6 && values.every(value => value instanceof PDFNumber)
+        ? (values.map(value => (value as PDFNumber).asNumber()) as Matrix)
+        : [1, 0, 0, 1, 0, 0];
+      stream.dict.set(PDFName.of('Matrix'), stream.dict.context.obj(multiplyMatrix(current, rotation)));
+    }
+  }
+}
+
+/**
+ * Transforms x,y pairs in place (recursing into nested arrays such as InkList)
+ */
+function transformCoordinates(array: PDFArray, matrix: Matrix): void {
+  for (let i = 0; i < array.size(); i++) {
+    const value = array.lookup(i);
+    if (value instanceof PDFArray) {
+      transformCoordinates(value, matrix);
+      continue;
+    }
+    const next = i + 1 < array.size() ? array.lookup(i + 1) : undefined;
+    if (value instanceof PDFNumber && next instanceof PDFNumber) {
+      const [x, y] = transformPoint(value.asNumber(), next.asNumber(), matrix);
+      array.set(i, PDFNumber.of(x));
+      array.set(i + 1, PDFNumber.of(y));
+      i++;
+    }
+  }
+}
+
+function transformPoint(x: number, y: number, matrix: Matrix): [number, number] {
+  const [a, b, c, d, e, f] = matrix;
+  return [a * x + c * y + e, b * x + d * y + f];
+}
+
+function transformRect(rect: Rect, matrix: Matrix): Rect {
+  const [x1, y1] = transformPoint(rect.left, rect.bottom, matrix);
+  const [x2, y2] = transformPoint(rect.right, rect.top, matrix);
+  return {
+    left: Math.min(x1, x2),
+    bottom: Math.min(y1, y2),
+    right: Math.max(x1, x2),
+    top: Math.max(y1, y2),
+  };
+}
+
+function setBox(page: PDFPage, name: PageBoxName, rect: Rect): void {
+  const { left, bottom, right, top } = rect;
+  page.node.set(PDFName.of(name), page.doc.context.obj([left, bottom, right, top]));
+}
+
+function hasArea(rect: Rect): boolean {
+  return rect.right - rect.left > TOLERANCE && rect.top - rect.bottom > TOLERANCE;
+}
+
+function intersect(a: Rect, b: Rect): Rect | undefined {
+  const rect = {
+    left: Math.max(a.left, b.left),
+    bottom: Math.max(a.bottom, b.bottom),
+    right: Math.min(a.right, b.right),
+    top: Math.min(a.top, b.top),
+  };
+  return hasArea(rect) ? rect : undefined;
+}
+
+function union(a: Rect, b: Rect): Rect {
+  return {
+    left: Math.min(a.left, b.left),
+    bottom: Math.min(a.bottom, b.bottom),
+    right: Math.max(a.right, b.right),
+    top: Math.max(a.top, b.top),
+  };
+}
+
+function expand(rect: Rect, margin: number): Rect {
+  return {
+    left: rect.left - margin,
+    bottom: rect.bottom - margin,
+    right: rect.right + margin,
+    top: rect.top + margin,
+  };
+}
@@ -0,0 +1,64 @@
+/**
+ * Processed-file marker
+ *
+ * Records in Info and XMP that this library produced a file, so pipelines
+ * can recognize their own output and skip it.
+ */
+
+import { PDFDocument, PDFName, PDFString } from 'pdf-lib';
+import type { ProcessedMarker } from '../api/types';
+import { ensureInfoDict, getInfoDict, lookupText } from './pdf-objects';
+import { getXmpValue, readXmp, setXmpValue, writeXmp } from './xmp';
+
+/** Keep in sync with package.json */
+export const LIBRARY_NAME = '@quicktoolsone/pdf-compress';
+export const LIBRARY_VERSION = '2.0.0';
+
+export const DEFAULT_MARKER_KEY = 'PdfCompressProcessed';
+
+/** XMP namespace of the marker property */
+export const MARKER_NS = 'https://quicktools.one/ns/pdf-compress/1.0/';
+const MARKER_PREFIX = 'qtpc';
+
+/** "<tool>/<version>; <ISO timestamp>" */
+const MARKER_PATTERN = /^(.+)\/(\S+); (.+)$/;
+
+/**
+ * Whether a key can be used both as a PDF name and an XML element name
+ */
+export function isValidMarkerKey(key: string): boolean {
+  return /^[A-Za-z_][\w.-]*$/.test(key);
+}
+
+export function createMarker(key: string): ProcessedMarker {
+  return { key, tool: LIBRARY_NAME, version: LIBRARY_VERSION, timestamp: new Date() };
+}
+
+/**
+ * Writes the marker to the Info dictionary and, when the document has an
+ * XMP packet, to XMP as well
+ */
+export function writeMarker(pdfDoc: PDFDocument, marker: ProcessedMarker): void {
+  const value = `${marker.tool}/${marker.version}; ${marker.timestamp.toISOString()}`;
+  ensureInfoDict(pdfDoc).set(PDFName.of(marker.key), PDFString.of(value));
+
+  const xmp = readXmp(pdfDoc);
+  if (xmp) writeXmp(pdfDoc, setXmpValue(xmp, `${MARKER_PREFIX}:${marker.key}`, MARKER_NS, value));
+}
+
+/**
+ * Reads the marker from Info, falling back to XMP
+ */
+export function readMarker(pdfDoc: PDFDocument, key: string): ProcessedMarker | null {
+  const info = getInfoDict(pdfDoc);
+  const xmp = readXmp(pdfDoc);
+  const value = (info && lookupText(info, key)) ?? (xmp && getXmpValue(xmp, `${MARKER_PREFIX}:${key}`));
+  if (!value) return null;
+
+  const match = MARKER_PATTERN.exec(value);
+  if (!match) return null;
+  const timestamp = new Date(match[3]);
+  if (Number.isNaN(timestamp.getTime())) return null;
+
+  return { key, tool: match[1], version: match[2], timestamp };
+}
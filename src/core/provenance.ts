@@ -0,0 +1,239 @@
+/**
+ * Provenance metadata
+ *
+ * Reads who created and modified a document from both the Info dictionary
+ * and XMP, and flags where the two disagree. Dates can also be written to
+ * both.
+ */
+
+import { PDFBool, PDFDocument, PDFName, PDFString } from 'pdf-lib';
+import type { CreationInfo, CreationInfoDiscrepancy, ProducerChain, ProducerHistoryEntry } from '../api/types';
+import { ensureInfoDict, getInfoDict, lookupText, parsePdfDate } from './pdf-objects';
+import { getXmpValue, parseXmpDate, readXmp, setXmpValue, writeXmp } from './xmp';
+
+const XMP_BASIC_NS = 'http://ns.adobe.com/xap/1.0/';
+
+/**
+ * Dates closer than this are considered equal (XMP often drops sub-second
+ * precision and writers round differently)
+ */
+const DATE_TOLERANCE_MS = 1000;
+
+/**
+ * Reads Info and XMP provenance and reconciles them
+ */
+export function readCreationInfo(pdfDoc: PDFDocument): CreationInfo {
+  const info = getInfoDict(pdfDoc);
+  const infoDate = (key: string) => {
+    const value = info && lookupText(info, key);
+    return value ? parsePdfDate(value) : undefined;
+  };
+
+  const result: CreationInfo = {
+    producer: info && lookupText(info, 'Producer'),
+    creator: info && lookupText(info, 'Creator'),
+    creationDate: infoDate('CreationDate'),
+    modDate: infoDate('ModDate'),
+    trapped: info && readTrapped(info.lookup(PDFName.of('Trapped'))),
+    hasXmp: false,
+    discrepancies: [],
+  };
+
+  const xmp = readXmp(pdfDoc);
+  if (!xmp) return result;
+
+  const xmpDate = (property: string) => {
+    const value = getXmpValue(xmp, property);
+    return value ? parseXmpDate(value) : undefined;
+  };
+
+  result.hasXmp = true;
+  result.xmp = {
+    creatorTool: getXmpValue(xmp, 'xmp:CreatorTool'),
+    producer: getXmpValue(xmp, 'pdf:Producer'),
+    createDate: xmpDate('xmp:CreateDate'),
+    modifyDate: xmpDate('xmp:ModifyDate'),
+    metadataDate: xmpDate('xmp:MetadataDate'),
+    trapped: getXmpValue(xmp, 'pdf:Trapped'),
+  };
+
+  const discrepancies: CreationInfoDiscrepancy[] = [];
+  compareText(discrepancies, 'producer', result.producer, result.xmp.producer);
+  compareText(discrepancies, 'creator', result.creator, result.xmp.creatorTool);
+  compareText(discrepancies, 'trapped', result.trapped, result.xmp.trapped);
+  compareDate(discrepancies, 'creationDate', result.creationDate, result.xmp.createDate);
+  compareDate(discrepancies, 'modDate', result.modDate, result.xmp.modifyDate);
+  result.discrepancies = discrepancies;
+
+  return result;
+}
+
+/**
+ * Reads the producer and creator from Info and XMP, with the XMP edit
+ * history
+ */
+export function readProducerChain(pdfDoc: PDFDocument): ProducerChain {
+  const info = getInfoDict(pdfDoc);
+  const chain: ProducerChain = {
+    producer: info && lookupText(info, 'Producer'),
+    creator: info && lookupText(info, 'Creator'),
+    history: [],
+  };
+
+  const xmp = readXmp(pdfDoc);
+  if (!xmp) return chain;
+
+  chain.xmpProducer = getXmpValue(xmp, 'pdf:Producer');
+  chain.creatorTool = getXmpValue(xmp, 'xmp:CreatorTool');
+  chain.history = readXmpHistory(xmp);
+  return chain;
+}
+
+/**
+ * Reads xmpMM:History events in the order written (oldest first)
+ *
+ * Event fields may be attributes of each rdf:li or child elements.
+ * Events without an action are skipped.
+ */
+function readXmpHistory(xmp: string): ProducerHistoryEntry[] {
+  const history = /<xmpMM:History(?:\s[^>]*)?>([\s\S]*?)<\/xmpMM:History>/.exec(xmp);
+  if (!history) return [];
+
+  const entries: ProducerHistoryEntry[] = [];
+  const items = /<rdf:li\b[^>]*?(?:\/>|>[\s\S]*?<\/rdf:li>)/g;
+  let item: RegExpExecArray | null;
+  while ((item = items.exec(history[1])) !== null) {
+    const event = item[0];
+    const action = getXmpValue(event, 'stEvt:action');
+    if (!action) continue;
+
+    const when = getXmpValue(event, 'stEvt:when');
+    entries.push({
+      action,
+      software: getXmpValue(event, 'stEvt:softwareAgent'),
+      when: when ? parseXmpDate(when) : undefined,
+      changed: getXmpValue(event, 'stEvt:changed'),
+      parameters: getXmpValue(event, 'stEvt:parameters'),
+    });
+  }
+  return entries;
+}
+
+/**
+ * A date and time as written, with its UTC offset in minutes (0 when the
+ * input had none, matching how zoneless dates are read)
+ */
+export interface ZonedDate {
+  year: number;
+  month: number;
+  day: number;
+  hour: number;
+  minute: number;
+  second: number;
+  offset: number;
+}
+
+/**
+ * Parses an ISO 8601 date or date-time, rejecting impossible dates
+ */
+export function parseIsoDate(value: string): ZonedDate | undefined {
+  const match = /^(\d{4})-(\d{2})-(\d{2})(?:T(\d{2}):(\d{2})(?::(\d{2})(?:\.\d+)?)?)?(Z|([+-])(\d{2}):?(\d{2}))?$/.exec(value.trim());
+  if (!match) return undefined;
+
+  const [, year, month, day, hour = '0', minute = '0', second = '0', , sign, offsetHours = '0', offsetMinutes = '0'] = match;
+  const date: ZonedDate = {
+    year: +year,
+    month: +month,
+    day: +day,
+    hour: +hour,
+    minute: +minute,
+    second: +second,
+    offset: (sign === '-' ? -1 : 1) * (+offsetHours * 60 + +offsetMinutes),
+  };
+
+  // Date.UTC rolls over out-of-range fields; a valid date survives unchanged
+  const check = new Date(Date.UTC(date.year, date.month - 1, date.day, date.hour, date.minute, date.second));
+  const valid =
+    check.getUTCFullYear() === date.year &&
+    check.getUTCMonth() === date.month - 1 &&
+    check.getUTCDate() === date.day &&
+    check.getUTCHours() === date.hour &&
+    check.getUTCMinutes() === date.minute &&
+    check.getUTCSeconds() === date.second &&
+    +offsetHours <= 14 &&
+    +offsetMinutes < 60;
+  return valid ? date : undefined;
+}
+
+/**
+ * Writes CreationDate and/or ModDate to the Info dictionary and, when the
+ * document has an XMP packet, to xmp:CreateDate and xmp:ModifyDate
+ */
+export function setDocumentDates(pdfDoc: PDFDocument, creationDate?: ZonedDate, modDate?: ZonedDate): void {
+  const info = ensureInfoDict(pdfDoc);
+  if (creationDate) info.set(PDFName.of('CreationDate'), PDFString.of(formatPdfDate(creationDate)));
+  if (modDate) info.set(PDFName.of('ModDate'), PDFString.of(formatPdfDate(modDate)));
+
+  const xmp = readXmp(pdfDoc);
+  if (!xmp) return;
+
+  let updated = xmp;
+  if (creationDate) updated = setXmpValue(updated, 'xmp:CreateDate', XMP_BASIC_NS, formatXmpDate(creationDate));
+  if (modDate) updated = setXmpValue(updated, 'xmp:ModifyDate', XMP_BASIC_NS, formatXmpDate(modDate));
+  writeXmp(pdfDoc, updated);
+}
+
+/**
+ * D:YYYYMMDDHHmmSS followed by Z or the offset as +HH'mm'
+ */
+function formatPdfDate(date: ZonedDate): string {
+  const zone = date.offset === 0
+    ? 'Z'
+    : `${date.offset < 0 ? '-' : '+'}${pad(Math.floor(Math.abs(date.offset) / 60))}'${pad(Math.abs(date.offset) % 60)}'`;
+  return `D:${date.year}${pad(date.month)}${pad(date.day)}${pad(date.hour)}${pad(date.minute)}${pad(date.second)}${zone}`;
+}
+
+/**
+ * YYYY-MM-DDTHH:mm:ss followed by Z or the offset as +HH:mm
+ */
+function formatXmpDate(date: ZonedDate): string {
+  const zone = date.offset === 0
+    ? 'Z'
+    : `${date.offset < 0 ? '-' : '+'}${pad(Math.floor(Math.abs(date.offset) / 60))}:${pad(Math.abs(date.offset) % 60)}`;
+  return `${date.year}-${pad(date.month)}-${pad(date.day)}T${pad(date.hour)}:${pad(date.minute)}:${pad(date.second)}${zone}`;
+}
+
+function pad(value: number): string {
+  return String(value).padStart(2, '0');
+}
+
+function readTrapped(value: unknown): string | undefined {
+  if (value instanceof PDFName) return value.decodeText();
+  if (value instanceof PDFBool) return value.asBoolean() ? 'True' : 'False';
+  return undefined;
+}
+
+function compareText(
+  discrepancies: CreationInfoDiscrepancy[],
+  field: CreationInfoDiscrepancy['field'],
+  info: string | undefined,
+  xmp: string | undefined
+): void {
+  // A value present on only one side is incomplete, not contradictory
+  if (info === undefined || xmp === undefined) return;
+  if (info.trim() !== xmp.trim()) {
+    discrepancies.push({ field, info, xmp });
+  }
+}
+
+function compareDate(
+  discrepancies: CreationInfoDiscrepancy[],
+  field: CreationInfoDiscrepancy['field'],
+  info: Date | undefined,
+  xmp: Date | undefined
+): void {
+  if (!info || !xmp) return;
+  if (Math.abs(info.getTime() - xmp.getTime()) > DATE_TOLERANCE_MS) {
+    discrepancies.push({ field, info: info.toISOString(), xmp: xmp.toISOString() });
+  }
+}
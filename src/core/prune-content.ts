@@ -0,0 +1,73 @@
+/**
+ * Empty content pruning
+ *
+ * Removes content streams that draw nothing and leave no state behind,
+ * and optionally the pages left without visible content.
+ */
+
+import { PDFArray, PDFDocument, PDFName, PDFStream } from 'pdf-lib';
+import type { PruneReport } from '../api/types';
+import { isNoOpContent, parseContentStream } from './content-stream';
+import { decodeStreamContents } from './pdf-objects';
+
+/**
+ * Prunes no-op content streams and, when asked, empty pages
+ *
+ * @param removeEmptyPages - Remove pages whose content was entirely no-op
+ * @param removeBlankLayout - Also remove pages that never had content
+ *   (blank pages placed deliberately, e.g. to start chapters on a right page)
+ */
+export function pruneEmptyContent(
+  pdfDoc: PDFDocument,
+  removeEmptyPages: boolean,
+  removeBlankLayout: boolean
+): PruneReport {
+  const contentsKey = PDFName.of('Contents');
+  let emptyStreamsRemoved = 0;
+  const blankPages: number[] = [];
+
+  pdfDoc.getPages().forEach((page, index) => {
+    const contents = page.node.Contents();
+    const hadContent = contents !== undefined;
+
+    if (contents instanceof PDFArray) {
+      for (let i = contents.size() - 1; i >= 0; i--) {
+        const stream = contents.lookup(i);
+        if (stream instanceof PDFStream && isEmptyStream(stream)) {
+          contents.remove(i);
+          emptyStreamsRemoved++;
+        }
+      }
+      if (contents.size() === 0) page.node.delete(contentsKey);
+    } else if (contents instanceof PDFStream && isEmptyStream(contents)) {
+      page.node.delete(contentsKey);
+      emptyStreamsRemoved++;
+    }
+
+    const isBlank = !page.node.has(contentsKey) && !hasAnnotations(page.node.Annots());
+    if (isBlank && (hadContent ? removeEmptyPages : removeBlankLayout)) {
+      blankPages.push(index);
+    }
+  });
+
+  // Never remove every page; a PDF needs at least one
+  const pagesRemoved = blankPages.length < pdfDoc.getPageCount() ? blankPages : blankPages.slice(1);
+  for (let i = pagesRemoved.length - 1; i >= 0; i--) {
+    pdfDoc.removePage(pagesRemoved[i]);
+  }
+
+  return {
+    emptyStreamsRemoved,
+    pagesRemoved: pagesRemoved.map(index => index + 1),
+  };
+}
+
+function isEmptyStream(stream: PDFStream): boolean {
+  const bytes = decodeStreamContents(stream);
+  // Keep anything we can't read
+  return bytes !== undefined && isNoOpContent(parseContentStream(bytes));
+}
+
+function hasAnnotations(annots: PDFArray | undefined): boolean {
+  return annots !== undefined && annots.size() > 0;
+}
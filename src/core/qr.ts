@@ -0,0 +1,418 @@
+/**
+ * QR code encoder (ISO/IEC 18004)
+ *
+ * Byte mode only, which covers any UTF-8 payload; versions 1-40 and all
+ * four error correction levels. The mask is chosen by the standard
+ * penalty rules.
+ */
+
+import type { QrErrorCorrection } from '../api/types';
+
+/** Error correction codewords per block, by level then version */
+const ECC_CODEWORDS_PER_BLOCK: Record<QrErrorCorrection, number[]> = {
+  L: [-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30],
+  M: [-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28],
+  Q: [-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30],
+  H: [-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30],
+};
+
+/** Error correction blocks, by level then version */
+const ECC_BLOCKS: Record<QrErrorCorrection, number[]> = {
+  L: [-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25],
+  M: [-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49],
+  Q: [-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68],
+  H: [-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81],
+};
+
+/** Level indicator in the format information */
+const FORMAT_BITS: Record<QrErrorCorrection, number> = { L: 1, M: 0, Q: 3, H: 2 };
+
+export const MIN_QR_VERSION = 1;
+export const MAX_QR_VERSION = 40;
+
+/**
+ * Encoded symbol
+ */
+export interface QrCode {
+  version: number;
+  /** Modules per side, without the quiet zone */
+  size: number;
+  /** modules[y][x], true for dark */
+  modules: boolean[][];
+}
+
+/**
+ * Smallest version that holds the data at the given level
+ *
+ * @returns The version, or undefined if the data doesn't fit in version 40
+ */
+export function qrVersionFor(data: Uint8Array, level: QrErrorCorrection): number | undefined {
+  for (let version = MIN_QR_VERSION; version <= MAX_QR_VERSION; version++) {
+    if (dataBitLength(data, version) <= dataCodewords(version, level) * 8) return version;
+  }
+  return undefined;
+}
+
+/**
+ * Encodes data as a QR code
+ *
+ * @param minVersion - Use at least this version, so a batch of codes can
+ *   share one size
+ * @throws If the data doesn't fit in version 40
+ */
+export function encodeQr(data: Uint8Array, level: QrErrorCorrection, minVersion = MIN_QR_VERSION): QrCode {
+  const needed = qrVersionFor(data, level);
+  if (needed === undefined) {
+    throw new Error(`QR payload of ${data.length} bytes is too long for error correction level ${level}`);
+  }
+  const version = Math.max(needed, minVersion);
+  const capacity = dataCodewords(version, level);
+
+  // Mode indicator, character count, data, terminator, padding
+  const bits: number[] = [];
+  appendBits(bits, 0b0100, 4);
+  appendBits(bits, data.length, version <= 9 ? 8 : 16);
+  for (const byte of data) appendBits(bits, byte, 8);
+  appendBits(bits, 0, Math.min(4, capacity * 8 - bits.length));
+  appendBits(bits, 0, (8 - (bits.length % 8)) % 8);
+
+  const codewords: number[] = [];
+  for (let i = 0; i < bits.length; i += 8) {
+    codewords.push(bits.slice(i, i + 8).reduce((byte, bit) => (byte << 1) | bit, 0));
+  }
+  for (let pad = 0xec; codewords.length < capacity; pad ^= 0xec ^ 0x11) codewords.push(pad);
+
+  const symbol = new QrSymbol(version);
+  symbol.drawFunctionPatterns();
+  symbol.drawCodewords(addErrorCorrection(codewords, version, level));
+
+  let best = 0;
+  let lowest = Infinity;
+  for (let mask = 0; mask < 8; mask++) {
+    symbol.applyMask(mask);
+    symbol.drawFormatBits(level, mask);
+    const penalty = symbol.penalty();
+    if (penalty < lowest) {
+      best = mask;
+      lowest = penalty;
+    }
+    symbol.applyMask(mask);
+  }
+  symbol.applyMask(best);
+  symbol.drawFormatBits(level, best);
+
+  return { version, size: symbol.size, modules: symbol.modules };
+}
+
+/**
+ * Module grid with its function pattern map
+ */
+class QrSymbol {
+  readonly size: number;
+  readonly modules: boolean[][];
+  private readonly reserved: boolean[][];
+
+  constructor(private readonly version: number) {
+    this.size = version * 4 + 17;
+    this.modules = Array.from({ length: this.size }, () => new Array<boolean>(this.size).fill(false));
+    this.reserved = Array.from({ length: this.size }, () => new Array<boolean>(this.size).fill(false));
+  }
+
+  drawFunctionPatterns(): void {
+    const size = this.size;
+    for (let i = 0; i < size; i++) {
+      this.setFunction(6, i, i % 2 === 0);
+      this.setFunction(i, 6, i % 2 === 0);
+    }
+
+    this.drawFinder(3, 3);
+    this.drawFinder(size - 4, 3);
+    this.drawFinder(3, size - 4);
+
+    const positions = alignmentPositions(this.version);
+    const last = positions.length - 1;
+    for (let i = 0; i <= last; i++) {
+      for (let j = 0; j <= last; j++) {
+        // Skip the three corners taken by finder patterns
+        if ((i === 0 && j === 0) || (i === 0 && j === last) || (i === last && j === 0)) continue;
+        for (let dy = -2; dy <= 2; dy++) {
+          for (let dx = -2; dx <= 2; dx++) {
+            this.setFunction(positions[i] + dx, positions[j] + dy, Math.max(Math.abs(dx), Math.abs(dy)) !== 1);
+          }
+        }
+      }
+    }
+
+    // Reserve the format areas; the real bits are drawn per mask
+    this.drawFormatBits('M', 0);
+    this.drawVersionBits();
+  }
+
+  /**
+   * Places codewords in the zigzag order, skipping function modules
+   */
+  drawCodewords(codewords: number[]): void {
+    const size = this.size;
+    let bit = 0;
+    for (let right = size - 1; right >= 1; right -= 2) {
+      // The vertical timing pattern column is skipped
+      if (right === 6) right = 5;
+      for (let vertical = 0; vertical < size; vertical++) {
+        for (let j = 0; j < 2; j++) {
+          const x = right - j;
+          const upward = ((right + 1) & 2) === 0;
+          const y = upward ? size - 1 - vertical : vertical;
+          if (!this.reserved[y][x] && bit < codewords.length * 8) {
+            this.modules[y][x] = ((codewords[bit >>> 3] >>> (7 - (bit & 7))) & 1) === 1;
+            bit++;
+          }
+        }
+      }
+    }
+  }
+
+  /**
+   * XORs the mask pattern into the data modules (applying twice undoes it)
+   */
+  applyMask(mask: number): void {
+    for (let y = 0; y < this.size; y++) {
+      for (let x = 0; x < this.size; x++) {
+        if (!this.reserved[y][x] && maskBit(mask, x, y)) this.modules[y][x] = !this.modules[y][x];
+      }
+    }
+  }
+
+  drawFormatBits(level: QrErrorCorrection, mask: number): void {
+    const data = (FORMAT_BITS[level] << 3) | mask;
+    let remainder = data;
+    for (let i = 0; i < 10; i++) remainder = (remainder << 1) ^ ((remainder >>> 9) * 0x537);
+    const bits = ((data << 10) | remainder) ^ 0x5412;
+    const bitAt = (i: number): boolean => ((bits >>> i) & 1) === 1;
+
+    // Around the top-left finder
+    for (let i = 0; i <= 5; i++) this.setFunction(8, i, bitAt(i));
+    this.setFunction(8, 7, bitAt(6));
+    this.setFunction(8, 8, bitAt(7));
+    this.setFunction(7, 8, bitAt(8));
+    for (let i = 9; i < 15; i++) this.setFunction(14 - i, 8, bitAt(i));
+
+    // Split between the other two finders, plus the dark module
+    for (let i = 0; i < 8; i++) this.setFunction(this.size - 1 - i, 8, bitAt(i));
+    for (let i = 8; i < 15; i++) this.setFunction(8, this.size - 15 + i, bitAt(i));
+    this.setFunction(8, this.size - 8, true);
+  }
+
+  /**
+   * Penalty score of the current modules (lower reads more reliably)
+   */
+  penalty(): number {
+    const size = this.size;
+    let score = 0;
+    let dark = 0;
+
+    for (let y = 0; y < size; y++) {
+      score += linePenalty(this.modules[y]);
+      score += linePenalty(this.modules.map(row => row[y]));
+      for (let x = 0; x < size; x++) {
+        const color = this.modules[y][x];
+        if (color) dark++;
+        if (
+          x < size - 1 && y < size - 1 &&
+          color === this.modules[y][x + 1] && color === this.modules[y + 1][x] && color === this.modules[y + 1][x + 1]
+        ) {
+          score += 3;
+        }
+      }
+    }
+
+    const total = size * size;
+    score += (Math.ceil(Math.abs(dark * 20 - total * 10) / total) - 1) * 10;
+    return score;
+  }
+
+  private drawFinder(cx: number, cy: number): void {
+    for (let dy = -4; dy <= 4; dy++) {
+      for (let dx = -4; dx <= 4; dx++) {
+        const x = cx + dx;
+        const y = cy + dy;
+        if (x < 0 || x >= this.size || y < 0 || y >= this.size) continue;
+        const distance = Math.max(Math.abs(dx), Math.abs(dy));
+        this.setFunction(x, y, distance !== 2 && distance !== 4);
+      }
+    }
+  }
+
+  private drawVersionBits(): void {
+    if (this.version < 7) return;
+    let remainder = this.version;
+    for (let i = 0; i < 12; i++) remainder = (remainder << 1) ^ ((remainder >>> 11) * 0x1f25);
+    const bits = (this.version << 12) | remainder;
+
+    for (let i = 0; i < 18; i++) {
+      const bit = ((bits >>> i) & 1) === 1;
+      const a = this.size - 11 + (i % 3);
+      const b = Math.floor(i / 3);
+      this.setFunction(a, b, bit);
+      this.setFunction(b, a, bit);
+    }
+  }
+
+  private setFunction(x: number, y: number, dark: boolean): void {
+    this.modules[y][x] = dark;
+    this.reserved[y][x] = true;
+  }
+}
+
+/**
+ * Penalties for runs of one color and finder-like patterns in a row or
+ * column
+ */
+function linePenalty(line: boolean[]): number {
+  let score = 0;
+  let runLength = 1;
+  for (let i = 1; i <= line.length; i++) {
+    if (i < line.length && line[i] === line[i - 1]) {
+      runLength++;
+      continue;
+    }
+    if (runLength >= 5) score += runLength - 2;
+    runLength = 1;
+  }
+
+  // 1:1:3:1:1 dark-light pattern with four light modules on one side
+  const finder = [true, false, true, true, true, false, true];
+  const matchesAt = (start: number): boolean => finder.every((dark, k) => line[start + k] === dark);
+  const lightAt = (from: number, to: number): boolean => {
+    for (let i = from; i < to; i++) {
+      if (i >= 0 && i < line.length && line[i]) return false;
+    }
+    return true;
+  };
+  for (let i = 0; i + finder.length <= line.length; i++) {
+    if (matchesAt(i) && (lightAt(i - 4, i) || lightAt(i + 7, i + 11))) score += 40;
+  }
+  return score;
+}
+
+function maskBit(mask: number, x: number, y: number): boolean {
+  switch (mask) {
+    case 0: return (x + y) % 2 === 0;
+    case 1: return y % 2 === 0;
+    case 2: return x % 3 === 0;
+    case 3: return (x + y) % 3 === 0;
+    case 4: return (Math.floor(x / 3) + Math.floor(y / 2)) % 2 === 0;
+    case 5: return ((x * y) % 2) + ((x * y) % 3) === 0;
+    case 6: return (((x * y) % 2) + ((x * y) % 3)) % 2 === 0;
+    default: return (((x + y) % 2) + ((x * y) % 3)) % 2 === 0;
+  }
+}
+
+/**
+ * Centers of the alignment patterns along each axis
+ */
+function alignmentPositions(version: number): number[] {
+  if (version === 1) return [];
+  const count = Math.floor(version / 7) + 2;
+  const step = version === 32 ? 26 : Math.ceil((version * 4 + 4) / (count * 2 - 2)) * 2;
+  const positions = [6];
+  for (let position = version * 4 + 10; positions.length < count; position -= step) {
+    positions.splice(1, 0, position);
+  }
+  return positions;
+}
+
+/**
+ * Modules available for codewords: everything but function patterns
+ * and format/version information
+ */
+function rawDataModules(version: number): number {
+  let modules = (16 * version + 128) * version + 64;
+  if (version >= 2) {
+    const alignments = Math.floor(version / 7) + 2;
+    modules -= (25 * alignments - 10) * alignments - 55;
+    if (version >= 7) modules -= 36;
+  }
+  return modules;
+}
+
+function dataCodewords(version: number, level: QrErrorCorrection): number {
+  return Math.floor(rawDataModules(version) / 8) - ECC_CODEWORDS_PER_BLOCK[level][version] * ECC_BLOCKS[level][version];
+}
+
+function dataBitLength(data: Uint8Array, version: number): number {
+  return 4 + (version <= 9 ? 8 : 16) + data.length * 8;
+}
+
+/**
+ * Splits data codewords into blocks, appends each block's Reed-Solomon
+ * codewords and interleaves the result
+ */
+function addErrorCorrection(data: number[], version: number, level: QrErrorCorrection): number[] {
+  const blockCount = ECC_BLOCKS[level][version];
+  const eccLength = ECC_CODEWORDS_PER_BLOCK[level][version];
+  const rawCodewords = Math.floor(rawDataModules(version) / 8);
+  const shortBlocks = blockCount - (rawCodewords % blockCount);
+  const shortLength = Math.floor(rawCodewords / blockCount);
+
+  const divisor = reedSolomonDivisor(eccLength);
+  const blocks: number[][] = [];
+  for (let i = 0, offset = 0; i < blockCount; i++) {
+    const length = shortLength - eccLength + (i < shortBlocks ? 0 : 1);
+    const block = data.slice(offset, offset + length);
+    offset += length;
+    const ecc = reedSolomonRemainder(block, divisor);
+    // Pad short blocks so every block interleaves at the same index
+    if (i < shortBlocks) block.push(0);
+    blocks.push([...block, ...ecc]);
+  }
+
+  const result: number[] = [];
+  for (let i = 0; i < blocks[0].length; i++) {
+    blocks.forEach((block, j) => {
+      if (i !== shortLength - eccLength || j >= shortBlocks) result.push(block[i]);
+    });
+  }
+  return result;
+}
+
+function reedSolomonDivisor(degree: number): number[] {
+  const result = new Array<number>(degree).fill(0);
+  result[degree - 1] = 1;
+  let root = 1;
+  for (let i = 0; i < degree; i++) {
+    for (let j = 0; j < degree; j++) {
+      result[j] = gfMultiply(result[j], root);
+      if (j + 1 < degree) result[j] ^= result[j + 1];
+    }
+    root = gfMultiply(root, 0x02);
+  }
+  return result;
+}
+
+function reedSolomonRemainder(data: number[], divisor: number[]): number[] {
+  const result = new Array<number>(divisor.length).fill(0);
+  for (const byte of data) {
+    const factor = byte ^ result.shift()!;
+    result.push(0);
+    divisor.forEach((coefficient, i) => {
+      result[i] ^= gfMultiply(coefficient, factor);
+    });
+  }
+  return result;
+}
+
+/**
+ * Multiplication in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+ */
+function gfMultiply(x: number, y: number): number {
+  let z = 0;
+  for (let i = 7; i >= 0; i--) {
+    z = (z << 1) ^ ((z >>> 7) * 0x11d);
+    z ^= ((y >>> i) & 1) * x;
+  }
+  return z;
+}
+
+function appendBits(bits: number[], value: number, length: number): void {
+  for (let i = length - 1; i >= 0; i--) bits.push((value >>> i) & 1);
+}
@@ -0,0 +1,225 @@
+/**
+ * Raw file scanning
+ *
+ * Some facts (object streams, xref layout, trailing bytes) are lost once
+ * pdf-lib has parsed a file, so they are read from the bytes directly.
+ */
+
+/**
+ * Decodes the file as Latin-1 so byte offsets equal string indices
+ */
+export function toLatin1(pdfBuffer: ArrayBuffer): string {
+  return new TextDecoder('latin1').decode(new Uint8Array(pdfBuffer));
+}
+
+/**
+ * Whether the file stores objects inside compressed object streams
+ */
+export function hasObjectStreams(raw: string): boolean {
+  return /\/Type\s*\/ObjStm\b/.test(raw);
+}
+
+/**
+ * Whether the file starts with a linearization dictionary (fast web view)
+ */
+export function isLinearized(raw: string): boolean {
+  // The dictionary must be the first object, within the first 1024 bytes
+  return /\/Linearized\s/.test(raw.slice(0, 1024));
+}
+
+/**
+ * Offset of the last cross-reference section, read from the final
+ * startxref keyword
+ */
+export function findStartXref(raw: string): number | undefined {
+  const match = /startxref\s+(\d+)(?![\s\S]*startxref)/.exec(raw.slice(-2048));
+  return match ? Number(match[1]) : undefined;
+}
+
+/**
+ * Whether the cross-reference section at an offset is a stream rather
+ * than a classic table
+ */
+export function isXrefStream(raw: string, offset: number): boolean {
+  return !/^\s*xref/.test(raw.slice(offset, offset + 32));
+}
+
+/**
+ * Reads /Size from the trailer (or cross-reference stream) at an offset
+ */
+export function readXrefSize(raw: string, offset: number): number | undefined {
+  const match = /\/Size\s+(\d+)/.exec(raw.slice(offset));
+  return match ? Number(match[1]) : undefined;
+}
+
+/**
+ * Number of indirect objects a parser will find, without parsing the file
+ *
+ * The larger of what the last cross-reference section declares (its
+ * /Size and the end of its highest subsection, less object 0, the head
+ * of the free list) and a tally of the object headers and object stream
+ * counts in the body. Parsers read every object in the body whatever the
+ * cross-reference section says, so a small /Size can't hide them.
+ */
+export function countDeclaredObjects(bytes: Uint8Array): number {
+  return Math.max(readXrefObjectCount(bytes) ?? 0, countBodyObjects(decodeRange(bytes, 0, bytes.length)));
+}
+
+function readXrefObjectCount(bytes: Uint8Array): number | undefined {
+  const startXref = findStartXref(decodeRange(bytes, Math.max(0, bytes.length - 2048), bytes.length));
+  if (startXref === undefined || startXref >= bytes.length) return undefined;
+
+  let size: number | undefined;
+  // One past the highest object number any subsection covers
+  let end = 0;
+  const head = decodeRange(bytes, startXref, startXref + 4096);
+  if (/^\s*xref/.test(head)) {
+    // Classic table: subsection headers, each followed by 20-byte entries
+    let offset = startXref + head.indexOf('xref') + 4;
+    for (;;) {
+      const window = decodeRange(bytes, offset, offset + 64);
+      const subsection = /^\s*(\d+)\s+(\d+)[ \t]*(?:\r\n|\r|\n)/.exec(window);
+      if (!subsection) {
+        // Entries of another width leave the headers misaligned
+        if (!/^\s*trailer/.test(window)) return undefined;
+        size = readXrefSize(decodeRange(bytes, offset, offset + 4096).split('startxref')[0], 0);
+        break;
+      }
+      const count = Number(subsection[2]);
+      end = Math.max(end, Number(subsection[1]) + count);
+      offset += subsection[0].length + count * 20;
+    }
+  } else {
+    const dict = /^\s*\d+\s+\d+\s+obj\s*<<([\s\S]*?)\bstream\b/.exec(head);
+    if (!dict || !/\/Type\s*\/XRef\b/.test(dict[1])) return undefined;
+    size = readXrefSize(dict[1], 0);
+    const index = /\/Index\s*\[([^\]]*)\]/.exec(dict[1]);
+    const numbers = index ? index[1].trim().split(/\s+/).map(Number) : [];
+    for (let i = 0; i + 1 < numbers.length; i += 2) end = Math.max(end, numbers[i] + numbers[i + 1]);
+  }
+  if (size === undefined || !Number.isFinite(end)) return undefined;
+  return Math.max(size, end) - 1;
+}
+
+/**
+ * Tallies object headers and the object counts of object streams
+ */
+function countBodyObjects(raw: string): number {
+  const header = /\d+\s+\d+\s+obj\b/g;
+  let headers = 0;
+  while (header.exec(raw)) headers++;
+  let compressed = 0;
+  for (const [dict] of raw.matchAll(/<<[^>]*\/Type\s*\/ObjStm\b[^>]*>>/g)) {
+    compressed += Number(/\/N\s+(\d+)/.exec(dict)?.[1] ?? 0);
+  }
+  return headers + compressed;
+}
+
+function decodeRange(bytes: Uint8Array, start: number, end: number): string {
+  return new TextDecoder('latin1').decode(bytes.subarray(start, end));
+}
+
+/**
+ * Reads /Count of the root page tree node from the bytes, without parsing
+ * the file
+ *
+ * Follows the last trailer's /Root to the catalog and its /Pages to the
+ * root node, each through its newest cross-reference entry so
+ * incremental updates win. Returns undefined when the file uses
+ * cross-reference streams (either object may be in an object stream),
+ * when an entry is missing, free or doesn't point at the object's
+ * header, or when /Count is missing, not positive, or smaller than the
+ * node's own /Kids.
+ */
+export function readPageTreeCount(raw: string): number | undefined {
+  const startXref = findStartXref(raw);
+  if (startXref === undefined) return undefined;
+  const root = /\/Root\s+(\d+)\s+(\d+)\s+R/.exec(raw.slice(startXref));
+  const catalog = root && readObjectText(raw, startXref, Number(root[1]), Number(root[2]));
+  const pages = catalog && /\/Pages\s+(\d+)\s+(\d+)\s+R/.exec(catalog);
+  const tree = pages && readObjectText(raw, startXref, Number(pages[1]), Number(pages[2]));
+  const count = tree && /\/Count\s+(\d+)/.exec(tree);
+  if (!tree || !count) return undefined;
+
+  const kids = /\/Kids\s*\[([^\]]*)\]/.exec(tree);
+  const kidCount = kids ? (kids[1].match(/\d+\s+\d+\s+R/g) ?? []).length : 0;
+  const value = Number(count[1]);
+  return value > 0 && value >= kidCount ? value : undefined;
+}
+
+/**
+ * Text of an uncompressed object, up to endobj, found at the offset its
+ * newest cross-reference table entry gives
+ */
+function readObjectText(raw: string, startXref: number, objectNumber: number, generation: number): string | undefined {
+  const offset = findObjectOffset(raw, startXref, objectNumber, generation);
+  if (offset === undefined) return undefined;
+  const header = new RegExp(`^${objectNumber}\\s+${generation}\\s+obj\\b`).exec(raw.slice(offset, offset + 64));
+  if (!header) return undefined;
+  const start = offset + header[0].length;
+  const end = raw.indexOf('endobj', start);
+  return raw.slice(start, end < 0 ? undefined : end);
+}
+
+/**
+ * Offset of an object from its newest cross-reference table entry,
+ * following /Prev to older sections
+ *
+ * Returns undefined for free entries, entries of another generation, and
+ * sections that are (or, through /XRefStm, include) cross-reference
+ * streams, whose entries may place the object in an object stream.
+ */
+function findObjectOffset(raw: string, startXref: number, objectNumber: number, generation: number): number | undefined {
+  const visited = new Set<number>();
+  for (let section: number | undefined = startXref; section !== undefined; ) {
+    if (visited.has(section) || section >= raw.length || isXrefStream(raw, section)) return undefined;
+    visited.add(section);
+
+    let offset = raw.indexOf('xref', section) + 4;
+    for (;;) {
+      const subsection = /^\s*(\d+)\s+(\d+)[ \t]*(?:\r\n|\r|\n)/.exec(raw.slice(offset, offset + 64));
+      if (!subsection) break;
+      const first = Number(subsection[1]);
+      const count = Number(subsection[2]);
+      offset += subsection[0].length;
+      if (objectNumber >= first && objectNumber < first + count) {
+        const entryStart = offset + (objectNumber - first) * 20;
+        const entry = /^(\d{10}) (\d{5}) ([nf])/.exec(raw.slice(entryStart, entryStart + 20));
+        if (!entry || entry[3] === 'f' || Number(entry[2]) !== generation) return undefined;
+        return Number(entry[1]);
+      }
+      offset += count * 20;
+    }
+
+    const trailer = /^\s*trailer\b([\s\S]*?)(?:startxref|$)/.exec(raw.slice(offset, offset + 4096));
+    if (!trailer || /\/XRefStm\b/.test(trailer[1])) return undefined;
+    const prev = /\/Prev\s+(\d+)/.exec(trailer[1]);
+    section = prev ? Number(prev[1]) : undefined;
+  }
+  return undefined;
+}
+
+/**
+ * Offset just past the last revision's %%EOF marker and its end of line,
+ * or undefined if no %%EOF follows a startxref pointing at a
+ * cross-reference section
+ *
+ * A %%EOF only counts after a startxref whose offset holds a table or
+ * stream, so junk that happens to contain the marker isn't taken for a
+ * revision. Signed byte ranges reaching past it are kept whole.
+ */
+export function findRevisionEnd(raw: string): number | undefined {
+  let end: number | undefined;
+  for (const match of raw.matchAll(/startxref\s+(\d+)\s*%%EOF(\r\n|\r|\n)?/g)) {
+    const offset = Number(match[1]);
+    if (/^\s*(xref|\d+\s+\d+\s+obj\b)/.test(raw.slice(offset, offset + 32))) {
+      end = match.index! + match[0].length;
+    }
+  }
+  if (end === undefined) return undefined;
+
+  for (const [, start, length] of raw.matchAll(/\/ByteRange\s*\[\s*\d+\s+\d+\s+(\d+)\s+(\d+)\s*\]/g)) {
+    end = Math.max(end, Math.min(raw.length, Number(start) + Number(length)));
+  }
+  return end;
+}
@@ -0,0 +1,96 @@
+/**
+ * Content stream recombination
+ *
+ * Some generators split a page into dozens of small content streams, each
+ * deflated on its own. One stream per page compresses better. Content
+ * streams may only be split between tokens, so joining them with a line
+ * break draws exactly the same page.
+ */
+
+import { PDFArray, PDFDocument, PDFName, PDFRef, PDFStream } from 'pdf-lib';
+import type { ContentRecombineReport } from '../api/types';
+import { decodeStreamContents } from './pdf-objects';
+
+/**
+ * Merges each page's content streams into one Flate stream
+ *
+ * Pages are left alone when a stream can't be decoded, when a stream is
+ * shared with another page (merging would copy it), or when the merged
+ * stream would not be smaller.
+ */
+export function recombineContentStreams(pdfDoc: PDFDocument): ContentRecombineReport {
+  const context = pdfDoc.context;
+  const pages = pdfDoc.getPages();
+  const report: ContentRecombineReport = { pagesRecombined: 0, streamsBefore: 0, streamsAfter: 0, bytesSaved: 0 };
+
+  const useCount = new Map<PDFRef, number>();
+  for (const page of pages) {
+    const contents = page.node.Contents();
+    if (!(contents instanceof PDFArray)) continue;
+    for (const item of contents.asArray()) {
+      if (item instanceof PDFRef) useCount.set(item, (useCount.get(item) ?? 0) + 1);
+    }
+  }
+
+  for (const page of pages) {
+    const contents = page.node.Contents();
+    if (!(contents instanceof PDFArray) || contents.size() < 2) continue;
+
+    const parts = readParts(contents, useCount);
+    if (!parts) continue;
+
+    const merged = context.flateStream(joinStreams(parts.data));
+    const saved = parts.size - merged.getContentsSize();
+    if (saved <= 0) continue;
+
+    report.pagesRecombined++;
+    report.streamsBefore += contents.size();
+    report.streamsAfter++;
+    report.bytesSaved += saved;
+    page.node.set(PDFName.of('Contents'), context.register(merged));
+  }
+
+  return report;
+}
+
+/**
+ * Decodes a page's content streams
+ *
+ * @returns The decoded parts and their stored size, or undefined if any
+ * part is shared, direct or undecodable
+ */
+function readParts(
+  contents: PDFArray,
+  useCount: Map<PDFRef, number>
+): { data: Uint8Array[]; size: number } | undefined {
+  const data: Uint8Array[] = [];
+  let size = 0;
+
+  for (let i = 0; i < contents.size(); i++) {
+    const ref = contents.get(i);
+    const stream = contents.lookup(i);
+    if (!(ref instanceof PDFRef) || useCount.get(ref) !== 1 || !(stream instanceof PDFStream)) return undefined;
+
+    const bytes = decodeStreamContents(stream);
+    if (!bytes) return undefined;
+    data.push(bytes);
+    size += stream.getContentsSize();
+  }
+
+  return { data, size };
+}
+
+/**
+ * Concatenates stream data with a line break between parts so tokens at
+ * the boundaries stay separate
+ */
+function joinStreams(parts: Uint8Array[]): Uint8Array {
+  const joined = new Uint8Array(parts.reduce((total, part) => total + part.length + 1, 0));
+  let offset = 0;
+  for (const part of parts) {
+    joined.set(part, offset);
+    joined[offset + part.length] = 0x0a;
+    offset += part.length + 1;
+  }
+  return joined;
+}
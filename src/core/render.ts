@@ -0,0 +1,62 @@
+/**
+ * Canvas rendering helpers (browser only)
+ */
+
+import type { PDFDocumentProxy } from 'pdfjs-dist';
+
+/**
+ * Creates a canvas with a 2D context
+ *
+ * @param alpha - Keep an alpha channel (for transparent images)
+ */
+export function createCanvas(
+  width: number,
+  height: number,
+  alpha = false
+): { canvas: HTMLCanvasElement; context: CanvasRenderingContext2D } {
+  if (typeof document === 'undefined') {
+    throw new Error('Rendering requires a browser environment');
+  }
+
+  const canvas = document.createElement('canvas');
+  canvas.width = Math.max(1, Math.round(width));
+  canvas.height = Math.max(1, Math.round(height));
+
+  const context = canvas.getContext('2d', { alpha, willReadFrequently: true });
+  if (!context) throw new Error('Failed to get canvas context');
+
+  return { canvas, context };
+}
+
+/**
+ * Renders a page so its longer side is maxDimension pixels
+ */
+export async function renderPage(
+  pdfDocument: PDFDocumentProxy,
+  pageNum: number,
+  maxDimension: number
+): Promise<HTMLCanvasElement> {
+  const page = await pdfDocument.getPage(pageNum);
+  const unscaled = page.getViewport({ scale: 1 });
+  const scale = maxDimension / Math.max(unscaled.width, unscaled.height);
+  const viewport = page.getViewport({ scale });
+
+  const { canvas, context } = createCanvas(viewport.width, viewport.height);
+  context.fillStyle = '#ffffff';
+  context.fillRect(0, 0, canvas.width, canvas.height);
+
+  await page.render({ canvasContext: context as any, viewport }).promise;
+  page.cleanup();
+  return canvas;
+}
+
+/**
+ * Decodes an image file (PNG, JPEG, ...) with the browser's decoders
+ */
+export async function decodeImage(data: ArrayBuffer | Uint8Array | Blob): Promise<ImageBitmap> {
+  if (typeof createImageBitmap === 'undefined') {
+    throw new Error('Image decoding requires a browser environment');
+  }
+  const blob = data instanceof Blob ? data : new Blob([data]);
+  return createImageBitmap(blob);
+}
@@ -0,0 +1,425 @@
+/**
+ * Encryption dictionary inspection
+ *
+ * Reads how a document is encrypted and, for the standard security
+ * handler, whether it opens without a password (owner-password-only
+ * files use an empty user password) and the file key a password gives.
+ */
+
+import { PDFArray, PDFBool, PDFDict, PDFDocument, PDFHexString, PDFName, PDFObject, PDFString } from 'pdf-lib';
+import type { DocumentPermissions, EncryptionAlgorithm, SecurityInfo } from '../api/types';
+import { aesCbcDecrypt, aesCbcEncrypt, concatBytes, md5, rc4, sha } from './crypto';
+import { lookupDict, lookupName, lookupNumber } from './pdf-objects';
+
+/** Password padding string from the PDF specification */
+const PASSWORD_PADDING = new Uint8Array([
+  0x28, 0xbf, 0x4e, 0x5e, 0x4e, 0x75, 0x8a, 0x41, 0x64, 0x00, 0x4e, 0x56, 0xff, 0xfa, 0x01, 0x08,
+  0x2e, 0x2e, 0x00, 0xb6, 0xd0, 0x68, 0x3e, 0x80, 0x2f, 0x0c, 0xa9, 0xfe, 0x64, 0x53, 0x69, 0x7a,
+]);
+
+/**
+ * Reads the encryption settings of a document
+ */
+export async function readSecurityInfo(pdfDoc: PDFDocument): Promise<SecurityInfo> {
+  const encryptRef = pdfDoc.context.trailerInfo.Encrypt;
+  const encrypt = encryptRef && pdfDoc.context.lookup(encryptRef);
+  if (!(encrypt instanceof PDFDict)) {
+    return { encrypted: false, warnings: [] };
+  }
+
+  const warnings: string[] = [];
+  const handler = lookupName(encrypt, 'Filter');
+  const version = lookupNumber(encrypt, 'V') ?? 0;
+  const revision = lookupNumber(encrypt, 'R');
+  const { algorithm, keyLength } = readAlgorithm(encrypt, version);
+  const encryptMetadata = encrypt.lookup(PDFName.of('EncryptMetadata')) !== PDFBool.False;
+  const permissionBits = lookupNumber(encrypt, 'P');
+
+  const info: SecurityInfo = {
+    encrypted: true,
+    handler,
+    version,
+    revision,
+    algorithm,
+    keyLength,
+    encryptMetadata,
+    ...(permissionBits !== undefined && { permissions: decodePermissions(permissionBits) }),
+    warnings,
+  };
+
+  if (handler !== 'Standard') {
+    warnings.push(`Security handler '${handler ?? 'unknown'}' is not supported; password requirements are unknown`);
+    return info;
+  }
+  if (algorithm === 'unknown') {
+    warnings.push(`Unrecognized encryption settings (V ${version}); password requirements are unknown`);
+    return info;
+  }
+
+  try {
+    const opensWithoutPassword = await checkEmptyUserPassword(pdfDoc, encrypt, revision ?? 0, keyLength ?? 40, encryptMetadata);
+    if (opensWithoutPassword === undefined) {
+      warnings.push(`Unsupported standard handler revision ${revision}; password requirements are unknown`);
+    } else {
+      info.userPasswordRequired = !opensWithoutPassword;
+      info.ownerPasswordOnly = opensWithoutPassword;
+    }
+  } catch (error) {
+    warnings.push(`Could not check the user password: ${error instanceof Error ? error.message : String(error)}`);
+  }
+
+  return info;
+}
+
+function readAlgorithm(encrypt: PDFDict, version: number): { algorithm: EncryptionAlgorithm; keyLength?: number } {
+  const length = lookupNumber(encrypt, 'Length');
+  switch (version) {
+    case 1:
+      return { algorithm: 'RC4', keyLength: 40 };
+    case 2:
+    case 3:
+      return { algorithm: 'RC4', keyLength: length ?? 40 };
+    case 4:
+    case 5: {
+      // Crypt filters name the method; StmF selects the one used for streams
+      const filterName = lookupName(encrypt, 'StmF') ?? 'Identity';
+      const filters = lookupDict(encrypt, 'CF');
+      const filter = filters && lookupDict(filters, filterName);
+      const method = filter && lookupName(filter, 'CFM');
+      if (method === 'AESV3') return { algorithm: 'AES-256', keyLength: 256 };
+      if (method === 'AESV2') return { algorithm: 'AES-128', keyLength: 128 };
+      if (method === 'V2') {
+        // Crypt filter lengths are usually bytes, but some writers use bits
+        const filterLength = lookupNumber(filter, 'Length') ?? 16;
+        return { algorithm: 'RC4', keyLength: filterLength <= 32 ? filterLength * 8 : filterLength };
+      }
+      if (filterName === 'Identity' || method === 'None') return { algorithm: 'none' };
+      return { algorithm: 'unknown' };
+    }
+    default:
+      return { algorithm: 'unknown', keyLength: length };
+  }
+}
+
+/**
+ * Whether the empty string is a valid user password
+ *
+ * @returns undefined for revisions this doesn't implement
+ */
+async function checkEmptyUserPassword(
+  pdfDoc: PDFDocument,
+  encrypt: PDFDict,
+  revision: number,
+  keyLength: number,
+  encryptMetadata: boolean
+): Promise<boolean | undefined> {
+  const { owner, user } = readPasswordEntries(encrypt);
+
+  if (revision >= 2 && revision <= 4) {
+    const key = legacyFileKey(pdfDoc, encrypt, PASSWORD_PADDING, owner, revision, keyLength, encryptMetadata);
+    return legacyUserMatches(pdfDoc, key, user, revision);
+  }
+
+  if (revision === 5 || revision === 6) {
+    // Validation salt follows the 32-byte hash in U
+    const hash = await passwordHash(revision, new Uint8Array(0), user.subarray(32, 40), new Uint8Array(0));
+    return bytesEqual(hash, user.subarray(0, 32));
+  }
+
+  return undefined;
+}
+
+/**
+ * Derives the file encryption key of a standard security handler
+ * document from its user or owner password
+ *
+ * Passwords are encoded as Latin-1 up to revision 4 and as UTF-8 from
+ * revision 5, without SASLprep normalization.
+ *
+ * @returns The key, or undefined if the password is neither
+ * @throws If the handler isn't the standard one or its revision isn't supported
+ */
+export async function deriveFileKey(pdfDoc: PDFDocument, encrypt: PDFDict, password: string): Promise<Uint8Array | undefined> {
+  const handler = lookupName(encrypt, 'Filter');
+  if (handler !== 'Standard') {
+    throw new Error(`Security handler '${handler ?? 'unknown'}' is not supported`);
+  }
+  const revision = lookupNumber(encrypt, 'R') ?? 0;
+  const keyLength = readAlgorithm(encrypt, lookupNumber(encrypt, 'V') ?? 0).keyLength ?? 40;
+  const encryptMetadata = encrypt.lookup(PDFName.of('EncryptMetadata')) !== PDFBool.False;
+  const { owner, user } = readPasswordEntries(encrypt);
+
+  if (revision >= 2 && revision <= 4) {
+    const padded = padPassword(password);
+
+    const userKey = legacyFileKey(pdfDoc, encrypt, padded, owner, revision, keyLength, encryptMetadata);
+    if (legacyUserMatches(pdfDoc, userKey, user, revision)) return userKey;
+
+    const userPassword = legacyUserPassword(padded, owner, revision, keyLength);
+    const ownerFileKey = legacyFileKey(pdfDoc, encrypt, userPassword, owner, revision, keyLength, encryptMetadata);
+    return legacyUserMatches(pdfDoc, ownerFileKey, user, revision) ? ownerFileKey : undefined;
+  }
+
+  if (revision === 5 || revision === 6) {
+    const utf8 = new TextEncoder().encode(password).subarray(0, 127);
+    const candidates = [
+      // Owner hashes also cover the 48-byte U entry
+      { entry: owner, userData: user.subarray(0, 48), encryptedKey: encrypt.lookup(PDFName.of('OE')) },
+      { entry: user, userData: new Uint8Array(0), encryptedKey: encrypt.lookup(PDFName.of('UE')) },
+    ];
+    for (const { entry, userData, encryptedKey } of candidates) {
+      const hash = await passwordHash(revision, utf8, entry.subarray(32, 40), userData);
+      if (!bytesEqual(hash, entry.subarray(0, 32))) continue;
+      const wrapped = stringBytes(encryptedKey);
+      if (!wrapped) throw new Error('Encryption dictionary is missing OE or UE');
+      const intermediate = await passwordHash(revision, utf8, entry.subarray(40, 48), userData);
+      return aesCbcDecrypt(intermediate, new Uint8Array(16), wrapped, false);
+    }
+    return undefined;
+  }
+
+  throw new Error(`Standard handler revision ${revision} is not supported`);
+}
+
+/**
+ * Recovers the user password of a revision 2 to 4 document from its
+ * owner password, which encrypts it in O
+ *
+ * @returns The user password (Latin-1), or undefined if ownerPassword
+ *   isn't the owner password
+ * @throws If the handler isn't the standard one or the revision isn't 2 to 4
+ */
+export function recoverUserPassword(pdfDoc: PDFDocument, encrypt: PDFDict, ownerPassword: string): string | undefined {
+  const handler = lookupName(encrypt, 'Filter');
+  const revision = lookupNumber(encrypt, 'R') ?? 0;
+  if (handler !== 'Standard' || revision < 2 || revision > 4) {
+    throw new Error(`Only standard handler revisions 2 to 4 store a recoverable user password (${handler ?? 'unknown'} R ${revision})`);
+  }
+  const keyLength = readAlgorithm(encrypt, lookupNumber(encrypt, 'V') ?? 0).keyLength ?? 40;
+  const encryptMetadata = encrypt.lookup(PDFName.of('EncryptMetadata')) !== PDFBool.False;
+  const { owner, user } = readPasswordEntries(encrypt);
+
+  const padded = legacyUserPassword(padPassword(ownerPassword), owner, revision, keyLength);
+  const key = legacyFileKey(pdfDoc, encrypt, padded, owner, revision, keyLength, encryptMetadata);
+  if (!legacyUserMatches(pdfDoc, key, user, revision)) return undefined;
+
+  // The password ends where the padding string starts
+  for (let length = 0; length <= 32; length++) {
+    if (bytesEqual(padded.subarray(length), PASSWORD_PADDING.subarray(0, 32 - length))) {
+      return String.fromCharCode(...padded.subarray(0, length));
+    }
+  }
+  return undefined;
+}
+
+function readPasswordEntries(encrypt: PDFDict): { owner: Uint8Array; user: Uint8Array } {
+  const owner = stringBytes(encrypt.lookup(PDFName.of('O')));
+  const user = stringBytes(encrypt.lookup(PDFName.of('U')));
+  if (!owner || !user) throw new Error('Encryption dictionary is missing O or U');
+  return { owner, user };
+}
+
+/**
+ * Latin-1 bytes of a password, cut or padded to 32 bytes (revisions 2 to 4)
+ */
+function padPassword(password: string): Uint8Array {
+  const latin1 = Uint8Array.from(password.slice(0, 32), char => char.charCodeAt(0) & 0xff);
+  return concatBytes(latin1, PASSWORD_PADDING).subarray(0, 32);
+}
+
+/**
+ * Algorithm 2: file key from a padded password (revisions 2 to 4)
+ */
+function legacyFileKey(
+  pdfDoc: PDFDocument,
+  encrypt: PDFDict,
+  paddedPassword: Uint8Array,
+  owner: Uint8Array,
+  revision: number,
+  keyLength: number,
+  encryptMetadata: boolean
+): Uint8Array {
+  const permissions = lookupNumber(encrypt, 'P') ?? 0;
+  const permissionBytes = new Uint8Array(4);
+  new DataView(permissionBytes.buffer).setInt32(0, permissions, true);
+  let key = md5(concatBytes(
+    paddedPassword,
+    owner.subarray(0, 32),
+    permissionBytes,
+    firstFileId(pdfDoc),
+    revision >= 4 && !encryptMetadata ? new Uint8Array([0xff, 0xff, 0xff, 0xff]) : new Uint8Array(0)
+  ));
+  const keyBytes = revision === 2 ? 5 : Math.min(16, keyLength / 8);
+  if (revision >= 3) {
+    for (let i = 0; i < 50; i++) key = md5(key.subarray(0, keyBytes));
+  }
+  return key.subarray(0, keyBytes);
+}
+
+/**
+ * Algorithms 4 and 5: whether a file key reproduces U
+ */
+function legacyUserMatches(pdfDoc: PDFDocument, key: Uint8Array, user: Uint8Array, revision: number): boolean {
+  if (revision === 2) {
+    return bytesEqual(rc4(key, PASSWORD_PADDING), user.subarray(0, 32));
+  }
+  let computed = rc4(key, md5(concatBytes(PASSWORD_PADDING, firstFileId(pdfDoc))));
+  for (let i = 1; i <= 19; i++) {
+    computed = rc4(key.map(byte => byte ^ i), computed);
+  }
+  return bytesEqual(computed, user.subarray(0, 16));
+}
+
+/**
+ * Algorithm 7: the padded user password, decrypted from O with the key
+ * a padded owner password gives
+ */
+function legacyUserPassword(paddedOwner: Uint8Array, owner: Uint8Array, revision: number, keyLength: number): Uint8Array {
+  let key = md5(paddedOwner);
+  if (revision >= 3) {
+    for (let i = 0; i < 50; i++) key = md5(key);
+  }
+  key = key.subarray(0, revision === 2 ? 5 : Math.min(16, keyLength / 8));
+
+  let userPassword = owner.subarray(0, 32);
+  if (revision === 2) return rc4(key, userPassword);
+  for (let i = 19; i >= 0; i--) userPassword = rc4(key.map(byte => byte ^ i), userPassword);
+  return userPassword;
+}
+
+function firstFileId(pdfDoc: PDFDocument): Uint8Array {
+  const id = pdfDoc.context.trailerInfo.ID;
+  const idArray = id && pdfDoc.context.lookup(id);
+  return idArray instanceof PDFArray ? stringBytes(idArray.lookup(0)) ?? new Uint8Array(0) : new Uint8Array(0);
+}
+
+/**
+ * Password hash of revision 5 (SHA-256) or 6 (algorithm 2.B)
+ */
+export async function passwordHash(
+  revision: number,
+  password: Uint8Array,
+  salt: Uint8Array,
+  userData: Uint8Array
+): Promise<Uint8Array> {
+  return revision === 5
+    ? sha(256, concatBytes(password, salt, userData))
+    : hardenedHash(password, salt, userData);
+}
+
+/**
+ * Algorithm 2.B (revision 6 password hash)
+ */
+async function hardenedHash(password: Uint8Array, salt: Uint8Array, userKey: Uint8Array): Promise<Uint8Array> {
+  let key = await sha(256, concatBytes(password, salt, userKey));
+
+  for (let round = 0; ; round++) {
+    const block = concatBytes(password, key, userKey);
+    const repeated = new Uint8Array(block.length * 64);
+    for (let i = 0; i < 64; i++) repeated.set(block, i * block.length);
+
+    const encrypted = await aesCbcEncrypt(key.subarray(0, 16), key.subarray(16, 32), repeated, false);
+    let remainder = 0;
+    for (let i = 0; i < 16; i++) remainder += encrypted[i];
+    const bits = ([256, 384, 512] as const)[remainder % 3];
+    key = await sha(bits, encrypted);
+
+    if (round >= 63 && encrypted[encrypted.length - 1] <= round - 31) break;
+  }
+
+  return key.subarray(0, 32);
+}
+
+function decodePermissions(bits: number): DocumentPermissions {
+  const allowed = (bit: number) => (bits & (1 << (bit - 1))) !== 0;
+  return {
+    print: allowed(3),
+    modify: allowed(4),
+    copy: allowed(5),
+    annotate: allowed(6),
+    fillForms: allowed(9),
+    extractForAccessibility: allowed(10),
+    assemble: allowed(11),
+    printHighQuality: allowed(12),
+  };
+}
+
+/**
+ * Encodes permissions as P for revision 3 and later: reserved bits set,
+ * the two lowest clear
+ */
+export function encodePermissions(permissions: DocumentPermissions): number {
+  const bits: Array<[keyof DocumentPermissions, number]> = [
+    ['print', 3], ['modify', 4], ['copy', 5], ['annotate', 6],
+    ['fillForms', 9], ['extractForAccessibility', 10], ['assemble', 11], ['printHighQuality', 12],
+  ];
+  let value = ~0b11;
+  for (const [key, bit] of bits) {
+    if (!permissions[key]) value &= ~(1 << (bit - 1));
+  }
+  return value;
+}
+
+function stringBytes(value: PDFObject | undefined): Uint8Array | undefined {
+  if (value instanceof PDFString || value instanceof PDFHexString) return value.asBytes();
+  return undefined;
+}
+
+function bytesEqual(a: Uint8Array, b: Uint8Array): boolean {
+  return a.length === b.length && a.every((byte, i) => byte === b[i]);
+}
+
+/** Display labels for the permissions, in the order they're listed */
+const PERMISSION_LABELS: Array<[keyof DocumentPermissions, string]> = [
+  ['copy', 'Content copying'],
+  ['extractForAccessibility', 'Content copying for accessibility'],
+  ['modify', 'Document changes'],
+  ['assemble', 'Page assembly'],
+  ['annotate', 'Commenting'],
+  ['fillForms', 'Form filling'],
+];
+
+/**
+ * Formats security settings as one display line per permission, such as
+ * 'Printing: allowed (high resolution)' or 'Content copying: denied'
+ *
+ * Revision 2 files have no separate bits for the later permissions, which
+ * then follow the permission that covered them. Annotating also allows
+ * form filling.
+ *
+ * @param restrictionsOnly - List only denied permissions
+ */
+export function describePermissionList(info: SecurityInfo, restrictionsOnly = false): string[] {
+  if (!info.encrypted) return ['No restrictions'];
+
+  const lines: string[] = [];
+  if (info.userPasswordRequired) lines.push('Opening: password required');
+  if (!info.permissions) {
+    lines.push('Permissions: unknown');
+    return lines;
+  }
+
+  const permissions = { ...info.permissions };
+  if ((info.revision ?? 0) < 3) {
+    permissions.printHighQuality = permissions.print;
+    permissions.extractForAccessibility = permissions.copy;
+    permissions.assemble = permissions.modify;
+    permissions.fillForms = permissions.annotate;
+  }
+  permissions.fillForms = permissions.fillForms || permissions.annotate;
+
+  const printing = !permissions.print
+    ? 'denied'
+    : permissions.printHighQuality
+      ? 'allowed (high resolution)'
+      : 'allowed (low resolution only)';
+  if (!restrictionsOnly || printing !== 'allowed (high resolution)') lines.push(`Printing: ${printing}`);
+
+  for (const [key, label] of PERMISSION_LABELS) {
+    if (!restrictionsOnly || !permissions[key]) {
+      lines.push(`${label}: ${permissions[key] ? 'allowed' : 'denied'}`);
+    }
+  }
+
+  return lines.length > 0 ? lines : ['No restrictions'];
+}
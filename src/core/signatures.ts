@@ -0,0 +1,160 @@
+/**
+ * Signature field discovery
+ *
+ * Walks the AcroForm field tree and reads signature dictionaries, and
+ * checks what their byte ranges cover. Nothing here verifies signatures
+ * cryptographically.
+ */
+
+import { PDFArray, PDFDict, PDFDocument } from 'pdf-lib';
+import type { SignatureCoverage, SignatureCoverageReport, SignatureInfo } from '../api/types';
+import { lookupArray, lookupDict, lookupName, lookupText, parsePdfDate, toNumberArray } from './pdf-objects';
+
+/**
+ * Reads every signed signature field in the document
+ */
+export function readSignatures(pdfDoc: PDFDocument): SignatureInfo[] {
+  const acroForm = lookupDict(pdfDoc.catalog, 'AcroForm');
+  const fields = acroForm && lookupArray(acroForm, 'Fields');
+  if (!fields) return [];
+
+  const signatures: SignatureInfo[] = [];
+  walkFields(fields, '', undefined, signatures, new Set());
+  return signatures;
+}
+
+function walkFields(
+  fields: PDFArray,
+  parentName: string,
+  inheritedType: string | undefined,
+  signatures: SignatureInfo[],
+  visited: Set<PDFDict>
+): void {
+  for (let i = 0; i < fields.size(); i++) {
+    const field = fields.lookup(i);
+    // Malformed field trees can list a field twice or loop back to an ancestor
+    if (!(field instanceof PDFDict) || visited.has(field)) continue;
+    visited.add(field);
+
+    const partialName = lookupText(field, 'T');
+    const name = partialName === undefined
+      ? parentName
+      : parentName ? `${parentName}.${partialName}` : partialName;
+    const fieldType = lookupName(field, 'FT') ?? inheritedType;
+
+    const kids = lookupArray(field, 'Kids');
+    if (kids) {
+      walkFields(kids, name, fieldType, signatures, visited);
+    }
+
+    if (fieldType !== 'Sig') continue;
+
+    const value = lookupDict(field, 'V');
+    if (!value) continue; // Unsigned signature field
+
+    const byteRange = lookupArray(value, 'ByteRange');
+    const signingTime = lookupText(value, 'M');
+
+    signatures.push({
+      name,
+      byteRange: byteRange ? toNumberArray(byteRange) : [],
+      subfilter: lookupName(value, 'SubFilter'),
+      signingTime: signingTime ? parsePdfDate(signingTime) : undefined,
+      signerName: lookupText(value, 'Name'),
+    });
+  }
+}
+
+const EOF_MARKER = [0x25, 0x25, 0x45, 0x4f, 0x46]; // %%EOF
+
+/**
+ * Checks what each signature's /ByteRange covers in the file
+ *
+ * A sound byte range starts at 0, skips only the /Contents hex string
+ * and ends where a revision ends (%%EOF). Bytes after the last signed
+ * range are a later incremental update.
+ */
+export function checkSignatureCoverage(
+  pdfBytes: Uint8Array,
+  signatures: SignatureInfo[]
+): SignatureCoverageReport {
+  const fileEnd = trimWhitespace(pdfBytes, pdfBytes.length);
+  const coverage = signatures.map(signature => checkByteRange(pdfBytes, fileEnd, signature));
+
+  const lastSigned = coverage.filter(item => item.status !== 'invalid');
+  const latest = lastSigned.reduce<SignatureCoverage | undefined>(
+    (best, item) => (!best || item.bytesAfter < best.bytesAfter ? item : best),
+    undefined
+  );
+
+  return {
+    signatures: coverage,
+    modifiedAfterSigning: latest !== undefined && latest.bytesAfter > 0,
+  };
+}
+
+function checkByteRange(pdfBytes: Uint8Array, fileEnd: number, signature: SignatureInfo): SignatureCoverage {
+  const { name, byteRange } = signature;
+  const issues: string[] = [];
+  const invalid = (issue: string): SignatureCoverage => ({
+    name,
+    byteRange,
+    status: 'invalid',
+    gapIsContents: false,
+    endsRevision: false,
+    bytesAfter: 0,
+    issues: [issue],
+  });
+
+  if (byteRange.length !== 4 || !byteRange.every(value => Number.isInteger(value) && value >= 0)) {
+    return invalid('ByteRange is not four non-negative integers');
+  }
+  const [start, firstLength, gapEnd, secondLength] = byteRange;
+  const end = gapEnd + secondLength;
+  if (start !== 0) return invalid('ByteRange does not start at the beginning of the file');
+  if (gapEnd < firstLength) return invalid('ByteRange parts overlap');
+  if (end > pdfBytes.length) return invalid('ByteRange extends past the end of the file');
+
+  // The gap must hold exactly <hex digits>
+  let gapIsContents = gapEnd - firstLength >= 2 && pdfBytes[firstLength] === 0x3c && pdfBytes[gapEnd - 1] === 0x3e;
+  for (let i = firstLength + 1; gapIsContents && i < gapEnd - 1; i++) {
+    gapIsContents = isHexDigit(pdfBytes[i]);
+  }
+  if (!gapIsContents) issues.push('unsigned gap holds more than the signature value');
+
+  const endsRevision = endsWithEof(pdfBytes, trimWhitespace(pdfBytes, end));
+  if (!endsRevision) issues.push('signed range does not end at the end of a revision (%%EOF)');
+
+  const bytesAfter = Math.max(0, fileEnd - end);
+  if (bytesAfter > 0) issues.push(`${bytesAfter} bytes were added after this signature`);
+
+  return {
+    name,
+    byteRange,
+    status: !gapIsContents ? 'invalid' : bytesAfter > 0 ? 'revision' : 'whole-file',
+    gapIsContents,
+    endsRevision,
+    bytesAfter,
+    issues,
+  };
+}
+
+/**
+ * Offset just past the last non-whitespace byte before end
+ */
+function trimWhitespace(bytes: Uint8Array, end: number): number {
+  while (end > 0 && [0x00, 0x09, 0x0a, 0x0c, 0x0d, 0x20].includes(bytes[end - 1])) end--;
+  return end;
+}
+
+function endsWithEof(bytes: Uint8Array, end: number): boolean {
+  return end >= EOF_MARKER.length && EOF_MARKER.every((byte, i) => bytes[end - EOF_MARKER.length + i] === byte);
+}
+
+/**
+ * Hex digit, or whitespace (which hex strings may contain)
+ */
+function isHexDigit(byte: number): boolean {
+  return (byte >= 0x30 && byte <= 0x39) || (byte >= 0x41 && byte <= 0x46) || (byte >= 0x61 && byte <= 0x66) ||
+    byte === 0x20 || byte === 0x0a || byte === 0x0d;
+}
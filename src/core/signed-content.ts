@@ -0,0 +1,89 @@
+/**
+ * Signed content protection
+ *
+ * A signature covers the bytes of the revision it signed. Later
+ * incremental updates leave those bytes intact, but viewers still flag
+ * signed objects that an update changes. This finds the objects a
+ * signature covers, so compression can pin them and append its other
+ * changes as an incremental update.
+ */
+
+import { PDFDocument } from 'pdf-lib';
+import type { PinnedObjectReport, SignedContentReport } from '../api/types';
+import { bytesEqual, serializeObject } from './pdf-objects';
+import { readSignatures } from './signatures';
+
+/**
+ * Objects covered by the document's signatures
+ */
+export interface SignedObjects {
+  /** Signatures with a usable byte range */
+  signatures: number;
+  /** Object numbers unchanged since the last signed revision */
+  objectNumbers: number[];
+}
+
+/**
+ * Finds objects that still have the bytes of the last signed revision
+ *
+ * Objects a later update replaced are no longer signed content and are
+ * left out, as is the document information dictionary, which pdf-lib
+ * rewrites on load and save.
+ *
+ * @param original - The bytes the document was loaded from
+ * @returns Undefined if the document has no signature with a byte range
+ */
+export async function findSignedObjects(pdfDoc: PDFDocument, original: ArrayBuffer): Promise<SignedObjects | undefined> {
+  const signatures = readSignatures(pdfDoc).filter(signature => signature.byteRange.length === 4);
+  if (signatures.length === 0) return undefined;
+
+  // The latest signed revision ends where its byte range does
+  const end = Math.min(
+    original.byteLength,
+    Math.max(...signatures.map(({ byteRange }) => byteRange[2] + byteRange[3]))
+  );
+  const signed = await PDFDocument.load(original.slice(0, end), {
+    ignoreEncryption: true,
+    throwOnInvalidObject: false,
+    updateMetadata: false,
+  });
+
+  const context = pdfDoc.context;
+  const objectNumbers: number[] = [];
+  for (const [ref, object] of signed.context.enumerateIndirectObjects()) {
+    if (ref === context.trailerInfo.Info) continue;
+    const current = context.lookup(ref);
+    if (current && bytesEqual(serializeObject(current), serializeObject(object))) objectNumbers.push(ref.objectNumber);
+  }
+  return { signatures: signatures.length, objectNumbers };
+}
+
+/**
+ * Moves signed objects out of the pinned object report into a signed
+ * content report
+ *
+ * @param pinnedByCaller - Object numbers the caller pinned with
+ *   pinObjects, which stay in the pinned object report
+ */
+export function splitSignedReport(
+  pinnedReport: PinnedObjectReport[],
+  signed: SignedObjects,
+  pinnedByCaller: number[]
+): { pinnedObjects: PinnedObjectReport[]; signedContent: SignedContentReport } {
+  const byCaller = (entry: PinnedObjectReport) => pinnedByCaller.includes(parseInt(entry.object, 10));
+  const skippedObjects = pinnedReport
+    .filter(entry => !byCaller(entry) && entry.restored)
+    .map(entry => entry.object);
+
+  return {
+    pinnedObjects: pinnedReport.filter(byCaller),
+    signedContent: {
+      signatures: signed.signatures,
+      protectedObjects: signed.objectNumbers.length,
+      skippedObjects,
+      ...(skippedObjects.length > 0 && {
+        warning: `Skipped changes to ${skippedObjects.length} signed object(s) to keep the signed content unchanged`,
+      }),
+    },
+  };
+}
@@ -0,0 +1,143 @@
+/**
+ * JPEG quality by structural similarity (browser only)
+ *
+ * One JPEG quality suits some pages and wastes bytes or smears detail on
+ * others. Searching per image for the lowest quality whose decoded result
+ * still has the wanted SSIM against the original gives every image the
+ * same visual fidelity. SSIM is computed on luminance over 8x8 windows,
+ * which is how it is usually applied to JPEG artifacts.
+ */
+
+import { createCanvas, decodeImage } from './render';
+
+/** Window size, matching JPEG's blocks */
+const WINDOW = 8;
+
+/** Stabilizing constants for 8-bit values, from the SSIM paper */
+const C1 = (0.01 * 255) ** 2;
+const C2 = (0.03 * 255) ** 2;
+
+/** Binary search steps; six narrow the quality to about 1.5% of the range */
+const SEARCH_STEPS = 6;
+
+/**
+ * JPEG chosen by searchJpegQuality()
+ */
+export interface SsimJpeg {
+  bytes: Uint8Array;
+  quality: number;
+  /** SSIM of the decoded JPEG against the original */
+  ssim: number;
+}
+
+/**
+ * Luminance of RGBA pixels
+ */
+export function toLuminance(data: Uint8ClampedArray): Float32Array {
+  const luminance = new Float32Array(data.length / 4);
+  for (let i = 0, p = 0; i < data.length; i += 4, p++) {
+    luminance[p] = 0.299 * data[i] + 0.587 * data[i + 1] + 0.114 * data[i + 2];
+  }
+  return luminance;
+}
+
+/**
+ * Mean SSIM of two luminance images of the same size, over
+ * non-overlapping windows (1 means identical)
+ */
+export function structuralSimilarity(a: Float32Array, b: Float32Array, width: number, height: number): number {
+  let total = 0;
+  let windows = 0;
+
+  for (let top = 0; top < height; top += WINDOW) {
+    for (let left = 0; left < width; left += WINDOW) {
+      const bottom = Math.min(top + WINDOW, height);
+      const right = Math.min(left + WINDOW, width);
+      const count = (bottom - top) * (right - left);
+
+      let sumA = 0;
+      let sumB = 0;
+      for (let y = top; y < bottom; y++) {
+        for (let x = left; x < right; x++) {
+          sumA += a[y * width + x];
+          sumB += b[y * width + x];
+        }
+      }
+      const meanA = sumA / count;
+      const meanB = sumB / count;
+
+      let varianceA = 0;
+      let varianceB = 0;
+      let covariance = 0;
+      for (let y = top; y < bottom; y++) {
+        for (let x = left; x < right; x++) {
+          const da = a[y * width + x] - meanA;
+          const db = b[y * width + x] - meanB;
+          varianceA += da * da;
+          varianceB += db * db;
+          covariance += da * db;
+        }
+      }
+      varianceA /= count;
+      varianceB /= count;
+      covariance /= count;
+
+      total += ((2 * meanA * meanB + C1) * (2 * covariance + C2)) /
+        ((meanA * meanA + meanB * meanB + C1) * (varianceA + varianceB + C2));
+      windows++;
+    }
+  }
+
+  return windows > 0 ? total / windows : 1;
+}
+
+/**
+ * Finds the lowest JPEG quality at which the canvas keeps minSSIM
+ *
+ * SSIM grows with quality, so the quality is binary searched between
+ * minQuality and 1. If even quality 1 misses the target, that JPEG is
+ * returned with the SSIM it reached.
+ *
+ * @param original - The canvas's pixels, already read
+ */
+export async function searchJpegQuality(
+  canvas: HTMLCanvasElement,
+  original: ImageData,
+  minSSIM: number,
+  minQuality: number
+): Promise<SsimJpeg> {
+  const reference = toLuminance(original.data);
+  const { width, height } = original;
+
+  const tryQuality = async (quality: number): Promise<SsimJpeg> => {
+    const bytes = encodeJpeg(canvas, quality);
+    const bitmap = await decodeImage(bytes);
+    const { canvas: decoded, context } = createCanvas(width, height);
+    context.drawImage(bitmap, 0, 0);
+    bitmap.close();
+    const ssim = structuralSimilarity(reference, toLuminance(context.getImageData(0, 0, width, height).data), width, height);
+    decoded.width = 0;
+    decoded.height = 0;
+    return { bytes, quality, ssim };
+  };
+
+  let low = minQuality;
+  let high = 1;
+  let best: SsimJpeg | undefined;
+  for (let step = 0; step < SEARCH_STEPS; step++) {
+    const candidate = await tryQuality(Math.round(((low + high) / 2) * 100) / 100);
+    if (candidate.ssim >= minSSIM) {
+      best = candidate;
+      high = candidate.quality;
+    } else {
+      low = candidate.quality;
+    }
+  }
+
+  return best ?? tryQuality(1);
+}
+
+function encodeJpeg(canvas: HTMLCanvasElement, quality: number): Uint8Array {
+  const base64Data = canvas.toDataURL('image/jpeg', quality).split(',')[1];
+  return Uint8Array.from(atob(base64Data), c => c.charCodeAt(0));
+}
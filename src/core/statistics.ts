@@ -0,0 +1,206 @@
+/**
+ * Document statistics for overview panels
+ */
+
+import { PDFArray, PDFBool, PDFDict, PDFDocument, PDFName, PDFObject, PDFRef, PDFStream } from 'pdf-lib';
+import type { DocumentStatistics, LargeObject, PageImageSummary } from '../api/types';
+import { analyzePage } from './page-analysis';
+import { lookupArray, lookupDict, lookupName, lookupNumber, readNameTree } from './pdf-objects';
+import { isLinearized, toLatin1 } from './raw-pdf';
+
+const FONT_FILE_KEYS = ['FontFile', 'FontFile2', 'FontFile3'];
+
+/** Keys that lead from a page's objects back up to pages */
+const BACK_REFERENCE_KEYS = new Set(['Parent', 'P']);
+
+/** Keys whose name describes an untyped stream they point to */
+const DESCRIPTIVE_KEYS = new Set([...FONT_FILE_KEYS, 'Contents', 'ToUnicode', 'CIDToGIDMap', 'CIDSet']);
+
+/**
+ * Gathers document statistics in one pass over the objects
+ */
+export function readStatistics(pdfDoc: PDFDocument, pdfBuffer: ArrayBuffer): DocumentStatistics {
+  let imageCount = 0;
+  let imageBytes = 0;
+  let fontCount = 0;
+  let embeddedFontCount = 0;
+
+  for (const [, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    if (object instanceof PDFStream) {
+      if (lookupName(object.dict, 'Subtype') === 'Image') {
+        imageCount++;
+        imageBytes += object.getContentsSize();
+      }
+    } else if (object instanceof PDFDict && lookupName(object, 'Type') === 'Font') {
+      // Descendant fonts are counted through their Type0 parent
+      const subtype = lookupName(object, 'Subtype');
+      if (subtype === 'CIDFontType0' || subtype === 'CIDFontType2') continue;
+
+      fontCount++;
+      if (isEmbeddedFont(object)) embeddedFontCount++;
+    }
+  }
+
+  let annotationCount = 0;
+  let hasFileAttachmentAnnots = false;
+  for (const page of pdfDoc.getPages()) {
+    const annots = page.node.Annots();
+    if (!annots) continue;
+    annotationCount += annots.size();
+    for (let i = 0; i < annots.size(); i++) {
+      const annot = annots.lookup(i);
+      if (annot instanceof PDFDict && lookupName(annot, 'Subtype') === 'FileAttachment') {
+        hasFileAttachmentAnnots = true;
+      }
+    }
+  }
+
+  const acroForm = lookupDict(pdfDoc.catalog, 'AcroForm');
+  const fields = acroForm && lookupArray(acroForm, 'Fields');
+  const names = lookupDict(pdfDoc.catalog, 'Names');
+  const embeddedFiles = names && lookupDict(names, 'EmbeddedFiles');
+  const markInfo = lookupDict(pdfDoc.catalog, 'MarkInfo');
+
+  return {
+    fileBytes: pdfBuffer.byteLength,
+    pageCount: pdfDoc.getPageCount(),
+    imageCount,
+    imageBytes,
+    fontCount,
+    embeddedFontCount,
+    annotationCount,
+    hasForms: (fields !== undefined && fields.size() > 0) || (acroForm?.has(PDFName.of('XFA')) ?? false),
+    hasAttachments: (embeddedFiles !== undefined && readNameTree(embeddedFiles).size > 0) || hasFileAttachmentAnnots,
+    isTagged: pdfDoc.catalog.has(PDFName.of('StructTreeRoot')) &&
+      markInfo?.lookup(PDFName.of('Marked')) === PDFBool.True,
+    isLinearized: isLinearized(toLatin1(pdfBuffer.slice(0, 1024))),
+    isEncrypted: pdfDoc.isEncrypted || pdfDoc.context.trailerInfo.Encrypt !== undefined,
+  };
+}
+
+/**
+ * Lists the objects with the largest serialized size, biggest first,
+ * with the pages that use each one
+ */
+export function findLargestObjects(pdfDoc: PDFDocument, count: number, fileBytes: number): LargeObject[] {
+  const context = pdfDoc.context;
+  const largest = context.enumerateIndirectObjects()
+    .map(([ref, object]) => ({ ref, object, bytes: object.sizeInBytes() }))
+    .sort((a, b) => b.bytes - a.bytes)
+    .slice(0, count);
+
+  const usages = new Map(largest.map(({ ref }) => [ref, { pages: [] as number[], key: undefined as string | undefined }]));
+
+  pdfDoc.getPages().forEach((page, index) => {
+    const visited = new Set<PDFRef>();
+    const stack: Array<[PDFObject, string | undefined]> = [[page.ref, undefined]];
+
+    while (stack.length > 0) {
+      const [value, key] = stack.pop()!;
+      if (value instanceof PDFRef) {
+        if (visited.has(value)) continue;
+        visited.add(value);
+
+        const usage = usages.get(value);
+        if (usage) {
+          usage.pages.push(index + 1);
+          usage.key ??= key;
+        }
+        const target = context.lookup(value);
+        if (target) stack.push([target, key]);
+      } else if (value instanceof PDFDict || value instanceof PDFStream) {
+        const dict = value instanceof PDFStream ? value.dict : value;
+        // Link destinations name other pages; don't count their content here
+        if (dict !== page.node && lookupName(dict, 'Type') === 'Page') continue;
+        for (const [name, child] of dict.entries()) {
+          if (!BACK_REFERENCE_KEYS.has(name.decodeText())) stack.push([child, name.decodeText()]);
+        }
+      } else if (value instanceof PDFArray) {
+        for (const child of value.asArray()) stack.push([child, key]);
+      }
+    }
+  });
+
+  return largest.map(({ ref, object, bytes }) => {
+    const usage = usages.get(ref)!;
+    return {
+      object: ref.toString(),
+      type: describeObject(object, usage.key),
+      bytes,
+      share: fileBytes > 0 ? bytes / fileBytes : 0,
+      pages: usage.pages,
+    };
+  });
+}
+
+/**
+ * Counts each page's images with their stored size and the highest
+ * effective resolution they're drawn at
+ *
+ * An image drawn several times on a page counts once, at its highest
+ * resolution; an image shared by several pages counts on each.
+ */
+export function readPageImageSummaries(pdfDoc: PDFDocument): PageImageSummary[] {
+  return pdfDoc.getPages().map((page, index) => {
+    const streams = new Set<PDFStream>();
+    let inlineImages = 0;
+    let maxEffectiveDPI: number | null = null;
+
+    for (const image of analyzePage(page).images) {
+      if (image.stream) streams.add(image.stream);
+      else inlineImages++;
+
+      // An image fills its placed box, so pixels per point give the resolution
+      if (image.placedWidth > 0 && image.placedHeight > 0) {
+        const dpi = Math.min((image.width * 72) / image.placedWidth, (image.height * 72) / image.placedHeight);
+        maxEffectiveDPI = Math.max(maxEffectiveDPI ?? 0, Math.round(dpi));
+      }
+    }
+
+    return {
+      page: index + 1,
+      imageCount: streams.size + inlineImages,
+      totalImageBytes: [...streams].reduce((total, stream) => total + stream.getContentsSize(), 0),
+      maxEffectiveDPI,
+    };
+  });
+}
+
+/**
+ * Names what an object is from its Type or Subtype, or for untyped
+ * streams the key that refers to them
+ */
+function describeObject(object: PDFObject, key: string | undefined): string {
+  const dict = object instanceof PDFStream ? object.dict : object instanceof PDFDict ? object : undefined;
+  if (dict) {
+    const type = lookupName(dict, 'Type');
+    const subtype = lookupName(dict, 'Subtype');
+    if (type === 'XObject' || subtype === 'Image' || subtype === 'Form') return subtype ?? 'XObject';
+    if (type) return type;
+    if (key && DESCRIPTIVE_KEYS.has(key)) return key;
+    if (object instanceof PDFStream && lookupNumber(dict, 'N') !== undefined) return 'ICCProfile';
+  }
+  if (object instanceof PDFStream) return 'Stream';
+  if (object instanceof PDFDict) return 'Dictionary';
+  if (object instanceof PDFArray) return 'Array';
+  return 'Object';
+}
+
+/**
+ * Whether a font's program is embedded (Type 3 fonts always are)
+ */
+export function isEmbeddedFont(font: PDFDict): boolean {
+  const subtype = lookupName(font, 'Subtype');
+  // Type 3 glyphs are content streams inside the document
+  if (subtype === 'Type3') return true;
+
+  let descriptorOwner: PDFDict | undefined = font;
+  if (subtype === 'Type0') {
+    const descendants = font.lookup(PDFName.of('DescendantFonts'));
+    const descendant = descendants instanceof PDFArray ? descendants.lookup(0) : undefined;
+    descriptorOwner = descendant instanceof PDFDict ? descendant : undefined;
+  }
+
+  const descriptor = descriptorOwner && lookupDict(descriptorOwner, 'FontDescriptor');
+  return descriptor !== undefined && FONT_FILE_KEYS.some(key => descriptor.has(PDFName.of(key)));
+}
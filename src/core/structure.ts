@@ -0,0 +1,132 @@
+/**
+ * Tagged structure reading for accessibility audits
+ */
+
+import { PDFArray, PDFBool, PDFDict, PDFDocument, PDFName, PDFRef } from 'pdf-lib';
+import type { StructElement, StructTreeReport } from '../api/types';
+import { PAINTING_OPERATORS, parsePageContent } from './content-stream';
+import type { ContentOperation } from './content-stream';
+import { lookupDict, lookupName, lookupText } from './pdf-objects';
+
+/**
+ * Reads the structure tree and audits tagging coverage
+ */
+export function readStructTree(pdfDoc: PDFDocument): StructTreeReport {
+  const structRoot = lookupDict(pdfDoc.catalog, 'StructTreeRoot');
+  const markInfo = lookupDict(pdfDoc.catalog, 'MarkInfo');
+  const marked = markInfo?.lookup(PDFName.of('Marked'));
+  const tagged = structRoot !== undefined && marked instanceof PDFBool && marked.asBoolean();
+
+  const untaggedContentCount = pdfDoc.getPages()
+    .reduce((count, page) => count + countUntaggedOperations(parsePageContent(page)), 0);
+
+  if (!structRoot) {
+    return { tagged: false, tree: [], untaggedContentCount, figuresMissingAlt: [] };
+  }
+
+  const pageNumbers = new Map<string, number>();
+  pdfDoc.getPages().forEach((page, index) => pageNumbers.set(page.ref.toString(), index + 1));
+
+  const roleMap = lookupDict(structRoot, 'RoleMap');
+  const context: WalkContext = { pageNumbers, roleMap, visited: new Set(), figuresMissingAlt: [] };
+  const tree = readKids(structRoot, undefined, context);
+
+  return { tagged, tree, untaggedContentCount, figuresMissingAlt: context.figuresMissingAlt };
+}
+
+interface WalkContext {
+  pageNumbers: Map<string, number>;
+  roleMap?: PDFDict;
+  visited: Set<PDFDict>;
+  figuresMissingAlt: StructElement[];
+}
+
+function readKids(parent: PDFDict, page: number | undefined, context: WalkContext): StructElement[] {
+  const kids = parent.lookup(PDFName.of('K'));
+  const items = kids instanceof PDFArray ? kids.asArray().map(kid => parent.context.lookup(kid)) : [kids];
+  const elements: StructElement[] = [];
+
+  for (const item of items) {
+    // Skip marked-content ids and content/object references
+    if (!(item instanceof PDFDict) || item.has(PDFName.of('MCID')) || lookupName(item, 'Type') === 'OBJR') {
+      continue;
+    }
+    if (context.visited.has(item)) continue;
+    context.visited.add(item);
+
+    const element = readElement(item, page, context);
+    if (element) elements.push(element);
+  }
+
+  return elements;
+}
+
+function readElement(dict: PDFDict, inheritedPage: number | undefined, context: WalkContext): StructElement | undefined {
+  const type = lookupName(dict, 'S');
+  if (!type) return undefined;
+
+  const pageRef = dict.get(PDFName.of('Pg'));
+  const page = pageRef instanceof PDFRef ? context.pageNumbers.get(pageRef.toString()) : inheritedPage;
+  const role = resolveRole(type, context.roleMap);
+  const alt = lookupText(dict, 'Alt') ?? lookupText(dict, 'ActualText');
+
+  const element: StructElement = {
+    type,
+    ...(role !== type && { role }),
+    ...(alt !== undefined && { alt }),
+    hasAlt: alt !== undefined && alt.trim() !== '',
+    page: page ?? null,
+    children: [],
+  };
+
+  if (role === 'Figure' && !element.hasAlt) {
+    context.figuresMissingAlt.push(element);
+  }
+
+  element.children = readKids(dict, page, context);
+  return element;
+}
+
+/**
+ * Follows the RoleMap from a custom structure type to a standard one
+ */
+function resolveRole(type: string, roleMap: PDFDict | undefined): string {
+  const seen = new Set<string>();
+  let current = type;
+  while (roleMap && !seen.has(current)) {
+    seen.add(current);
+    const mapped = lookupName(roleMap, current);
+    if (!mapped) break;
+    current = mapped;
+  }
+  return current;
+}
+
+/**
+ * Counts painting operations outside tagged marked content (those with an
+ * MCID) and outside artifacts
+ */
+function countUntaggedOperations(operations: ContentOperation[]): number {
+  // One entry per open marked-content sequence: is it tagged or an artifact?
+  const stack: boolean[] = [];
+  let coveredDepth = 0;
+  let count = 0;
+
+  for (const { operator, operands } of operations) {
+    if (operator === 'BMC' || operator === 'BDC') {
+      const tag = operands[0];
+      const properties = operands[1];
+      const hasMcid = typeof properties === 'object' && properties !== null && !Array.isArray(properties) &&
+        properties.kind === 'dict' && 'MCID' in properties.entries;
+      const covered = tag === '/Artifact' || hasMcid;
+      stack.push(covered);
+      if (covered) coveredDepth++;
+    } else if (operator === 'EMC') {
+      if (stack.pop()) coveredDepth--;
+    } else if (PAINTING_OPERATORS.has(operator) && coveredDepth === 0) {
+      count++;
+    }
+  }
+
+  return count;
+}
@@ -0,0 +1,1202 @@
+/**
+ * Page to SVG conversion
+ *
+ * Vector content is interpreted from the page's content streams and
+ * annotation appearances. Text comes from pdf.js, which knows each font's
+ * Unicode mapping, and is set in a generic font family with the paint and
+ * render mode of the text operator it came from, stretched to the
+ * original width.
+ *
+ * Converted: paths and clipping; gray, RGB, CMYK, ICC-based and indexed
+ * colors; line styles; constant opacity and blend modes; form XObjects;
+ * JPEG images and uncompressed-codec images of up to 16 bits per
+ * component (with same-size soft masks); stencil masks; and axial or
+ * radial shadings with exponential or stitching functions. Everything
+ * else (mesh and function-based shadings, sampled or PostScript shading
+ * functions, tiling patterns, soft masks in graphics states, inline
+ * images, JPEG 2000, JBIG2 and CCITT images) is left out and listed, so
+ * the caller can fall back to a raster. Separation, DeviceN and Lab
+ * colors are approximated in gray and listed too.
+ */
+
+import {
+  PDFArray,
+  PDFBool,
+  PDFDict,
+  PDFHexString,
+  PDFName,
+  PDFObject,
+  PDFPage,
+  PDFRawStream,
+  PDFStream,
+  PDFString,
+} from 'pdf-lib';
+import type { PDFDocumentProxy } from 'pdfjs-dist';
+import type { ContentOperand } from '../api/types';
+import { HIDDEN_FLAG, placeAppearance } from './annotations';
+import { parseContentStream, parsePageContent } from './content-stream';
+import type { ContentOperation } from './content-stream';
+import { multiplyMatrix } from './page-analysis';
+import type { Matrix } from './page-analysis';
+import { getPageRotation } from './pages';
+import {
+  decodeOuterFilters,
+  decodeStreamContents,
+  getFilters,
+  lookupArray,
+  lookupDict,
+  lookupName,
+  lookupNumber,
+  toNumberArray,
+} from './pdf-objects';
+import { createCanvas } from './render';
+
+const IDENTITY: Matrix = [1, 0, 0, 1, 0, 0];
+const MAX_FORM_DEPTH = 8;
+
+/** Annotation flag: not displayed on screen (printing only) */
+const NO_VIEW_FLAG = 1 << 5;
+
+/** Evenly spaced samples per shading function when building gradient stops */
+const GRADIENT_SAMPLES = 16;
+
+/** PDF blend modes with a CSS mix-blend-mode equivalent */
+const BLEND_MODES = new Set([
+  'Multiply', 'Screen', 'Overlay', 'Darken', 'Lighten', 'ColorDodge', 'ColorBurn', 'HardLight',
+  'SoftLight', 'Difference', 'Exclusion', 'Hue', 'Saturation', 'Color', 'Luminosity',
+]);
+
+const LINE_CAPS = ['butt', 'round', 'square'];
+const LINE_JOINS = ['miter', 'round', 'bevel'];
+
+/**
+ * Text item from pdf.js, with its font's generic family
+ */
+export interface SvgTextItem {
+  str: string;
+  transform: number[];
+  width: number;
+  fontFamily?: string;
+}
+
+/**
+ * Converted page
+ */
+export interface PageSvg {
+  svg: string;
+  /** Constructs left out or approximated; empty if the conversion is complete */
+  unsupported: string[];
+}
+
+interface ColorSpace {
+  family: 'gray' | 'rgb' | 'cmyk' | 'indexed' | 'tint' | 'lab' | 'pattern';
+  components: number;
+  /** Indexed base space */
+  base?: ColorSpace;
+  /** Indexed palette */
+  lookup?: Uint8Array;
+}
+
+type Rgb = [number, number, number];
+
+/**
+ * SVG paint: a color, a shading pattern (with the matrix from pattern
+ * space to page space), or nothing
+ */
+type Paint = { color: string } | { shading: PDFDict; toPage: Matrix } | undefined;
+
+interface GraphicsState {
+  ctm: Matrix;
+  fillSpace: ColorSpace;
+  strokeSpace: ColorSpace;
+  fill: Paint;
+  stroke: Paint;
+  /** Plain fill color, for stencil masks */
+  fillRgb?: Rgb;
+  fillAlpha: number;
+  strokeAlpha: number;
+  lineWidth: number;
+  lineCap: number;
+  lineJoin: number;
+  miterLimit: number;
+  dash: number[];
+  dashPhase: number;
+  /** CSS mix-blend-mode */
+  blend?: string;
+  /** Id of the clipPath in effect */
+  clip?: string;
+  renderMode: number;
+}
+
+/**
+ * Where a text showing operator started, and the state it painted with
+ */
+interface TextRun {
+  x: number;
+  y: number;
+  state: GraphicsState;
+  /** Position among the page's elements, to keep the drawing order */
+  order: number;
+}
+
+interface Writer {
+  defs: string[];
+  elements: Array<{ clip?: string; markup: string; order: number }>;
+  runs: TextRun[];
+  unsupported: Set<string>;
+  nextId: number;
+  /** Page area in page space, for painting shadings with sh */
+  area: { x: number; y: number; width: number; height: number };
+  activeForms: Set<PDFStream>;
+}
+
+const DEVICE_GRAY: ColorSpace = { family: 'gray', components: 1 };
+const DEVICE_RGB: ColorSpace = { family: 'rgb', components: 3 };
+const DEVICE_CMYK: ColorSpace = { family: 'cmyk', components: 4 };
+
+/**
+ * Reads a page's text items with their font families (1-indexed page)
+ */
+export async function readSvgText(pdfDocument: PDFDocumentProxy, pageNum: number): Promise<SvgTextItem[]> {
+  const page = await pdfDocument.getPage(pageNum);
+  const content = await page.getTextContent();
+  const items: SvgTextItem[] = [];
+
+  for (const item of content.items) {
+    if (!('str' in item) || !item.str.trim()) continue;
+    items.push({
+      str: item.str,
+      transform: item.transform,
+      width: item.width,
+      fontFamily: content.styles[item.fontName]?.fontFamily,
+    });
+  }
+  return items;
+}
+
+/**
+ * Converts a page's content, annotation appearances and text to SVG
+ */
+export function convertPageToSvg(page: PDFPage, text: SvgTextItem[]): PageSvg {
+  const frame = pageFrame(page);
+  const box = page.getCropBox();
+  const writer: Writer = {
+    defs: [],
+    elements: [],
+    runs: [],
+    unsupported: new Set(),
+    nextId: 0,
+    area: box,
+    activeForms: new Set(),
+  };
+
+  interpret(writer, parsePageContent(page), page.node.Resources(), initialState(IDENTITY), IDENTITY, 0);
+  drawAnnotations(writer, page);
+
+  for (const item of text) {
+    const run = findRun(writer.runs, item);
+    const element = textElement(writer, item, run?.state, false);
+    if (element) {
+      writer.elements.push({ clip: run?.state.clip, markup: element, order: run ? run.order : Infinity });
+    }
+  }
+
+  const unsupported = [...writer.unsupported];
+  return { svg: assemble(writer, frame, unsupported), unsupported };
+}
+
+/**
+ * Wraps a rendered image of the page in SVG, with the text on top,
+ * transparent, so it stays selectable and searchable
+ *
+ * @param imageUrl - Data URL of the page rendered at any scale
+ * @param unsupported - Why the vector conversion was replaced, noted in a
+ *   comment
+ */
+export function rasterPageToSvg(page: PDFPage, imageUrl: string, text: SvgTextItem[], unsupported: string[]): string {
+  const frame = pageFrame(page);
+  const writer: Writer = {
+    defs: [],
+    elements: [],
+    runs: [],
+    unsupported: new Set(),
+    nextId: 0,
+    area: page.getCropBox(),
+    activeForms: new Set(),
+  };
+
+  text.forEach((item, order) => {
+    const element = textElement(writer, item, undefined, true);
+    if (element) writer.elements.push({ markup: element, order });
+  });
+
+  const underlay = `<image width="${fmt(frame.width)}" height="${fmt(frame.height)}" ` +
+    `preserveAspectRatio="none" href="${imageUrl}"/>`;
+  return assemble(writer, frame, unsupported, underlay);
+}
+
+/**
+ * Size of the displayed page and the matrix from page space to SVG space
+ * (crop box at the origin, y down, page rotation applied)
+ */
+function pageFrame(page: PDFPage): { width: number; height: number; matrix: Matrix } {
+  const { x, y, width, height } = page.getCropBox();
+  const rotation = getPageRotation(page);
+
+  const orient: Matrix = rotation === 90
+    ? [0, 1, 1, 0, 0, 0]
+    : rotation === 180
+      ? [-1, 0, 0, 1, width, 0]
+      : rotation === 270
+        ? [0, -1, -1, 0, height, width]
+        : [1, 0, 0, -1, 0, height];
+
+  return {
+    width: rotation % 180 === 0 ? width : height,
+    height: rotation % 180 === 0 ? height : width,
+    matrix: multiplyMatrix([1, 0, 0, 1, -x, -y], orient),
+  };
+}
+
+function initialState(ctm: Matrix): GraphicsState {
+  return {
+    ctm,
+    fillSpace: DEVICE_GRAY,
+    strokeSpace: DEVICE_GRAY,
+    fill: { color: '#000000' },
+    stroke: { color: '#000000' },
+    fillRgb: [0, 0, 0],
+    fillAlpha: 1,
+    strokeAlpha: 1,
+    lineWidth: 1,
+    lineCap: 0,
+    lineJoin: 0,
+    miterLimit: 10,
+    dash: [],
+    dashPhase: 0,
+    renderMode: 0,
+  };
+}
+
+/**
+ * Interprets content stream operations, adding SVG elements to the writer
+ *
+ * @param base - Matrix from this stream's default space to page space,
+ *   which shading patterns are defined against
+ */
+function interpret(
+  writer: Writer,
+  operations: ContentOperation[],
+  resources: PDFDict | undefined,
+  initial: GraphicsState,
+  base: Matrix,
+  depth: number
+): void {
+  const stack: GraphicsState[] = [];
+  let state = initial;
+
+  let path: string[] = [];
+  let current: [number, number] = [0, 0];
+  let pendingClip: 'nonzero' | 'evenodd' | undefined;
+
+  let textMatrix = IDENTITY;
+  let lineMatrix = IDENTITY;
+  let leading = 0;
+  let rise = 0;
+
+  const paintPath = (fillRule: 'nonzero' | 'evenodd' | undefined, stroke: boolean, close = false): void => {
+    if (close) path.push('Z');
+    if (path.length > 0) {
+      const d = path.join(' ');
+      if (fillRule || stroke) drawPath(writer, state, d, fillRule, stroke);
+      if (pendingClip) state = { ...state, clip: addClip(writer, state, d, pendingClip) };
+    }
+    path = [];
+    pendingClip = undefined;
+  };
+
+  const moveText = (tx: number, ty: number): void => {
+    lineMatrix = multiplyMatrix([1, 0, 0, 1, tx, ty], lineMatrix);
+    textMatrix = lineMatrix;
+  };
+
+  const showText = (): void => {
+    const origin = multiplyMatrix([1, 0, 0, 1, 0, rise], multiplyMatrix(textMatrix, state.ctm));
+    writer.runs.push({ x: origin[4], y: origin[5], state, order: writer.elements.length - 0.5 });
+    if (state.renderMode >= 4) writer.unsupported.add('text used as a clipping path (drawn, not clipped)');
+  };
+
+  for (const { operator, operands } of operations) {
+    const numbers = operands.filter((value): value is number => typeof value === 'number');
+    const name = operands.find((value): value is string => typeof value === 'string')?.slice(1);
+
+    switch (operator) {
+      // Graphics state
+      case 'q':
+        stack.push(state);
+        break;
+      case 'Q':
+        state = stack.pop() ?? state;
+        break;
+      case 'cm':
+        if (numbers.length === 6) state = { ...state, ctm: multiplyMatrix(numbers as Matrix, state.ctm) };
+        break;
+      case 'w':
+        if (numbers.length === 1) state = { ...state, lineWidth: numbers[0] };
+        break;
+      case 'J':
+        if (numbers.length === 1) state = { ...state, lineCap: numbers[0] };
+        break;
+      case 'j':
+        if (numbers.length === 1) state = { ...state, lineJoin: numbers[0] };
+        break;
+      case 'M':
+        if (numbers.length === 1) state = { ...state, miterLimit: numbers[0] };
+        break;
+      case 'd': {
+        const array = operands[0];
+        if (Array.isArray(array)) {
+          const dash = array.filter((value): value is number => typeof value === 'number');
+          state = { ...state, dash, dashPhase: typeof operands[1] === 'number' ? operands[1] : 0 };
+        }
+        break;
+      }
+      case 'gs': {
+        const states = resources && lookupDict(resources, 'ExtGState');
+        const ext = name !== undefined ? states?.lookup(PDFName.of(name)) : undefined;
+        if (ext instanceof PDFDict) state = applyExtGState(writer, state, ext);
+        break;
+      }
+
+      // Color
+      case 'g':
+      case 'G':
+      case 'rg':
+      case 'RG':
+      case 'k':
+      case 'K': {
+        const space = operator.toLowerCase() === 'g' ? DEVICE_GRAY : operator.toLowerCase() === 'rg' ? DEVICE_RGB : DEVICE_CMYK;
+        state = setColor(writer, state, operator === operator.toLowerCase(), space, operands, resources, base);
+        break;
+      }
+      case 'cs':
+      case 'CS': {
+        const space = name !== undefined ? resolveColorSpace(writer, name, resources) : undefined;
+        if (!space) break;
+        const initialColor = space.family === 'cmyk' ? [0, 0, 0, 1] : space.family === 'tint' ? [1] : [0, 0, 0].slice(0, space.components);
+        const fill = operator === 'cs';
+        state = { ...state, [fill ? 'fillSpace' : 'strokeSpace']: space };
+        state = setColor(writer, state, fill, space, space.family === 'pattern' ? [] : initialColor, resources, base);
+        break;
+      }
+      case 'sc':
+      case 'scn':
+        state = setColor(writer, state, true, state.fillSpace, operands, resources, base);
+        break;
+      case 'SC':
+      case 'SCN':
+        state = setColor(writer, state, false, state.strokeSpace, operands, resources, base);
+        break;
+
+      // Path construction
+      case 'm':
+        if (numbers.length === 2) {
+          path.push(`M${fmt(numbers[0])} ${fmt(numbers[1])}`);
+          current = [numbers[0], numbers[1]];
+        }
+        break;
+      case 'l':
+        if (numbers.length === 2) {
+          path.push(`L${fmt(numbers[0])} ${fmt(numbers[1])}`);
+          current = [numbers[0], numbers[1]];
+        }
+        break;
+      case 'c':
+        if (numbers.length === 6) {
+          path.push(`C${numbers.map(fmt).join(' ')}`);
+          current = [numbers[4], numbers[5]];
+        }
+        break;
+      case 'v':
+        if (numbers.length === 4) {
+          path.push(`C${[...current, ...numbers].map(fmt).join(' ')}`);
+          current = [numbers[2], numbers[3]];
+        }
+        break;
+      case 'y':
+        if (numbers.length === 4) {
+          path.push(`C${[...numbers, numbers[2], numbers[3]].map(fmt).join(' ')}`);
+          current = [numbers[2], numbers[3]];
+        }
+        break;
+      case 'h':
+        path.push('Z');
+        break;
+      case 're':
+        if (numbers.length === 4) {
+          const [x, y, width, height] = numbers;
+          path.push(`M${fmt(x)} ${fmt(y)}H${fmt(x + width)}V${fmt(y + height)}H${fmt(x)}Z`);
+          current = [x, y];
+        }
+        break;
+
+      // Path painting and clipping
+      case 'S':
+        paintPath(undefined, true);
+        break;
+      case 's':
+        paintPath(undefined, true, true);
+        break;
+      case 'f':
+      case 'F':
+        paintPath('nonzero', false);
+        break;
+      case 'f*':
+        paintPath('evenodd', false);
+        break;
+      case 'B':
+        paintPath('nonzero', true);
+        break;
+      case 'B*':
+        paintPath('evenodd', true);
+        break;
+      case 'b':
+        paintPath('nonzero', true, true);
+        break;
+      case 'b*':
+        paintPath('evenodd', true, true);
+        break;
+      case 'n':
+        paintPath(undefined, false);
+        break;
+      case 'W':
+        pendingClip = 'nonzero';
+        break;
+      case 'W*':
+        pendingClip = 'evenodd';
+        break;
+
+      // Shadings, XObjects and inline images
+      case 'sh': {
+        const shadings = resources && lookupDict(resources, 'Shading');
+        const shading = name !== undefined ? shadings?.lookup(PDFName.of(name)) : undefined;
+        const dict = shading instanceof PDFStream ? shading.dict : shading;
+        const id = dict instanceof PDFDict ? shadingGradient(writer, dict, state.ctm) : undefined;
+        if (id) {
+          const { x, y, width, height } = writer.area;
+          emit(writer, state, `<rect x="${fmt(x)}" y="${fmt(y)}" width="${fmt(width)}" height="${fmt(height)}" ` +
+            `fill="url(#${id})"${opacity('fill-opacity', state.fillAlpha)}/>`);
+        }
+        break;
+      }
+      case 'Do':
+        if (name !== undefined) drawXObject(writer, name, resources, state, depth);
+        break;
+      case 'BI':
+        writer.unsupported.add('inline images');
+        break;
+
+      // Text
+      case 'BT':
+        textMatrix = IDENTITY;
+        lineMatrix = IDENTITY;
+        break;
+      case 'Tm':
+        if (numbers.length === 6) {
+          lineMatrix = numbers as Matrix;
+          textMatrix = lineMatrix;
+        }
+        break;
+      case 'Td':
+        if (numbers.length === 2) moveText(numbers[0], numbers[1]);
+        break;
+      case 'TD':
+        if (numbers.length === 2) {
+          leading = -numbers[1];
+          moveText(numbers[0], numbers[1]);
+        }
+        break;
+      case 'T*':
+        moveText(0, -leading);
+        break;
+      case 'TL':
+        if (numbers.length === 1) leading = numbers[0];
+        break;
+      case 'Ts':
+        if (numbers.length === 1) rise = numbers[0];
+        break;
+      case 'Tr':
+        if (numbers.length === 1) state = { ...state, renderMode: numbers[0] };
+        break;
+      case 'Tj':
+      case 'TJ':
+        showText();
+        break;
+      case "'":
+      case '"':
+        moveText(0, -leading);
+        showText();
+        break;
+    }
+  }
+}
+
+function drawPath(
+  writer: Writer,
+  state: GraphicsState,
+  d: string,
+  fillRule: 'nonzero' | 'evenodd' | undefined,
+  stroke: boolean
+): void {
+  const fill = fillRule ? paintValue(writer, state.fill, state.ctm) : 'none';
+  const strokePaint = stroke ? paintValue(writer, state.stroke, state.ctm) : 'none';
+  if (fill === 'none' && strokePaint === 'none') return;
+
+  let attributes = `d="${d}" transform="${matrixAttr(state.ctm)}" fill="${fill}"`;
+  if (fill !== 'none') {
+    if (fillRule === 'evenodd') attributes += ' fill-rule="evenodd"';
+    attributes += opacity('fill-opacity', state.fillAlpha);
+  }
+  if (strokePaint !== 'none') attributes += strokeAttributes(state, strokePaint);
+  emit(writer, state, `<path ${attributes}/>`);
+}
+
+function strokeAttributes(state: GraphicsState, paint: string): string {
+  // Width 0 means the thinnest line the device can draw
+  let attributes = state.lineWidth > 0
+    ? ` stroke="${paint}" stroke-width="${fmt(state.lineWidth)}"`
+    : ` stroke="${paint}" stroke-width="1" vector-effect="non-scaling-stroke"`;
+  if (state.lineCap > 0) attributes += ` stroke-linecap="${LINE_CAPS[state.lineCap] ?? 'butt'}"`;
+  if (state.lineJoin > 0) attributes += ` stroke-linejoin="${LINE_JOINS[state.lineJoin] ?? 'miter'}"`;
+  if (state.miterLimit !== 4) attributes += ` stroke-miterlimit="${fmt(Math.max(1, state.miterLimit))}"`;
+  if (state.dash.some(length => length > 0)) {
+    attributes += ` stroke-dasharray="${state.dash.map(fmt).join(' ')}"`;
+    if (state.dashPhase) attributes += ` stroke-dashoffset="${fmt(state.dashPhase)}"`;
+  }
+  return attributes + opacity('stroke-opacity', state.strokeAlpha);
+}
+
+/**
+ * Adds a clipPath intersected with the current one
+ *
+ * @returns Its id
+ */
+function addClip(writer: Writer, state: GraphicsState, d: string, rule: 'nonzero' | 'evenodd'): string {
+  const id = `c${writer.nextId++}`;
+  const parent = state.clip ? ` clip-path="url(#${state.clip})"` : '';
+  const clipRule = rule === 'evenodd' ? ' clip-rule="evenodd"' : '';
+  writer.defs.push(`<clipPath id="${id}" clipPathUnits="userSpaceOnUse"${parent}>` +
+    `<path d="${d}" transform="${matrixAttr(state.ctm)}"${clipRule}/></clipPath>`);
+  return id;
+}
+
+function emit(writer: Writer, state: GraphicsState, markup: string): void {
+  const styled = state.blend ? markup.replace(/^<(\w+)/, `<$1 style="mix-blend-mode:${state.blend}"`) : markup;
+  writer.elements.push({ clip: state.clip, markup: styled, order: writer.elements.length });
+}
+
+function applyExtGState(writer: Writer, state: GraphicsState, ext: PDFDict): GraphicsState {
+  const next = { ...state };
+  next.lineWidth = lookupNumber(ext, 'LW') ?? next.lineWidth;
+  next.lineCap = lookupNumber(ext, 'LC') ?? next.lineCap;
+  next.lineJoin = lookupNumber(ext, 'LJ') ?? next.lineJoin;
+  next.miterLimit = lookupNumber(ext, 'ML') ?? next.miterLimit;
+  next.strokeAlpha = lookupNumber(ext, 'CA') ?? next.strokeAlpha;
+  next.fillAlpha = lookupNumber(ext, 'ca') ?? next.fillAlpha;
+
+  const dash = lookupArray(ext, 'D');
+  const dashArray = dash?.lookup(0);
+  if (dashArray instanceof PDFArray) {
+    next.dash = toNumberArray(dashArray);
+    next.dashPhase = dash!.size() > 1 ? toNumberArray(dash!)[1] ?? 0 : 0;
+  }
+
+  const blend = ext.lookup(PDFName.of('BM'));
+  const blendName = blend instanceof PDFArray ? blend.lookup(0) : blend;
+  if (blendName instanceof PDFName) {
+    const mode = blendName.decodeText();
+    next.blend = BLEND_MODES.has(mode) ? mode.replace(/([a-z])([A-Z])/g, '$1-$2').toLowerCase() : undefined;
+  }
+
+  const softMask = ext.lookup(PDFName.of('SMask'));
+  if (softMask instanceof PDFDict) writer.unsupported.add('soft masks (content drawn unmasked)');
+
+  return next;
+}
+
+/**
+ * Sets the fill or stroke color from color operands in the given space
+ */
+function setColor(
+  writer: Writer,
+  state: GraphicsState,
+  fill: boolean,
+  space: ColorSpace,
+  operands: ContentOperand[],
+  resources: PDFDict | undefined,
+  base: Matrix
+): GraphicsState {
+  let paint: Paint;
+  let rgb: Rgb | undefined;
+
+  if (space.family === 'pattern') {
+    const name = operands.find((value): value is string => typeof value === 'string');
+    const patterns = resources && lookupDict(resources, 'Pattern');
+    const pattern = name !== undefined ? patterns?.lookup(PDFName.of(name.slice(1))) : undefined;
+    paint = pattern !== undefined ? patternPaint(writer, pattern, base) : undefined;
+  } else {
+    const components = operands.filter((value): value is number => typeof value === 'number');
+    rgb = toRgb(writer, space, components);
+    paint = { color: hex(rgb) };
+  }
+
+  const next = { ...state, [fill ? 'fillSpace' : 'strokeSpace']: space };
+  if (fill) return { ...next, fill: paint, fillRgb: rgb };
+  return { ...next, stroke: paint };
+}
+
+function patternPaint(writer: Writer, pattern: PDFObject, base: Matrix): Paint {
+  if (pattern instanceof PDFStream) {
+    writer.unsupported.add('tiling patterns');
+    return undefined;
+  }
+  if (!(pattern instanceof PDFDict)) return undefined;
+
+  const shading = pattern.lookup(PDFName.of('Shading'));
+  const dict = shading instanceof PDFStream ? shading.dict : shading;
+  if (!(dict instanceof PDFDict)) return undefined;
+
+  const matrixArray = lookupArray(pattern, 'Matrix');
+  const matrix = matrixArray && matrixArray.size() === 6 ? toNumberArray(matrixArray) as Matrix : IDENTITY;
+  return { shading: dict, toPage: multiplyMatrix(matrix, base) };
+}
+
+/**
+ * SVG paint value for an element whose local space maps to page space by
+ * the given matrix
+ */
+function paintValue(writer: Writer, paint: Paint, elementMatrix: Matrix): string {
+  if (!paint) return 'none';
+  if ('color' in paint) return paint.color;
+
+  const inverse = invertMatrix(elementMatrix);
+  const id = inverse && shadingGradient(writer, paint.shading, multiplyMatrix(paint.toPage, inverse));
+  return id ? `url(#${id})` : 'none';
+}
+
+/**
+ * Adds an SVG gradient for an axial or radial shading
+ *
+ * @param transform - Matrix from shading space to the painted element's
+ *   local space
+ * @returns The gradient id, or undefined if the shading can't be converted
+ */
+function shadingGradient(writer: Writer, shading: PDFDict, transform: Matrix): string | undefined {
+  const type = lookupNumber(shading, 'ShadingType');
+  const coordsArray = lookupArray(shading, 'Coords');
+  if ((type !== 2 && type !== 3) || !coordsArray) {
+    writer.unsupported.add(`shading type ${type ?? 'unknown'}`);
+    return undefined;
+  }
+
+  const space = resolveColorSpace(writer, shading.lookup(PDFName.of('ColorSpace')), undefined);
+  if (!space || space.family === 'pattern') return undefined;
+
+  const domainArray = lookupArray(shading, 'Domain');
+  const [t0, t1] = domainArray ? toNumberArray(domainArray) : [0, 1];
+  const stops = sampleStops(shading.lookup(PDFName.of('Function')), t0, t1);
+  if (!stops) {
+    writer.unsupported.add('sampled and PostScript shading functions');
+    return undefined;
+  }
+
+  const id = `g${writer.nextId++}`;
+  const coords = toNumberArray(coordsArray).map(fmt);
+  const geometry = type === 2
+    ? `x1="${coords[0]}" y1="${coords[1]}" x2="${coords[2]}" y2="${coords[3]}"`
+    : `fx="${coords[0]}" fy="${coords[1]}" fr="${coords[2]}" cx="${coords[3]}" cy="${coords[4]}" r="${coords[5]}"`;
+  const stopMarkup = stops
+    .map(stop => `<stop offset="${fmt(stop.offset)}" stop-color="${hex(toRgb(writer, space, stop.color))}"/>`)
+    .join('');
+  const element = type === 2 ? 'linearGradient' : 'radialGradient';
+  writer.defs.push(`<${element} id="${id}" gradientUnits="userSpaceOnUse" ${geometry} ` +
+    `gradientTransform="${matrixAttr(transform)}">${stopMarkup}</${element}>`);
+  return id;
+}
+
+/**
+ * Samples a shading function into gradient stops, adding stops on both
+ * sides of stitching bounds so steps stay sharp
+ */
+function sampleStops(fn: PDFObject | undefined, t0: number, t1: number): Array<{ offset: number; color: number[] }> | undefined {
+  const span = t1 - t0 || 1;
+  const positions = new Set<number>();
+  for (let i = 0; i <= GRADIENT_SAMPLES; i++) positions.add(t0 + (span * i) / GRADIENT_SAMPLES);
+
+  const dict = fn instanceof PDFStream ? fn.dict : fn;
+  const bounds = dict instanceof PDFDict ? lookupArray(dict, 'Bounds') : undefined;
+  for (const bound of bounds ? toNumberArray(bounds) : []) {
+    positions.add(bound - span * 1e-4);
+    positions.add(bound);
+  }
+
+  const stops: Array<{ offset: number; color: number[] }> = [];
+  for (const t of [...positions].sort((a, b) => a - b)) {
+    const color = evaluateFunction(fn, t);
+    if (!color) return undefined;
+    stops.push({ offset: Math.min(1, Math.max(0, (t - t0) / span)), color });
+  }
+  return stops;
+}
+
+/**
+ * Evaluates exponential (type 2) and stitching (type 3) functions, or an
+ * array of one-output functions
+ */
+function evaluateFunction(fn: PDFObject | undefined, t: number): number[] | undefined {
+  if (fn instanceof PDFArray) {
+    const outputs = fn.asArray().map((_, i) => evaluateFunction(fn.lookup(i), t)?.[0]);
+    return outputs.every((value): value is number => value !== undefined) ? outputs : undefined;
+  }
+
+  const dict = fn instanceof PDFStream ? fn.dict : fn;
+  if (!(dict instanceof PDFDict)) return undefined;
+
+  const domainArray = lookupArray(dict, 'Domain');
+  const [d0, d1] = domainArray ? toNumberArray(domainArray) : [0, 1];
+  const x = Math.min(Math.max(t, Math.min(d0, d1)), Math.max(d0, d1));
+
+  switch (lookupNumber(dict, 'FunctionType')) {
+    case 2: {
+      const c0Array = lookupArray(dict, 'C0');
+      const c1Array = lookupArray(dict, 'C1');
+      const c0 = c0Array ? toNumberArray(c0Array) : [0];
+      const c1 = c1Array ? toNumberArray(c1Array) : [1];
+      const exponent = lookupNumber(dict, 'N') ?? 1;
+      return c0.map((value, i) => value + Math.pow(x, exponent) * ((c1[i] ?? value) - value));
+    }
+    case 3: {
+      const functions = lookupArray(dict, 'Functions');
+      if (!functions || functions.size() === 0) return undefined;
+      const boundsArray = lookupArray(dict, 'Bounds');
+      const encodeArray = lookupArray(dict, 'Encode');
+      const bounds = boundsArray ? toNumberArray(boundsArray) : [];
+      const encode = encodeArray ? toNumberArray(encodeArray) : [];
+
+      let k = bounds.findIndex(bound => x < bound);
+      if (k < 0) k = bounds.length;
+      k = Math.min(k, functions.size() - 1);
+      const low = k === 0 ? d0 : bounds[k - 1];
+      const high = k === bounds.length ? d1 : bounds[k];
+      const e0 = encode[2 * k] ?? 0;
+      const e1 = encode[2 * k + 1] ?? 1;
+      const u = high === low ? e0 : e0 + ((x - low) * (e1 - e0)) / (high - low);
+      return evaluateFunction(functions.lookup(k), u);
+    }
+    default:
+      return undefined;
+  }
+}
+
+/**
+ * Resolves a color space from an operand name (looked up in the resources
+ * unless it's a device space) or a color space object
+ */
+function resolveColorSpace(
+  writer: Writer,
+  value: string | PDFObject | undefined,
+  resources: PDFDict | undefined,
+  depth = 0
+): ColorSpace | undefined {
+  if (depth > 4) return undefined;
+
+  if (typeof value === 'string' || value instanceof PDFName) {
+    const name = typeof value === 'string' ? value : value.decodeText();
+    switch (name) {
+      case 'DeviceGray':
+      case 'G':
+      case 'CalGray':
+        return DEVICE_GRAY;
+      case 'DeviceRGB':
+      case 'RGB':
+      case 'CalRGB':
+        return DEVICE_RGB;
+      case 'DeviceCMYK':
+      case 'CMYK':
+        return DEVICE_CMYK;
+      case 'Pattern':
+        return { family: 'pattern', components: 0 };
+    }
+    if (typeof value !== 'string') return undefined;
+    const spaces = resources && lookupDict(resources, 'ColorSpace');
+    return resolveColorSpace(writer, spaces?.lookup(PDFName.of(name)), undefined, depth + 1);
+  }
+
+  if (!(value instanceof PDFArray)) return undefined;
+  const family = value.lookup(0);
+  switch (family instanceof PDFName ? family.decodeText() : undefined) {
+    case 'ICCBased': {
+      const profile = value.lookup(1);
+      const count = profile instanceof PDFStream ? lookupNumber(profile.dict, 'N') : undefined;
+      return count === 1 ? DEVICE_GRAY : count === 4 ? DEVICE_CMYK : count === 3 ? DEVICE_RGB : undefined;
+    }
+    case 'CalGray':
+      return DEVICE_GRAY;
+    case 'CalRGB':
+      return DEVICE_RGB;
+    case 'Lab':
+      return { family: 'lab', components: 3 };
+    case 'Indexed': {
+      const base = resolveColorSpace(writer, value.lookup(1), undefined, depth + 1);
+      const table = value.lookup(3);
+      const lookup = table instanceof PDFString || table instanceof PDFHexString
+        ? table.asBytes()
+        : table instanceof PDFStream ? decodeStreamContents(table) : undefined;
+      return base && lookup ? { family: 'indexed', components: 1, base, lookup } : undefined;
+    }
+    case 'Separation':
+      return { family: 'tint', components: 1 };
+    case 'DeviceN': {
+      const names = value.lookup(1);
+      return { family: 'tint', components: names instanceof PDFArray ? names.size() : 1 };
+    }
+    case 'Pattern':
+      return { family: 'pattern', components: 0 };
+    default:
+      return undefined;
+  }
+}
+
+/**
+ * Converts color components (0-1, or a palette index) to RGB (0-1)
+ */
+function toRgb(writer: Writer, space: ColorSpace, components: number[]): Rgb {
+  const c = components.map(value => Math.min(1, Math.max(0, value)));
+  switch (space.family) {
+    case 'gray':
+      return [c[0] ?? 0, c[0] ?? 0, c[0] ?? 0];
+    case 'rgb':
+      return [c[0] ?? 0, c[1] ?? 0, c[2] ?? 0];
+    case 'cmyk': {
+      const k = 1 - (c[3] ?? 1);
+      return [(1 - (c[0] ?? 0)) * k, (1 - (c[1] ?? 0)) * k, (1 - (c[2] ?? 0)) * k];
+    }
+    case 'indexed': {
+      const base = space.base!;
+      const index = Math.round(components[0] ?? 0) * base.components;
+      const entry = Array.from(space.lookup!.subarray(index, index + base.components), byte => byte / 255);
+      return toRgb(writer, base, entry);
+    }
+    case 'lab': {
+      writer.unsupported.add('Lab colors (approximated in gray)');
+      const lightness = Math.min(1, Math.max(0, (components[0] ?? 0) / 100));
+      return [lightness, lightness, lightness];
+    }
+    case 'tint': {
+      writer.unsupported.add('Separation and DeviceN colors (approximated in gray)');
+      const ink = Math.min(1, c.reduce((sum, value) => sum + value, 0));
+      return [1 - ink, 1 - ink, 1 - ink];
+    }
+    default:
+      return [0, 0, 0];
+  }
+}
+
+function drawXObject(writer: Writer, name: string, resources: PDFDict | undefined, state: GraphicsState, depth: number): void {
+  const xObjects = resources && lookupDict(resources, 'XObject');
+  const xObject = xObjects?.lookup(PDFName.of(name));
+  if (!(xObject instanceof PDFStream)) return;
+
+  const subtype = lookupName(xObject.dict, 'Subtype');
+  if (subtype === 'Image' && xObject instanceof PDFRawStream) {
+    drawImage(writer, xObject, state);
+  } else if (subtype === 'Form') {
+    drawForm(writer, xObject, resources, state, depth);
+  }
+}
+
+function drawForm(writer: Writer, form: PDFStream, resources: PDFDict | undefined, state: GraphicsState, depth: number): void {
+  if (depth >= MAX_FORM_DEPTH || writer.activeForms.has(form)) return;
+  const bytes = decodeStreamContents(form);
+  if (!bytes) return;
+
+  const matrixArray = lookupArray(form.dict, 'Matrix');
+  const matrix = matrixArray && matrixArray.size() === 6 ? toNumberArray(matrixArray) as Matrix : IDENTITY;
+  let inner: GraphicsState = { ...state, ctm: multiplyMatrix(matrix, state.ctm) };
+
+  const bbox = lookupArray(form.dict, 'BBox');
+  if (bbox && bbox.size() === 4) {
+    const [x1, y1, x2, y2] = toNumberArray(bbox);
+    inner = { ...inner, clip: addClip(writer, inner, `M${fmt(x1)} ${fmt(y1)}H${fmt(x2)}V${fmt(y2)}H${fmt(x1)}Z`, 'nonzero') };
+  }
+
+  writer.activeForms.add(form);
+  interpret(writer, parseContentStream(bytes), lookupDict(form.dict, 'Resources') ?? resources, inner, inner.ctm, depth + 1);
+  writer.activeForms.delete(form);
+}
+
+function drawImage(writer: Writer, stream: PDFRawStream, state: GraphicsState): void {
+  const url = imageUrl(writer, stream, state);
+  if (!url) return;
+
+  // Images fill the unit square with their first row at the top
+  const transform = multiplyMatrix([1, 0, 0, -1, 0, 1], state.ctm);
+  emit(writer, state, `<image width="1" height="1" preserveAspectRatio="none" ` +
+    `transform="${matrixAttr(transform)}"${opacity('opacity', state.fillAlpha)} href="${url}"/>`);
+}
+
+/**
+ * Encodes an image as a data URL: JPEG data as is, anything else as PNG
+ * through a canvas
+ */
+function imageUrl(writer: Writer, stream: PDFRawStream, state: GraphicsState): string | undefined {
+  const dict = stream.dict;
+  const filters = getFilters(dict);
+  const last = filters[filters.length - 1];
+  const isMask = dict.lookup(PDFName.of('ImageMask')) === PDFBool.True;
+  const space = isMask ? undefined : resolveColorSpace(writer, dict.lookup(PDFName.of('ColorSpace')), undefined);
+
+  if (last === 'DCTDecode' && !isMask) {
+    if (space?.family === 'cmyk') {
+      writer.unsupported.add('CMYK JPEG images');
+      return undefined;
+    }
+    if (dict.has(PDFName.of('SMask'))) writer.unsupported.add('soft masks on JPEG images (drawn opaque)');
+    const data = filters.length === 1 ? stream.contents : decodeOuterFilters(stream, filters.length - 1);
+    return data && `data:image/jpeg;base64,${toBase64(data)}`;
+  }
+
+  if (last === 'JPXDecode' || last === 'JBIG2Decode' || last === 'CCITTFaxDecode') {
+    writer.unsupported.add(`${last} images`);
+    return undefined;
+  }
+
+  const parms = dict.lookup(PDFName.of('DecodeParms'));
+  if (parms instanceof PDFDict && (lookupNumber(parms, 'Predictor') ?? 1) > 1) {
+    writer.unsupported.add('predictor-encoded images');
+    return undefined;
+  }
+
+  const width = lookupNumber(dict, 'Width') ?? 0;
+  const height = lookupNumber(dict, 'Height') ?? 0;
+  const bitsPerComponent = isMask ? 1 : lookupNumber(dict, 'BitsPerComponent') ?? 8;
+  const components = isMask ? 1 : space?.components ?? 0;
+  const samples = decodeStreamContents(stream);
+  const stride = Math.ceil((width * components * bitsPerComponent) / 8);
+  if (
+    !samples || width <= 0 || height <= 0 || components === 0 ||
+    ![1, 2, 4, 8, 16].includes(bitsPerComponent) || samples.length < stride * height
+  ) {
+    writer.unsupported.add('images in unsupported formats or with damaged data');
+    return undefined;
+  }
+  if (typeof document === 'undefined') {
+    writer.unsupported.add('non-JPEG images (encoding them needs a browser)');
+    return undefined;
+  }
+
+  const alpha = readSoftMask(writer, dict, width, height);
+  const decode = lookupArray(dict, 'Decode');
+  const inverted = isMask && decode !== undefined && toNumberArray(decode)[0] === 1;
+  const maskColor = (state.fillRgb ?? [0, 0, 0]).map(value => Math.round(value * 255));
+  const max = bitsPerComponent === 16 ? 255 : (1 << bitsPerComponent) - 1;
+
+  const rgba = new Uint8ClampedArray(width * height * 4);
+  const values: number[] = new Array(components);
+  for (let y = 0; y < height; y++) {
+    for (let x = 0; x < width; x++) {
+      for (let k = 0; k < components; k++) {
+        values[k] = readSample(samples, y * stride, x * components + k, bitsPerComponent);
+      }
+      const offset = (y * width + x) * 4;
+      if (isMask) {
+        // Stencil masks paint the fill color where the sample is 0
+        const painted = (values[0] === 0) !== inverted;
+        rgba.set([maskColor[0], maskColor[1], maskColor[2], painted ? 255 : 0], offset);
+        continue;
+      }
+      const rgb = toRgb(writer, space!, space!.family === 'indexed' ? values : values.map(value => value / max));
+      rgba.set([rgb[0] * 255, rgb[1] * 255, rgb[2] * 255, alpha ? alpha[y * width + x] : 255], offset);
+    }
+  }
+
+  const { canvas, context } = createCanvas(width, height, true);
+  context.putImageData(new ImageData(rgba, width, height), 0, 0);
+  return canvas.toDataURL('image/png');
+}
+
+/**
+ * Reads an image's soft mask as one alpha byte per pixel, if it has the
+ * image's size and 8-bit samples
+ */
+function readSoftMask(writer: Writer, dict: PDFDict, width: number, height: number): Uint8Array | undefined {
+  const mask = dict.lookup(PDFName.of('SMask'));
+  if (!(mask instanceof PDFStream)) return undefined;
+
+  const data = decodeStreamContents(mask);
+  const matches = lookupNumber(mask.dict, 'Width') === width &&
+    lookupNumber(mask.dict, 'Height') === height &&
+    lookupNumber(mask.dict, 'BitsPerComponent') === 8;
+  if (!data || !matches || data.length < width * height) {
+    writer.unsupported.add('soft masks that differ from their image in size or depth (drawn opaque)');
+    return undefined;
+  }
+  return data;
+}
+
+function readSample(data: Uint8Array, rowStart: number, index: number, bitsPerComponent: number): number {
+  if (bitsPerComponent === 8) return data[rowStart + index];
+  if (bitsPerComponent === 16) return data[rowStart + index * 2];
+  const bit = index * bitsPerComponent;
+  const byte = data[rowStart + (bit >> 3)];
+  return (byte >> (8 - bitsPerComponent - (bit & 7))) & ((1 << bitsPerComponent) - 1);
+}
+
+/**
+ * Draws the normal appearance of each visible annotation
+ */
+function drawAnnotations(writer: Writer, page: PDFPage): void {
+  const annots = page.node.Annots();
+  if (!annots) return;
+
+  for (let i = 0; i < annots.size(); i++) {
+    const annot = annots.lookup(i);
+    if (!(annot instanceof PDFDict) || lookupName(annot, 'Subtype') === 'Popup') continue;
+    if (((lookupNumber(annot, 'F') ?? 0) & (HIDDEN_FLAG | NO_VIEW_FLAG)) !== 0) continue;
+
+    const placed = placeAppearance(annot);
+    if (placed) drawForm(writer, placed.stream, undefined, initialState(placed.matrix), 0);
+  }
+}
+
+/**
+ * Finds the text operator a pdf.js item came from: the nearest one
+ * starting on its baseline at or before it, else the nearest overall
+ */
+function findRun(runs: TextRun[], item: SvgTextItem): TextRun | undefined {
+  const [, , c, d, x, y] = item.transform;
+  const tolerance = (Math.hypot(c, d) || 1) * 0.5;
+
+  let best: TextRun | undefined;
+  let nearest: TextRun | undefined;
+  let nearestDistance = Infinity;
+  for (const run of runs) {
+    if (Math.abs(run.y - y) <= tolerance && run.x <= x + tolerance && (!best || run.x >= best.x)) best = run;
+    const distance = Math.hypot(run.x - x, run.y - y);
+    if (distance < nearestDistance) {
+      nearest = run;
+      nearestDistance = distance;
+    }
+  }
+  return best ?? nearest;
+}
+
+/**
+ * SVG text element for a pdf.js item, painted like its text operator
+ *
+ * @param hidden - Draw transparent (over a raster of the page)
+ */
+function textElement(writer: Writer, item: SvgTextItem, state: GraphicsState | undefined, hidden: boolean): string | undefined {
+  const [a, b, c, d, e, f] = item.transform;
+  const size = Math.hypot(c, d) || Math.hypot(a, b);
+  if (!size || !item.str.trim()) return undefined;
+
+  // Text space is y-up like the page; flip glyphs back upright
+  const matrix: Matrix = [a / size, b / size, -c / size, -d / size, e, f];
+  let attributes = `transform="${matrixAttr(matrix)}" font-size="${fmt(size)}"` +
+    ` font-family="${escapeXml(item.fontFamily ?? 'sans-serif')}"`;
+
+  const horizontalScale = Math.hypot(a, b) / size;
+  if (item.width > 0 && horizontalScale > 0) {
+    attributes += ` textLength="${fmt(item.width / horizontalScale)}" lengthAdjust="spacingAndGlyphs"`;
+  }
+
+  const mode = (state?.renderMode ?? 0) % 4;
+  if (hidden || mode === 3) {
+    // Invisible text (OCR layers) stays selectable and searchable
+    attributes += ' fill-opacity="0"';
+  } else {
+    const fill = mode === 0 || mode === 2 ? paintValue(writer, state?.fill ?? { color: '#000000' }, matrix) : 'none';
+    attributes += ` fill="${fill}"`;
+    if (fill !== 'none') attributes += opacity('fill-opacity', state?.fillAlpha ?? 1);
+    if ((mode === 1 || mode === 2) && state) {
+      const stroke = paintValue(writer, state.stroke, matrix);
+      if (stroke !== 'none') attributes += strokeAttributes(state, stroke);
+    }
+  }
+  if (state?.blend) attributes += ` style="mix-blend-mode:${state.blend}"`;
+
+  return `<text ${attributes} xml:space="preserve">${escapeXml(item.str)}</text>`;
+}
+
+/**
+ * Writes the document: definitions, then elements in drawing order,
+ * grouped by clip path
+ */
+function assemble(
+  writer: Writer,
+  frame: { width: number; height: number; matrix: Matrix },
+  unsupported: string[],
+  underlay = ''
+): string {
+  const elements = [...writer.elements].sort((x, y) => x.order - y.order);
+  let body = '';
+  let openClip: string | undefined;
+  for (const element of elements) {
+    if (element.clip !== openClip) {
+      if (openClip) body += '</g>';
+      if (element.clip) body += `<g clip-path="url(#${element.clip})">`;
+      openClip = element.clip;
+    }
+    body += element.markup;
+  }
+  if (openClip) body += '</g>';
+
+  const note = unsupported.length > 0 ? `<!-- Not converted: ${escapeXml(unsupported.join('; ')).replace(/--/g, '- -')} -->` : '';
+  const defs = writer.defs.length > 0 ? `<defs>${writer.defs.join('')}</defs>` : '';
+  return `<svg xmlns="http://www.w3.org/2000/svg" width="${fmt(frame.width)}" height="${fmt(frame.height)}" ` +
+    `viewBox="0 0 ${fmt(frame.width)} ${fmt(frame.height)}">${note}${defs}${underlay}` +
+    `<g transform="${matrixAttr(frame.matrix)}">${body}</g></svg>`;
+}
+
+function invertMatrix([a, b, c, d, e, f]: Matrix): Matrix | undefined {
+  const determinant = a * d - b * c;
+  if (Math.abs(determinant) < 1e-12) return undefined;
+  return [
+    d / determinant,
+    -b / determinant,
+    -c / determinant,
+    a / determinant,
+    (c * f - d * e) / determinant,
+    (b * e - a * f) / determinant,
+  ];
+}
+
+function matrixAttr(matrix: Matrix): string {
+  return `matrix(${matrix.map(fmt).join(' ')})`;
+}
+
+function opacity(attribute: string, alpha: number): string {
+  return alpha < 1 ? ` ${attribute}="${fmt(Math.max(0, alpha))}"` : '';
+}
+
+function hex(rgb: Rgb): string {
+  return '#' + rgb.map(value => Math.round(value * 255).toString(16).padStart(2, '0')).join('');
+}
+
+function fmt(value: number): string {
+  const rounded = Math.round(value * 1000) / 1000;
+  return String(rounded === 0 ? 0 : rounded);
+}
+
+function escapeXml(text: string): string {
+  return text.replace(/[&<>"]/g, char => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' })[char]!);
+}
+
+function toBase64(data: Uint8Array): string {
+  let binary = '';
+  for (let i = 0; i < data.length; i += 0x8000) {
+    binary += String.fromCharCode(...data.subarray(i, i + 0x8000));
+  }
+  return btoa(binary);
+}
@@ -0,0 +1,78 @@
+/**
+ * Invisible OCR text layers
+ *
+ * Scans become searchable and selectable when the recognized words are
+ * drawn over the image in text render mode 3 (neither filled nor
+ * stroked). Each word is sized to its box height and squeezed to its box
+ * width, so selections line up with the scanned glyphs.
+ */
+
+import {
+  PDFFont,
+  PDFPage,
+  TextRenderingMode,
+  beginText,
+  endText,
+  popGraphicsState,
+  pushGraphicsState,
+  setCharacterSqueeze,
+  setFontAndSize,
+  setTextMatrix,
+  setTextRenderingMode,
+  showText,
+} from 'pdf-lib';
+import type { PDFOperator } from 'pdf-lib';
+import type { WordBox } from '../api/types';
+
+/**
+ * Maps word boxes in image pixels (origin top left, as in hOCR) to user
+ * space, for an image covering the page's crop box without rotation
+ */
+export function imageToPageWords(page: PDFPage, words: WordBox[], imageWidth: number, imageHeight: number): WordBox[] {
+  const box = page.getCropBox();
+  const scaleX = box.width / imageWidth;
+  const scaleY = box.height / imageHeight;
+  return words.map(word => ({
+    text: word.text,
+    x: box.x + word.x * scaleX,
+    y: box.y + box.height - (word.y + word.height) * scaleY,
+    width: word.width * scaleX,
+    height: word.height * scaleY,
+  }));
+}
+
+/**
+ * Draws words invisibly on a page, in PDF user space
+ *
+ * Characters the font can't encode are drawn as '?'.
+ *
+ * @returns Number of words drawn (empty and zero-size words are skipped)
+ */
+export function addInvisibleWords(page: PDFPage, font: PDFFont, words: WordBox[]): number {
+  const characters = new Set(font.getCharacterSet());
+  const drawable = words.flatMap(word => {
+    const text = [...word.text.trim()].map(char => (characters.has(char.codePointAt(0) ?? 0) ? char : '?')).join('');
+    return text !== '' && word.width > 0 && word.height > 0 ? [{ ...word, text }] : [];
+  });
+  if (drawable.length === 0) return 0;
+
+  const fontKey = page.node.newFontDictionary(font.name, font.ref);
+  const operators: PDFOperator[] = [pushGraphicsState(), beginText(), setTextRenderingMode(TextRenderingMode.Invisible)];
+  for (const word of drawable) {
+    // Fit the font's ascender-to-descender height to the box
+    const size = (word.height * word.height) / font.heightAtSize(word.height);
+    const descent = font.heightAtSize(size) - font.heightAtSize(size, { descender: false });
+    const squeeze = (word.width / font.widthOfTextAtSize(word.text, size)) * 100;
+
+    operators.push(
+      setFontAndSize(fontKey, size),
+      setCharacterSqueeze(squeeze),
+      setTextMatrix(1, 0, 0, 1, word.x, word.y + descent),
+      showText(font.encodeText(word.text))
+    );
+  }
+  operators.push(endText(), popGraphicsState());
+
+  page.pushOperators(...operators);
+  return drawable.length;
+}
@@ -0,0 +1,182 @@
+/**
+ * Page text layout modes
+ *
+ * - raw: lines in content-stream order, as the generator wrote them
+ * - reading: logical order, reading columns top to bottom one at a time
+ *   (recursive XY-cut over the line segments)
+ * - layout: a character grid that keeps the page's spatial arrangement,
+ *   with columns side by side
+ */
+
+import type { TextLayoutMode } from '../api/types';
+import { groupTextLines } from './text';
+import type { TextItemLike, TextLine } from './text';
+
+/** Font heights of horizontal whitespace that separate columns */
+const COLUMN_GAP = 1.5;
+
+/** Line heights of vertical whitespace that separate blocks */
+const PARAGRAPH_GAP = 0.5;
+
+/** Line heights of vertical whitespace that separate page sections */
+const SECTION_GAP = 2;
+
+/** Widest run of blank lines kept in layout mode */
+const MAX_BLANK_ROWS = 2;
+
+/**
+ * Formats a page's text items in the given mode
+ */
+export function formatPageText(items: TextItemLike[], mode: TextLayoutMode): string {
+  if (mode === 'raw') {
+    return groupTextLines(items).map(line => line.text.trim()).join('\n');
+  }
+
+  const segments = groupTextLines(items, COLUMN_GAP);
+  return mode === 'reading' ? formatReading(segments) : formatLayout(segments);
+}
+
+function formatReading(segments: TextLine[]): string {
+  const blocks = xyCut(segments, medianHeight(segments));
+  return blocks.map(block => joinRows(block)).join('\n\n');
+}
+
+/**
+ * Splits segments at the widest vertical gutter or horizontal gap until
+ * neither is left
+ *
+ * Wide horizontal gaps (section breaks, e.g. under a full-width heading
+ * or above a footer) are cut first, then gutters, so columns are read
+ * whole rather than interleaved at aligned paragraph breaks.
+ *
+ * @returns Blocks in reading order
+ */
+function xyCut(segments: TextLine[], lineHeight: number): TextLine[][] {
+  if (segments.length < 2) return [segments];
+
+  // PDF y grows upwards; negate so the first block is the top one
+  const gap = widestGap(segments.map(s => [-(s.y + s.height), -(s.y - s.height * 0.25)]));
+  if (gap && gap.size >= lineHeight * SECTION_GAP) {
+    return splitAt(segments, gap.at, lineHeight);
+  }
+
+  const gutter = widestGap(segments.map(s => [s.x, s.right]));
+  if (gutter && gutter.size >= lineHeight) {
+    const left = segments.filter(s => s.right <= gutter.at);
+    const right = segments.filter(s => s.right > gutter.at);
+    return [...xyCut(left, lineHeight), ...xyCut(right, lineHeight)];
+  }
+
+  if (gap && gap.size >= lineHeight * PARAGRAPH_GAP) {
+    return splitAt(segments, gap.at, lineHeight);
+  }
+
+  return [segments];
+}
+
+function splitAt(segments: TextLine[], at: number, lineHeight: number): TextLine[][] {
+  const top = segments.filter(s => -(s.y + s.height) < at);
+  const bottom = segments.filter(s => -(s.y + s.height) >= at);
+  return [...xyCut(top, lineHeight), ...xyCut(bottom, lineHeight)];
+}
+
+/**
+ * Finds the widest empty stretch between intervals
+ *
+ * @returns Its midpoint and width, or undefined if the intervals overlap
+ * into one
+ */
+function widestGap(intervals: number[][]): { at: number; size: number } | undefined {
+  const sorted = [...intervals].sort((a, b) => a[0] - b[0]);
+  let best: { at: number; size: number } | undefined;
+  let end = sorted[0][1];
+
+  for (const [start, stop] of sorted.slice(1)) {
+    if (start > end && (!best || start - end > best.size)) {
+      best = { at: (start + end) / 2, size: start - end };
+    }
+    end = Math.max(end, stop);
+  }
+  return best;
+}
+
+/**
+ * Joins segments into lines, top to bottom and left to right
+ */
+function joinRows(segments: TextLine[]): string {
+  const sorted = [...segments].sort((a, b) => b.y - a.y || a.x - b.x);
+  const rows: string[] = [];
+  let previous: TextLine | undefined;
+
+  for (const segment of sorted) {
+    const text = segment.text.trim();
+    if (previous && Math.abs(previous.y - segment.y) <= previous.height * 0.5) {
+      rows[rows.length - 1] += ' ' + text;
+    } else {
+      rows.push(text);
+    }
+    previous = segment;
+  }
+  return rows.join('\n');
+}
+
+/**
+ * Places segments on a character grid sized from the page's median
+ * character width and line height
+ */
+function formatLayout(segments: TextLine[]): string {
+  if (segments.length === 0) return '';
+
+  const lineHeight = medianHeight(segments);
+  const pitch = linePitch(segments, lineHeight);
+  const charWidth = median(segments
+    .filter(s => s.text.trim().length > 0)
+    .map(s => (s.right - s.x) / s.text.length)) || lineHeight / 2;
+  const left = Math.min(...segments.map(s => s.x));
+  const top = Math.max(...segments.map(s => s.y));
+
+  const rows: string[] = [];
+  const sorted = [...segments].sort((a, b) => b.y - a.y || a.x - b.x);
+  for (const segment of sorted) {
+    const row = Math.round((top - segment.y) / pitch);
+    const column = Math.max(0, Math.round((segment.x - left) / charWidth));
+    const text = segment.text.trim();
+
+    const current = rows[row] ?? '';
+    // Overlapping text is pushed right rather than overwritten
+    const start = current.length === 0 ? column : Math.max(column, current.length + 1);
+    rows[row] = current.padEnd(start) + text;
+  }
+
+  const lines: string[] = [];
+  let blanks = 0;
+  for (let i = 0; i < rows.length; i++) {
+    const line = rows[i] ?? '';
+    blanks = line === '' ? blanks + 1 : 0;
+    if (blanks <= MAX_BLANK_ROWS) lines.push(line);
+  }
+  return lines.join('\n');
+}
+
+/**
+ * Typical distance between baselines (line height plus leading)
+ */
+function linePitch(segments: TextLine[], lineHeight: number): number {
+  const baselines = [...new Set(segments.map(s => s.y))].sort((a, b) => b - a);
+  const steps: number[] = [];
+  for (let i = 1; i < baselines.length; i++) {
+    const step = baselines[i - 1] - baselines[i];
+    if (step > lineHeight * 0.5) steps.push(step);
+  }
+  return median(steps) || lineHeight * 1.2;
+}
+
+function medianHeight(segments: TextLine[]): number {
+  return median(segments.map(s => s.height)) || 1;
+}
+
+function median(values: number[]): number {
+  if (values.length === 0) return 0;
+  const sorted = [...values].sort((a, b) => a - b);
+  return sorted[sorted.length >> 1];
+}
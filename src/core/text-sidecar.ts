@@ -0,0 +1,100 @@
+/**
+ * Plain-text sidecar attachment
+ *
+ * Archives read by tools without a PDF parser can still search a file
+ * whose text is attached as plain UTF-8. The text is extracted from the
+ * input in reading order, so it survives the image pass, which
+ * rasterizes pages and drops their text.
+ */
+
+import { PDFDict, PDFDocument, PDFHexString, PDFString } from 'pdf-lib';
+import type { TextSidecarReport } from '../api/types';
+import { lookupArray, lookupDict } from './pdf-objects';
+import { openPdfjsDocument } from './pdfjs';
+import { getPageTextItems } from './text';
+import { formatPageText } from './text-layout';
+
+export const DEFAULT_SIDECAR_NAME = 'text.txt';
+
+/**
+ * Extracted text ready to attach
+ */
+export interface TextSidecar {
+  name: string;
+  /** UTF-8 text, pages separated by form feeds */
+  data: Uint8Array;
+}
+
+/**
+ * Extracts the document's text for a sidecar
+ *
+ * @returns The sidecar, or undefined with a report explaining why when
+ *   the document has no extractable text
+ */
+export async function createTextSidecar(
+  pdfBuffer: ArrayBuffer,
+  name: string
+): Promise<{ sidecar?: TextSidecar; report: TextSidecarReport }> {
+  const pdfDocument = await openPdfjsDocument(pdfBuffer);
+  const pages: string[] = [];
+  try {
+    for (let pageNum = 1; pageNum <= pdfDocument.numPages; pageNum++) {
+      pages.push(formatPageText(await getPageTextItems(pdfDocument, pageNum), 'reading'));
+    }
+  } finally {
+    await pdfDocument.destroy();
+  }
+
+  if (pages.every(text => text.trim() === '')) {
+    return {
+      report: { name, bytes: 0, attached: false, warning: 'No sidecar was attached: the document has no extractable text' },
+    };
+  }
+
+  const data = new TextEncoder().encode(pages.join('\n\f'));
+  return { sidecar: { name, data }, report: { name, bytes: data.length, attached: true } };
+}
+
+/**
+ * Embeds the sidecar as a document-level attachment
+ *
+ * pdf-lib normally adds attachments to the catalog on save; they are
+ * embedded right away instead, so pinned and signed catalogs are
+ * restored over the change like any other.
+ */
+export async function attachTextSidecar(pdfDoc: PDFDocument, sidecar: TextSidecar): Promise<void> {
+  await pdfDoc.attach(sidecar.data, sidecar.name, {
+    mimeType: 'text/plain',
+    description: 'Extracted text',
+  });
+  await pdfDoc.flush();
+}
+
+/**
+ * Whether the document's EmbeddedFiles name tree has an entry with this name
+ */
+export function hasAttachment(pdfDoc: PDFDocument, name: string): boolean {
+  const names = lookupDict(pdfDoc.catalog, 'Names');
+  const tree = names && lookupDict(names, 'EmbeddedFiles');
+  return tree !== undefined && nameTreeHas(tree, name, new Set());
+}
+
+function nameTreeHas(node: PDFDict, name: string, visited: Set<PDFDict>): boolean {
+  if (visited.has(node)) return false;
+  visited.add(node);
+
+  const entries = lookupArray(node, 'Names');
+  if (entries) {
+    for (let i = 0; i < entries.size(); i += 2) {
+      const key = entries.lookup(i);
+      if ((key instanceof PDFString || key instanceof PDFHexString) && key.decodeText() === name) return true;
+    }
+  }
+  const kids = lookupArray(node, 'Kids');
+  if (!kids) return false;
+  for (let i = 0; i < kids.size(); i++) {
+    const kid = kids.lookup(i);
+    if (kid instanceof PDFDict && nameTreeHas(kid, name, visited)) return true;
+  }
+  return false;
+}
@@ -0,0 +1,194 @@
+/**
+ * Text extraction using pdf.js text content
+ *
+ * Items are grouped into lines by baseline and end-of-line markers, and
+ * lines into blocks (paragraphs) by vertical spacing, or split into
+ * positioned words.
+ */
+
+import type { PDFDocumentProxy } from 'pdfjs-dist';
+import type { WordBox } from '../api/types';
+
+/**
+ * Positioned text item as reported by pdf.js
+ */
+export interface TextItemLike {
+  str: string;
+  transform: number[];
+  width: number;
+  height: number;
+  hasEOL: boolean;
+}
+
+/**
+ * Line of text in PDF user space
+ */
+export interface TextLine {
+  text: string;
+  /** Left edge of the first item */
+  x: number;
+  /** Baseline */
+  y: number;
+  /** Right edge of the last item */
+  right: number;
+  /** Font height of the tallest item */
+  height: number;
+}
+
+/**
+ * Reads the positioned text items of a page (1-indexed)
+ */
+export async function getPageTextItems(
+  pdfDocument: PDFDocumentProxy,
+  pageNum: number
+): Promise<TextItemLike[]> {
+  const page = await pdfDocument.getPage(pageNum);
+  const content = await page.getTextContent();
+  const items: TextItemLike[] = [];
+
+  for (const item of content.items) {
+    if ('str' in item) items.push(item);
+  }
+
+  return items;
+}
+
+/**
+ * Groups text items into lines, preserving content-stream order
+ *
+ * @param columnGap - Also start a new line where items on one baseline are
+ *   further apart than this many font heights, or jump back to the left,
+ *   so side-by-side columns come out as separate lines
+ */
+export function groupTextLines(items: TextItemLike[], columnGap?: number): TextLine[] {
+  const lines: TextLine[] = [];
+  let current: TextLine | undefined;
+  let breakPending = false;
+
+  for (const item of items) {
+    const x = item.transform[4];
+    const y = item.transform[5];
+    const height = item.height || Math.abs(item.transform[3]) || 1;
+
+    const columnBreak = current !== undefined && columnGap !== undefined && current.text !== '' &&
+      (x - current.right > height * columnGap || x < current.right - height);
+    const sameLine = current && !breakPending && !columnBreak && Math.abs(current.y - y) <= height * 0.5;
+    if (!current || !sameLine) {
+      if (current && current.text.trim()) lines.push(current);
+      current = { text: '', x, y, right: x, height };
+    }
+
+    // Insert a space when items are visibly separated but carry none
+    const gap = x - current.right;
+    if (current.text && gap > height * 0.2 && !/\s$/.test(current.text) && !/^\s/.test(item.str)) {
+      current.text += ' ';
+    }
+
+    current.text += item.str;
+    current.right = Math.max(current.right, x + item.width);
+    current.height = Math.max(current.height, height);
+    breakPending = item.hasEOL;
+  }
+
+  if (current && current.text.trim()) lines.push(current);
+  return lines;
+}
+
+/**
+ * Groups lines into blocks, splitting where the line spacing opens up
+ */
+export function groupTextBlocks(lines: TextLine[]): string[] {
+  const blocks: string[] = [];
+  let block: string[] = [];
+  let previous: TextLine | undefined;
+
+  for (const line of lines) {
+    if (previous) {
+      const spacing = Math.abs(previous.y - line.y);
+      if (spacing > Math.max(previous.height, line.height) * 1.8) {
+        blocks.push(block.join(' '));
+        block = [];
+      }
+    }
+    block.push(line.text.trim());
+    previous = line;
+  }
+
+  if (block.length > 0) blocks.push(block.join(' '));
+  return blocks;
+}
+
+/**
+ * Splits text items into words with axis-aligned bounding boxes in PDF
+ * user space
+ *
+ * pdf.js reports one advance width per item, so words inside an item are
+ * placed by character count. Items that continue a word without a gap
+ * (split by kerning or font changes) extend it.
+ */
+export function groupWords(items: TextItemLike[]): WordBox[] {
+  const words: WordBox[] = [];
+  let open: { box: WordBox; endX: number; endY: number } | undefined;
+
+  for (const item of items) {
+    const [a, b, c, d, x, y] = item.transform;
+    const scale = Math.hypot(a, b) || 1;
+    const height = Math.hypot(c, d) || item.height || 1;
+    // Unit vectors along the baseline and up the glyphs
+    const along = [a / scale, b / scale];
+    const up = [-along[1], along[0]];
+    const advance = item.str.length > 0 ? item.width / item.str.length : 0;
+
+    for (const match of item.str.matchAll(/\S+/g)) {
+      const start = match.index! * advance;
+      const end = start + match[0].length * advance;
+      const startX = x + along[0] * start;
+      const startY = y + along[1] * start;
+      const endX = x + along[0] * end;
+      const endY = y + along[1] * end;
+
+      // Descenders reach about a fifth of the font height below the baseline
+      const corners = [
+        [startX - up[0] * height * 0.2, startY - up[1] * height * 0.2],
+        [endX - up[0] * height * 0.2, endY - up[1] * height * 0.2],
+        [startX + up[0] * height, startY + up[1] * height],
+        [endX + up[0] * height, endY + up[1] * height],
+      ];
+      const box = boundingBox(match[0], corners);
+
+      const continues = open !== undefined && match.index === 0 &&
+        Math.hypot(startX - open.endX, startY - open.endY) <= height * 0.2;
+      if (continues && open) {
+        open.box = mergeBoxes(open.box, box);
+        words[words.length - 1] = open.box;
+      } else {
+        words.push(box);
+      }
+      open = { box: words[words.length - 1], endX, endY };
+    }
+
+    // A trailing space or line end closes the word
+    if (/\s$/.test(item.str) || item.str.length === 0 || item.hasEOL) open = undefined;
+  }
+  return words;
+}
+
+function boundingBox(text: string, corners: number[][]): WordBox {
+  const xs = corners.map(corner => corner[0]);
+  const ys = corners.map(corner => corner[1]);
+  const x = Math.min(...xs);
+  const y = Math.min(...ys);
+  return { text, x, y, width: Math.max(...xs) - x, height: Math.max(...ys) - y };
+}
+
+function mergeBoxes(first: WordBox, second: WordBox): WordBox {
+  const x = Math.min(first.x, second.x);
+  const y = Math.min(first.y, second.y);
+  return {
+    text: first.text + second.text,
+    x,
+    y,
+    width: Math.max(first.x + first.width, second.x + second.width) - x,
+    height: Math.max(first.y + first.height, second.y + second.height) - y,
+  };
+}
@@ -0,0 +1,91 @@
+/**
+ * Trailer inspection
+ *
+ * pdf-lib keeps only Root, Info, ID and Encrypt from the trailer, so the
+ * last trailer (or cross-reference stream dictionary) is parsed again from
+ * the raw bytes.
+ */
+
+import {
+  PDFArray,
+  PDFDict,
+  PDFDocument,
+  PDFHexString,
+  PDFName,
+  PDFObjectParser,
+  PDFRawStream,
+  PDFRef,
+  PDFString,
+} from 'pdf-lib';
+import type { TrailerInfo } from '../api/types';
+import { lookupNumber } from './pdf-objects';
+import { findStartXref, isXrefStream, toLatin1 } from './raw-pdf';
+
+/**
+ * Reads the trailer of the last cross-reference section
+ *
+ * @returns The trailer, or undefined if startxref is missing or doesn't
+ * point at a readable section
+ */
+export function readTrailer(pdfDoc: PDFDocument, pdfBuffer: ArrayBuffer): TrailerInfo | undefined {
+  const raw = toLatin1(pdfBuffer);
+  const startXref = findStartXref(raw);
+  if (startXref === undefined || startXref >= raw.length) return undefined;
+
+  const xrefType = isXrefStream(raw, startXref) ? 'stream' : 'table';
+  let dictStart: number;
+  if (xrefType === 'table') {
+    const keyword = raw.indexOf('trailer', startXref);
+    if (keyword < 0) return undefined;
+    dictStart = keyword + 'trailer'.length;
+  } else {
+    const header = /^\s*\d+\s+\d+\s+obj/.exec(raw.slice(startXref, startXref + 64));
+    if (!header) return undefined;
+    dictStart = startXref + header[0].length;
+  }
+
+  let dict: PDFDict;
+  try {
+    const bytes = new Uint8Array(pdfBuffer, dictStart);
+    const parsed = PDFObjectParser.forBytes(bytes, pdfDoc.context).parseObject();
+    if (parsed instanceof PDFRawStream) dict = parsed.dict;
+    else if (parsed instanceof PDFDict) dict = parsed;
+    else return undefined;
+  } catch {
+    return undefined;
+  }
+
+  return {
+    size: lookupNumber(dict, 'Size') ?? 0,
+    root: refString(dict, 'Root'),
+    info: refString(dict, 'Info'),
+    id: readId(dict),
+    prev: lookupNumber(dict, 'Prev'),
+    startXref,
+    xrefType,
+  };
+}
+
+function refString(dict: PDFDict, key: string): string | undefined {
+  const value = dict.get(PDFName.of(key));
+  return value instanceof PDFRef ? value.toString() : undefined;
+}
+
+/**
+ * Reads the two file identifiers as hex
+ */
+function readId(dict: PDFDict): [string, string] | undefined {
+  const id = dict.lookup(PDFName.of('ID'));
+  if (!(id instanceof PDFArray) || id.size() !== 2) return undefined;
+
+  const [first, second] = id.asArray().map(item =>
+    item instanceof PDFHexString || item instanceof PDFString ? toHex(item.asBytes()) : undefined
+  );
+  return first !== undefined && second !== undefined ? [first, second] : undefined;
+}
+
+function toHex(bytes: Uint8Array): string {
+  let hex = '';
+  for (const byte of bytes) hex += byte.toString(16).padStart(2, '0');
+  return hex;
+}
@@ -0,0 +1,53 @@
+/**
+ * XFA form removal
+ *
+ * Hybrid forms carry both an XFA form (XML, often hundreds of KB) and an
+ * AcroForm equivalent. Most viewers only use the AcroForm, so the XFA
+ * data can go.
+ */
+
+import { PDFArray, PDFDocument, PDFName, PDFStream } from 'pdf-lib';
+import type { XfaRemovalReport } from '../api/types';
+import { lookupArray, lookupDict } from './pdf-objects';
+
+/**
+ * Removes XFA data from hybrid forms
+ *
+ * XFA-only forms (no AcroForm fields to fall back on) are left alone with
+ * a warning, since removing the XFA would remove the form.
+ */
+export function removeXfa(pdfDoc: PDFDocument): XfaRemovalReport {
+  const acroForm = lookupDict(pdfDoc.catalog, 'AcroForm');
+  const xfaKey = PDFName.of('XFA');
+  if (!acroForm || !acroForm.has(xfaKey)) return { bytesRemoved: 0 };
+
+  const fields = lookupArray(acroForm, 'Fields');
+  if (!fields || fields.size() === 0) {
+    return {
+      bytesRemoved: 0,
+      warning: 'XFA-only form: it has no AcroForm fields to fall back on, so the XFA data was kept',
+    };
+  }
+
+  const bytesRemoved = xfaSize(acroForm.lookup(xfaKey));
+  acroForm.delete(xfaKey);
+  // Only XFA viewers act on NeedsRendering
+  pdfDoc.catalog.delete(PDFName.of('NeedsRendering'));
+
+  return { bytesRemoved };
+}
+
+/**
+ * Stored size of the XFA data: one stream, or packets as [name stream ...]
+ */
+function xfaSize(xfa: unknown): number {
+  if (xfa instanceof PDFStream) return xfa.getContentsSize();
+  if (!(xfa instanceof PDFArray)) return 0;
+
+  let size = 0;
+  for (let i = 1; i < xfa.size(); i += 2) {
+    const packet = xfa.lookup(i);
+    if (packet instanceof PDFStream) size += packet.getContentsSize();
+  }
+  return size;
+}
@@ -0,0 +1,267 @@
+/**
+ * XMP metadata reading and trimming
+ *
+ * XMP packets are small and regular enough that simple pattern matching
+ * covers the properties we need (both element and attribute forms)
+ * without an XML parser, which isn't available in workers.
+ */
+
+import { PDFDocument, PDFName, PDFRef, PDFStream } from 'pdf-lib';
+import { decodeStreamContents, lookupName } from './pdf-objects';
+
+const XML_ENTITIES: Record<string, string> = { amp: '&', lt: '<', gt: '>', quot: '"', apos: "'" };
+
+const RDF_NS = 'http://www.w3.org/1999/02/22-rdf-syntax-ns#';
+
+/**
+ * Namespaces kept by trimXmp: Dublin Core, Adobe PDF, XMP basic, and the
+ * PDF/A and PDF/UA identification schemas (dropping those would silently
+ * revoke a conformance claim)
+ */
+const STANDARD_NAMESPACES = [
+  'http://purl.org/dc/elements/1.1/',
+  'http://ns.adobe.com/pdf/1.3/',
+  'http://ns.adobe.com/xap/1.0/',
+  'http://www.aiim.org/pdfa/ns/id/',
+  'http://www.aiim.org/pdfua/ns/id/',
+];
+
+/** Comments, processing instructions, and start/end/empty tags */
+const TAG_PATTERN =
+  /<!--[\s\S]*?-->|<\?[\s\S]*?\?>|<(\/?)([A-Za-z_][\w.-]*(?::[\w.-]+)?)((?:\s+[^\s=>/]+\s*=\s*(?:"[^"]*"|'[^']*'))*)\s*(\/?)>/g;
+const ATTRIBUTE_PATTERN = /\s+([^\s=>/]+)\s*=\s*("[^"]*"|'[^']*')/g;
+
+/**
+ * Reads the document-level XMP packet from the catalog /Metadata stream
+ */
+export function readXmp(pdfDoc: PDFDocument): string | undefined {
+  const metadata = pdfDoc.catalog.lookup(PDFName.of('Metadata'));
+  if (!(metadata instanceof PDFStream)) return undefined;
+
+  const bytes = decodeStreamContents(metadata);
+  return bytes ? new TextDecoder('utf-8').decode(bytes) : undefined;
+}
+
+/**
+ * Replaces the document-level XMP packet, keeping the stream's object
+ * number when it has one
+ */
+export function writeXmp(pdfDoc: PDFDocument, xmp: string): void {
+  const context = pdfDoc.context;
+  // Metadata stays unfiltered so it can be found without a PDF parser
+  const stream = context.stream(new TextEncoder().encode(xmp), { Type: 'Metadata', Subtype: 'XML' });
+
+  const metadataRef = pdfDoc.catalog.get(PDFName.of('Metadata'));
+  if (metadataRef instanceof PDFRef) {
+    context.assign(metadataRef, stream);
+  } else {
+    pdfDoc.catalog.set(PDFName.of('Metadata'), context.register(stream));
+  }
+}
+
+/**
+ * Reads a simple XMP property (e.g. 'xmp:CreatorTool')
+ *
+ * Handles element and attribute forms; for arrays (rdf:Alt/Seq/Bag) the
+ * first item is returned.
+ */
+export function getXmpValue(xmp: string, property: string): string | undefined {
+  const name = escapeRegExp(property);
+
+  const attribute = new RegExp(`\\s${name}\\s*=\\s*(["'])([\\s\\S]*?)\\1`).exec(xmp);
+  if (attribute) return decodeXmlEntities(attribute[2]);
+
+  const element = new RegExp(`<${name}(?:\\s[^>]*)?>([\\s\\S]*?)</${name}>`).exec(xmp);
+  if (!element) return undefined;
+
+  const content = element[1];
+  const item = /<rdf:li(?:\s[^>]*)?>([\s\S]*?)<\/rdf:li>/.exec(content);
+  return decodeXmlEntities((item ? item[1] : content).trim());
+}
+
+/**
+ * Sets a simple XMP property, replacing its element or attribute form, or
+ * adding it to an rdf:Description (declaring the namespace if needed)
+ *
+ * @returns The updated packet, unchanged if it has no rdf:Description
+ */
+export function setXmpValue(xmp: string, property: string, namespace: string, value: string): string {
+  const name = escapeRegExp(property);
+  const escaped = encodeXmlEntities(value);
+
+  const attribute = new RegExp(`(\\s${name}\\s*=\\s*)(["'])[\\s\\S]*?\\2`);
+  if (attribute.test(xmp)) return xmp.replace(attribute, (_, lead: string, quote: string) => `${lead}${quote}${escaped}${quote}`);
+
+  const element = new RegExp(`(<${name}(?:\\s[^>]*)?>)[\\s\\S]*?(</${name}>)`);
+  if (element.test(xmp)) return xmp.replace(element, (_, open: string, close: string) => `${open}${escaped}${close}`);
+
+  // Declarations are scoped: prefer a description that already declares the prefix
+  const prefix = property.slice(0, property.indexOf(':'));
+  const declaration = new RegExp(`\\sxmlns:${escapeRegExp(prefix)}\\s*=`);
+  const descriptions = [...xmp.matchAll(/<rdf:Description\b([^>]*?)(\/?)>/g)];
+  if (descriptions.length === 0) return xmp;
+  const description = descriptions.find(match => declaration.test(match[1])) ?? descriptions[0];
+
+  const declaredAbove = declaration.test(xmp.slice(0, descriptions[0].index));
+  const attributes = declaredAbove || declaration.test(description[1])
+    ? description[1]
+    : `${description[1]} xmlns:${prefix}="${namespace}"`;
+  const propertyElement = `<${property}>${escaped}</${property}>`;
+  const replacement = description[2]
+    ? `<rdf:Description${attributes}>${propertyElement}</rdf:Description>`
+    : `<rdf:Description${attributes}>${propertyElement}`;
+
+  return xmp.slice(0, description.index!) + replacement + xmp.slice(description.index! + description[0].length);
+}
+
+/**
+ * Parses an XMP (ISO 8601) date; dates without a zone are read as UTC,
+ * matching how PDF dates without a zone are read
+ */
+export function parseXmpDate(value: string): Date | undefined {
+  const trimmed = value.trim();
+  const hasZone = /(Z|[+-]\d{2}:?\d{2})$/.test(trimmed) || !trimmed.includes('T');
+  const time = Date.parse(hasZone ? trimmed : `${trimmed}Z`);
+  return Number.isNaN(time) ? undefined : new Date(time);
+}
+
+/**
+ * Decodes the predefined XML entities and character references;
+ * references beyond U+10FFFF become U+FFFD
+ */
+export function decodeXmlEntities(text: string): string {
+  return text.replace(/&(#x[0-9a-fA-F]+|#\d+|amp|lt|gt|quot|apos);/g, (_, entity: string) => {
+    if (entity[0] === '#') {
+      const code = entity[1] === 'x' ? parseInt(entity.slice(2), 16) : parseInt(entity.slice(1), 10);
+      return code <= 0x10ffff ? String.fromCodePoint(code) : '\ufffd';
+    }
+    return XML_ENTITIES[entity] ?? '';
+  });
+}
+
+/**
+ * Trims XMP metadata streams to the standard namespaces plus a safelist
+ *
+ * Every metadata stream is trimmed, including those attached to images
+ * (often bloated with editing history). Packet padding is dropped too.
+ *
+ * @param keepNamespaces - Additional namespace URIs to keep
+ * @returns Bytes saved across all metadata streams
+ */
+export function trimXmpStreams(pdfDoc: PDFDocument, keepNamespaces: string[]): number {
+  const keep = new Set([...STANDARD_NAMESPACES, ...keepNamespaces]);
+  let bytesSaved = 0;
+
+  for (const [ref, object] of pdfDoc.context.enumerateIndirectObjects()) {
+    if (!(object instanceof PDFStream)) continue;
+    if (lookupName(object.dict, 'Type') !== 'Metadata' || lookupName(object.dict, 'Subtype') !== 'XML') continue;
+
+    const bytes = decodeStreamContents(object);
+    if (!bytes) continue;
+
+    const trimmed = new TextEncoder().encode(trimXmp(new TextDecoder('utf-8').decode(bytes), keep));
+    const saved = object.getContentsSize() - trimmed.length;
+    if (saved <= 0) continue;
+
+    // Metadata stays unfiltered so it can be found without a PDF parser
+    pdfDoc.context.assign(ref, pdfDoc.context.stream(trimmed, { Type: 'Metadata', Subtype: 'XML' }));
+    bytesSaved += saved;
+  }
+
+  return bytesSaved;
+}
+
+/**
+ * Removes properties outside the kept namespaces from an XMP packet
+ */
+export function trimXmp(xmp: string, keep: Set<string>): string {
+  const namespaces = new Map<string, string>();
+  for (const match of xmp.matchAll(/xmlns:([\w.-]+)\s*=\s*(["'])(.*?)\2/g)) {
+    if (!namespaces.has(match[1])) namespaces.set(match[1], match[3]);
+  }
+
+  const isKept = (qualifiedName: string): boolean => {
+    const colon = qualifiedName.indexOf(':');
+    if (colon === -1) return true;
+    const prefix = qualifiedName.slice(0, colon);
+    if (prefix === 'xml' || prefix === 'xmlns') return true;
+    const uri = namespaces.get(prefix);
+    // Keep anything we can't resolve rather than guess
+    return uri === undefined || uri === RDF_NS || keep.has(uri);
+  };
+
+  let output = '';
+  let last = 0;
+  // Open elements; skipDepth marks where a removed property started
+  const stack: string[] = [];
+  let skipDepth = -1;
+
+  for (const match of xmp.matchAll(TAG_PATTERN)) {
+    const [tag, closing, name, attributes, selfClosing] = match;
+    const start = match.index!;
+    if (name === undefined) continue;
+
+    if (closing) {
+      stack.pop();
+      if (skipDepth === stack.length) {
+        last = start + tag.length;
+        skipDepth = -1;
+      }
+      continue;
+    }
+
+    if (skipDepth !== -1) {
+      if (!selfClosing) stack.push(name);
+      continue;
+    }
+
+    const parent = stack[stack.length - 1];
+    if (parent === 'rdf:Description' && !isKept(name)) {
+      // Drop the whole property element
+      output += xmp.slice(last, start);
+      if (selfClosing) {
+        last = start + tag.length;
+      } else {
+        skipDepth = stack.length;
+        stack.push(name);
+      }
+      continue;
+    }
+
+    if (name === 'rdf:Description') {
+      // Drop attribute-form properties
+      const kept = [...attributes.matchAll(ATTRIBUTE_PATTERN)]
+        .filter(([, attribute]) => isKept(attribute))
+        .map(([declaration]) => declaration);
+      output += xmp.slice(last, start) + `<${name}${kept.join('')}${selfClosing ? '/' : ''}>`;
+      last = start + tag.length;
+    }
+
+    if (!selfClosing) stack.push(name);
+  }
+
+  output += xmp.slice(last);
+
+  // Drop declarations of namespaces nothing uses any more
+  for (const prefix of namespaces.keys()) {
+    const escaped = escapeRegExp(prefix);
+    if (!new RegExp(`[<\\s]${escaped}:`).test(output.replace(/\sxmlns:[\w.-]+\s*=\s*(["']).*?\1/g, ''))) {
+      output = output.replace(new RegExp(`\\s+xmlns:${escaped}\\s*=\\s*(["']).*?\\1`, 'g'), '');
+    }
+  }
+
+  // Drop the whitespace padding before the closing packet wrapper
+  return output.replace(/\s+(<\?xpacket\s+end=)/, '\n$1');
+}
+
+/**
+ * Escapes text for XML content and attribute values
+ */
+export function encodeXmlEntities(text: string): string {
+  return text.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/"/g, '&quot;').replace(/'/g, '&apos;');
+}
+
+function escapeRegExp(text: string): string {
+  return text.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+}
+
@@ -0,0 +1,171 @@
+import { describe, expect, it } from 'vitest';
+import {
+  PDFArray,
+  PDFDict,
+  PDFDocument,
+  PDFHexString,
+  PDFName,
+  PDFObject,
+  PDFRawStream,
+  PDFRef,
+  PDFString,
+  StandardFonts,
+} from 'pdf-lib';
+import { CompressionError, encryptBatch, upgradeEncryption } from '../src';
+import { md5, rc4 } from '../src/core/crypto';
+import { decryptDocument } from '../src/core/encryption';
+import { loadDocument } from '../src/core/pdf-objects';
+import { readSecurityInfo } from '../src/core/security';
+
+const TITLE = 'Quarterly report (draft)';
+const USER_PASSWORD = 'secret';
+const OWNER_PASSWORD = 'boss';
+
+// RC4 128-bit (revision 3) entries for USER_PASSWORD and OWNER_PASSWORD
+// with P = -3904 and FILE_ID, computed independently of this library
+const FILE_ID = '000102030405060708090a0b0c0d0e0f';
+const RC4_OWNER_ENTRY = 'efecfca20761e6e447d16d65e2277349937d0650d26fba43ccaa77f0ec09b5cd';
+const RC4_USER_ENTRY = '1bbfaaaa05f0363d331ba877fbc2e41c00000000000000000000000000000000';
+const RC4_FILE_KEY = '78ba5e505dc588c4a386eece5422acc0';
+
+async function createPdf(): Promise<ArrayBuffer> {
+  const pdfDoc = await PDFDocument.create();
+  pdfDoc.setTitle(TITLE);
+  const font = await pdfDoc.embedFont(StandardFonts.Helvetica);
+  pdfDoc.addPage([200, 200]).drawText('Hello', { x: 20, y: 100, size: 12, font });
+  const bytes = await pdfDoc.save({ useObjectStreams: false });
+  return bytes.buffer as ArrayBuffer;
+}
+
+/** Encrypts every string and stream with RC4 and adds the revision 3 dictionary */
+async function encryptRc4(pdf: ArrayBuffer): Promise<ArrayBuffer> {
+  const pdfDoc = await loadDocument(pdf);
+  const { context } = pdfDoc;
+  const fileKey = Buffer.from(RC4_FILE_KEY, 'hex');
+
+  for (const [ref, object] of context.enumerateIndirectObjects()) {
+    const key = objectKey(fileKey, ref);
+    if (object instanceof PDFRawStream) {
+      context.assign(ref, PDFRawStream.of(encryptStrings(object.dict, key) as PDFDict, rc4(key, object.contents)));
+    } else {
+      context.assign(ref, encryptStrings(object, key));
+    }
+  }
+
+  const encrypt = context.obj({ Filter: 'Standard', V: 2, R: 3, Length: 128, P: -3904 });
+  encrypt.set(PDFName.of('O'), PDFHexString.of(RC4_OWNER_ENTRY));
+  encrypt.set(PDFName.of('U'), PDFHexString.of(RC4_USER_ENTRY));
+  context.trailerInfo.Encrypt = context.register(encrypt);
+  context.trailerInfo.ID = context.obj([PDFHexString.of(FILE_ID), PDFHexString.of(FILE_ID)]);
+
+  const bytes = await pdfDoc.save({ useObjectStreams: false, addDefaultPage: false });
+  return bytes.buffer as ArrayBuffer;
+}
+
+function objectKey(fileKey: Uint8Array, ref: PDFRef): Uint8Array {
+  const { objectNumber, generationNumber } = ref;
+  const salt = [objectNumber, objectNumber >> 8, objectNumber >> 16, generationNumber, generationNumber >> 8];
+  return md5(new Uint8Array([...fileKey, ...salt.map((byte) => byte & 0xff)])).subarray(0, 16);
+}
+
+function encryptStrings(object: PDFObject, key: Uint8Array): PDFObject {
+  if (object instanceof PDFString || object instanceof PDFHexString) {
+    return PDFHexString.of(Buffer.from(rc4(key, object.asBytes())).toString('hex'));
+  }
+  if (object instanceof PDFDict) {
+    for (const [name, value] of object.entries()) object.set(name, encryptStrings(value, key));
+  } else if (object instanceof PDFArray) {
+    for (let i = 0; i < object.size(); i++) object.set(i, encryptStrings(object.get(i), key));
+  }
+  return object;
+}
+
+/** Loads and decrypts a file, or returns undefined if the password is wrong */
+async function open(pdf: ArrayBuffer, password: string): Promise<PDFDocument | undefined> {
+  const pdfDoc = await loadDocument(pdf);
+  return (await decryptDocument(pdfDoc, password)) ? pdfDoc : undefined;
+}
+
+/** The first page's content stream bytes, as stored */
+function pageContent(pdfDoc: PDFDocument): string {
+  const contents = pdfDoc.getPage(0).node.Contents();
+  const streams = contents instanceof PDFArray
+    ? contents.asArray().map((ref) => pdfDoc.context.lookup(ref, PDFRawStream))
+    : [contents as PDFRawStream];
+  return streams.map((stream) => Buffer.from(stream.contents).toString('latin1')).join('\n');
+}
+
+describe('encryptBatch', () => {
+  it('opens with the user and owner passwords and rejects a wrong one', async () => {
+    const original = await createPdf();
+    const [result] = await encryptBatch([{ pdf: original }], {
+      userPassword: USER_PASSWORD,
+      ownerPassword: OWNER_PASSWORD,
+    });
+    expect(result.error).toBeUndefined();
+
+    const encrypted = result.pdf!;
+    const info = await readSecurityInfo(await loadDocument(encrypted));
+    expect(info.algorithm).toBe('AES-256');
+    expect(info.userPasswordRequired).toBe(true);
+
+    const expectedContent = pageContent(await loadDocument(original));
+    for (const password of [USER_PASSWORD, OWNER_PASSWORD]) {
+      const pdfDoc = await open(encrypted, password);
+      expect(pdfDoc?.getTitle()).toBe(TITLE);
+      expect(pageContent(pdfDoc!)).toBe(expectedContent);
+    }
+    expect(await open(encrypted, 'wrong')).toBeUndefined();
+  });
+
+  it('reports files that are already encrypted', async () => {
+    const options = { ownerPassword: OWNER_PASSWORD };
+    const [first] = await encryptBatch([{ pdf: await createPdf() }], options);
+    const [second] = await encryptBatch([{ pdf: first.pdf!, name: 'again.pdf' }], options);
+
+    expect(second.name).toBe('again.pdf');
+    expect(second.pdf).toBeUndefined();
+    expect(second.error).toBeInstanceOf(CompressionError);
+    expect(second.error?.code).toBe('ALREADY_ENCRYPTED');
+  });
+});
+
+describe('upgradeEncryption', () => {
+  it('re-encrypts an RC4 file with AES-256 and keeps both passwords', async () => {
+    const original = await createPdf();
+    const legacy = await encryptRc4(original);
+    expect((await open(legacy, USER_PASSWORD))?.getTitle()).toBe(TITLE);
+
+    const { pdf, previousAlgorithm, upgraded } = await upgradeEncryption(legacy, { ownerPassword: OWNER_PASSWORD });
+    expect(previousAlgorithm).toBe('RC4');
+    expect(upgraded).toBe(true);
+
+    const info = await readSecurityInfo(await loadDocument(pdf));
+    expect(info.algorithm).toBe('AES-256');
+    expect(info.revision).toBe(6);
+
+    const expectedContent = pageContent(await loadDocument(original));
+    for (const password of [USER_PASSWORD, OWNER_PASSWORD]) {
+      const pdfDoc = await open(pdf, password);
+      expect(pdfDoc?.getTitle()).toBe(TITLE);
+      expect(pageContent(pdfDoc!)).toBe(expectedContent);
+    }
+    expect(await open(pdf, 'wrong')).toBeUndefined();
+  });
+
+  it('rejects a password that is not the owner password', async () => {
+    const legacy = await encryptRc4(await createPdf());
+
+    const error = await upgradeEncryption(legacy, { ownerPassword: USER_PASSWORD }).catch((e: unknown) => e);
+    expect(error).toBeInstanceOf(CompressionError);
+    expect((error as CompressionError).code).toBe('PASSWORD_INCORRECT');
+  });
+
+  it('returns AES-256 files unchanged', async () => {
+    const [{ pdf }] = await encryptBatch([{ pdf: await createPdf() }], { ownerPassword: OWNER_PASSWORD });
+
+    const result = await upgradeEncryption(pdf!, { ownerPassword: OWNER_PASSWORD });
+    expect(result.upgraded).toBe(false);
+    expect(result.pdf).toBe(pdf);
+  });
+});
@@ -0,0 +1,46 @@
+import { describe, expect, it } from 'vitest';
+import { CompressionError, compress } from '../src';
+import { countDeclaredObjects } from '../src/core/raw-pdf';
+
+/**
+ * A file whose only cross-reference section declares /Size 10 and
+ * covers objects 0 to 9, but whose body holds objectCount objects
+ */
+function understatedPdf(objectCount: number): Uint8Array {
+  let body = '%PDF-1.7\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n2 0 obj\n<< /Type /Pages /Kids [] /Count 0 >>\nendobj\n';
+  for (let n = 3; n <= objectCount; n++) body += `${n} 0 obj\nnull\nendobj\n`;
+
+  const entries = ['0000000000 65535 f \n'];
+  for (let n = 1; n < 10; n++) entries.push('0000000009 00000 n \n');
+  const startXref = body.length;
+  const tail = `xref\n0 10\n${entries.join('')}trailer\n<< /Size 10 /Root 1 0 R >>\nstartxref\n${startXref}\n%%EOF\n`;
+  return new TextEncoder().encode(body + tail);
+}
+
+describe('countDeclaredObjects', () => {
+  it('takes /Size when it is larger than the body count', () => {
+    expect(countDeclaredObjects(understatedPdf(2))).toBe(9);
+  });
+
+  it('counts body objects a small /Size leaves out', () => {
+    expect(countDeclaredObjects(understatedPdf(5000))).toBe(5000);
+  });
+
+  it('counts the objects inside object streams', () => {
+    const pdf = new TextEncoder().encode(
+      '%PDF-1.7\n1 0 obj\n<< /Type /ObjStm /N 700 /First 10 /Length 0 >>\nstream\n\nendstream\nendobj\n'
+    );
+    expect(countDeclaredObjects(pdf)).toBe(701);
+  });
+});
+
+describe('compress maxObjects', () => {
+  it('rejects a file whose /Size understates its objects', async () => {
+    const pdf = understatedPdf(5000);
+
+    const error = await compress(pdf.buffer as ArrayBuffer, { preset: 'lossless', maxObjects: 1000 })
+      .catch((e: unknown) => e);
+    expect(error).toBeInstanceOf(CompressionError);
+    expect((error as CompressionError).code).toBe('TOO_MANY_OBJECTS');
+  });
+});
@@ -0,0 +1,56 @@
+import { describe, expect, it } from 'vitest';
+import { readPageTreeCount } from '../src/core/raw-pdf';
+
+/**
+ * Appends a revision holding the given objects, with a classic
+ * cross-reference table; a first revision also gets the %PDF header
+ */
+function addRevision(previous: string, objects: Array<[number, string]>, trailerExtra = ''): string {
+  let raw = previous || '%PDF-1.7\n';
+  const offsets: Array<[number, number]> = [];
+  for (const [objectNumber, text] of objects) {
+    offsets.push([objectNumber, raw.length]);
+    raw += `${objectNumber} 0 obj\n${text}\nendobj\n`;
+  }
+
+  const startXref = raw.length;
+  raw += previous ? 'xref\n' : 'xref\n0 1\n0000000000 65535 f \n';
+  for (const [objectNumber, offset] of offsets) {
+    raw += `${objectNumber} 1\n${String(offset).padStart(10, '0')} 00000 n \n`;
+  }
+  const prev = previous ? ` /Prev ${/startxref\s+(\d+)\s*%%EOF\s*$/.exec(previous)![1]}` : '';
+  return raw + `trailer\n<< /Size 10 /Root 1 0 R${prev}${trailerExtra} >>\nstartxref\n${startXref}\n%%EOF\n`;
+}
+
+const BASE = addRevision('', [
+  [1, '<< /Type /Catalog /Pages 2 0 R >>'],
+  [2, '<< /Type /Pages /Kids [3 0 R] /Count 3 >>'],
+  [3, '<< /Type /Page /Parent 2 0 R >>'],
+]);
+
+describe('readPageTreeCount', () => {
+  it('reads /Count through the cross-reference table', () => {
+    expect(readPageTreeCount(BASE)).toBe(3);
+  });
+
+  it('follows /Prev to objects an update left alone', () => {
+    expect(readPageTreeCount(addRevision(BASE, [[3, '<< /Type /Page /Parent 2 0 R >>']]))).toBe(3);
+  });
+
+  it('takes the page tree from the newest revision', () => {
+    expect(readPageTreeCount(addRevision(BASE, [[2, '<< /Type /Pages /Kids [3 0 R] /Count 7 >>']]))).toBe(7);
+  });
+
+  it('ignores object headers inside stream data', () => {
+    const stream = '<< /Length 33 >>\nstream\n2 0 obj << /Count 99 >> endobj\nendstream';
+    expect(readPageTreeCount(addRevision(BASE, [[5, stream]]))).toBe(3);
+  });
+
+  it('gives up when an update adds a cross-reference stream', () => {
+    expect(readPageTreeCount(addRevision(BASE, [[3, '<< /Type /Page >>']], ' /XRefStm 9'))).toBeUndefined();
+  });
+
+  it('gives up when an entry does not point at the object', () => {
+    expect(readPageTreeCount(BASE.replace('0000000009 00000 n', '0000000010 00000 n'))).toBeUndefined();
+  });
+});